@@ -6,6 +6,7 @@ package cmd
 import (
 	"fmt"
 	"github.com/spf13/cobra"
+	"github.com/vlifesystems/rulehunter/experiment"
 	"github.com/vlifesystems/rulehunter/logger"
 	"github.com/vlifesystems/rulehunter/quitter"
 )
@@ -50,6 +51,7 @@ func init() {
 	)
 	RootCmd.AddCommand(ServeCmd)
 	RootCmd.AddCommand(ServiceCmd)
+	RootCmd.AddCommand(ValidateCmd)
 	RootCmd.AddCommand(VersionCmd)
 }
 
@@ -65,6 +67,7 @@ func runRoot(
 	if err != nil {
 		return err
 	}
+	defer experiment.CloseDataSources()
 	if experimentFilename != "" {
 		err := s.prg.ProcessFilename(experimentFilename, ignoreWhen)
 		if err != nil {
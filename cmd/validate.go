@@ -0,0 +1,91 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/experiment"
+	"github.com/vlifesystems/rulehunter/fileinfo"
+	"github.com/vlifesystems/rulehunter/watcher"
+)
+
+var ValidateCmd = &cobra.Command{
+	Use:   "validate [experiment files]",
+	Short: "Check experiment files without processing them",
+	Long: `Rulehunter will check experiment files for mistakes without processing
+         them.  If no files are given, the files in the 'experiments' directory
+         are checked.  It exits with an error if any problems are found.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runValidate(os.Stdout, flagConfigFilename, args)
+	},
+}
+
+// errValidate indicates that problems were found in experiment files
+type errValidate struct {
+	numProblems int
+	numFiles    int
+}
+
+func (e errValidate) Error() string {
+	return fmt.Sprintf("found %d problem(s) in %d experiment file(s)",
+		e.numProblems, e.numFiles)
+}
+
+// runValidate writes any problems found in the experiment files to w.
+// The filenames are relative to the current directory, if none are given
+// the files in the experiments directory are validated.
+func runValidate(
+	w io.Writer,
+	configFilename string,
+	filenames []string,
+) error {
+	cfg, err := config.Load(configFilename)
+	if err != nil {
+		return errConfigLoad{filename: configFilename, err: err}
+	}
+
+	numProblems := 0
+	numFiles := 0
+	validate := func(cfg *config.Config, file fileinfo.FileInfo) {
+		errs := experiment.Validate(cfg, file)
+		for _, err := range errs {
+			fmt.Fprintf(w, "%s: %s\n",
+				filepath.Join(cfg.ExperimentsDir, file.Name()), err)
+		}
+		if len(errs) > 0 {
+			numProblems += len(errs)
+			numFiles++
+		}
+	}
+
+	if len(filenames) == 0 {
+		files, err := watcher.GetExperimentFiles(cfg.ExperimentsDir)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			validate(cfg, file)
+		}
+	}
+	for _, filename := range filenames {
+		file, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		fileCfg := *cfg
+		fileCfg.ExperimentsDir = filepath.Dir(filename)
+		validate(&fileCfg, file)
+	}
+
+	if numProblems > 0 {
+		return errValidate{numProblems: numProblems, numFiles: numFiles}
+	}
+	return nil
+}
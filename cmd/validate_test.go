@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+)
+
+func TestRunValidate(t *testing.T) {
+	cfgDir := testhelpers.BuildConfigDirs(t, false)
+	defer os.RemoveAll(cfgDir)
+	cfgFilename := filepath.Join(cfgDir, "config.yaml")
+	testhelpers.MustWriteConfig(t, cfgDir, 100)
+	experimentsDir := filepath.Join(cfgDir, "experiments")
+	for _, f := range []string{"debt.yaml", "debt2.json"} {
+		testhelpers.CopyFile(t, filepath.Join("fixtures", f), experimentsDir)
+	}
+
+	var out bytes.Buffer
+	if err := runValidate(&out, cfgFilename, []string{}); err != nil {
+		t.Errorf("runValidate: %s", err)
+	}
+	if out.String() != "" {
+		t.Errorf("runValidate output got: %s, want: \"\"", out.String())
+	}
+
+	for _, f := range []string{"0debt_broken.yaml", "debt_invalid_goal.yaml"} {
+		testhelpers.CopyFile(t, filepath.Join("fixtures", f), experimentsDir)
+	}
+	out.Reset()
+	wantErr := errValidate{numProblems: 3, numFiles: 2}
+	err := runValidate(&out, cfgFilename, []string{})
+	if err != wantErr {
+		t.Errorf("runValidate err: %v, want: %v", err, wantErr)
+	}
+	wantOut := filepath.Join(experimentsDir, "0debt_broken.yaml") +
+		": yaml: line 5: did not find expected key\n" +
+		filepath.Join(experimentsDir, "debt_invalid_goal.yaml") +
+		": line 21: unknown field: train: ruleGeneration: combinationLenght\n" +
+		filepath.Join(experimentsDir, "debt_invalid_goal.yaml") +
+		": experiment field: goals: successMCC > 0: unknown aggregator: successMCC\n"
+	if out.String() != wantOut {
+		t.Errorf("runValidate output got: %s, want: %s", out.String(), wantOut)
+	}
+}
+
+func TestRunValidate_files(t *testing.T) {
+	cfgDir := testhelpers.BuildConfigDirs(t, false)
+	defer os.RemoveAll(cfgDir)
+	cfgFilename := filepath.Join(cfgDir, "config.yaml")
+	testhelpers.MustWriteConfig(t, cfgDir, 100)
+
+	cases := []struct {
+		filenames []string
+		wantErr   error
+		wantOut   string
+	}{
+		{filenames: []string{
+			filepath.Join("fixtures", "debt.yaml"),
+			filepath.Join("fixtures", "debt.json"),
+		},
+			wantErr: nil,
+			wantOut: "",
+		},
+		{filenames: []string{filepath.Join("fixtures", "debt_when_hasrun.yaml")},
+			wantErr: nil,
+			wantOut: "",
+		},
+		{filenames: []string{filepath.Join("fixtures", "debt.jso")},
+			wantErr: errValidate{numProblems: 1, numFiles: 1},
+			wantOut: filepath.Join("fixtures", "debt.jso") +
+				": invalid extension: .jso\n",
+		},
+	}
+	for i, c := range cases {
+		var out bytes.Buffer
+		err := runValidate(&out, cfgFilename, c.filenames)
+		if err != c.wantErr {
+			t.Errorf("(%d) runValidate err: %v, want: %v", i, err, c.wantErr)
+		}
+		if out.String() != c.wantOut {
+			t.Errorf("(%d) runValidate output got: %s, want: %s",
+				i, out.String(), c.wantOut)
+		}
+	}
+}
+
+func TestRunValidate_errors(t *testing.T) {
+	cfgDir := testhelpers.BuildConfigDirs(t, false)
+	defer os.RemoveAll(cfgDir)
+	cfgFilename := filepath.Join(cfgDir, "config.yaml")
+	testhelpers.MustWriteConfig(t, cfgDir, 100)
+
+	var out bytes.Buffer
+	err := runValidate(&out, cfgFilename, []string{"missing.yaml"})
+	if err == nil || !os.IsNotExist(err) {
+		t.Errorf("runValidate err: %v, want: not exist error", err)
+	}
+	err = runValidate(&out, "missing.yaml", []string{})
+	if _, ok := err.(errConfigLoad); !ok {
+		t.Errorf("runValidate err: %v, want: errConfigLoad", err)
+	}
+}
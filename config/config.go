@@ -6,10 +6,13 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"time"
 )
 
 type Config struct {
@@ -20,8 +23,57 @@ type Config struct {
 	MaxNumProcesses int    `yaml:"maxNumProcesses"`
 	MaxNumRecords   int64  `yaml:"maxNumRecords"`
 	HTTPPort        int    `yaml:"httpPort"`
+	Sample          Sample `yaml:"sample"`
+	// DataSources maps names to database connections that experiments
+	// can refer to
+	DataSources map[string]DataSource `yaml:"dataSources"`
+	// DatasetCache controls the copies of datasets kept between runs
+	DatasetCache DatasetCache `yaml:"datasetCache"`
+	// LibraryDir is the directory that experiment files include shared
+	// fragments from, if empty it is the library directory of ExperimentsDir
+	LibraryDir string `yaml:"libraryDir"`
 }
 
+// DatasetCache describes the cache of dataset copies kept in the
+// cache directory of BuildDir
+type DatasetCache struct {
+	// MaxSize is the number of bytes the cache may use before the least
+	// recently used copies are removed.  If 0 the cache may use 1GiB and
+	// if < 0 datasets aren't cached.
+	MaxSize int64 `yaml:"maxSize"`
+}
+
+// DataSource describes a database connection that can be shared
+// by experiments
+type DataSource struct {
+	DriverName     string `yaml:"driverName"`
+	DataSourceName string `yaml:"dataSourceName"`
+	// MaxOpenConns is the maximum number of open connections to the
+	// database, if < 1 the number isn't limited
+	MaxOpenConns int `yaml:"maxOpenConns"`
+	// QueryTimeout is the longest a query may run for such as: 5m, if 0
+	// there is no limit
+	QueryTimeout time.Duration `yaml:"queryTimeout"`
+}
+
+// Sample describes how records are chosen from a dataset when it has
+// more than MaxNumRecords records
+type Sample struct {
+	// Method is one of: head, reservoir or stratified.  Head, the default,
+	// uses the first MaxNumRecords records.
+	Method string `yaml:"method"`
+	// Field is the field to stratify by when using stratified sampling
+	Field string `yaml:"field"`
+	Seed  int64  `yaml:"seed"`
+}
+
+// Sampling methods
+const (
+	SampleHead       = "head"
+	SampleReservoir  = "reservoir"
+	SampleStratified = "stratified"
+)
+
 // InvalidExtError indicates that a config file has an invalid extension
 type InvalidExtError string
 
@@ -47,10 +99,18 @@ func Load(filename string) (*Config, error) {
 		c.MaxNumRecords = -1
 	}
 
+	if c.LibraryDir == "" {
+		c.LibraryDir = filepath.Join(c.ExperimentsDir, "library")
+	}
+
 	if c.BaseURL == "" {
 		c.BaseURL = "/"
 	}
 
+	if c.Sample.Method == "" {
+		c.Sample.Method = SampleHead
+	}
+
 	if err := checkConfigValid(c); err != nil {
 		return nil, err
 	}
@@ -85,5 +145,46 @@ func checkConfigValid(c *Config) error {
 	if len(c.BuildDir) == 0 {
 		return errors.New("missing field: buildDir")
 	}
+	if err := c.Sample.Check(); err != nil {
+		return fmt.Errorf("sample: %s", err)
+	}
+	names := make([]string, 0, len(c.DataSources))
+	for name := range c.DataSources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := c.DataSources[name].Check(); err != nil {
+			return fmt.Errorf("dataSources: %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// Check returns an error if the DataSource isn't valid
+func (ds DataSource) Check() error {
+	if ds.DriverName == "" {
+		return errors.New("missing field: driverName")
+	}
+	if ds.DataSourceName == "" {
+		return errors.New("missing field: dataSourceName")
+	}
+	if ds.QueryTimeout < 0 {
+		return errors.New("queryTimeout: can't be negative")
+	}
 	return nil
 }
+
+// Check returns an error if the Sample isn't valid
+func (s Sample) Check() error {
+	switch s.Method {
+	case SampleHead, SampleReservoir:
+		return nil
+	case SampleStratified:
+		if s.Field == "" {
+			return errors.New("missing field: field")
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid method: %s", s.Method)
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"syscall"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -20,9 +22,11 @@ func TestLoad(t *testing.T) {
 				ExperimentsDir:  "experiments",
 				WWWDir:          "www",
 				BuildDir:        "build",
+				LibraryDir:      filepath.Join("experiments", "library"),
 				BaseURL:         "/rulehunter/",
 				MaxNumProcesses: 1,
 				MaxNumRecords:   -1,
+				Sample:          Sample{Method: "head"},
 			},
 		},
 		{filepath.Join("fixtures", "config_somemaxnumrecords.yaml"),
@@ -30,9 +34,27 @@ func TestLoad(t *testing.T) {
 				ExperimentsDir:  "experiments",
 				WWWDir:          "www",
 				BuildDir:        "build",
+				LibraryDir:      filepath.Join("experiments", "library"),
 				BaseURL:         "/rulehunter/",
 				MaxNumProcesses: 4,
 				MaxNumRecords:   150,
+				Sample:          Sample{Method: "head"},
+			},
+		},
+		{filepath.Join("fixtures", "config_samplestratified.yaml"),
+			&Config{
+				ExperimentsDir:  "experiments",
+				WWWDir:          "www",
+				BuildDir:        "build",
+				LibraryDir:      filepath.Join("experiments", "library"),
+				BaseURL:         "/rulehunter/",
+				MaxNumProcesses: 4,
+				MaxNumRecords:   150,
+				Sample: Sample{
+					Method: "stratified",
+					Field:  "group",
+					Seed:   42,
+				},
 			},
 		},
 		{filepath.Join("fixtures", "config_zeromaxnumrecords.yaml"),
@@ -40,9 +62,11 @@ func TestLoad(t *testing.T) {
 				ExperimentsDir:  "experiments",
 				WWWDir:          "www",
 				BuildDir:        "build",
+				LibraryDir:      filepath.Join("experiments", "library"),
 				BaseURL:         "/rulehunter/",
 				MaxNumProcesses: 4,
 				MaxNumRecords:   -1,
+				Sample:          Sample{Method: "head"},
 			},
 		},
 		{filepath.Join("fixtures", "config_nomaxnumprocesses.yaml"),
@@ -50,9 +74,11 @@ func TestLoad(t *testing.T) {
 				ExperimentsDir:  "experiments",
 				WWWDir:          "www",
 				BuildDir:        "build",
+				LibraryDir:      filepath.Join("experiments", "library"),
 				BaseURL:         "/rulehunter/",
 				MaxNumProcesses: runtime.NumCPU(),
 				MaxNumRecords:   -1,
+				Sample:          Sample{Method: "head"},
 			},
 		},
 		{filepath.Join("fixtures", "config_nobaseurl.yaml"),
@@ -60,9 +86,11 @@ func TestLoad(t *testing.T) {
 				ExperimentsDir:  "experiments",
 				WWWDir:          "www",
 				BuildDir:        "build",
+				LibraryDir:      filepath.Join("experiments", "library"),
 				BaseURL:         "/",
 				MaxNumProcesses: 4,
 				MaxNumRecords:   -1,
+				Sample:          Sample{Method: "head"},
 			},
 		},
 		{filepath.Join("fixtures", "config.yaml"),
@@ -70,9 +98,60 @@ func TestLoad(t *testing.T) {
 				ExperimentsDir:  "experiments",
 				WWWDir:          "www",
 				BuildDir:        "build",
+				LibraryDir:      filepath.Join("experiments", "library"),
 				BaseURL:         "/rulehunter/",
 				MaxNumProcesses: 4,
 				MaxNumRecords:   -1,
+				Sample:          Sample{Method: "head"},
+			},
+		},
+		{filepath.Join("fixtures", "config_datasources.yaml"),
+			&Config{
+				ExperimentsDir:  "experiments",
+				WWWDir:          "www",
+				BuildDir:        "build",
+				LibraryDir:      filepath.Join("experiments", "library"),
+				BaseURL:         "/",
+				MaxNumProcesses: runtime.NumCPU(),
+				MaxNumRecords:   -1,
+				Sample:          Sample{Method: "head"},
+				DataSources: map[string]DataSource{
+					"warehouse": DataSource{
+						DriverName:     "postgres",
+						DataSourceName: "postgres://rulehunter@warehouse/sales",
+						MaxOpenConns:   4,
+						QueryTimeout:   5 * time.Minute,
+					},
+					"flow": DataSource{
+						DriverName:     "sqlite3",
+						DataSourceName: "flow.db",
+					},
+				},
+			},
+		},
+		{filepath.Join("fixtures", "config_librarydir.yaml"),
+			&Config{
+				ExperimentsDir:  "experiments",
+				WWWDir:          "www",
+				BuildDir:        "build",
+				LibraryDir:      "shared",
+				BaseURL:         "/",
+				MaxNumProcesses: 4,
+				MaxNumRecords:   -1,
+				Sample:          Sample{Method: "head"},
+			},
+		},
+		{filepath.Join("fixtures", "config_datasetcache.yaml"),
+			&Config{
+				ExperimentsDir:  "experiments",
+				WWWDir:          "www",
+				BuildDir:        "build",
+				LibraryDir:      filepath.Join("experiments", "library"),
+				BaseURL:         "/",
+				MaxNumProcesses: 4,
+				MaxNumRecords:   -1,
+				Sample:          Sample{Method: "head"},
+				DatasetCache:    DatasetCache{MaxSize: -1},
 			},
 		},
 	}
@@ -115,6 +194,12 @@ func TestLoad_errors(t *testing.T) {
 				syscall.ENOENT,
 			},
 		},
+		{filepath.Join("fixtures", "config_sampleinvalidmethod.yaml"),
+			errors.New("sample: invalid method: random")},
+		{filepath.Join("fixtures", "config_samplenofield.yaml"),
+			errors.New("sample: missing field: field")},
+		{filepath.Join("fixtures", "config_datasourcenodriver.yaml"),
+			errors.New("dataSources: warehouse: missing field: driverName")},
 		{filepath.Join("fixtures", "config_invalidyaml.yaml"),
 			errors.New("yaml: line 2: did not find expected key")},
 	}
@@ -144,9 +229,13 @@ func configsMatch(c1, c2 *Config) bool {
 	return c1.ExperimentsDir == c2.ExperimentsDir &&
 		c1.WWWDir == c2.WWWDir &&
 		c1.BuildDir == c2.BuildDir &&
+		c1.LibraryDir == c2.LibraryDir &&
 		c1.BaseURL == c2.BaseURL &&
 		c1.MaxNumProcesses == c2.MaxNumProcesses &&
-		c1.MaxNumRecords == c2.MaxNumRecords
+		c1.MaxNumRecords == c2.MaxNumRecords &&
+		c1.Sample == c2.Sample &&
+		c1.DatasetCache == c2.DatasetCache &&
+		reflect.DeepEqual(c1.DataSources, c2.DataSources)
 }
 
 func checkErrorMatch(got, want error) error {
@@ -0,0 +1,105 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package experiment
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/internal/dataset/dcommand"
+)
+
+// commandDesc describes an external command whose standard output is
+// read as the dataset
+type commandDesc struct {
+	// The executable to run, which is looked up in the PATH if it doesn't
+	// contain a path separator
+	Path string   `yaml:"path"`
+	Args []string `yaml:"args"`
+	// The working directory of the command
+	Dir string `yaml:"dir"`
+	// The longest the command may run for such as: 5m, if empty there
+	// is no limit
+	Timeout string `yaml:"timeout"`
+	// The format of the output, either csv (the default) or jsonl
+	Format    string `yaml:"format"`
+	HasHeader bool   `yaml:"hasHeader"`
+	// The separator of the csv format, if empty this is a comma
+	Separator string `yaml:"separator"`
+	// Maps field names to dot separated key paths for the jsonl format
+	FieldPaths map[string]string `yaml:"fieldPaths"`
+}
+
+func makeCommandDataset(
+	cfg *config.Config,
+	desc *commandDesc,
+	fields []string,
+) (ddataset.Dataset, error) {
+	// File mode permission:
+	// No special permission bits
+	// User: Read, Write Execute
+	// Group: None
+	// Other: None
+	const modePerm = 0700
+	spec, err := desc.spec(cfg, fields)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(spec.TmpDir, modePerm); err != nil {
+		return nil, err
+	}
+	return dcommand.New(spec, fields), nil
+}
+
+// spec returns the dcommand.Spec described by desc for a command that
+// outputs fields
+func (desc *commandDesc) spec(
+	cfg *config.Config,
+	fields []string,
+) (dcommand.Spec, error) {
+	if desc.Path == "" {
+		return dcommand.Spec{}, errors.New("command: missing path")
+	}
+	spec := dcommand.Spec{
+		Path:       desc.Path,
+		Args:       desc.Args,
+		Dir:        desc.Dir,
+		HasHeader:  desc.HasHeader,
+		Separator:  ',',
+		FieldPaths: desc.FieldPaths,
+		TmpDir:     filepath.Join(cfg.BuildDir, "tmp"),
+	}
+	if desc.Timeout != "" {
+		timeout, err := time.ParseDuration(desc.Timeout)
+		if err != nil || timeout < 0 {
+			return dcommand.Spec{},
+				fmt.Errorf("command: invalid timeout: %s", desc.Timeout)
+		}
+		spec.Timeout = timeout
+	}
+	switch desc.Format {
+	case "", "csv":
+		spec.Format = dcommand.CSV
+	case "jsonl":
+		spec.Format = dcommand.JSONL
+	default:
+		return dcommand.Spec{},
+			fmt.Errorf("command: invalid format: %s", desc.Format)
+	}
+	if desc.Separator != "" {
+		spec.Separator = rune(desc.Separator[0])
+	}
+	for field := range desc.FieldPaths {
+		if !hasField(fields, field) {
+			return dcommand.Spec{},
+				fmt.Errorf("command: fieldPaths: unknown field: %s", field)
+		}
+	}
+	return spec, nil
+}
@@ -0,0 +1,221 @@
+package experiment
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+	"github.com/vlifesystems/rulehunter/progress"
+)
+
+func TestLoad_command(t *testing.T) {
+	os.Setenv("RULEHUNTER_TEST_COMMAND", os.Args[0])
+	defer os.Unsetenv("RULEHUNTER_TEST_COMMAND")
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow_command.yaml"),
+		time.Now(),
+	)
+	e, err := Load(cfg, file)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	defer e.Release()
+	if n := len(datasetHeights(t, e.Train.Dataset())); n != 9 {
+		t.Errorf("got %d records, want: 9", n)
+	}
+}
+
+func TestLoad_command_error(t *testing.T) {
+	os.Setenv("RULEHUNTER_TEST_COMMAND", os.Args[0])
+	defer os.Unsetenv("RULEHUNTER_TEST_COMMAND")
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	pm, err := progress.NewMonitor(filepath.Join(cfg.BuildDir, "progress"))
+	if err != nil {
+		t.Fatalf("progress.NewMonitor: %s", err)
+	}
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow_command_fail.yaml"),
+		time.Now(),
+	)
+	wantErr := "experiment field: train: dataset: " + os.Args[0] +
+		": exit code 3: can't connect to warehouse"
+	_, err = LoadWithProgress(cfg, file, pm)
+	if err == nil || err.Error() != wantErr {
+		t.Fatalf("Load err: %v, want: %s", err, wantErr)
+	}
+	if err := pm.ReportLoadError(file.Name(), err); err != nil {
+		t.Fatalf("ReportLoadError: %s", err)
+	}
+	experiments := pm.GetExperiments()
+	if len(experiments) != 1 {
+		t.Fatalf("GetExperiments got %d experiments, want: 1", len(experiments))
+	}
+	status := experiments[0].Status
+	wantMsg := "Error loading experiment: " + wantErr
+	if status.State != progress.Error || status.Msg != wantMsg {
+		t.Errorf("Status got: %s, want msg: %s", status, wantMsg)
+	}
+}
+
+func TestLoad_command_split(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	counterFilename := filepath.Join(tmpDir, "counter")
+	os.Setenv("RULEHUNTER_TEST_COMMAND", os.Args[0])
+	os.Setenv("RULEHUNTER_TEST_COUNTER", counterFilename)
+	defer os.Unsetenv("RULEHUNTER_TEST_COMMAND")
+	defer os.Unsetenv("RULEHUNTER_TEST_COUNTER")
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow_split_command.yaml"),
+		time.Now(),
+	)
+	e, err := Load(cfg, file)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	defer e.Release()
+	// The command returns the records in a different order each time that
+	// it is run, so the partitions must be split from one copy of them
+	trainHeights := datasetHeights(t, e.Train.Dataset())
+	testHeights := datasetHeights(t, e.Test.Dataset())
+	if len(trainHeights) != 6 || len(testHeights) != 3 {
+		t.Errorf("got %d train and %d test records, want: 6 and 3",
+			len(trainHeights), len(testHeights))
+	}
+	for h := range testHeights {
+		if trainHeights[h] {
+			t.Errorf("record with height: %s, in train and test datasets", h)
+		}
+	}
+	counter, err := ioutil.ReadFile(counterFilename)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	if string(counter) != "1" {
+		t.Errorf("command run %s times, want: 1", counter)
+	}
+}
+
+func TestMakeDataset_command_errors(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	fields := []string{"group", "district", "height", "flow"}
+	cases := []struct {
+		desc    *commandDesc
+		wantErr string
+	}{
+		{desc: &commandDesc{},
+			wantErr: "command: missing path",
+		},
+		{desc: &commandDesc{Path: os.Args[0], Timeout: "soon"},
+			wantErr: "command: invalid timeout: soon",
+		},
+		{desc: &commandDesc{Path: os.Args[0], Timeout: "-5s"},
+			wantErr: "command: invalid timeout: -5s",
+		},
+		{desc: &commandDesc{Path: os.Args[0], Format: "xml"},
+			wantErr: "command: invalid format: xml",
+		},
+		{desc: &commandDesc{
+			Path:       os.Args[0],
+			Format:     "jsonl",
+			FieldPaths: map[string]string{"region": "location.region"},
+		},
+			wantErr: "command: fieldPaths: unknown field: region",
+		},
+		{desc: &commandDesc{
+			Path: os.Args[0],
+			Args: []string{
+				"-test.run=TestCommandHelperProcess", "--", "sleep", "10s",
+			},
+			Timeout: "100ms",
+		},
+			wantErr: os.Args[0] + ": timed out after 100ms: sleeping",
+		},
+	}
+	for i, c := range cases {
+		_, err := makeDataset(cfg, &datasetDesc{Command: c.desc, Fields: fields})
+		if err == nil || err.Error() != c.wantErr {
+			t.Errorf("(%d) makeDataset err: %v, want: %s", i, err, c.wantErr)
+		}
+	}
+}
+
+// TestCommandHelperProcess isn't a real test, it is run as the command
+// by the other tests so that they don't depend on commands of the OS
+func TestCommandHelperProcess(t *testing.T) {
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		return
+	}
+	args = args[1:]
+	switch args[0] {
+	case "cat":
+		b, err := ioutil.ReadFile(args[1])
+		if err != nil {
+			fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(b)
+	case "rotate":
+		// Rotates the records of a csv file by the number of times that it
+		// has been run, which is kept in a counter file
+		b, err := ioutil.ReadFile(args[1])
+		if err != nil {
+			fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		n := 0
+		if c, err := ioutil.ReadFile(args[2]); err == nil {
+			n, _ = strconv.Atoi(string(c))
+		}
+		if err := ioutil.WriteFile(args[2], []byte(strconv.Itoa(n+1)), 0600); err != nil {
+			fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		records := lines[1:]
+		n %= len(records)
+		records = append(records[n:], records[:n]...)
+		fmt.Println(lines[0])
+		fmt.Println(strings.Join(records, "\n"))
+	case "fail":
+		code, _ := strconv.Atoi(args[1])
+		fmt.Fprintln(os.Stderr, args[2])
+		os.Exit(code)
+	case "sleep":
+		d, _ := time.ParseDuration(args[1])
+		fmt.Fprintln(os.Stderr, "sleeping")
+		time.Sleep(d)
+	}
+	os.Exit(0)
+}
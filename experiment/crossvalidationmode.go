@@ -0,0 +1,229 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package experiment
+
+import (
+	"fmt"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/vlifesystems/rhkit/assessment"
+	"github.com/vlifesystems/rhkit/description"
+	"github.com/vlifesystems/rhkit/rule"
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/internal/dataset/dsplit"
+	"github.com/vlifesystems/rulehunter/progress"
+	"github.com/vlifesystems/rulehunter/quitter"
+	"github.com/vlifesystems/rulehunter/report"
+)
+
+// The number of folds used if none is specified
+const defaultNumFolds = 5
+
+type CrossValidationMode struct {
+	dataset        ddataset.Dataset
+	folds          []*crossValidationFold
+	where          string
+	sample         *report.Sample
+	when           *dexpr.Expr
+	hasNewRows     func() (bool, error)
+	ruleGeneration ruleGeneration
+}
+
+type crossValidationModeDesc struct {
+	Dataset *datasetDesc `yaml:"dataset"`
+	// An expression that works out whether to run the experiment for this mode
+	When     string `yaml:"when"`
+	NumFolds int    `yaml:"numFolds"`
+	Seed     int64  `yaml:"seed"`
+	// A field whose values should be in the same proportions in each fold
+	Stratify       string             `yaml:"stratify"`
+	RuleGeneration ruleGenerationDesc `yaml:"ruleGeneration"`
+}
+
+// crossValidationFold holds the train and test partitions of a fold
+type crossValidationFold struct {
+	train *foldMode
+	test  *foldMode
+}
+
+// foldMode is used to train or assess rules on one partition of a fold
+type foldMode struct {
+	dataset              ddataset.Dataset
+	numAssessRulesStages int
+}
+
+func newCrossValidationMode(
+	cfg *config.Config,
+	desc *crossValidationModeDesc,
+) (*CrossValidationMode, error) {
+	when, err := makeWhenExpr(desc.When)
+	if err != nil {
+		return nil, InvalidWhenExprError(desc.When)
+	}
+	d, err := makeModeDataset(cfg, desc.Dataset, when)
+	if err != nil {
+		return nil, fmt.Errorf("dataset: %s", err)
+	}
+	if desc.Stratify != "" && !hasField(d.Fields(), desc.Stratify) {
+		d.Release()
+		return nil, fmt.Errorf("stratify: unknown field: %s", desc.Stratify)
+	}
+	rg, err := makeRuleGeneration(desc.RuleGeneration, desc.Dataset, d.Fields())
+	if err != nil {
+		d.Release()
+		return nil, err
+	}
+	spec := dsplit.KFoldSpec{
+		NumFolds: desc.numFolds(),
+		Seed:     desc.Seed,
+		Stratify: desc.Stratify,
+	}
+	numAssessRulesStages := 5 + desc.RuleGeneration.CombinationLength
+	// The folds share one assignment of the records of d, which is a
+	// stable copy, so that they are disjoint
+	kFold := dsplit.NewKFolds(d, spec)
+	folds := make([]*crossValidationFold, spec.NumFolds)
+	for i := range folds {
+		folds[i] = &crossValidationFold{
+			train: &foldMode{
+				dataset:              kFold.Fold(i, dsplit.Train),
+				numAssessRulesStages: numAssessRulesStages,
+			},
+			test: &foldMode{
+				dataset:              kFold.Fold(i, dsplit.Test),
+				numAssessRulesStages: numAssessRulesStages,
+			},
+		}
+	}
+	return &CrossValidationMode{
+		dataset:        d,
+		folds:          folds,
+		where:          desc.Dataset.Where,
+		sample:         desc.Dataset.sample(cfg),
+		when:           when,
+		hasNewRows:     desc.Dataset.newRowsFunc(cfg),
+		ruleGeneration: rg,
+	}, nil
+}
+
+func (desc *crossValidationModeDesc) numFolds() int {
+	if desc.NumFolds == 0 {
+		return defaultNumFolds
+	}
+	return desc.NumFolds
+}
+
+func (m *CrossValidationMode) Kind() report.ModeKind {
+	return report.CrossValidation
+}
+
+func (m *CrossValidationMode) Release() error {
+	if m == nil {
+		return nil
+	}
+	return m.dataset.Release()
+}
+
+func (m *CrossValidationMode) Dataset() ddataset.Dataset {
+	return m.dataset
+}
+
+func (m *CrossValidationMode) NumAssessRulesStages() int {
+	return 5 + m.ruleGeneration.combinationLength
+}
+
+// Process trains rules on the train partition of each fold, assesses
+// the rules found, along with rules, on the held-out partition of the
+// same fold and writes a report of the results
+func (m *CrossValidationMode) Process(
+	e *Experiment,
+	cfg *config.Config,
+	pm *progress.Monitor,
+	q *quitter.Quitter,
+	rules []rule.Rule,
+) error {
+	foldAssessments := make([]*assessment.Assessment, len(m.folds))
+	for i, f := range m.folds {
+		_, trainAss, err :=
+			trainRules(e, f.train, m.ruleGeneration, cfg, pm, q, rules)
+		if err != nil {
+			return err
+		}
+		rt := newRuleTracker()
+		foldRules := append(rt.track(trainAss.Rules()), rt.track(rules)...)
+		ass, err := assessRules(
+			e,
+			f.test,
+			m.NumAssessRulesStages(),
+			foldRules,
+			pm,
+			q,
+			cfg,
+			false,
+		)
+		if err != nil {
+			return fmt.Errorf("Couldn't assess rules: %s", err)
+		}
+		foldAssessments[i] = ass
+	}
+
+	err := pm.ReportProgress(
+		e.File.Name(),
+		report.CrossValidation,
+		"Describing dataset",
+		0,
+	)
+	if err != nil {
+		return err
+	}
+	desc, err := description.DescribeDataset(m.dataset)
+	if err != nil {
+		return fmt.Errorf("Couldn't describe cross validation dataset: %s", err)
+	}
+	nullCounts, err := countNulls(m.dataset)
+	if err != nil {
+		return fmt.Errorf(
+			"Couldn't count nulls in cross validation dataset: %s",
+			err,
+		)
+	}
+	r := report.NewCrossValidation(
+		e.Title,
+		desc,
+		m.where,
+		m.sample,
+		foldAssessments,
+		e.Aggregators,
+		e.Goals,
+		e.SortOrder,
+		e.File.Name(),
+		e.Tags,
+		e.Category,
+	)
+	r.NullCounts = nullCounts
+	r.Matrix = e.Matrix
+	if err := r.WriteJSON(cfg); err != nil {
+		return fmt.Errorf("Couldn't write JSON cross validation report: %s", err)
+	}
+	return nil
+}
+
+func (m *foldMode) Kind() report.ModeKind {
+	return report.CrossValidation
+}
+
+// Release does nothing as the dataset of a fold is released along
+// with the CrossValidationMode
+func (m *foldMode) Release() error {
+	return nil
+}
+
+func (m *foldMode) Dataset() ddataset.Dataset {
+	return m.dataset
+}
+
+func (m *foldMode) NumAssessRulesStages() int {
+	return m.numAssessRulesStages
+}
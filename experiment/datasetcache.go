@@ -0,0 +1,229 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package experiment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/internal/dataset/dcache"
+)
+
+var (
+	datasetCachesMu sync.Mutex
+	datasetCaches   = map[string]*dcache.Cache{}
+)
+
+// getDatasetCache returns the cache shared by experiments using cfg or
+// nil if datasets aren't to be cached
+func getDatasetCache(cfg *config.Config) *dcache.Cache {
+	maxSize := cfg.DatasetCache.MaxSize
+	if maxSize < 0 {
+		return nil
+	}
+	dir := filepath.Join(cfg.BuildDir, "cache")
+	datasetCachesMu.Lock()
+	defer datasetCachesMu.Unlock()
+	if c, ok := datasetCaches[dir]; ok {
+		return c
+	}
+	c := dcache.New(dir, maxSize)
+	datasetCaches[dir] = c
+	return c
+}
+
+// sourceKey returns a fingerprint of the source of the dataset so that
+// a copy can be reused while the source is unchanged.  Files are
+// identified by their size and modification time and databases by their
+// connection details along with the query and its parameters.  As the
+// rows returned by a query can change while it doesn't, its fingerprint
+// also changes after each period of its cacheFor.
+func (dd *datasetDesc) sourceKey(cfg *config.Config) (string, error) {
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	write := func(vs ...interface{}) error {
+		for _, v := range vs {
+			if err := enc.Encode(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := write(dd.Fields); err != nil {
+		return "", err
+	}
+
+	var filenames []string
+	switch {
+	case dd.CSV != nil:
+		fs, err := dd.CSV.Filename.expand()
+		if err != nil {
+			return "", err
+		}
+		filenames = fs
+		if err := write("csv", dd.CSV); err != nil {
+			return "", err
+		}
+	case dd.SQL != nil:
+		source, err := dd.SQL.source(cfg)
+		if err != nil {
+			return "", err
+		}
+		query, args, err :=
+			bindSQLParams(source.driverName, dd.SQL.Query, dd.sqlParams)
+		if err != nil {
+			return "", err
+		}
+		cacheFor, err := dd.SQL.cacheFor()
+		if err != nil {
+			return "", err
+		}
+		var period int64
+		if cacheFor > 0 {
+			period = time.Now().UnixNano() / int64(cacheFor)
+		}
+		err = write(
+			"sql",
+			source.driverName,
+			source.dataSourceName,
+			query,
+			args,
+			period,
+		)
+		if err != nil {
+			return "", err
+		}
+		if source.driverName == "sqlite3" {
+			filenames = []string{source.dataSourceName}
+		}
+	case dd.JSONL != nil:
+		filenames = []string{dd.JSONL.Filename}
+		if err := write("jsonl", dd.JSONL); err != nil {
+			return "", err
+		}
+	case dd.Parquet != nil:
+		filenames = []string{dd.Parquet.Filename}
+		if err := write("parquet", dd.Parquet); err != nil {
+			return "", err
+		}
+	case dd.Arrow != nil:
+		filenames = []string{dd.Arrow.Filename}
+		if err := write("arrow", dd.Arrow); err != nil {
+			return "", err
+		}
+	case dd.XLSX != nil:
+		filenames = []string{dd.XLSX.Filename}
+		if err := write("xlsx", dd.XLSX); err != nil {
+			return "", err
+		}
+	case dd.FixedWidth != nil:
+		filenames = []string{dd.FixedWidth.Filename}
+		if err := write("fixedWidth", dd.FixedWidth); err != nil {
+			return "", err
+		}
+	}
+
+	for _, filename := range filenames {
+		// A missing file is left for the source to report
+		if fi, err := os.Stat(filename); err == nil {
+			absFilename, err := filepath.Abs(filename)
+			if err != nil {
+				return "", err
+			}
+			err = write(absFilename, fi.Size(), fi.ModTime().UnixNano())
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// makeCachedDataset returns a copy of pipeline, the pipeline of dd
+// applied to its source, from cache.  Only the output of the pipeline is
+// copied, so that an experiment that is loaded again doesn't copy
+// anything while its source is unchanged.
+func makeCachedDataset(
+	cfg *config.Config,
+	cache *dcache.Cache,
+	dd *datasetDesc,
+	pipeline ddataset.Dataset,
+) (ddataset.Dataset, error) {
+	sourceKey, err := dd.sourceKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	pipelineKey, err := dd.pipelineKey(cfg, sourceKey)
+	if err != nil {
+		return nil, err
+	}
+	return cache.Dataset(pipelineKey, pipeline)
+}
+
+// isCacheable returns whether the dataset and those it joins to can be
+// cached.  Registered kinds and commands can't be cached because their
+// sources can't be fingerprinted.  Queries are only cached if they have
+// a cacheFor, because the rows they return can change without the query
+// or its parameters changing.
+func (dd *datasetDesc) isCacheable() bool {
+	if len(dd.kinds) > 0 || dd.Command != nil {
+		return false
+	}
+	if dd.SQL != nil && dd.SQL.CacheFor == "" {
+		return false
+	}
+	for _, jd := range dd.Joins {
+		if jd != nil && jd.Dataset != nil && !jd.Dataset.isCacheable() {
+			return false
+		}
+	}
+	return true
+}
+
+// pipelineKey returns a fingerprint of the joins, null handling, derived
+// fields, where, split and sample of the dataset applied to the source
+// with sourceKey
+func (dd *datasetDesc) pipelineKey(
+	cfg *config.Config,
+	sourceKey string,
+) (string, error) {
+	joinKeys := make([]string, len(dd.Joins))
+	for i, jd := range dd.Joins {
+		if jd == nil || jd.Dataset == nil {
+			continue
+		}
+		lookup := jd.Dataset.asLookup()
+		lookupSourceKey, err := lookup.sourceKey(cfg)
+		if err != nil {
+			return "", err
+		}
+		joinKeys[i], err = lookup.pipelineKey(cfg, lookupSourceKey)
+		if err != nil {
+			return "", err
+		}
+	}
+	h := sha256.New()
+	err := json.NewEncoder(h).Encode([]interface{}{
+		sourceKey,
+		dd.Joins,
+		joinKeys,
+		dd.Nulls,
+		dd.DerivedFields,
+		dd.Where,
+		dd.split,
+		dd.partition,
+		dd.sample(cfg),
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,219 @@
+package experiment
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+)
+
+func TestMakeDataset_cache(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	flowFilename := filepath.Join(tmpDir, "flow.csv")
+	testhelpers.CopyFile(t, filepath.Join("fixtures", "flow.csv"), tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	newDesc := func(where string) *datasetDesc {
+		return &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{flowFilename},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+			Where:  where,
+		}
+	}
+	d1, err := makeDataset(cfg, newDesc(""))
+	if err != nil {
+		t.Fatalf("makeDataset: %s", err)
+	}
+	defer d1.Release()
+	d2, err := makeDataset(cfg, newDesc("height > 20"))
+	if err != nil {
+		t.Fatalf("makeDataset: %s", err)
+	}
+	if n := d1.NumRecords(); n != 9 {
+		t.Errorf("NumRecords got: %d, want: 9", n)
+	}
+	if n := d2.NumRecords(); n != 6 {
+		t.Errorf("NumRecords got: %d, want: 6", n)
+	}
+	if err := d2.Release(); err != nil {
+		t.Errorf("Release: %s", err)
+	}
+	// Each dataset is copied once under the key of its source and pipeline
+	assertNumFiles(t, filepath.Join(cfg.BuildDir, "cache"), 2)
+	assertNumFiles(t, filepath.Join(cfg.BuildDir, "tmp"), 0)
+
+	// Nothing new is copied if the dataset is made again
+	d2, err = makeDataset(cfg, newDesc("height > 20"))
+	if err != nil {
+		t.Fatalf("makeDataset: %s", err)
+	}
+	if err := d2.Release(); err != nil {
+		t.Errorf("Release: %s", err)
+	}
+	assertNumFiles(t, filepath.Join(cfg.BuildDir, "cache"), 2)
+
+	// A changed source must be copied again
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(flowFilename, modTime, modTime); err != nil {
+		t.Fatalf("Chtimes: %s", err)
+	}
+	d3, err := makeDataset(cfg, newDesc(""))
+	if err != nil {
+		t.Fatalf("makeDataset: %s", err)
+	}
+	defer d3.Release()
+	assertNumFiles(t, filepath.Join(cfg.BuildDir, "cache"), 3)
+
+	// Caching can be turned off
+	cfg.DatasetCache.MaxSize = -1
+	d4, err := makeDataset(cfg, newDesc(""))
+	if err != nil {
+		t.Fatalf("makeDataset: %s", err)
+	}
+	defer d4.Release()
+	assertNumFiles(t, filepath.Join(cfg.BuildDir, "cache"), 3)
+	assertNumFiles(t, filepath.Join(cfg.BuildDir, "tmp"), 1)
+}
+
+func TestDatasetDescSourceKey(t *testing.T) {
+	cfg := &config.Config{
+		DataSources: map[string]config.DataSource{
+			"flow": config.DataSource{
+				DriverName:     "sqlite3",
+				DataSourceName: filepath.Join("fixtures", "flow.db"),
+			},
+		},
+	}
+	fields := []string{"group", "district", "height", "flow"}
+	newCSVDesc := func(separator string) *datasetDesc {
+		return &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: separator,
+			},
+			Fields: fields,
+		}
+	}
+	newSQLDesc := func(lastRunStamp time.Time) *datasetDesc {
+		return &datasetDesc{
+			SQL: &sqlDesc{
+				Source:   "flow",
+				Query:    "select * from flow where stamp > :lastRunStamp",
+				CacheFor: "10000h",
+			},
+			Fields:    fields,
+			sqlParams: map[string]interface{}{"lastRunStamp": lastRunStamp},
+		}
+	}
+	stamp := time.Date(2018, time.March, 14, 8, 0, 0, 0, time.UTC)
+	cases := []struct {
+		a, b     *datasetDesc
+		wantSame bool
+	}{
+		{a: newCSVDesc(","), b: newCSVDesc(","), wantSame: true},
+		{a: newCSVDesc(","), b: newCSVDesc(";"), wantSame: false},
+		{a: newSQLDesc(stamp), b: newSQLDesc(stamp), wantSame: true},
+		{a: newSQLDesc(stamp),
+			b:        newSQLDesc(stamp.Add(time.Hour)),
+			wantSame: false,
+		},
+	}
+	for i, c := range cases {
+		keyA, err := c.a.sourceKey(cfg)
+		if err != nil {
+			t.Fatalf("(%d) sourceKey: %s", i, err)
+		}
+		keyB, err := c.b.sourceKey(cfg)
+		if err != nil {
+			t.Fatalf("(%d) sourceKey: %s", i, err)
+		}
+		if (keyA == keyB) != c.wantSame {
+			t.Errorf("(%d) sourceKey got same: %t, want: %t",
+				i, keyA == keyB, c.wantSame)
+		}
+	}
+}
+
+func TestDatasetDescIsCacheable(t *testing.T) {
+	csv := &csvDesc{Filename: fileList{filepath.Join("fixtures", "flow.csv")}}
+	cases := []struct {
+		desc *datasetDesc
+		want bool
+	}{
+		{desc: &datasetDesc{CSV: csv}, want: true},
+		{desc: &datasetDesc{SQL: &sqlDesc{Query: "select * from flow"}},
+			want: false,
+		},
+		{desc: &datasetDesc{
+			SQL: &sqlDesc{Query: "select * from flow", CacheFor: "1h"},
+		},
+			want: true,
+		},
+		{desc: &datasetDesc{Command: &commandDesc{Path: "flow"}}, want: false},
+		{desc: &datasetDesc{
+			CSV: csv,
+			Joins: []*joinDesc{
+				{Dataset: &datasetDesc{SQL: &sqlDesc{Query: "select * from flow"}}},
+			},
+		},
+			want: false,
+		},
+	}
+	for i, c := range cases {
+		if got := c.desc.isCacheable(); got != c.want {
+			t.Errorf("(%d) isCacheable got: %t, want: %t", i, got, c.want)
+		}
+	}
+}
+
+func TestSQLDescCacheFor(t *testing.T) {
+	cases := []struct {
+		cacheFor string
+		want     time.Duration
+		wantErr  error
+	}{
+		{cacheFor: "", want: 0},
+		{cacheFor: "90m", want: 90 * time.Minute},
+		{cacheFor: "0s", wantErr: errors.New("invalid cacheFor: 0s")},
+		{cacheFor: "-1h", wantErr: errors.New("invalid cacheFor: -1h")},
+		{cacheFor: "an hour", wantErr: errors.New("invalid cacheFor: an hour")},
+	}
+	for i, c := range cases {
+		got, err := (&sqlDesc{CacheFor: c.cacheFor}).cacheFor()
+		if (err == nil) != (c.wantErr == nil) ||
+			(err != nil && err.Error() != c.wantErr.Error()) {
+			t.Errorf("(%d) cacheFor err: %v, wantErr: %v", i, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("(%d) cacheFor got: %s, want: %s", i, got, c.want)
+		}
+	}
+}
+
+/*************************
+ *   Helper functions
+ *************************/
+
+func assertNumFiles(t *testing.T, dir string, want int) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("ReadDir: %s", err)
+	}
+	if len(files) != want {
+		t.Errorf("%s got %d files, want: %d", dir, len(files), want)
+	}
+}
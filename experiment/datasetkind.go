@@ -0,0 +1,251 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package experiment
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lawrencewoodman/ddataset"
+	"gopkg.in/yaml.v2"
+)
+
+// DatasetFactory makes a Dataset with fields from node, the description
+// of a dataset kind registered with RegisterDatasetKind
+type DatasetFactory func(node DatasetNode, fields []string) (ddataset.Dataset, error)
+
+// DatasetNode is the raw YAML or JSON describing a dataset of a
+// registered kind
+type DatasetNode struct {
+	raw    []byte
+	isJSON bool
+}
+
+var (
+	datasetKindsMu sync.RWMutex
+	datasetKinds   = map[string]DatasetFactory{}
+)
+
+// RegisterDatasetKind makes a dataset kind available to experiments
+// under name, so that a dataset description can contain name in place
+// of a source such as csv or sql.  factory is passed the value of name
+// to make the dataset.  If RegisterDatasetKind is called twice with the
+// same name, with the name of an existing dataset field or if factory is
+// nil, it panics.
+func RegisterDatasetKind(name string, factory DatasetFactory) {
+	datasetKindsMu.Lock()
+	defer datasetKindsMu.Unlock()
+	if factory == nil {
+		panic("experiment: RegisterDatasetKind factory is nil")
+	}
+	if _, dup := datasetKinds[name]; dup {
+		panic("experiment: RegisterDatasetKind called twice for kind: " + name)
+	}
+	if name == "" || isDatasetField(name) {
+		panic("experiment: RegisterDatasetKind invalid kind: " + name)
+	}
+	datasetKinds[name] = factory
+}
+
+// DatasetKinds returns a sorted list of the names of the registered
+// dataset kinds
+func DatasetKinds() []string {
+	datasetKindsMu.RLock()
+	defer datasetKindsMu.RUnlock()
+	names := make([]string, 0, len(datasetKinds))
+	for name := range datasetKinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getDatasetKind(name string) (DatasetFactory, bool) {
+	datasetKindsMu.RLock()
+	defer datasetKindsMu.RUnlock()
+	factory, ok := datasetKinds[name]
+	return factory, ok
+}
+
+// isDatasetField returns whether name is used by a field of datasetDesc.
+// JSON field names are matched case insensitively.
+func isDatasetField(name string) bool {
+	t := reflect.TypeOf(datasetDesc{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		yamlName := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == yamlName || strings.EqualFold(name, f.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Decode unmarshals the node into v using the yaml or json package
+// depending on the format of the experiment file
+func (n DatasetNode) Decode(v interface{}) error {
+	if n.isJSON {
+		return json.Unmarshal(n.raw, v)
+	}
+	return yaml.Unmarshal(n.raw, v)
+}
+
+// String returns the node as YAML or JSON
+func (n DatasetNode) String() string {
+	return string(n.raw)
+}
+
+// interpolate returns the node with the references in its strings
+// resolved by ip
+func (n DatasetNode) interpolate(ip *interpolator) (DatasetNode, error) {
+	var v interface{}
+	if n.isJSON {
+		dec := json.NewDecoder(bytes.NewReader(n.raw))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return n, err
+		}
+	} else if err := yaml.Unmarshal(n.raw, &v); err != nil {
+		return n, err
+	}
+	v, err := interpolateNodeValue(ip, v, "")
+	if err != nil {
+		return n, err
+	}
+	var raw []byte
+	if n.isJSON {
+		raw, err = json.Marshal(v)
+	} else {
+		raw, err = yaml.Marshal(v)
+	}
+	if err != nil {
+		return n, err
+	}
+	return DatasetNode{raw: raw, isJSON: n.isJSON}, nil
+}
+
+// interpolateNodeValue returns v, a value decoded from a DatasetNode,
+// with the references in its strings resolved by ip.  Errors are
+// prefixed with path followed by the keys leading to the string.
+func interpolateNodeValue(
+	ip *interpolator,
+	v interface{},
+	path string,
+) (interface{}, error) {
+	switch x := v.(type) {
+	case string:
+		s, err := ip.interpolate(x)
+		if err != nil {
+			return nil, fmt.Errorf("%s%s", path, err)
+		}
+		return s, nil
+	case []interface{}:
+		for i, e := range x {
+			r, err := interpolateNodeValue(ip, e, path)
+			if err != nil {
+				return nil, err
+			}
+			x[i] = r
+		}
+	case map[interface{}]interface{}:
+		for k, e := range x {
+			r, err := interpolateNodeValue(ip, e, fmt.Sprintf("%s%v: ", path, k))
+			if err != nil {
+				return nil, err
+			}
+			x[k] = r
+		}
+	case map[string]interface{}:
+		for k, e := range x {
+			r, err := interpolateNodeValue(ip, e, path+k+": ")
+			if err != nil {
+				return nil, err
+			}
+			x[k] = r
+		}
+	}
+	return v, nil
+}
+
+// plainDatasetDesc is used to unmarshal the fields of datasetDesc
+// without recursing into its unmarshallers
+type plainDatasetDesc datasetDesc
+
+func (dd *datasetDesc) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal((*plainDatasetDesc)(dd)); err != nil {
+		return err
+	}
+	var nodes map[string]interface{}
+	if err := unmarshal(&nodes); err != nil {
+		return err
+	}
+	for name, v := range nodes {
+		if _, ok := getDatasetKind(name); !ok {
+			continue
+		}
+		raw, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		dd.addKind(name, DatasetNode{raw: raw, isJSON: false})
+	}
+	return nil
+}
+
+func (dd *datasetDesc) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*plainDatasetDesc)(dd)); err != nil {
+		return err
+	}
+	var nodes map[string]json.RawMessage
+	if err := json.Unmarshal(data, &nodes); err != nil {
+		return err
+	}
+	for name, raw := range nodes {
+		if _, ok := getDatasetKind(name); ok {
+			dd.addKind(name, DatasetNode{raw: raw, isJSON: true})
+		}
+	}
+	return nil
+}
+
+func (dd *datasetDesc) addKind(name string, node DatasetNode) {
+	if dd.kinds == nil {
+		dd.kinds = map[string]DatasetNode{}
+	}
+	dd.kinds[name] = node
+}
+
+// kindNames returns the sorted names of the registered kinds used by dd
+func (dd *datasetDesc) kindNames() []string {
+	names := make([]string, 0, len(dd.kinds))
+	for name := range dd.kinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func makeKindDataset(
+	name string,
+	node DatasetNode,
+	fields []string,
+) (ddataset.Dataset, error) {
+	factory, ok := getDatasetKind(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown kind: %s", name)
+	}
+	d, err := factory(node, fields)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return d, nil
+}
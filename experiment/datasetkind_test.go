@@ -0,0 +1,224 @@
+package experiment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/ddataset/dcsv"
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	RegisterDatasetKind("testcsv", newTestCSVDataset)
+}
+
+// newTestCSVDataset is a DatasetFactory for a comma separated csv file
+// with a header
+func newTestCSVDataset(
+	node DatasetNode,
+	fields []string,
+) (ddataset.Dataset, error) {
+	var desc struct {
+		Filename string `yaml:"filename" json:"filename"`
+	}
+	if err := node.Decode(&desc); err != nil {
+		return nil, err
+	}
+	if desc.Filename == "" {
+		return nil, errors.New("missing filename")
+	}
+	return dcsv.New(desc.Filename, true, ',', fields), nil
+}
+
+func TestRegisterDatasetKind_panics(t *testing.T) {
+	cases := []struct {
+		name    string
+		factory DatasetFactory
+	}{
+		{name: "testcsv", factory: newTestCSVDataset},
+		{name: "csv", factory: newTestCSVDataset},
+		{name: "Where", factory: newTestCSVDataset},
+		{name: "derivedFields", factory: newTestCSVDataset},
+		{name: "", factory: newTestCSVDataset},
+		{name: "testcsv2", factory: nil},
+	}
+	for i, c := range cases {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("(%d) RegisterDatasetKind(%s) didn't panic", i, c.name)
+				}
+			}()
+			RegisterDatasetKind(c.name, c.factory)
+		}()
+	}
+	if got, want := DatasetKinds(), []string{"testcsv"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DatasetKinds got: %v, want: %v", got, want)
+	}
+}
+
+func TestMakeDataset_kind(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	filename := filepath.Join("fixtures", "flow.csv")
+	yamlDesc := fmt.Sprintf(`
+testcsv:
+  filename: %s
+fields: [group, district, height, flow]
+where: "height > 20"
+`, filename)
+	jsonDesc := fmt.Sprintf(`{
+  "testcsv": {"filename": %q},
+  "fields": ["group", "district", "height", "flow"],
+  "where": "height > 20"
+}`, filename)
+	descs := []*datasetDesc{}
+	dd := &datasetDesc{}
+	if err := yaml.Unmarshal([]byte(yamlDesc), dd); err != nil {
+		t.Fatalf("yaml.Unmarshal: %s", err)
+	}
+	descs = append(descs, dd)
+	dd = &datasetDesc{}
+	if err := json.Unmarshal([]byte(jsonDesc), dd); err != nil {
+		t.Fatalf("json.Unmarshal: %s", err)
+	}
+	descs = append(descs, dd)
+	for i, dd := range descs {
+		if dd.Where != "height > 20" {
+			t.Errorf("(%d) Where got: %s, want: height > 20", i, dd.Where)
+		}
+		d, err := makeDataset(cfg, dd)
+		if err != nil {
+			t.Errorf("(%d) makeDataset: %s", i, err)
+			continue
+		}
+		if n := d.NumRecords(); n != 6 {
+			t.Errorf("(%d) NumRecords got: %d, want: 6", i, n)
+		}
+		d.Release()
+	}
+}
+
+func TestMakeDataset_kind_errors(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	cases := []struct {
+		desc    string
+		wantErr string
+	}{
+		{desc: `
+testcsv:
+  name: flow
+fields: [group, district, height, flow]
+`,
+			wantErr: "testcsv: missing filename",
+		},
+		{desc: `
+csv:
+  filename: fixtures/flow.csv
+  separator: ","
+testcsv:
+  filename: fixtures/flow.csv
+fields: [group, district, height, flow]
+`,
+			wantErr: "can't specify csv and testcsv source",
+		},
+		{desc: `
+unregistered:
+  filename: fixtures/flow.csv
+fields: [group, district, height, flow]
+`,
+			wantErr: "has no csv, sql, jsonl, parquet, arrow, xlsx, fixedWidth or command field",
+		},
+	}
+	for i, c := range cases {
+		dd := &datasetDesc{}
+		if err := yaml.Unmarshal([]byte(c.desc), dd); err != nil {
+			t.Fatalf("(%d) yaml.Unmarshal: %s", i, err)
+		}
+		_, err := makeDataset(cfg, dd)
+		if err == nil || err.Error() != c.wantErr {
+			t.Errorf("(%d) makeDataset got err: %v, want: %s", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestDatasetDescInterpolate_kind(t *testing.T) {
+	os.Setenv("RULEHUNTER_TEST_FILENAME", filepath.Join("fixtures", "flow.csv"))
+	defer os.Unsetenv("RULEHUNTER_TEST_FILENAME")
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	yamlDesc := `
+testcsv:
+  filename: ${RULEHUNTER_TEST_FILENAME}
+fields: [group, district, height, flow]
+`
+	jsonDesc := `{
+  "testcsv": {"filename": "${RULEHUNTER_TEST_FILENAME}"},
+  "fields": ["group", "district", "height", "flow"]
+}`
+	descs := []*datasetDesc{}
+	dd := &datasetDesc{}
+	if err := yaml.Unmarshal([]byte(yamlDesc), dd); err != nil {
+		t.Fatalf("yaml.Unmarshal: %s", err)
+	}
+	descs = append(descs, dd)
+	dd = &datasetDesc{}
+	if err := json.Unmarshal([]byte(jsonDesc), dd); err != nil {
+		t.Fatalf("json.Unmarshal: %s", err)
+	}
+	descs = append(descs, dd)
+	for i, dd := range descs {
+		if err := dd.interpolate(&interpolator{}); err != nil {
+			t.Errorf("(%d) interpolate: %s", i, err)
+			continue
+		}
+		d, err := makeDataset(cfg, dd)
+		if err != nil {
+			t.Errorf("(%d) makeDataset: %s", i, err)
+			continue
+		}
+		if n := d.NumRecords(); n != 9 {
+			t.Errorf("(%d) NumRecords got: %d, want: 9", i, n)
+		}
+		d.Release()
+	}
+}
+
+func TestDatasetDescInterpolate_kind_errors(t *testing.T) {
+	dd := &datasetDesc{}
+	desc := `
+testcsv:
+  filename: ${RULEHUNTER_TEST_UNSET}
+fields: [group, district, height, flow]
+`
+	if err := yaml.Unmarshal([]byte(desc), dd); err != nil {
+		t.Fatalf("yaml.Unmarshal: %s", err)
+	}
+	wantErr := "testcsv: filename: " +
+		"environment variable not set: RULEHUNTER_TEST_UNSET"
+	err := dd.interpolate(&interpolator{})
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("interpolate got err: %v, want: %s", err, wantErr)
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package experiment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vlifesystems/rhkit/rule"
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/fileinfo"
+	"github.com/vlifesystems/rulehunter/progress"
+	"github.com/vlifesystems/rulehunter/report"
+)
+
+// dependsOnDesc describes an experiment file that must have been
+// processed successfully before this one is processed.  It can be
+// given as just the filename.
+type dependsOnDesc struct {
+	// The experiment file relative to the experiments directory
+	Experiment string `yaml:"experiment"`
+	// The number of the best rules from the latest train report of the
+	// experiment to add to the rules of this one
+	NumSeedRules int `yaml:"numSeedRules"`
+}
+
+func (d *dependsOnDesc) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var filename string
+	if err := unmarshal(&filename); err == nil {
+		*d = dependsOnDesc{Experiment: filename}
+		return nil
+	}
+	type plainDependsOnDesc dependsOnDesc
+	return unmarshal((*plainDependsOnDesc)(d))
+}
+
+func (d *dependsOnDesc) UnmarshalJSON(data []byte) error {
+	var filename string
+	if err := json.Unmarshal(data, &filename); err == nil {
+		*d = dependsOnDesc{Experiment: filename}
+		return nil
+	}
+	type plainDependsOnDesc dependsOnDesc
+	return json.Unmarshal(data, (*plainDependsOnDesc)(d))
+}
+
+// makeDependsOn returns the experiment files described by descs
+func makeDependsOn(descs []*dependsOnDesc) ([]string, error) {
+	r := make([]string, 0, len(descs))
+	for _, d := range descs {
+		if d.Experiment == "" {
+			return nil, errors.New("missing experiment")
+		}
+		ext := filepath.Ext(d.Experiment)
+		if ext != ".json" && ext != ".yaml" {
+			return nil, fmt.Errorf("%s: %s", d.Experiment, InvalidExtError(ext))
+		}
+		if d.NumSeedRules < 0 {
+			return nil, fmt.Errorf("%s: numSeedRules: must be at least 0",
+				d.Experiment)
+		}
+		if !hasField(r, d.Experiment) {
+			r = append(r, d.Experiment)
+		}
+	}
+	return r, nil
+}
+
+// DependsOn returns the experiment files that the experiments in file
+// depend on
+func DependsOn(
+	cfg *config.Config,
+	file fileinfo.FileInfo,
+) ([]string, error) {
+	expansions, err := loadExpansions(cfg, file)
+	if err != nil {
+		return nil, err
+	}
+	r := []string{}
+	for _, x := range expansions {
+		dependsOn, err := makeDependsOn(x.desc.DependsOn)
+		if err != nil {
+			return nil, fmt.Errorf("experiment field: dependsOn: %s", err)
+		}
+		for _, filename := range dependsOn {
+			if !hasField(r, filename) {
+				r = append(r, filename)
+			}
+		}
+	}
+	return r, nil
+}
+
+// WaitingFor returns the experiment files that the experiment depends on
+// which haven't been processed successfully
+func (e *Experiment) WaitingFor(pm *progress.Monitor) []string {
+	r := []string{}
+	for _, filename := range e.DependsOn {
+		if ok, _ := dependencyStatus(pm, filename); !ok {
+			r = append(r, filename)
+		}
+	}
+	return r
+}
+
+// dependencyStatus returns whether the experiments in filename were last
+// processed successfully and the latest time that one of them finished.
+// If filename has a matrix every experiment expanded from it must have
+// been successful.
+func dependencyStatus(
+	pm *progress.Monitor,
+	filename string,
+) (bool, time.Time) {
+	var stamp time.Time
+	found := false
+	for _, pe := range pm.GetExperiments() {
+		if pe.Filename != filename &&
+			!strings.HasPrefix(pe.Filename, filename+" (") {
+			continue
+		}
+		if pe.Status.State != progress.Success {
+			return false, time.Time{}
+		}
+		if pe.Status.Stamp.After(stamp) {
+			stamp = pe.Status.Stamp
+		}
+		found = true
+	}
+	return found, stamp
+}
+
+// dependsOnFileInfo returns file with its ModTime set to the latest time
+// that one of the experiments it depends on finished successfully, if
+// later than its own, so that the experiment is rerun after them
+func dependsOnFileInfo(
+	pm *progress.Monitor,
+	file fileinfo.FileInfo,
+	dependsOn []string,
+) fileinfo.FileInfo {
+	modTime := file.ModTime()
+	for _, filename := range dependsOn {
+		if ok, stamp := dependencyStatus(pm, filename); ok &&
+			stamp.After(modTime) {
+			modTime = stamp
+		}
+	}
+	if modTime.Equal(file.ModTime()) {
+		return file
+	}
+	return fileinfo.New(file.Name(), modTime)
+}
+
+// makeSeedRules returns the best rules from the latest train reports of
+// the experiments described by descs that have numSeedRules set
+func makeSeedRules(
+	cfg *config.Config,
+	descs []*dependsOnDesc,
+) ([]rule.Rule, error) {
+	exprs := []string{}
+	for _, d := range descs {
+		if d.NumSeedRules == 0 {
+			continue
+		}
+		reportRules, err := bestReportRules(cfg, d.Experiment, d.NumSeedRules)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", d.Experiment, err)
+		}
+		for _, expr := range reportRules {
+			if !hasField(exprs, expr) {
+				exprs = append(exprs, expr)
+			}
+		}
+	}
+	rules, err := makeRules(exprs)
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// bestReportRules returns up to numRules of the best rules, excluding
+// the true rule, from the latest train report of each experiment in
+// filename.  If there aren't any reports no rules are returned.
+func bestReportRules(
+	cfg *config.Config,
+	filename string,
+	numRules int,
+) ([]string, error) {
+	latest, err := latestTrainReports(cfg, filename)
+	if err != nil {
+		return nil, err
+	}
+	return reportsBestRules(latest, numRules), nil
+}
+
+// reportSummary is what latestTrainReports needs to know about a train
+// report file, so that the file is only decoded again if it changes
+type reportSummary struct {
+	modTime            time.Time
+	size               int64
+	experimentFilename string
+	matrixFilename     string
+	stamp              time.Time
+}
+
+var (
+	reportSummariesMu sync.Mutex
+	// Maps reports directories to the summaries of their train report
+	// files, keyed by filename
+	reportSummaries = map[string]map[string]reportSummary{}
+)
+
+// latestTrainReports returns the latest train report of each experiment
+// in filename, keyed by experiment filename.  Only files named as train
+// reports are considered and only the latest of each are loaded.
+func latestTrainReports(
+	cfg *config.Config,
+	filename string,
+) (map[string]*report.Report, error) {
+	summaries, err := trainReportSummaries(cfg)
+	if err != nil {
+		return nil, err
+	}
+	latestFiles := map[string]string{}
+	for reportFilename, s := range summaries {
+		if s.experimentFilename == "" ||
+			(s.experimentFilename != filename && s.matrixFilename != filename) {
+			continue
+		}
+		l, ok := latestFiles[s.experimentFilename]
+		if !ok || s.stamp.After(summaries[l].stamp) {
+			latestFiles[s.experimentFilename] = reportFilename
+		}
+	}
+	latest := map[string]*report.Report{}
+	for experimentFilename, reportFilename := range latestFiles {
+		r, err := report.LoadJSON(cfg, reportFilename)
+		if err != nil {
+			return nil, err
+		}
+		latest[experimentFilename] = r
+	}
+	return latest, nil
+}
+
+// trainReportSummaries returns the summaries of the train report files
+// in the reports directory keyed by filename.  Only the files that are
+// new or have changed since the last call are decoded.
+func trainReportSummaries(
+	cfg *config.Config,
+) (map[string]reportSummary, error) {
+	dir := filepath.Join(cfg.BuildDir, "reports")
+	summaries := map[string]reportSummary{}
+	reportFiles, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return summaries, nil
+		}
+		return nil, err
+	}
+	reportSummariesMu.Lock()
+	defer reportSummariesMu.Unlock()
+	prevSummaries := reportSummaries[dir]
+	prefix := report.Train.String() + "_"
+	for _, file := range reportFiles {
+		if file.IsDir() ||
+			!strings.HasPrefix(file.Name(), prefix) ||
+			filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		s, ok := prevSummaries[file.Name()]
+		if ok && s.modTime.Equal(file.ModTime()) && s.size == file.Size() {
+			summaries[file.Name()] = s
+			continue
+		}
+		r, err := report.LoadJSON(cfg, file.Name())
+		if err != nil {
+			return nil, err
+		}
+		// Reports that aren't train reports are summarized without an
+		// experiment filename so that they are skipped
+		s = reportSummary{modTime: file.ModTime(), size: file.Size()}
+		if r.Mode == report.Train {
+			s.experimentFilename = r.ExperimentFilename
+			s.stamp = r.Stamp
+			if r.Matrix != nil {
+				s.matrixFilename = r.Matrix.Filename
+			}
+		}
+		summaries[file.Name()] = s
+	}
+	reportSummaries[dir] = summaries
+	return summaries, nil
+}
+
+// reportsBestRules returns up to numRules of the best rules, excluding
+// the true rule, from each of reports in order of experiment filename
+func reportsBestRules(
+	reports map[string]*report.Report,
+	numRules int,
+) []string {
+	experimentFilenames := make([]string, 0, len(reports))
+	for experimentFilename := range reports {
+		experimentFilenames = append(experimentFilenames, experimentFilename)
+	}
+	sort.Strings(experimentFilenames)
+	rules := []string{}
+	for _, experimentFilename := range experimentFilenames {
+		n := 0
+		for _, a := range reports[experimentFilename].Assessments {
+			if n >= numRules {
+				break
+			}
+			if a.Rule == "true()" {
+				continue
+			}
+			rules = append(rules, a.Rule)
+			n++
+		}
+	}
+	return rules
+}
@@ -0,0 +1,323 @@
+package experiment
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/internal"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+	"github.com/vlifesystems/rulehunter/progress"
+	"github.com/vlifesystems/rulehunter/report"
+	"gopkg.in/yaml.v2"
+)
+
+func TestMakeDependsOn(t *testing.T) {
+	cases := []struct {
+		src  string
+		want []string
+	}{
+		{src: "[]", want: []string{}},
+		{src: "[a.yaml, b.json, a.yaml]", want: []string{"a.yaml", "b.json"}},
+		{src: "[a.yaml, {experiment: c.yaml, numSeedRules: 3}]",
+			want: []string{"a.yaml", "c.yaml"},
+		},
+	}
+	for _, c := range cases {
+		var descs []*dependsOnDesc
+		if err := yaml.Unmarshal([]byte(c.src), &descs); err != nil {
+			t.Fatalf("yaml.Unmarshal: %s", err)
+		}
+		got, err := makeDependsOn(descs)
+		if err != nil {
+			t.Errorf("makeDependsOn(%s) err: %s", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("makeDependsOn(%s) got: %v, want: %v", c.src, got, c.want)
+		}
+	}
+}
+
+func TestMakeDependsOn_errors(t *testing.T) {
+	cases := []struct {
+		src     string
+		wantErr string
+	}{
+		{src: "[{numSeedRules: 3}]", wantErr: "missing experiment"},
+		{src: "[a.yml]", wantErr: "a.yml: invalid extension: .yml"},
+		{src: "[{experiment: a.yaml, numSeedRules: -1}]",
+			wantErr: "a.yaml: numSeedRules: must be at least 0",
+		},
+	}
+	for _, c := range cases {
+		var descs []*dependsOnDesc
+		if err := yaml.Unmarshal([]byte(c.src), &descs); err != nil {
+			t.Fatalf("yaml.Unmarshal: %s", err)
+		}
+		_, err := makeDependsOn(descs)
+		if err == nil || err.Error() != c.wantErr {
+			t.Errorf("makeDependsOn(%s) err: %v, wantErr: %s", c.src, err, c.wantErr)
+		}
+	}
+}
+
+func TestDependsOn(t *testing.T) {
+	cfg := &config.Config{MaxNumRecords: -1}
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow_dependson.yaml"),
+		time.Now(),
+	)
+	got, err := DependsOn(cfg, file)
+	if err != nil {
+		t.Fatalf("DependsOn: %s", err)
+	}
+	want := []string{"flow.yaml", "flow_matrix.yaml"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DependsOn got: %v, want: %v", got, want)
+	}
+}
+
+func TestWaitingFor(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	pm, err := progress.NewMonitor(filepath.Join(tmpDir, "build", "progress"))
+	if err != nil {
+		t.Fatalf("progress.NewMonitor: %s", err)
+	}
+	e := &Experiment{DependsOn: []string{"flow.yaml", "flow_matrix.yaml"}}
+	cellA := "flow_matrix.yaml (group: a)"
+	cellB := "flow_matrix.yaml (group: b)"
+
+	steps := []struct {
+		update func()
+		want   []string
+	}{
+		{update: func() {},
+			want: []string{"flow.yaml", "flow_matrix.yaml"},
+		},
+		{update: func() {
+			pm.AddExperiment("flow.yaml", "", []string{}, "")
+			pm.ReportSuccess("flow.yaml")
+			pm.AddExperiment(cellA, "", []string{}, "")
+			pm.ReportSuccess(cellA)
+			pm.AddExperiment(cellB, "", []string{}, "")
+		},
+			want: []string{"flow_matrix.yaml"},
+		},
+		{update: func() { pm.ReportSuccess(cellB) },
+			want: []string{},
+		},
+		{update: func() { pm.ReportLoadError("flow.yaml", os.ErrNotExist) },
+			want: []string{"flow.yaml"},
+		},
+	}
+	for i, s := range steps {
+		s.update()
+		got := e.WaitingFor(pm)
+		if !reflect.DeepEqual(got, s.want) {
+			t.Errorf("(%d) WaitingFor got: %v, want: %v", i, got, s.want)
+		}
+	}
+}
+
+func TestLoad_seedRules(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	reports := []*report.Report{
+		{Mode: report.Train,
+			Title:              "old",
+			Stamp:              time.Now().Add(-time.Hour),
+			ExperimentFilename: "flow_matrix.yaml (group: a)",
+			Matrix:             &report.Matrix{Filename: "flow_matrix.yaml"},
+			Assessments: []*report.Assessment{
+				{Rule: "height > 5"},
+			},
+		},
+		{Mode: report.Train,
+			Title:              "new a",
+			Stamp:              time.Now(),
+			ExperimentFilename: "flow_matrix.yaml (group: a)",
+			Matrix:             &report.Matrix{Filename: "flow_matrix.yaml"},
+			Assessments: []*report.Assessment{
+				{Rule: "true()"},
+				{Rule: "group == \"a\""},
+				{Rule: "height > 10"},
+			},
+		},
+		{Mode: report.Train,
+			Title:              "new b",
+			Stamp:              time.Now(),
+			ExperimentFilename: "flow_matrix.yaml (group: b)",
+			Matrix:             &report.Matrix{Filename: "flow_matrix.yaml"},
+			Assessments: []*report.Assessment{
+				{Rule: "group == \"a\""},
+				{Rule: "district == \"northcal\""},
+			},
+		},
+		{Mode: report.Test,
+			Title:              "test",
+			Stamp:              time.Now(),
+			ExperimentFilename: "flow_matrix.yaml (group: b)",
+			Matrix:             &report.Matrix{Filename: "flow_matrix.yaml"},
+			Assessments: []*report.Assessment{
+				{Rule: "flow > 2"},
+			},
+		},
+		{Mode: report.Train,
+			Title:              "flow",
+			Stamp:              time.Now(),
+			ExperimentFilename: "flow.yaml",
+			Assessments: []*report.Assessment{
+				{Rule: "flow > 3"},
+			},
+		},
+	}
+	for _, r := range reports {
+		if err := r.WriteJSON(cfg); err != nil {
+			t.Fatalf("WriteJSON: %s", err)
+		}
+	}
+
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow_dependson.yaml"),
+		time.Now(),
+	)
+	e, err := Load(cfg, file)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	defer e.Release()
+	gotRules := make([]string, len(e.Rules))
+	for i, r := range e.Rules {
+		gotRules[i] = r.String()
+	}
+	wantRules := []string{"group == \"a\""}
+	if !reflect.DeepEqual(gotRules, wantRules) {
+		t.Errorf("Load: Rules got: %v, want: %v", gotRules, wantRules)
+	}
+	wantDependsOn := []string{"flow.yaml", "flow_matrix.yaml"}
+	if !reflect.DeepEqual(e.DependsOn, wantDependsOn) {
+		t.Errorf("Load: DependsOn got: %v, want: %v", e.DependsOn, wantDependsOn)
+	}
+}
+
+func TestBestReportRules_noReports(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, false)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{BuildDir: filepath.Join(tmpDir, "build")}
+	got, err := bestReportRules(cfg, "flow.yaml", 3)
+	if err != nil {
+		t.Fatalf("bestReportRules: %s", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("bestReportRules got: %v, want: []", got)
+	}
+}
+
+func TestBestReportRules_otherFiles(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{BuildDir: filepath.Join(tmpDir, "build")}
+	r := &report.Report{
+		Mode:               report.Train,
+		Title:              "flow",
+		Stamp:              time.Now(),
+		ExperimentFilename: "flow.yaml",
+		Assessments: []*report.Assessment{
+			{Rule: "flow > 3"},
+		},
+	}
+	if err := r.WriteJSON(cfg); err != nil {
+		t.Fatalf("WriteJSON: %s", err)
+	}
+	otherFiles := []string{"test_abc.json", "train_abc.json.tmp", "notes.txt"}
+	for _, name := range otherFiles {
+		filename := filepath.Join(cfg.BuildDir, "reports", name)
+		if err := ioutil.WriteFile(filename, []byte("not json"), 0640); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+	}
+	got, err := bestReportRules(cfg, "flow.yaml", 3)
+	if err != nil {
+		t.Fatalf("bestReportRules: %s", err)
+	}
+	want := []string{"flow > 3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bestReportRules got: %v, want: %v", got, want)
+	}
+}
+
+func TestLatestTrainReports_unchangedNotDecoded(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{BuildDir: filepath.Join(tmpDir, "build")}
+	reportsDir := filepath.Join(cfg.BuildDir, "reports")
+	stamp := time.Now()
+	newer := &report.Report{
+		Mode:               report.Train,
+		Title:              "flow newer",
+		Stamp:              stamp,
+		ExperimentFilename: "flow.yaml",
+	}
+	older := &report.Report{
+		Mode:               report.Train,
+		Title:              "flow older",
+		Stamp:              stamp.Add(-time.Hour),
+		ExperimentFilename: "flow.yaml",
+	}
+	for _, r := range []*report.Report{newer, older} {
+		if err := r.WriteJSON(cfg); err != nil {
+			t.Fatalf("WriteJSON: %s", err)
+		}
+	}
+	assertLatestTitle := func(want string) {
+		latest, err := latestTrainReports(cfg, "flow.yaml")
+		if err != nil {
+			t.Fatalf("latestTrainReports: %s", err)
+		}
+		if r, ok := latest["flow.yaml"]; !ok || r.Title != want {
+			t.Fatalf("latestTrainReports got: %v, want title: %s", latest, want)
+		}
+	}
+	assertLatestTitle("flow newer")
+
+	// Corrupt the older report without changing its size or modification
+	// time, so that it would fail to decode if it were read again
+	olderFilename := filepath.Join(
+		reportsDir,
+		internal.MakeBuildFilename("train", "", older.Title),
+	)
+	fi, err := os.Stat(olderFilename)
+	if err != nil {
+		t.Fatalf("Stat: %s", err)
+	}
+	notJSON := []byte(strings.Repeat("x", int(fi.Size())))
+	if err := ioutil.WriteFile(olderFilename, notJSON, 0640); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := os.Chtimes(olderFilename, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatalf("Chtimes: %s", err)
+	}
+	assertLatestTitle("flow newer")
+
+	// A changed report is read again
+	older.Stamp = stamp.Add(time.Hour)
+	if err := older.WriteJSON(cfg); err != nil {
+		t.Fatalf("WriteJSON: %s", err)
+	}
+	modTime := fi.ModTime().Add(time.Minute)
+	if err := os.Chtimes(olderFilename, modTime, modTime); err != nil {
+		t.Fatalf("Chtimes: %s", err)
+	}
+	assertLatestTitle("flow older")
+}
@@ -0,0 +1,142 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package experiment
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/internal/dataset/djoin"
+	"github.com/vlifesystems/rulehunter/internal/dataset/dnull"
+)
+
+// errDescribeOnly indicates that a dataset only describes the fields of
+// another dataset and so can't be opened
+var errDescribeOnly = errors.New("dataset only has its fields described")
+
+// fieldsDataset is a Dataset that has fields but no records
+type fieldsDataset struct {
+	fields []string
+}
+
+func (d fieldsDataset) Open() (ddataset.Conn, error) {
+	return nil, errDescribeOnly
+}
+
+func (d fieldsDataset) Fields() []string {
+	return d.fields
+}
+
+func (d fieldsDataset) NumRecords() int64 {
+	return -1
+}
+
+func (d fieldsDataset) Release() error {
+	return nil
+}
+
+// describeDataset returns a dataset with the fields of the dataset
+// described by dd.  The description is checked as it would be by
+// makeDataset, but no data is read, commands aren't run, sql queries
+// only have their columns inferred and nothing is written to the build
+// directory.
+func describeDataset(
+	cfg *config.Config,
+	dd *datasetDesc,
+) (ddataset.Dataset, error) {
+	dataset, err := describeSourceDataset(cfg, dd)
+	if err != nil {
+		return nil, err
+	}
+	for i, jd := range dd.Joins {
+		if jd == nil {
+			return nil, fmt.Errorf("joins: %d: missing dataset", i)
+		}
+		if dataset, err = describeJoinDataset(cfg, jd, dataset); err != nil {
+			return nil, fmt.Errorf("joins: %d: %s", i, err)
+		}
+	}
+	dataset, err = makeStagesDataset(cfg, dd, dataset)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]string, 0, len(dataset.Fields()))
+	for _, f := range dataset.Fields() {
+		if f != dnull.MarkField {
+			fields = append(fields, f)
+		}
+	}
+	return fieldsDataset{fields: fields}, nil
+}
+
+// describeSourceDataset returns a dataset with the fields of the source
+// described by dd.  Commands have the fields listed by dd as finding
+// any others would mean running the command.
+func describeSourceDataset(
+	cfg *config.Config,
+	dd *datasetDesc,
+) (ddataset.Dataset, error) {
+	if dd.Command != nil && len(dd.sources()) == 1 {
+		if _, err := dd.Command.spec(cfg, dd.Fields); err != nil {
+			return nil, err
+		}
+		return fieldsDataset{fields: dd.Fields}, nil
+	}
+	source, err := makeSourceDataset(cfg, dd)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Release()
+	return fieldsDataset{fields: source.Fields()}, nil
+}
+
+// describeJoinDataset returns a dataset with the fields of dataset once
+// it has been joined as described by jd
+func describeJoinDataset(
+	cfg *config.Config,
+	jd *joinDesc,
+	dataset ddataset.Dataset,
+) (ddataset.Dataset, error) {
+	kind, err := jd.check(dataset.Fields())
+	if err != nil {
+		return nil, err
+	}
+	lookup, err := describeDataset(cfg, jd.Dataset.asLookup())
+	if err != nil {
+		return nil, fmt.Errorf("dataset: %s", err)
+	}
+	spec, err := jd.spec(kind, dataset.Fields(), lookup.Fields())
+	if err != nil {
+		return nil, err
+	}
+	return djoin.New(dataset, lookup, spec), nil
+}
+
+// setDescribeOnly marks the datasets of d so that when an experiment is
+// made from it only the fields of its datasets are found, and its
+// rulesFrom so that the reports of other experiments aren't read
+func (d *descFile) setDescribeOnly() {
+	datasets := []*datasetDesc{d.Dataset}
+	if d.Train != nil {
+		datasets = append(datasets, d.Train.Dataset)
+	}
+	if d.Test != nil {
+		datasets = append(datasets, d.Test.Dataset)
+	}
+	if d.CrossValidation != nil {
+		datasets = append(datasets, d.CrossValidation.Dataset)
+	}
+	for _, dd := range datasets {
+		if dd != nil {
+			dd.isDescribeOnly = true
+		}
+	}
+	for _, rd := range d.RulesFrom {
+		if rd != nil {
+			rd.isDescribeOnly = true
+		}
+	}
+}
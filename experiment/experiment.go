@@ -10,6 +10,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/vlifesystems/rhkit/aggregator"
 	rhkassessment "github.com/vlifesystems/rhkit/assessment"
@@ -17,35 +18,64 @@ import (
 	"github.com/vlifesystems/rhkit/rule"
 	"github.com/vlifesystems/rulehunter/config"
 	"github.com/vlifesystems/rulehunter/fileinfo"
+	"github.com/vlifesystems/rulehunter/internal/dataset/dsplit"
+	"github.com/vlifesystems/rulehunter/internal/include"
 	"github.com/vlifesystems/rulehunter/logger"
 	"github.com/vlifesystems/rulehunter/progress"
 	"github.com/vlifesystems/rulehunter/quitter"
+	"github.com/vlifesystems/rulehunter/report"
 	"gopkg.in/yaml.v2"
 )
 
 type Experiment struct {
-	Title       string
-	File        fileinfo.FileInfo
-	Train       *TrainMode
-	Test        *TestMode
-	Aggregators []aggregator.Spec
-	Goals       []*goal.Goal
-	SortOrder   []rhkassessment.SortOrder
-	Category    string
-	Tags        []string
-	Rules       []rule.Rule
+	Title           string
+	File            fileinfo.FileInfo
+	Train           *TrainMode
+	Test            *TestMode
+	CrossValidation *CrossValidationMode
+	Aggregators     []aggregator.Spec
+	Goals           []*goal.Goal
+	SortOrder       []rhkassessment.SortOrder
+	Category        string
+	Tags            []string
+	Rules           []rule.Rule
+	// Matrix is the combination of matrix values that the experiment was
+	// expanded from, nil if its file doesn't have a matrix
+	Matrix *report.Matrix
+	// DependsOn is the experiment files that must be processed
+	// successfully before the experiment is processed
+	DependsOn []string
+	// Values resolved when interpolating the experiment file
+	secrets secrets
 }
 
 type descFile struct {
-	Title       string             `yaml:"title"`
-	Category    string             `yaml:"category"`
-	Tags        []string           `yaml:"tags"`
-	Train       *trainModeDesc     `yaml:"train"`
-	Test        *testModeDesc      `yaml:"test"`
-	Aggregators []*aggregator.Desc `yaml:"aggregators"`
-	Goals       []string           `yaml:"goals"`
-	SortOrder   []sortDesc         `yaml:"sortOrder"`
-	Rules       []string           `yaml:"rules"`
+	Title           string                   `yaml:"title"`
+	Category        string                   `yaml:"category"`
+	Tags            []string                 `yaml:"tags"`
+	Train           *trainModeDesc           `yaml:"train"`
+	Test            *testModeDesc            `yaml:"test"`
+	CrossValidation *crossValidationModeDesc `yaml:"crossValidation"`
+	Dataset         *datasetDesc             `yaml:"dataset"`
+	Split           *splitDesc               `yaml:"split"`
+	Aggregators     []*aggregator.Desc       `yaml:"aggregators"`
+	Goals           []string                 `yaml:"goals"`
+	SortOrder       []sortDesc               `yaml:"sortOrder"`
+	Rules           []string                 `yaml:"rules"`
+	// RulesFrom lists the rules files and experiment reports to load
+	// more rules from
+	RulesFrom []*rulesFromDesc `yaml:"rulesFrom"`
+	// Include lists the fragments, relative to the library directory,
+	// that are merged with the rest of the file
+	Include []string `yaml:"include"`
+	// Matrix maps variables to the values that the file is expanded
+	// with, one experiment for each combination of values
+	Matrix map[string][]string `yaml:"matrix"`
+	// DependsOn lists the experiment files that must be processed
+	// successfully before this one
+	DependsOn []*dependsOnDesc `yaml:"dependsOn"`
+	// FileFormatVersion is ignored but allowed for older experiment files
+	FileFormatVersion string `yaml:"fileFormatVersion"`
 }
 
 type sortDesc struct {
@@ -77,11 +107,24 @@ func newExperiment(
 ) (*Experiment, error) {
 	var train *TrainMode
 	var test *TestMode
+	var crossValidation *CrossValidationMode
 	var err error
 
 	if err := d.checkValid(); err != nil {
 		return nil, err
 	}
+	if d.Split != nil {
+		source := newSplitSource()
+		if d.Train != nil {
+			d.Train.Dataset = d.Dataset.withSplit(d.Split, dsplit.Train, source)
+		}
+		if d.Test != nil {
+			d.Test.Dataset = d.Dataset.withSplit(d.Split, dsplit.Test, source)
+		}
+	}
+	if d.CrossValidation != nil && d.CrossValidation.Dataset == nil {
+		d.CrossValidation.Dataset = d.Dataset
+	}
 
 	allFields := []string{}
 
@@ -97,6 +140,14 @@ func newExperiment(
 	if err != nil {
 		return nil, fmt.Errorf("experiment field: sortOrder: %s", err)
 	}
+	dependsOn, err := makeDependsOn(d.DependsOn)
+	if err != nil {
+		return nil, fmt.Errorf("experiment field: dependsOn: %s", err)
+	}
+	seedRules, err := makeSeedRules(cfg, d.DependsOn)
+	if err != nil {
+		return nil, fmt.Errorf("experiment field: dependsOn: %s", err)
+	}
 
 	if d.Train != nil {
 		train, err = newTrainMode(
@@ -119,27 +170,174 @@ func newExperiment(
 		}
 		allFields = append(allFields, d.Test.Dataset.Fields...)
 	}
+	if d.CrossValidation != nil {
+		crossValidation, err = newCrossValidationMode(cfg, d.CrossValidation)
+		if err != nil {
+			return nil, fmt.Errorf("experiment field: crossValidation: %s", err)
+		}
+	}
 
-	rules, err := rule.MakeDynamicRules(d.Rules)
+	rules, err := makeRules(d.Rules)
 	if err != nil {
 		return nil, fmt.Errorf("experiment field: rules: %s", err)
 	}
+	rulesFrom, err := makeRulesFrom(cfg, d.RulesFrom)
+	if err != nil {
+		return nil, fmt.Errorf("experiment field: rulesFrom: %s", err)
+	}
+	rules = appendNewRules(rules, rulesFrom...)
+	rules = appendNewRules(rules, seedRules...)
 
 	return &Experiment{
-		Title:       d.Title,
-		File:        file,
-		Train:       train,
-		Test:        test,
-		Aggregators: aggregators,
-		Goals:       goals,
-		SortOrder:   sortOrder,
-		Tags:        d.Tags,
-		Category:    d.Category,
-		Rules:       rules,
+		Title:           d.Title,
+		File:            file,
+		Train:           train,
+		Test:            test,
+		CrossValidation: crossValidation,
+		Aggregators:     aggregators,
+		Goals:           goals,
+		SortOrder:       sortOrder,
+		Tags:            d.Tags,
+		Category:        d.Category,
+		Rules:           rules,
+		DependsOn:       dependsOn,
 	}, nil
 }
 
+// File is an experiment file whose experiments are loaded one at a
+// time, so that only the datasets of the experiment being processed
+// need to exist.  There is one experiment for each combination of the
+// values of the variables in the file's matrix, or just one if it
+// doesn't have a matrix.
+type File struct {
+	cfg        *config.Config
+	pm         *progress.Monitor
+	expansions []expansion
+}
+
+// ReadFile reads the experiment file, resolving any includes and
+// expanding any matrix, without loading its experiments.  pm is used
+// as with LoadWithProgress.
+func ReadFile(
+	cfg *config.Config,
+	file fileinfo.FileInfo,
+	pm *progress.Monitor,
+) (*File, error) {
+	expansions, err := loadExpansions(cfg, file)
+	if err != nil {
+		return nil, err
+	}
+	return &File{cfg: cfg, pm: pm, expansions: expansions}, nil
+}
+
+// NumExperiments returns the number of experiments in the file
+func (f *File) NumExperiments() int {
+	return len(f.expansions)
+}
+
+// Name returns the name of the file of experiment i, which includes
+// its matrix values if the file has a matrix
+func (f *File) Name(i int) string {
+	return f.expansions[i].file.Name()
+}
+
+// Load loads experiment i of the file.  Each experiment should only be
+// loaded once.
+func (f *File) Load(i int) (*Experiment, error) {
+	return loadExpansion(f.cfg, f.expansions[i], f.pm)
+}
+
+// Load loads the experiment in file as if it had never been run.  If
+// file has a matrix only the experiment for the first combination of its
+// values is loaded, use ReadFile or LoadAll to load the others.
 func Load(cfg *config.Config, file fileinfo.FileInfo) (*Experiment, error) {
+	return LoadWithProgress(cfg, file, nil)
+}
+
+// LoadWithProgress loads the experiment in file as Load does.  pm is
+// used to find out when the experiment was last run to set the
+// parameters of sql queries, if it is nil the experiment is treated as
+// never having been run.
+func LoadWithProgress(
+	cfg *config.Config,
+	file fileinfo.FileInfo,
+	pm *progress.Monitor,
+) (*Experiment, error) {
+	f, err := ReadFile(cfg, file, pm)
+	if err != nil {
+		return nil, err
+	}
+	return f.Load(0)
+}
+
+// LoadAll loads all the experiments in file, see File.  As each
+// experiment's datasets are made when it is loaded ReadFile should be
+// used if the experiments are to be processed.  pm is used as with
+// LoadWithProgress.
+func LoadAll(
+	cfg *config.Config,
+	file fileinfo.FileInfo,
+	pm *progress.Monitor,
+) ([]*Experiment, error) {
+	f, err := ReadFile(cfg, file, pm)
+	if err != nil {
+		return nil, err
+	}
+	es := make([]*Experiment, 0, f.NumExperiments())
+	for i, x := range f.expansions {
+		e, err := f.Load(i)
+		if err != nil {
+			for _, e := range es {
+				e.Release()
+			}
+			if x.matrix != nil {
+				return nil, fmt.Errorf("(%s) %s", x.cell, err)
+			}
+			return nil, err
+		}
+		es = append(es, e)
+	}
+	return es, nil
+}
+
+// loadExpansion creates the experiment described by x
+func loadExpansion(
+	cfg *config.Config,
+	x expansion,
+	pm *progress.Monitor,
+) (*Experiment, error) {
+	d := x.desc
+	ip := &interpolator{}
+	if err := d.interpolate(ip); err != nil {
+		return nil, ip.secrets.redactError(err)
+	}
+	file := x.file
+	isFinished, stamp := false, time.Now()
+	if pm != nil {
+		dependsOn, err := makeDependsOn(d.DependsOn)
+		if err != nil {
+			return nil, fmt.Errorf("experiment field: dependsOn: %s", err)
+		}
+		file = dependsOnFileInfo(pm, file, dependsOn)
+		isFinished, stamp = pm.GetFinishStamp(file.Name())
+	}
+	isFinished, stamp = runStatus(file, isFinished, stamp)
+	d.setSQLParams(makeSQLParams(time.Now(), isFinished, stamp))
+	e, err := newExperiment(cfg, file, d)
+	if err != nil {
+		return nil, ip.secrets.redactError(err)
+	}
+	e.Matrix = x.matrix
+	e.secrets = ip.secrets
+	return e, nil
+}
+
+// loadExpansions returns the experiment descriptions in file, resolving
+// any includes and expanding any matrix
+func loadExpansions(
+	cfg *config.Config,
+	file fileinfo.FileInfo,
+) ([]expansion, error) {
 	var d *descFile
 	var err error
 	fullFilename := filepath.Join(cfg.ExperimentsDir, file.Name())
@@ -156,12 +354,26 @@ func Load(cfg *config.Config, file fileinfo.FileInfo) (*Experiment, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(d.Include) == 0 && len(d.Matrix) == 0 {
+		return []expansion{{file: file, desc: d}}, nil
+	}
 
-	return newExperiment(cfg, file, d)
+	doc, d, file, err := resolveIncludes(cfg, file, fullFilename)
+	if err != nil {
+		return nil, fmt.Errorf("experiment field: include: %s", err)
+	}
+	if len(d.Matrix) == 0 {
+		return []expansion{{file: file, desc: d}}, nil
+	}
+	expansions, err := expandMatrix(doc, d.Matrix, file, ext)
+	if err != nil {
+		return nil, fmt.Errorf("experiment field: matrix: %s", err)
+	}
+	return expansions, nil
 }
 
 func (e *Experiment) Release() error {
-	modes := []Mode{e.Train, e.Test}
+	modes := []Mode{e.Train, e.Test, e.CrossValidation}
 	for _, m := range modes {
 		if m != nil {
 			if err := m.Release(); err != nil {
@@ -207,6 +419,7 @@ func (e *Experiment) Process(
 	}
 
 	reportError := func(err error) error {
+		err = e.secrets.redactError(err)
 		pmErr := pm.AddExperiment(e.File.Name(), e.Title, e.Tags, e.Category)
 		if pmErr != nil {
 			return l.Error(pmErr)
@@ -223,7 +436,13 @@ func (e *Experiment) Process(
 	isFinished, stamp := pm.GetFinishStamp(e.File.Name())
 
 	if e.Train != nil {
-		ok, err := shouldProcessMode(e.Train.when, e.File, isFinished, stamp)
+		ok, err := shouldProcessMode(
+			e.Train.when,
+			e.File,
+			isFinished,
+			stamp,
+			e.Train.hasNewRows,
+		)
 		if err != nil {
 			return reportError(err)
 		}
@@ -243,7 +462,13 @@ func (e *Experiment) Process(
 	}
 
 	if e.Test != nil {
-		ok, err := shouldProcessMode(e.Test.when, e.File, isFinished, stamp)
+		ok, err := shouldProcessMode(
+			e.Test.when,
+			e.File,
+			isFinished,
+			stamp,
+			e.Test.hasNewRows,
+		)
 		if err != nil {
 			return reportError(err)
 		}
@@ -260,6 +485,31 @@ func (e *Experiment) Process(
 		}
 	}
 
+	if e.CrossValidation != nil {
+		ok, err := shouldProcessMode(
+			e.CrossValidation.when,
+			e.File,
+			isFinished,
+			stamp,
+			e.CrossValidation.hasNewRows,
+		)
+		if err != nil {
+			return reportError(err)
+		}
+		if ok || ignoreWhen {
+			if err := reportProcessing("crossvalidation"); err != nil {
+				return err
+			}
+			err := e.CrossValidation.Process(e, cfg, pm, q, e.Rules)
+			if err != nil {
+				return reportError(err)
+			}
+			if err := reportSuccess("crossvalidation"); err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -290,6 +540,48 @@ func loadYAML(filename string) (*descFile, error) {
 	return &e, nil
 }
 
+// resolveIncludes returns the document in filename merged with the
+// fragments it includes, its decoded description and file with its
+// ModTime set to the latest of those files so that the experiment is
+// rerun if a fragment changes
+func resolveIncludes(
+	cfg *config.Config,
+	file fileinfo.FileInfo,
+	filename string,
+) (include.Doc, *descFile, fileinfo.FileInfo, error) {
+	doc, files, err := include.Resolve(filename, cfg.LibraryDir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	d, err := decodeDoc(doc, filepath.Ext(filename))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	file, err = include.FileInfo(file, files)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return doc, d, file, nil
+}
+
+// decodeDoc decodes doc using the format given by the extension ext
+func decodeDoc(doc include.Doc, ext string) (*descFile, error) {
+	var d descFile
+	b, err := include.Marshal(doc, ext)
+	if err != nil {
+		return nil, err
+	}
+	if ext == ".json" {
+		err = json.Unmarshal(b, &d)
+	} else {
+		err = yaml.Unmarshal(b, &d)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
 func makeSortOrder(
 	aggregators []aggregator.Spec,
 	sortDescs []sortDesc,
@@ -306,13 +598,73 @@ func makeSortOrder(
 	return r, nil
 }
 
+// fieldDataset is a dataset description along with the experiment
+// field that it came from
+type fieldDataset struct {
+	field string
+	desc  *datasetDesc
+}
+
+// datasets returns the dataset descriptions in the experiment
+func (e *descFile) datasets() []fieldDataset {
+	datasets := []fieldDataset{}
+	add := func(field string, desc *datasetDesc) {
+		if desc != nil {
+			datasets = append(datasets, fieldDataset{field, desc})
+		}
+	}
+	add("dataset", e.Dataset)
+	if e.Train != nil {
+		add("train: dataset", e.Train.Dataset)
+	}
+	if e.Test != nil {
+		add("test: dataset", e.Test.Dataset)
+	}
+	if e.CrossValidation != nil {
+		add("crossValidation: dataset", e.CrossValidation.Dataset)
+	}
+	return datasets
+}
+
+// interpolate resolves environment variable and secret file references
+// in the dataset sources.  Only the sources are interpolated so that
+// secrets can't end up in reports.
+func (e *descFile) interpolate(ip *interpolator) error {
+	for _, d := range e.datasets() {
+		if err := d.desc.interpolate(ip); err != nil {
+			return fmt.Errorf("experiment field: %s: %s", d.field, err)
+		}
+	}
+	return nil
+}
+
+// setSQLParams sets the parameters used by sql queries of the datasets
+func (e *descFile) setSQLParams(params map[string]interface{}) {
+	for _, d := range e.datasets() {
+		d.desc.setSQLParams(params)
+	}
+}
+
 func (e *descFile) checkValid() error {
 	if len(e.Title) == 0 {
 		return errors.New("experiment missing: title")
 	}
-	if e.Train == nil && e.Test == nil {
+	if e.Train == nil && e.Test == nil && e.CrossValidation == nil {
+		return errors.New(
+			"experiment missing either: train, test or crossValidation",
+		)
+	}
+	if e.CrossValidation != nil {
+		if err := e.checkCrossValidationValid(); err != nil {
+			return err
+		}
+	}
+	if e.Split != nil {
+		return e.checkSplitValid()
+	}
+	if e.Dataset != nil && e.CrossValidation == nil {
 		return errors.New(
-			"experiment missing either: train or test",
+			"experiment field: dataset: can only be used with split or crossValidation",
 		)
 	}
 	if e.Train != nil {
@@ -331,3 +683,49 @@ func (e *descFile) checkValid() error {
 	}
 	return nil
 }
+
+func (e *descFile) checkSplitValid() error {
+	if e.Dataset == nil {
+		return errors.New("experiment field: split: missing dataset")
+	}
+	if e.Train != nil && e.Train.Dataset != nil {
+		return errors.New(
+			"experiment field: train: can't specify dataset with split",
+		)
+	}
+	if e.Test != nil && e.Test.Dataset != nil {
+		return errors.New(
+			"experiment field: test: can't specify dataset with split",
+		)
+	}
+	if e.Split.Holdout <= 0 || e.Split.Holdout >= 1 {
+		return errors.New(
+			"experiment field: split: holdout: must be between 0 and 1",
+		)
+	}
+	if e.Split.Stratify != "" && e.Split.TimeField != "" {
+		return errors.New(
+			"experiment field: split: can't specify stratify and timeField",
+		)
+	}
+	return nil
+}
+
+func (e *descFile) checkCrossValidationValid() error {
+	if e.CrossValidation.Dataset == nil && e.Dataset == nil {
+		return errors.New(
+			"experiment field: crossValidation: missing dataset",
+		)
+	}
+	if e.CrossValidation.Dataset != nil && e.Dataset != nil {
+		return errors.New(
+			"experiment field: crossValidation: can't specify dataset with experiment dataset",
+		)
+	}
+	if e.CrossValidation.NumFolds != 0 && e.CrossValidation.NumFolds < 2 {
+		return errors.New(
+			"experiment field: crossValidation: numFolds: must be at least 2",
+		)
+	}
+	return nil
+}
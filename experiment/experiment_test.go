@@ -28,6 +28,7 @@ import (
 	"github.com/vlifesystems/rulehunter/internal/testhelpers"
 	"github.com/vlifesystems/rulehunter/progress"
 	"github.com/vlifesystems/rulehunter/quitter"
+	"github.com/vlifesystems/rulehunter/report"
 )
 
 func TestLoad(t *testing.T) {
@@ -316,12 +317,12 @@ func TestLoad_error(t *testing.T) {
 			filepath.Join("fixtures", "flow_no_train_or_test.json"),
 			time.Now(),
 		),
-			errors.New("experiment missing either: train or test")},
+			errors.New("experiment missing either: train, test or crossValidation")},
 		{testhelpers.NewFileInfo(
 			filepath.Join("fixtures", "flow_no_csv_sql.json"),
 			time.Now(),
 		),
-			errors.New("experiment field: train: dataset: has no csv or sql field")},
+			errors.New("experiment field: train: dataset: has no csv, sql, jsonl, parquet, arrow, xlsx, fixedWidth or command field")},
 		{testhelpers.NewFileInfo(
 			filepath.Join("fixtures", "flow_no_csv_filename.json"),
 			time.Now(),
@@ -332,6 +333,149 @@ func TestLoad_error(t *testing.T) {
 			time.Now(),
 		),
 			errors.New("experiment field: train: dataset: csv: missing separator")},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_no_jsonl_filename.json"),
+			time.Now(),
+		),
+			errors.New("experiment field: train: dataset: jsonl: missing filename")},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_no_parquet_filename.json"),
+			time.Now(),
+		),
+			errors.New("experiment field: train: dataset: parquet: missing filename")},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_no_arrow_filename.json"),
+			time.Now(),
+		),
+			errors.New("experiment field: train: dataset: arrow: missing filename")},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_no_xlsx_filename.json"),
+			time.Now(),
+		),
+			errors.New("experiment field: train: dataset: xlsx: missing filename")},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_xlsx_invalid_range.json"),
+			time.Now(),
+		),
+			errors.New(
+				"experiment field: train: dataset: xlsx: invalid range: B3",
+			),
+		},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_no_fixedwidth_filename.json"),
+			time.Now(),
+		),
+			errors.New("experiment field: train: dataset: fixedWidth: missing filename")},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_fixedwidth_missing_column.json"),
+			time.Now(),
+		),
+			errors.New(
+				"experiment field: train: dataset: fixedWidth: columns: flow: missing",
+			),
+		},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_jsonl_unknown_field.json"),
+			time.Now(),
+		),
+			errors.New(
+				"experiment field: train: dataset: jsonl: fieldPaths: unknown field: region",
+			),
+		},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_csv_glob_no_match.yaml"),
+			time.Now(),
+		),
+			errors.New(
+				"experiment field: train: dataset: csv: filename: no files match: fixtures/calls-2017-*.csv",
+			),
+		},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_csv_header_mismatch.yaml"),
+			time.Now(),
+		),
+			errors.New(
+				"experiment field: train: dataset: header of fixtures/calls-2026-01-03.csv: group,district,height, doesn't match header of fixtures/calls-2026-01-01.csv: group,district,height,flow",
+			),
+		},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_derived_clash.yaml"),
+			time.Now(),
+		),
+			errors.New(
+				"experiment field: train: dataset: derivedFields: flow: clashes with field",
+			),
+		},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_split_no_dataset.yaml"),
+			time.Now(),
+		),
+			errors.New(
+				"experiment field: split: missing dataset",
+			),
+		},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_split_train_dataset.yaml"),
+			time.Now(),
+		),
+			errors.New(
+				"experiment field: train: can't specify dataset with split",
+			),
+		},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_split_invalid_holdout.yaml"),
+			time.Now(),
+		),
+			errors.New(
+				"experiment field: split: holdout: must be between 0 and 1",
+			),
+		},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_split_stratify_timefield.yaml"),
+			time.Now(),
+		),
+			errors.New(
+				"experiment field: split: can't specify stratify and timeField",
+			),
+		},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_split_unknown_field.yaml"),
+			time.Now(),
+		),
+			errors.New(
+				"experiment field: train: dataset: split: unknown field: region",
+			),
+		},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_dataset_no_split.yaml"),
+			time.Now(),
+		),
+			errors.New(
+				"experiment field: dataset: can only be used with split or crossValidation",
+			),
+		},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_crossvalidation_no_dataset.yaml"),
+			time.Now(),
+		),
+			errors.New("experiment field: crossValidation: missing dataset"),
+		},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_crossvalidation_invalid_numfolds.yaml"),
+			time.Now(),
+		),
+			errors.New(
+				"experiment field: crossValidation: numFolds: must be at least 2",
+			),
+		},
+		{testhelpers.NewFileInfo(
+			filepath.Join("fixtures", "flow_crossvalidation_unknown_field.yaml"),
+			time.Now(),
+		),
+			errors.New(
+				"experiment field: crossValidation: stratify: unknown field: region",
+			),
+		},
 		{testhelpers.NewFileInfo(
 			filepath.Join("fixtures", "flow_csv_and_sql.yaml"),
 			time.Now(),
@@ -429,6 +573,79 @@ func TestLoad_error(t *testing.T) {
 	}
 }
 
+func TestLoad_split(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow_split.yaml"),
+		time.Now(),
+	)
+	e, err := Load(cfg, file)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	defer e.Release()
+	trainHeights := datasetHeights(t, e.Train.Dataset())
+	testHeights := datasetHeights(t, e.Test.Dataset())
+	if len(trainHeights) != 6 || len(testHeights) != 3 {
+		t.Errorf("got %d train and %d test records, want: 6 and 3",
+			len(trainHeights), len(testHeights))
+	}
+	for h := range testHeights {
+		if trainHeights[h] {
+			t.Errorf("record with height: %s, in train and test datasets", h)
+		}
+	}
+}
+
+func TestLoad_crossValidation(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow_crossvalidation.yaml"),
+		time.Now(),
+	)
+	e, err := Load(cfg, file)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	defer e.Release()
+	if len(e.CrossValidation.folds) != 3 {
+		t.Fatalf("got %d folds, want: 3", len(e.CrossValidation.folds))
+	}
+	allTestHeights := map[string]bool{}
+	for i, f := range e.CrossValidation.folds {
+		trainHeights := datasetHeights(t, f.train.Dataset())
+		testHeights := datasetHeights(t, f.test.Dataset())
+		if len(trainHeights) != 6 || len(testHeights) != 3 {
+			t.Errorf("fold: %d, got %d train and %d test records, want: 6 and 3",
+				i, len(trainHeights), len(testHeights))
+		}
+		for h := range testHeights {
+			if trainHeights[h] {
+				t.Errorf("fold: %d, record with height: %s, in train and test datasets",
+					i, h)
+			}
+			if allTestHeights[h] {
+				t.Errorf("fold: %d, record with height: %s, in more than one test fold",
+					i, h)
+			}
+			allTestHeights[h] = true
+		}
+	}
+	if len(allTestHeights) != 9 {
+		t.Errorf("got %d records in test folds, want: 9", len(allTestHeights))
+	}
+}
+
 func TestInvalidWhenExprErrorError(t *testing.T) {
 	e := InvalidWhenExprError("has)nothing")
 	want := "when field invalid: has)nothing"
@@ -507,6 +724,75 @@ func TestProcess(t *testing.T) {
 	// TODO: Test files generated
 }
 
+func TestProcess_crossValidation(t *testing.T) {
+	cfgDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(cfgDir)
+	cfg := &config.Config{
+		ExperimentsDir:  filepath.Join(cfgDir, "experiments"),
+		WWWDir:          filepath.Join(cfgDir, "www"),
+		BuildDir:        filepath.Join(cfgDir, "build"),
+		MaxNumRecords:   100,
+		MaxNumProcesses: 4,
+	}
+	testhelpers.CopyFile(
+		t,
+		filepath.Join("fixtures", "flow_crossvalidation.yaml"),
+		cfg.ExperimentsDir,
+	)
+	file := testhelpers.NewFileInfo("flow_crossvalidation.yaml", time.Now())
+
+	quit := quitter.New()
+	defer quit.Quit()
+	pm, err := progress.NewMonitor(
+		filepath.Join(cfg.BuildDir, "progress"),
+	)
+	if err != nil {
+		t.Fatalf("progress.NewMonitor: err: %v", err)
+	}
+	l := testhelpers.NewLogger()
+	go l.Run(quit)
+	e, err := Load(cfg, file)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	defer e.Release()
+	if err := e.Process(cfg, pm, l, quit, false); err != nil {
+		t.Fatalf("Process: %s", err)
+	}
+
+	r, err := report.LoadJSON(
+		cfg,
+		internal.MakeBuildFilename("crossvalidation", e.Category, e.Title),
+	)
+	if err != nil {
+		t.Fatalf("LoadJSON: %s", err)
+	}
+	if r.Mode != report.CrossValidation || r.NumFolds != 3 {
+		t.Errorf("got mode: %s, numFolds: %d, want mode: crossvalidation, numFolds: 3",
+			r.Mode, r.NumFolds)
+	}
+	if len(r.Assessments) == 0 {
+		t.Fatalf("report has no assessments")
+	}
+	for _, a := range r.Assessments {
+		for _, ag := range a.Aggregators {
+			if len(ag.FoldValues) != 3 {
+				t.Errorf("rule: %s, aggregator: %s, got %d fold values, want: 3",
+					a.Rule, ag.Name, len(ag.FoldValues))
+			}
+			// The true rule is assessed on every fold
+			if a.Rule == "true()" {
+				for i, v := range ag.FoldValues {
+					if v == "" {
+						t.Errorf("rule: %s, aggregator: %s, fold: %d has no value",
+							a.Rule, ag.Name, i)
+					}
+				}
+			}
+		}
+	}
+}
+
 func TestProcess_ignoreWhen(t *testing.T) {
 	cfgDir := testhelpers.BuildConfigDirs(t, true)
 	defer os.RemoveAll(cfgDir)
@@ -1207,3 +1493,19 @@ func mustNewDynamicRule(e string) rule.Rule {
 	}
 	return r
 }
+
+func datasetHeights(t *testing.T, ds ddataset.Dataset) map[string]bool {
+	conn, err := ds.Open()
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer conn.Close()
+	heights := map[string]bool{}
+	for conn.Next() {
+		heights[conn.Read()["height"].String()] = true
+	}
+	if err := conn.Err(); err != nil {
+		t.Fatalf("Err: %s", err)
+	}
+	return heights
+}
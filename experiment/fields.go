@@ -0,0 +1,127 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package experiment
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/vlifesystems/rhkit/description"
+)
+
+// makeFieldTypes returns the field types described by types, which maps
+// field names to one of: number, string or ignore
+func makeFieldTypes(
+	types map[string]string,
+	fields []string,
+) (map[string]description.FieldType, error) {
+	r := make(map[string]description.FieldType, len(types))
+	for field, t := range types {
+		if !hasField(fields, field) {
+			return nil, fmt.Errorf("fieldTypes: %s: unknown field", field)
+		}
+		switch t {
+		case "number":
+			r[field] = description.Number
+		case "string":
+			r[field] = description.String
+		case "ignore":
+			r[field] = description.Ignore
+		default:
+			return nil, fmt.Errorf("fieldTypes: %s: invalid type: %s", field, t)
+		}
+	}
+	return r, nil
+}
+
+// applyFieldTypes changes the kind of the fields in desc to their types.
+// A number field can be treated as a string, but a string field can't
+// be treated as a number.
+func applyFieldTypes(
+	desc *description.Description,
+	types map[string]description.FieldType,
+) error {
+	for field, t := range types {
+		fd, ok := desc.Fields[field]
+		if !ok || fd.Kind == t || fd.Kind == description.Unknown {
+			continue
+		}
+		switch t {
+		case description.Ignore:
+			fd.Kind = description.Ignore
+		case description.String:
+			if fd.Kind == description.Number {
+				fd.Kind = description.String
+				// In line with a string field that has too many values to
+				// generate rules from
+				if fd.NumValues == -1 {
+					fd.Kind = description.Ignore
+				}
+			}
+		case description.Number:
+			return fmt.Errorf("fieldTypes: %s: has values that aren't numbers", field)
+		}
+	}
+	return nil
+}
+
+// matchFields returns the fields that match patterns, in the order of
+// patterns and then fields.  A pattern that doesn't contain any of the
+// special characters: *?[ is returned as it is, even if it isn't one of
+// fields.
+func matchFields(patterns []string, fields []string) ([]string, error) {
+	r := []string{}
+	for _, p := range patterns {
+		if !isFieldPattern(p) {
+			if !hasField(r, p) {
+				r = append(r, p)
+			}
+			continue
+		}
+		numMatches := 0
+		for _, f := range fields {
+			ok, err := path.Match(p, f)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern: %s", p)
+			}
+			if ok {
+				numMatches++
+				if !hasField(r, f) {
+					r = append(r, f)
+				}
+			}
+		}
+		if numMatches == 0 {
+			return nil, fmt.Errorf("pattern doesn't match any fields: %s", p)
+		}
+	}
+	return r, nil
+}
+
+// excludeFields returns fields without those that match any of patterns
+func excludeFields(fields []string, patterns []string) ([]string, error) {
+	r := []string{}
+	for _, f := range fields {
+		isExcluded := false
+		for _, p := range patterns {
+			ok, err := path.Match(p, f)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern: %s", p)
+			}
+			if ok {
+				isExcluded = true
+				break
+			}
+		}
+		if !isExcluded {
+			r = append(r, f)
+		}
+	}
+	return r, nil
+}
+
+func isFieldPattern(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
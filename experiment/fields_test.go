@@ -0,0 +1,256 @@
+package experiment
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vlifesystems/rhkit/description"
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+)
+
+func TestMakeDataset_inferFields(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	cases := []struct {
+		desc *datasetDesc
+		want []string
+	}{
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+		},
+			want: []string{"group", "district", "height", "flow"},
+		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			DerivedFields: map[string]string{"isHigh": "height > 100"},
+		},
+			want: []string{"group", "district", "height", "flow", "isHigh"},
+		},
+		{desc: &datasetDesc{
+			SQL: &sqlDesc{
+				DriverName:     "sqlite3",
+				DataSourceName: filepath.Join("fixtures", "flow.db"),
+				Query:          "select grp, district, height from flow",
+			},
+		},
+			want: []string{"grp", "district", "height"},
+		},
+	}
+	for i, c := range cases {
+		d, err := makeDataset(cfg, c.desc)
+		if err != nil {
+			t.Errorf("(%d) makeDataset: %s", i, err)
+			continue
+		}
+		if got := d.Fields(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("(%d) Fields got: %v, want: %v", i, got, c.want)
+		}
+		if n := d.NumRecords(); n != 9 {
+			t.Errorf("(%d) NumRecords got: %d, want: 9", i, n)
+		}
+		if len(c.desc.Fields) != 0 {
+			t.Errorf("(%d) desc.Fields got: %v, want: []", i, c.desc.Fields)
+		}
+		d.Release()
+	}
+}
+
+func TestMakeDataset_inferFields_errors(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	filename := filepath.Join(tmpDir, "empty.csv")
+	if err := ioutil.WriteFile(filename, []byte{}, 0600); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	dd := &datasetDesc{
+		CSV: &csvDesc{
+			Filename:  fileList{filename},
+			HasHeader: true,
+			Separator: ",",
+		},
+	}
+	wantErr := filename + ": missing header"
+	_, err := makeDataset(cfg, dd)
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("makeDataset err: %v, want: %s", err, wantErr)
+	}
+}
+
+func TestLoad_inferFields(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow_infer_fields.yaml"),
+		time.Now(),
+	)
+	e, err := Load(cfg, file)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	defer e.Release()
+	wantFields := []string{"group", "district", "height", "flow", "heightM"}
+	if got := e.Train.Dataset().Fields(); !reflect.DeepEqual(got, wantFields) {
+		t.Errorf("Fields got: %v, want: %v", got, wantFields)
+	}
+	wantRuleFields := []string{"group", "height", "heightM"}
+	if got := e.Train.ruleGeneration.Fields(); !reflect.DeepEqual(got, wantRuleFields) {
+		t.Errorf("ruleGeneration.Fields got: %v, want: %v", got, wantRuleFields)
+	}
+	wantFieldTypes := map[string]description.FieldType{
+		"group": description.String,
+	}
+	if got := e.Train.ruleGeneration.fieldTypes; !reflect.DeepEqual(got, wantFieldTypes) {
+		t.Errorf("ruleGeneration.fieldTypes got: %v, want: %v",
+			got, wantFieldTypes)
+	}
+}
+
+func TestMakeRuleGeneration(t *testing.T) {
+	fields := []string{"group", "district", "height", "heightM", "flow"}
+	cases := []struct {
+		desc ruleGenerationDesc
+		want []string
+	}{
+		{desc: ruleGenerationDesc{Fields: []string{"group", "height"}},
+			want: []string{"group", "height"},
+		},
+		{desc: ruleGenerationDesc{Fields: []string{"height", "group"}},
+			want: []string{"height", "group"},
+		},
+		{desc: ruleGenerationDesc{Fields: []string{"*"}},
+			want: fields,
+		},
+		{desc: ruleGenerationDesc{Fields: []string{"flow", "height*"}},
+			want: []string{"flow", "height", "heightM"},
+		},
+		{desc: ruleGenerationDesc{
+			Fields:  []string{"*"},
+			Exclude: []string{"flow", "*M"},
+		},
+			want: []string{"group", "district", "height"},
+		},
+		{desc: ruleGenerationDesc{
+			Fields:  []string{"group", "g*"},
+			Exclude: []string{"region"},
+		},
+			want: []string{"group"},
+		},
+	}
+	for i, c := range cases {
+		got, err := makeRuleGeneration(c.desc, &datasetDesc{}, fields)
+		if err != nil {
+			t.Errorf("(%d) makeRuleGeneration: %s", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Fields(), c.want) {
+			t.Errorf("(%d) Fields got: %v, want: %v", i, got.Fields(), c.want)
+		}
+	}
+}
+
+func TestMakeRuleGeneration_errors(t *testing.T) {
+	fields := []string{"group", "district", "height", "flow"}
+	cases := []struct {
+		desc       ruleGenerationDesc
+		fieldTypes map[string]string
+		wantErr    string
+	}{
+		{desc: ruleGenerationDesc{Fields: []string{"region_*"}},
+			wantErr: "ruleGeneration: fields: " +
+				"pattern doesn't match any fields: region_*",
+		},
+		{desc: ruleGenerationDesc{Fields: []string{"[a-"}},
+			wantErr: "ruleGeneration: fields: invalid pattern: [a-",
+		},
+		{desc: ruleGenerationDesc{
+			Fields:  []string{"*"},
+			Exclude: []string{"[a-"},
+		},
+			wantErr: "ruleGeneration: exclude: invalid pattern: [a-",
+		},
+		{desc: ruleGenerationDesc{Fields: []string{"*"}},
+			fieldTypes: map[string]string{"region": "string"},
+			wantErr:    "dataset: fieldTypes: region: unknown field",
+		},
+		{desc: ruleGenerationDesc{Fields: []string{"*"}},
+			fieldTypes: map[string]string{"height": "date"},
+			wantErr:    "dataset: fieldTypes: height: invalid type: date",
+		},
+	}
+	for i, c := range cases {
+		dd := &datasetDesc{FieldTypes: c.fieldTypes}
+		_, err := makeRuleGeneration(c.desc, dd, fields)
+		if err == nil || err.Error() != c.wantErr {
+			t.Errorf("(%d) makeRuleGeneration err: %v, want: %s", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestApplyFieldTypes(t *testing.T) {
+	newDesc := func() *description.Description {
+		return &description.Description{
+			Fields: map[string]*description.Field{
+				"zip":      {Kind: description.Number, NumValues: 3},
+				"id":       {Kind: description.Number, NumValues: -1},
+				"district": {Kind: description.String, NumValues: 3},
+				"empty":    {Kind: description.Unknown},
+			},
+		}
+	}
+	types := map[string]description.FieldType{
+		"zip":      description.String,
+		"id":       description.String,
+		"district": description.Ignore,
+		"empty":    description.Number,
+	}
+	want := map[string]description.FieldType{
+		"zip":      description.String,
+		"id":       description.Ignore,
+		"district": description.Ignore,
+		"empty":    description.Unknown,
+	}
+	desc := newDesc()
+	if err := applyFieldTypes(desc, types); err != nil {
+		t.Fatalf("applyFieldTypes: %s", err)
+	}
+	for field, kind := range want {
+		if got := desc.Fields[field].Kind; got != kind {
+			t.Errorf("field: %s, Kind got: %s, want: %s", field, got, kind)
+		}
+	}
+
+	desc = newDesc()
+	wantErr := "fieldTypes: district: has values that aren't numbers"
+	err := applyFieldTypes(
+		desc,
+		map[string]description.FieldType{"district": description.Number},
+	)
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("applyFieldTypes err: %v, want: %s", err, wantErr)
+	}
+}
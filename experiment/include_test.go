@@ -0,0 +1,114 @@
+package experiment
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+)
+
+func TestLoad_include(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	libraryDir := filepath.Join(tmpDir, "library")
+	if err := os.Mkdir(libraryDir, 0700); err != nil {
+		t.Fatalf("Mkdir: %s", err)
+	}
+	for _, name := range []string{"flow_dataset.yaml", "flow_goals.yaml"} {
+		testhelpers.CopyFile(
+			t,
+			filepath.Join("fixtures", "library", name),
+			libraryDir,
+		)
+	}
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+		LibraryDir:    libraryDir,
+	}
+	fileModTime := time.Now().Add(time.Hour)
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow_include.yaml"),
+		fileModTime,
+	)
+	e, err := Load(cfg, file)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+
+	if e.Title != "What would indicate good flow?" {
+		t.Errorf("Title got: %s", e.Title)
+	}
+	wantAggregators := []string{
+		"goodFlowMcc mcc flow > 60",
+		"numHigh count height > 120",
+		"meanFlow mean flow",
+	}
+	// Skip the built-in aggregators at the start and end
+	gotAggregators := []string{}
+	for _, a := range e.Aggregators[2 : len(e.Aggregators)-1] {
+		gotAggregators = append(gotAggregators,
+			fmt.Sprintf("%s %s %s", a.Name(), a.Kind(), a.Arg()))
+	}
+	if !reflect.DeepEqual(gotAggregators, wantAggregators) {
+		t.Errorf("Aggregators got: %v, want: %v", gotAggregators, wantAggregators)
+	}
+	if len(e.Goals) != 1 || e.Goals[0].String() != "goodFlowMcc > 0.5" {
+		t.Errorf("Goals got: %v, want: [goodFlowMcc > 0.5]", e.Goals)
+	}
+	if len(e.SortOrder) != 1 || e.SortOrder[0].Aggregator != "goodFlowMcc" {
+		t.Errorf("SortOrder got: %v", e.SortOrder)
+	}
+	wantRuleFields := []string{"group", "height"}
+	if got := e.Train.ruleGeneration.Fields(); !reflect.DeepEqual(got, wantRuleFields) {
+		t.Errorf("ruleGeneration.Fields got: %v, want: %v", got, wantRuleFields)
+	}
+	if n := len(datasetHeights(t, e.Train.Dataset())); n != 9 {
+		t.Errorf("got %d records, want: 9", n)
+	}
+	if !e.File.ModTime().Equal(fileModTime) {
+		t.Errorf("File.ModTime got: %s, want: %s", e.File.ModTime(), fileModTime)
+	}
+	e.Release()
+
+	// An experiment is changed if a file it includes is changed
+	later := fileModTime.Add(time.Hour).Truncate(time.Second)
+	err = os.Chtimes(filepath.Join(libraryDir, "flow_goals.yaml"), later, later)
+	if err != nil {
+		t.Fatalf("Chtimes: %s", err)
+	}
+	e, err = Load(cfg, file)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	defer e.Release()
+	if !e.File.ModTime().Equal(later) {
+		t.Errorf("File.ModTime got: %s, want: %s", e.File.ModTime(), later)
+	}
+	if e.File.Name() != file.Name() {
+		t.Errorf("File.Name got: %s, want: %s", e.File.Name(), file.Name())
+	}
+}
+
+func TestLoad_include_error(t *testing.T) {
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		LibraryDir:    filepath.Join("fixtures", "library"),
+	}
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow_include_missing.yaml"),
+		time.Now(),
+	)
+	wantErr := "experiment field: include: flow_missing.yaml: open " +
+		filepath.Join("fixtures", "library", "flow_missing.yaml") +
+		": no such file or directory"
+	_, err := Load(cfg, file)
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("Load err: %v, want: %s", err, wantErr)
+	}
+}
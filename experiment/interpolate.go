@@ -0,0 +1,182 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package experiment
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// redacted is used in place of a secret
+const redacted = "****"
+
+// interpolator replaces ${ENV_VAR}, ${secret:ENV_VAR} and
+// ${file:/path/to/secret} references in strings.  The values of secret
+// and file references are recorded as secrets so that they can be
+// redacted, as are the values of every reference within a struct field
+// tagged with interpolate:"secret".  $${ is replaced with a literal ${.
+type interpolator struct {
+	secrets secrets
+	// Whether the values of all references are secrets
+	isSecret bool
+}
+
+// secrets holds the secret values resolved by an interpolator
+type secrets []string
+
+var interpolateRegexp = regexp.MustCompile(`\$\$\{|\$\{([^}]*)\}`)
+
+// interpolate replaces the references in s with their values
+func (ip *interpolator) interpolate(s string) (string, error) {
+	var err error
+	r := interpolateRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		if err != nil {
+			return ref
+		}
+		if ref == "$${" {
+			return "${"
+		}
+		name := interpolateRegexp.FindStringSubmatch(ref)[1]
+		var value string
+		var isSecret bool
+		value, isSecret, err = resolveRef(name)
+		if err != nil {
+			return ref
+		}
+		if isSecret || ip.isSecret {
+			ip.secrets.add(value)
+		}
+		return value
+	})
+	return r, err
+}
+
+// resolveRef returns the value of the reference name and whether it
+// is a secret
+func resolveRef(name string) (string, bool, error) {
+	if strings.HasPrefix(name, "file:") {
+		filename := strings.TrimPrefix(name, "file:")
+		if filename == "" {
+			return "", false, errors.New("missing secret filename")
+		}
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return "", false, fmt.Errorf("can't read secret file: %s", filename)
+		}
+		return strings.TrimRight(string(b), "\r\n"), true, nil
+	}
+	isSecret := strings.HasPrefix(name, "secret:")
+	name = strings.TrimPrefix(name, "secret:")
+	if name == "" {
+		return "", false, errors.New("missing environment variable name")
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", false, fmt.Errorf("environment variable not set: %s", name)
+	}
+	return value, isSecret, nil
+}
+
+// walk interpolates every string within v, which must be a pointer.
+// Errors are prefixed with path followed by the yaml names of the fields
+// leading to the string.
+func (ip *interpolator) walk(v interface{}, path string) error {
+	return ip.walkValue(reflect.ValueOf(v), path)
+}
+
+func (ip *interpolator) walkValue(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return ip.walkValue(v.Elem(), path)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if name == "" {
+				name = f.Name
+			}
+			isSecret := ip.isSecret
+			ip.isSecret = isSecret || f.Tag.Get("interpolate") == "secret"
+			err := ip.walkValue(v.Field(i), path+name+": ")
+			ip.isSecret = isSecret
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := ip.walkValue(v.Index(i), path); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			e := v.MapIndex(k)
+			if e.Kind() != reflect.String {
+				continue
+			}
+			s, err := ip.interpolate(e.String())
+			if err != nil {
+				return fmt.Errorf("%s%s: %s", path, k, err)
+			}
+			v.SetMapIndex(k, reflect.ValueOf(s).Convert(e.Type()))
+		}
+	case reflect.String:
+		s, err := ip.interpolate(v.String())
+		if err != nil {
+			return fmt.Errorf("%s%s", path, err)
+		}
+		v.SetString(s)
+	}
+	return nil
+}
+
+func (s *secrets) add(secret string) {
+	if secret == "" {
+		return
+	}
+	for _, x := range *s {
+		if x == secret {
+			return
+		}
+	}
+	*s = append(*s, secret)
+	// Longest first so that a secret containing another is fully redacted
+	sort.SliceStable(*s, func(i, j int) bool {
+		return len((*s)[i]) > len((*s)[j])
+	})
+}
+
+// redact returns str with any secrets replaced
+func (s secrets) redact(str string) string {
+	for _, secret := range s {
+		str = strings.Replace(str, secret, redacted, -1)
+	}
+	return str
+}
+
+// redactError returns err with any secrets in its message replaced
+func (s secrets) redactError(err error) error {
+	if err == nil || len(s) == 0 {
+		return err
+	}
+	msg := err.Error()
+	if r := s.redact(msg); r != msg {
+		return errors.New(r)
+	}
+	return err
+}
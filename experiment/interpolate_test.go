@@ -0,0 +1,201 @@
+package experiment
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+)
+
+func TestInterpolatorInterpolate(t *testing.T) {
+	os.Setenv("RULEHUNTER_TEST_USER", "fred")
+	os.Setenv("RULEHUNTER_TEST_EMPTY", "")
+	defer os.Unsetenv("RULEHUNTER_TEST_USER")
+	defer os.Unsetenv("RULEHUNTER_TEST_EMPTY")
+	cases := []struct {
+		in          string
+		want        string
+		wantSecrets secrets
+	}{
+		{in: "no references", want: "no references", wantSecrets: nil},
+		{in: "${RULEHUNTER_TEST_USER}:${file:fixtures/flow_filename_secret.txt}@/db",
+			want:        "fred:fixtures/flow.csv@/db",
+			wantSecrets: secrets{"fixtures/flow.csv"},
+		},
+		{in: "${secret:RULEHUNTER_TEST_USER}@/db/${RULEHUNTER_TEST_USER}",
+			want:        "fred@/db/fred",
+			wantSecrets: secrets{"fred"},
+		},
+		{in: "echo $${RULEHUNTER_TEST_USER} ${RULEHUNTER_TEST_USER}",
+			want:        "echo ${RULEHUNTER_TEST_USER} fred",
+			wantSecrets: nil,
+		},
+		{in: "user=${RULEHUNTER_TEST_EMPTY}",
+			want:        "user=",
+			wantSecrets: nil,
+		},
+	}
+	for i, c := range cases {
+		ip := &interpolator{}
+		got, err := ip.interpolate(c.in)
+		if err != nil {
+			t.Errorf("(%d) interpolate: %s", i, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("(%d) interpolate got: %s, want: %s", i, got, c.want)
+		}
+		if !reflect.DeepEqual(ip.secrets, c.wantSecrets) {
+			t.Errorf("(%d) secrets got: %v, want: %v", i, ip.secrets, c.wantSecrets)
+		}
+	}
+}
+
+func TestInterpolatorInterpolate_errors(t *testing.T) {
+	cases := []struct {
+		in      string
+		wantErr string
+	}{
+		{in: "${RULEHUNTER_TEST_UNSET}",
+			wantErr: "environment variable not set: RULEHUNTER_TEST_UNSET",
+		},
+		{in: "${}", wantErr: "missing environment variable name"},
+		{in: "${secret:}", wantErr: "missing environment variable name"},
+		{in: "${file:}", wantErr: "missing secret filename"},
+		{in: "${file:fixtures/missing_secret.txt}",
+			wantErr: "can't read secret file: fixtures/missing_secret.txt",
+		},
+	}
+	for i, c := range cases {
+		ip := &interpolator{}
+		_, err := ip.interpolate(c.in)
+		if err == nil || err.Error() != c.wantErr {
+			t.Errorf("(%d) interpolate got err: %v, want: %s", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestInterpolatorWalk_secretFields(t *testing.T) {
+	os.Setenv("RULEHUNTER_TEST_USER", "fred")
+	os.Setenv("RULEHUNTER_TEST_PASSWORD", "password1")
+	defer os.Unsetenv("RULEHUNTER_TEST_USER")
+	defer os.Unsetenv("RULEHUNTER_TEST_PASSWORD")
+	desc := &sqlDesc{
+		DriverName:     "${RULEHUNTER_TEST_USER}",
+		DataSourceName: "fred:${RULEHUNTER_TEST_PASSWORD}@/db",
+		Query:          "select * from ${RULEHUNTER_TEST_USER}",
+	}
+	ip := &interpolator{}
+	if err := ip.walk(desc, "sql: "); err != nil {
+		t.Fatalf("walk: %s", err)
+	}
+	if want := "fred:password1@/db"; desc.DataSourceName != want {
+		t.Errorf("DataSourceName got: %s, want: %s", desc.DataSourceName, want)
+	}
+	wantSecrets := secrets{"password1"}
+	if !reflect.DeepEqual(ip.secrets, wantSecrets) {
+		t.Errorf("secrets got: %v, want: %v", ip.secrets, wantSecrets)
+	}
+	err := errors.New("can't connect to: fred:password1@/db")
+	want := "can't connect to: fred:****@/db"
+	if got := ip.secrets.redactError(err); got.Error() != want {
+		t.Errorf("redactError got: %s, want: %s", got, want)
+	}
+}
+
+func TestSecretsRedactError(t *testing.T) {
+	s := secrets{}
+	s.add("pass")
+	s.add("password1")
+	s.add("")
+	err := errors.New("can't connect to: fred:password1@/db, pass")
+	want := "can't connect to: fred:****@/db, ****"
+	if got := s.redactError(err); got.Error() != want {
+		t.Errorf("redactError got: %s, want: %s", got, want)
+	}
+	err = errors.New("no secrets here")
+	if got := s.redactError(err); got != err {
+		t.Errorf("redactError got: %v, want: %v", got, err)
+	}
+	if got := s.redactError(nil); got != nil {
+		t.Errorf("redactError got: %v, want: nil", got)
+	}
+}
+
+func TestLoad_interpolate(t *testing.T) {
+	os.Setenv("RULEHUNTER_TEST_SEPARATOR", ",")
+	defer os.Unsetenv("RULEHUNTER_TEST_SEPARATOR")
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow_interpolate.yaml"),
+		time.Now(),
+	)
+	e, err := Load(cfg, file)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	defer e.Release()
+	if n := len(datasetHeights(t, e.Train.Dataset())); n != 9 {
+		t.Errorf("got %d records, want: 9", n)
+	}
+}
+
+func TestLoad_interpolate_errors(t *testing.T) {
+	os.Setenv("RULEHUNTER_TEST_SEPARATOR", ",")
+	os.Setenv("RULEHUNTER_TEST_FILENAME", "fixtures/secret_nonexistant.csv")
+	defer os.Unsetenv("RULEHUNTER_TEST_SEPARATOR")
+	defer os.Unsetenv("RULEHUNTER_TEST_FILENAME")
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	cases := []struct {
+		filename string
+		wantErr  string
+	}{
+		{filename: "flow_interpolate_unset_env.yaml",
+			wantErr: "experiment field: train: dataset: csv: separator: " +
+				"environment variable not set: RULEHUNTER_TEST_UNSET",
+		},
+		{filename: "flow_interpolate_missing_file.yaml",
+			wantErr: "experiment field: train: dataset: csv: filename: " +
+				"can't read secret file: fixtures/missing_secret.txt",
+		},
+	}
+	for i, c := range cases {
+		file := testhelpers.NewFileInfo(
+			filepath.Join("fixtures", c.filename),
+			time.Now(),
+		)
+		_, err := Load(cfg, file)
+		if err == nil || err.Error() != c.wantErr {
+			t.Errorf("(%d) Load got err: %v, want: %s", i, err, c.wantErr)
+		}
+	}
+
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow_interpolate_redact.yaml"),
+		time.Now(),
+	)
+	_, err := Load(cfg, file)
+	if err == nil {
+		t.Fatalf("Load got err: nil, want: error")
+	}
+	if strings.Contains(err.Error(), "secret_nonexistant") ||
+		!strings.Contains(err.Error(), redacted) {
+		t.Errorf("Load got err: %s, want secret redacted", err)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package experiment
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/internal/dataset/djoin"
+)
+
+// The maximum number of lookup records held in memory if a join
+// doesn't specify maxInMemory
+const defaultJoinMaxInMemory = 100000
+
+// joinDesc describes a lookup join to a secondary dataset
+type joinDesc struct {
+	Dataset *datasetDesc `yaml:"dataset"`
+	// The key fields, which must be in both datasets
+	Keys []string `yaml:"keys"`
+	// The fields of the lookup dataset to add, if empty all those that
+	// aren't key fields are added
+	Fields []string `yaml:"fields"`
+	// A prefix to add to the names of the added fields
+	Prefix string `yaml:"prefix"`
+	// Either left, the default, or inner
+	Kind string `yaml:"kind"`
+	// The maximum number of lookup records to hold in memory before they
+	// are spilled to disk
+	MaxInMemory int64 `yaml:"maxInMemory"`
+}
+
+// joinedDataset is a Dataset that has had lookup joins applied.
+// Releasing it releases the joins and hence their lookup datasets.
+type joinedDataset struct {
+	ddataset.Dataset
+	joins []ddataset.Dataset
+}
+
+// makeJoinDataset returns dataset with the lookup joins of dd applied
+// along with the joins, which must be released once finished with
+func makeJoinDataset(
+	cfg *config.Config,
+	dd *datasetDesc,
+	dataset ddataset.Dataset,
+) (ddataset.Dataset, []ddataset.Dataset, error) {
+	joins := []ddataset.Dataset{}
+	for i, jd := range dd.Joins {
+		if jd == nil {
+			releaseAll(joins)
+			return nil, nil, fmt.Errorf("joins: %d: missing dataset", i)
+		}
+		d, err := jd.make(cfg, dataset)
+		if err != nil {
+			releaseAll(joins)
+			return nil, nil, fmt.Errorf("joins: %d: %s", i, err)
+		}
+		joins = append(joins, d)
+		dataset = d
+	}
+	return dataset, joins, nil
+}
+
+func releaseAll(datasets []ddataset.Dataset) {
+	for _, d := range datasets {
+		d.Release()
+	}
+}
+
+func (jd *joinDesc) make(
+	cfg *config.Config,
+	dataset ddataset.Dataset,
+) (ddataset.Dataset, error) {
+	// File mode permission:
+	// No special permission bits
+	// User: Read, Write Execute
+	// Group: None
+	// Other: None
+	const modePerm = 0700
+	kind, err := jd.check(dataset.Fields())
+	if err != nil {
+		return nil, err
+	}
+	lookup, err := makeDataset(cfg, jd.Dataset.asLookup())
+	if err != nil {
+		return nil, fmt.Errorf("dataset: %s", err)
+	}
+	spec, err := jd.spec(kind, dataset.Fields(), lookup.Fields())
+	if err != nil {
+		lookup.Release()
+		return nil, err
+	}
+	spec.TmpDir = filepath.Join(cfg.BuildDir, "tmp")
+	if err := os.MkdirAll(spec.TmpDir, modePerm); err != nil {
+		lookup.Release()
+		return nil, err
+	}
+	return djoin.New(dataset, lookup, spec), nil
+}
+
+// check returns the kind of the join if it is valid for joining to a
+// dataset with fields
+func (jd *joinDesc) check(fields []string) (djoin.Kind, error) {
+	if jd.Dataset == nil {
+		return djoin.Left, errors.New("missing dataset")
+	}
+	if len(jd.Keys) == 0 {
+		return djoin.Left, errors.New("missing keys")
+	}
+	kind, err := jd.kind()
+	if err != nil {
+		return djoin.Left, err
+	}
+	for _, k := range jd.Keys {
+		if !hasField(fields, k) {
+			return djoin.Left, fmt.Errorf("keys: unknown field: %s", k)
+		}
+	}
+	return kind, nil
+}
+
+func (jd *joinDesc) kind() (djoin.Kind, error) {
+	switch jd.Kind {
+	case "", "left":
+		return djoin.Left, nil
+	case "inner":
+		return djoin.Inner, nil
+	}
+	return djoin.Left, fmt.Errorf("invalid kind: %s", jd.Kind)
+}
+
+// spec returns the djoin.Spec for joining a dataset with fields to a
+// lookup dataset with lookupFields
+func (jd *joinDesc) spec(
+	kind djoin.Kind,
+	fields []string,
+	lookupFields []string,
+) (djoin.Spec, error) {
+	for _, k := range jd.Keys {
+		if !hasField(lookupFields, k) {
+			return djoin.Spec{}, fmt.Errorf("keys: unknown lookup field: %s", k)
+		}
+	}
+	addFields := jd.Fields
+	if len(addFields) == 0 {
+		for _, f := range lookupFields {
+			if !hasField(jd.Keys, f) {
+				addFields = append(addFields, f)
+			}
+		}
+	}
+	for _, f := range addFields {
+		if !hasField(lookupFields, f) {
+			return djoin.Spec{}, fmt.Errorf("fields: unknown field: %s", f)
+		}
+		if hasField(fields, jd.Prefix+f) {
+			return djoin.Spec{},
+				fmt.Errorf("fields: %s: clashes with field", jd.Prefix+f)
+		}
+	}
+	maxInMemory := jd.MaxInMemory
+	if maxInMemory < 1 {
+		maxInMemory = defaultJoinMaxInMemory
+	}
+	return djoin.Spec{
+		On:          jd.Keys,
+		Fields:      addFields,
+		Prefix:      jd.Prefix,
+		Kind:        kind,
+		MaxInMemory: maxInMemory,
+	}, nil
+}
+
+// asLookup returns a copy of the dataset description to use as the
+// lookup side of a join.  Lookups aren't sampled unless they specify
+// their own sample.
+func (dd datasetDesc) asLookup() *datasetDesc {
+	dd.isLookup = true
+	return &dd
+}
+
+func (d *joinedDataset) Release() error {
+	if err := d.Dataset.Release(); err != nil {
+		return err
+	}
+	for _, j := range d.joins {
+		if j == d.Dataset {
+			continue
+		}
+		if err := j.Release(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
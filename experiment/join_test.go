@@ -0,0 +1,237 @@
+package experiment
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/internal"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+	"github.com/vlifesystems/rulehunter/progress"
+	"github.com/vlifesystems/rulehunter/quitter"
+	"github.com/vlifesystems/rulehunter/report"
+)
+
+func TestLoad_joins(t *testing.T) {
+	cfgDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(cfgDir)
+	cfg := &config.Config{
+		WWWDir:          filepath.Join(cfgDir, "www"),
+		BuildDir:        filepath.Join(cfgDir, "build"),
+		MaxNumRecords:   -1,
+		MaxNumProcesses: 4,
+	}
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow_joins.yaml"),
+		time.Now(),
+	)
+	e, err := Load(cfg, file)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	defer e.Release()
+	wantFields := []string{
+		"group", "district", "height", "flow", "district_rainfall",
+	}
+	if got := e.Train.Dataset().Fields(); !reflect.DeepEqual(got, wantFields) {
+		t.Errorf("Fields got: %v, want: %v", got, wantFields)
+	}
+	wantHeights := map[string]bool{
+		"120": true, "128": true, "20": true,
+		"28": true, "320": true, "328": true,
+	}
+	gotHeights := datasetHeights(t, e.Train.Dataset())
+	if !reflect.DeepEqual(gotHeights, wantHeights) {
+		t.Errorf("heights got: %v, want: %v", gotHeights, wantHeights)
+	}
+
+	quit := quitter.New()
+	defer quit.Quit()
+	pm, err := progress.NewMonitor(filepath.Join(cfg.BuildDir, "progress"))
+	if err != nil {
+		t.Fatalf("progress.NewMonitor: %s", err)
+	}
+	l := testhelpers.NewLogger()
+	go l.Run(quit)
+	if err := e.Process(cfg, pm, l, quit, false); err != nil {
+		t.Fatalf("Process: %s", err)
+	}
+	_, err = report.LoadJSON(
+		cfg,
+		internal.MakeBuildFilename("train", e.Category, e.Title),
+	)
+	if err != nil {
+		t.Fatalf("report.LoadJSON: %s", err)
+	}
+}
+
+func TestMakeDataset_joins(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	lookup := &datasetDesc{
+		CSV: &csvDesc{
+			Filename:  fileList{filepath.Join("fixtures", "flow_districts.csv")},
+			HasHeader: true,
+			Separator: ",",
+		},
+		Fields: []string{"district", "region", "rainfall"},
+		Where:  "rainfall > 40",
+	}
+	cases := []struct {
+		join       *joinDesc
+		wantFields []string
+		field      string
+		want       []string
+	}{
+		{join: &joinDesc{Dataset: lookup, Keys: []string{"district"}},
+			wantFields: []string{
+				"group", "district", "height", "flow", "region", "rainfall",
+			},
+			field: "region",
+			want: []string{
+				"north", "central", "", "north", "central", "",
+				"north", "central", "",
+			},
+		},
+		{join: &joinDesc{
+			Dataset:     lookup,
+			Keys:        []string{"district"},
+			Fields:      []string{"rainfall"},
+			Kind:        "inner",
+			MaxInMemory: 1,
+		},
+			wantFields: []string{"group", "district", "height", "flow", "rainfall"},
+			field:      "rainfall",
+			want:       []string{"80", "45", "80", "45", "80", "45"},
+		},
+	}
+	cfg := &config.Config{
+		MaxNumRecords: 4,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	for i, c := range cases {
+		dd := &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+			Joins:  []*joinDesc{c.join},
+			Sample: &sampleDesc{NumRecords: 100},
+		}
+		d, err := makeDataset(cfg, dd)
+		if err != nil {
+			t.Errorf("(%d) makeDataset: %s", i, err)
+			continue
+		}
+		if got := d.Fields(); !reflect.DeepEqual(got, c.wantFields) {
+			t.Errorf("(%d) Fields got: %v, want: %v", i, got, c.wantFields)
+		}
+		conn, err := d.Open()
+		if err != nil {
+			t.Fatalf("(%d) Open: %s", i, err)
+		}
+		got := []string{}
+		for conn.Next() {
+			got = append(got, conn.Read()[c.field].String())
+		}
+		if err := conn.Err(); err != nil {
+			t.Errorf("(%d) Err: %s", i, err)
+		}
+		conn.Close()
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("(%d) got: %v, want: %v", i, got, c.want)
+		}
+		if err := d.Release(); err != nil {
+			t.Errorf("(%d) Release: %s", i, err)
+		}
+	}
+	assertNumFiles(t, filepath.Join(cfg.BuildDir, "tmp"), 0)
+}
+
+func TestMakeDataset_joins_errors(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	lookup := &datasetDesc{
+		CSV: &csvDesc{
+			Filename:  fileList{filepath.Join("fixtures", "flow_districts.csv")},
+			HasHeader: true,
+			Separator: ",",
+		},
+		Fields: []string{"district", "region", "rainfall"},
+	}
+	cases := []struct {
+		join    *joinDesc
+		wantErr string
+	}{
+		{join: nil, wantErr: "joins: 0: missing dataset"},
+		{join: &joinDesc{Keys: []string{"district"}},
+			wantErr: "joins: 0: missing dataset",
+		},
+		{join: &joinDesc{Dataset: lookup},
+			wantErr: "joins: 0: missing keys",
+		},
+		{join: &joinDesc{
+			Dataset: lookup,
+			Keys:    []string{"district"},
+			Kind:    "outer",
+		},
+			wantErr: "joins: 0: invalid kind: outer",
+		},
+		{join: &joinDesc{Dataset: lookup, Keys: []string{"region"}},
+			wantErr: "joins: 0: keys: unknown field: region",
+		},
+		{join: &joinDesc{Dataset: lookup, Keys: []string{"district", "group"}},
+			wantErr: "joins: 0: keys: unknown lookup field: group",
+		},
+		{join: &joinDesc{
+			Dataset: lookup,
+			Keys:    []string{"district"},
+			Fields:  []string{"snowfall"},
+		},
+			wantErr: "joins: 0: fields: unknown field: snowfall",
+		},
+		{join: &joinDesc{
+			Dataset: lookup,
+			Keys:    []string{"district"},
+			Fields:  []string{"region", "district"},
+		},
+			wantErr: "joins: 0: fields: district: clashes with field",
+		},
+		{join: &joinDesc{
+			Dataset: &datasetDesc{
+				CSV: &csvDesc{
+					Filename:  fileList{filepath.Join("fixtures", "flow_districts.csv")},
+					HasHeader: true,
+				},
+				Fields: []string{"district", "region", "rainfall"},
+			},
+			Keys: []string{"district"},
+		},
+			wantErr: "joins: 0: dataset: csv: missing separator",
+		},
+	}
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	for i, c := range cases {
+		dd := &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+			Joins:  []*joinDesc{c.join},
+		}
+		_, err := makeDataset(cfg, dd)
+		if err == nil || err.Error() != c.wantErr {
+			t.Errorf("(%d) makeDataset got err: %v, want: %s", i, err, c.wantErr)
+		}
+	}
+}
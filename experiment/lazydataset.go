@@ -0,0 +1,90 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package experiment
+
+import (
+	"sync"
+
+	"github.com/lawrencewoodman/ddataset"
+)
+
+// lazyDataset represents a Dataset that isn't made until it is first
+// opened or its number of records is needed
+type lazyDataset struct {
+	fields []string
+	make   func() (ddataset.Dataset, error)
+	// discard is called on release if the Dataset was never made
+	discard    func()
+	mu         sync.Mutex
+	dataset    ddataset.Dataset
+	err        error
+	isReleased bool
+}
+
+func newLazyDataset(
+	fields []string,
+	make func() (ddataset.Dataset, error),
+	discard func(),
+) *lazyDataset {
+	return &lazyDataset{fields: fields, make: make, discard: discard}
+}
+
+// get returns the Dataset, making it if this is the first time it is
+// needed.  If the Dataset couldn't be made the error is returned each
+// time.
+func (d *lazyDataset) get() (ddataset.Dataset, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.isReleased {
+		return nil, ddataset.ErrReleased
+	}
+	if d.make != nil {
+		d.dataset, d.err = d.make()
+		d.make = nil
+	}
+	return d.dataset, d.err
+}
+
+// Open creates a connection to the Dataset
+func (d *lazyDataset) Open() (ddataset.Conn, error) {
+	dataset, err := d.get()
+	if err != nil {
+		return nil, err
+	}
+	return dataset.Open()
+}
+
+// Fields returns the field names used by the Dataset
+func (d *lazyDataset) Fields() []string {
+	return d.fields
+}
+
+// NumRecords returns the number of records in the Dataset.  If there is
+// a problem getting the number of records it returns -1.
+func (d *lazyDataset) NumRecords() int64 {
+	dataset, err := d.get()
+	if err != nil {
+		return -1
+	}
+	return dataset.NumRecords()
+}
+
+// Release releases any resources associated with the Dataset d,
+// rendering it unusable in the future.
+func (d *lazyDataset) Release() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.isReleased {
+		return ddataset.ErrReleased
+	}
+	d.isReleased = true
+	if d.make != nil {
+		d.discard()
+		return nil
+	}
+	if d.dataset != nil {
+		return d.dataset.Release()
+	}
+	return nil
+}
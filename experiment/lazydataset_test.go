@@ -0,0 +1,102 @@
+package experiment
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/ddataset/dcsv"
+)
+
+func TestLazyDataset(t *testing.T) {
+	fields := []string{"group", "district", "height", "flow"}
+	numMakes := 0
+	d := newLazyDataset(
+		fields,
+		func() (ddataset.Dataset, error) {
+			numMakes++
+			return dcsv.New(
+				filepath.Join("fixtures", "flow.csv"),
+				true,
+				',',
+				fields,
+			), nil
+		},
+		func() { t.Errorf("discard called") },
+	)
+	if got := d.Fields(); !reflect.DeepEqual(got, fields) {
+		t.Errorf("Fields got: %v, want: %v", got, fields)
+	}
+	if numMakes != 0 {
+		t.Errorf("numMakes got: %d, want: 0", numMakes)
+	}
+	for i := 0; i < 2; i++ {
+		conn, err := d.Open()
+		if err != nil {
+			t.Fatalf("Open: %s", err)
+		}
+		conn.Close()
+	}
+	if n := d.NumRecords(); n != 9 {
+		t.Errorf("NumRecords got: %d, want: 9", n)
+	}
+	if numMakes != 1 {
+		t.Errorf("numMakes got: %d, want: 1", numMakes)
+	}
+	if err := d.Release(); err != nil {
+		t.Errorf("Release: %s", err)
+	}
+	if _, err := d.Open(); err != ddataset.ErrReleased {
+		t.Errorf("Open got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+	if err := d.Release(); err != ddataset.ErrReleased {
+		t.Errorf("Release got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+}
+
+func TestLazyDataset_errors(t *testing.T) {
+	wantErr := errors.New("can't make dataset")
+	numMakes := 0
+	d := newLazyDataset(
+		[]string{"group"},
+		func() (ddataset.Dataset, error) {
+			numMakes++
+			return nil, wantErr
+		},
+		func() { t.Errorf("discard called") },
+	)
+	for i := 0; i < 2; i++ {
+		if _, err := d.Open(); err != wantErr {
+			t.Errorf("Open got: %v, want: %s", err, wantErr)
+		}
+	}
+	if n := d.NumRecords(); n != -1 {
+		t.Errorf("NumRecords got: %d, want: -1", n)
+	}
+	if numMakes != 1 {
+		t.Errorf("numMakes got: %d, want: 1", numMakes)
+	}
+	if err := d.Release(); err != nil {
+		t.Errorf("Release: %s", err)
+	}
+}
+
+func TestLazyDatasetRelease_discard(t *testing.T) {
+	isDiscarded := false
+	d := newLazyDataset(
+		[]string{"group"},
+		func() (ddataset.Dataset, error) {
+			t.Errorf("make called")
+			return nil, nil
+		},
+		func() { isDiscarded = true },
+	)
+	if err := d.Release(); err != nil {
+		t.Errorf("Release: %s", err)
+	}
+	if !isDiscarded {
+		t.Errorf("Release didn't discard the dataset")
+	}
+}
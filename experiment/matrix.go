@@ -0,0 +1,200 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package experiment
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/vlifesystems/rulehunter/fileinfo"
+	"github.com/vlifesystems/rulehunter/internal/include"
+	"github.com/vlifesystems/rulehunter/report"
+)
+
+// expansion is an experiment description along with the file that it
+// is from.  If the file has a matrix, file is named after the
+// combination of matrix values that the description was expanded with.
+type expansion struct {
+	file   fileinfo.FileInfo
+	desc   *descFile
+	cell   matrixCell
+	matrix *report.Matrix
+}
+
+// matrixCell is a combination of the values of the matrix variables
+type matrixCell map[string]string
+
+var matrixVariableRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// matrixRefRegexp matches references to matrix variables such as:
+// ${matrix.class}
+var matrixRefRegexp = regexp.MustCompile(`\$\{matrix\.([^}]*)\}`)
+
+// expandMatrix returns a description for each combination of the values
+// of the variables in matrix.  The descriptions are expanded from doc,
+// which is encoded using the format given by ext, by replacing references
+// to the variables with their values.  The values of any variables that
+// the title doesn't refer to are appended to it so that each report
+// has a unique title.
+func expandMatrix(
+	doc include.Doc,
+	matrix map[string][]string,
+	file fileinfo.FileInfo,
+	ext string,
+) ([]expansion, error) {
+	cells, err := makeMatrixCells(matrix)
+	if err != nil {
+		return nil, err
+	}
+	title, _ := doc["title"].(string)
+	titleRefs := map[string]bool{}
+	for _, m := range matrixRefRegexp.FindAllStringSubmatch(title, -1) {
+		titleRefs[m[1]] = true
+	}
+	expansions := make([]expansion, len(cells))
+	for i, cell := range cells {
+		cellDoc, err := cell.expand(doc)
+		if err != nil {
+			return nil, err
+		}
+		d := cellDoc.(include.Doc)
+		delete(d, "matrix")
+		unrefCell := cell.without(titleRefs)
+		if title != "" && len(unrefCell) > 0 {
+			d["title"] = fmt.Sprintf("%s (%s)", d["title"], unrefCell)
+		}
+		desc, err := decodeDoc(d, ext)
+		if err != nil {
+			return nil, err
+		}
+		expansions[i] = expansion{
+			file: fileinfo.New(
+				fmt.Sprintf("%s (%s)", file.Name(), cell),
+				file.ModTime(),
+			),
+			desc: desc,
+			cell: cell,
+			matrix: &report.Matrix{
+				Filename: file.Name(),
+				Values:   cell,
+			},
+		}
+	}
+	return expansions, nil
+}
+
+// makeMatrixCells returns every combination of the values of the
+// variables in matrix, the earlier variables in alphabetical order
+// changing least often
+func makeMatrixCells(matrix map[string][]string) ([]matrixCell, error) {
+	variables := make([]string, 0, len(matrix))
+	for variable := range matrix {
+		variables = append(variables, variable)
+	}
+	sort.Strings(variables)
+	cells := []matrixCell{{}}
+	for _, variable := range variables {
+		if !matrixVariableRegexp.MatchString(variable) {
+			return nil, fmt.Errorf("invalid variable: %s", variable)
+		}
+		values := matrix[variable]
+		if len(values) == 0 {
+			return nil, fmt.Errorf("%s: no values", variable)
+		}
+		seen := map[string]bool{}
+		for _, value := range values {
+			if seen[value] {
+				return nil, fmt.Errorf("%s: duplicate value: %s", variable, value)
+			}
+			seen[value] = true
+		}
+		newCells := make([]matrixCell, 0, len(cells)*len(values))
+		for _, cell := range cells {
+			for _, value := range values {
+				newCell := make(matrixCell, len(cell)+1)
+				for k, v := range cell {
+					newCell[k] = v
+				}
+				newCell[variable] = value
+				newCells = append(newCells, newCell)
+			}
+		}
+		cells = newCells
+	}
+	return cells, nil
+}
+
+// String returns the variables and their values in alphabetical order
+// of variable such as: class: Iris-setosa, region: north
+func (c matrixCell) String() string {
+	variables := make([]string, 0, len(c))
+	for variable := range c {
+		variables = append(variables, variable)
+	}
+	sort.Strings(variables)
+	pairs := make([]string, len(variables))
+	for i, variable := range variables {
+		pairs[i] = variable + ": " + c[variable]
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// without returns the cell without the variables in exclude
+func (c matrixCell) without(exclude map[string]bool) matrixCell {
+	r := matrixCell{}
+	for variable, value := range c {
+		if !exclude[variable] {
+			r[variable] = value
+		}
+	}
+	return r
+}
+
+// expand returns a copy of v with any references to matrix variables in
+// its strings replaced with their values
+func (c matrixCell) expand(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case include.Doc:
+		r := make(include.Doc, len(x))
+		for k, v := range x {
+			e, err := c.expand(v)
+			if err != nil {
+				return nil, err
+			}
+			r[k] = e
+		}
+		return r, nil
+	case []interface{}:
+		r := make([]interface{}, len(x))
+		for i, v := range x {
+			e, err := c.expand(v)
+			if err != nil {
+				return nil, err
+			}
+			r[i] = e
+		}
+		return r, nil
+	case string:
+		return c.substitute(x)
+	}
+	return v, nil
+}
+
+func (c matrixCell) substitute(s string) (string, error) {
+	var err error
+	r := matrixRefRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		variable := matrixRefRegexp.FindStringSubmatch(ref)[1]
+		value, ok := c[variable]
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("unknown variable: %s", variable)
+			}
+			return ref
+		}
+		return value
+	})
+	return r, err
+}
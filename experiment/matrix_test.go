@@ -0,0 +1,228 @@
+package experiment
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+	"github.com/vlifesystems/rulehunter/report"
+)
+
+func TestLoadAll_matrix(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	modTime := time.Now()
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow_matrix.yaml"),
+		modTime,
+	)
+	es, err := LoadAll(cfg, file, nil)
+	if err != nil {
+		t.Fatalf("LoadAll: %s", err)
+	}
+	defer func() {
+		for _, e := range es {
+			e.Release()
+		}
+	}()
+
+	type want struct {
+		filename string
+		title    string
+		arg      string
+		values   map[string]string
+	}
+	wants := []want{
+		{filename: file.Name() + " (district: northcal, group: a)",
+			title:  "Is flow good in group a? (district: northcal)",
+			arg:    "group == \"a\" && district == \"northcal\"",
+			values: map[string]string{"district": "northcal", "group": "a"},
+		},
+		{filename: file.Name() + " (district: northcal, group: b)",
+			title:  "Is flow good in group b? (district: northcal)",
+			arg:    "group == \"b\" && district == \"northcal\"",
+			values: map[string]string{"district": "northcal", "group": "b"},
+		},
+		{filename: file.Name() + " (district: southcal, group: a)",
+			title:  "Is flow good in group a? (district: southcal)",
+			arg:    "group == \"a\" && district == \"southcal\"",
+			values: map[string]string{"district": "southcal", "group": "a"},
+		},
+		{filename: file.Name() + " (district: southcal, group: b)",
+			title:  "Is flow good in group b? (district: southcal)",
+			arg:    "group == \"b\" && district == \"southcal\"",
+			values: map[string]string{"district": "southcal", "group": "b"},
+		},
+	}
+	if len(es) != len(wants) {
+		t.Fatalf("LoadAll got %d experiments, want: %d", len(es), len(wants))
+	}
+	for i, w := range wants {
+		e := es[i]
+		if e.File.Name() != w.filename || !e.File.ModTime().Equal(modTime) {
+			t.Errorf("(%d) File got: %s %s, want: %s %s",
+				i, e.File.Name(), e.File.ModTime(), w.filename, modTime)
+		}
+		if e.Title != w.title {
+			t.Errorf("(%d) Title got: %s, want: %s", i, e.Title, w.title)
+		}
+		agg := e.Aggregators[2]
+		if agg.Name() != "inGroupMcc" || agg.Arg() != w.arg {
+			t.Errorf("(%d) Aggregator got: %s %s, want: inGroupMcc %s",
+				i, agg.Name(), agg.Arg(), w.arg)
+		}
+		wantMatrix := &report.Matrix{Filename: file.Name(), Values: w.values}
+		if !reflect.DeepEqual(e.Matrix, wantMatrix) {
+			t.Errorf("(%d) Matrix got: %v, want: %v", i, e.Matrix, wantMatrix)
+		}
+	}
+}
+
+func TestLoadAll_noMatrix(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow.yaml"),
+		time.Now(),
+	)
+	es, err := LoadAll(cfg, file, nil)
+	if err != nil {
+		t.Fatalf("LoadAll: %s", err)
+	}
+	if len(es) != 1 {
+		t.Fatalf("LoadAll got %d experiments, want: 1", len(es))
+	}
+	defer es[0].Release()
+	if es[0].File.Name() != file.Name() || es[0].Matrix != nil {
+		t.Errorf("LoadAll got File: %s, Matrix: %v, want File: %s, Matrix: nil",
+			es[0].File.Name(), es[0].Matrix, file.Name())
+	}
+}
+
+func TestLoadAll_matrix_errors(t *testing.T) {
+	cfg := &config.Config{MaxNumRecords: -1}
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow_matrix_unknown_variable.yaml"),
+		time.Now(),
+	)
+	wantErr := "experiment field: matrix: unknown variable: region"
+	_, err := LoadAll(cfg, file, nil)
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("LoadAll err: %v, want: %s", err, wantErr)
+	}
+}
+
+func TestLoad_matrix(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow_matrix.yaml"),
+		time.Now(),
+	)
+	e, err := Load(cfg, file)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	defer e.Release()
+	wantFilename := file.Name() + " (district: northcal, group: a)"
+	if e.File.Name() != wantFilename {
+		t.Errorf("Load got File: %s, want: %s", e.File.Name(), wantFilename)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow_matrix.yaml"),
+		time.Now(),
+	)
+	f, err := ReadFile(cfg, file, nil)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	if n := f.NumExperiments(); n != 4 {
+		t.Fatalf("NumExperiments got: %d, want: 4", n)
+	}
+	// Nothing is built until an experiment is loaded
+	if _, err := os.Stat(filepath.Join(cfg.BuildDir, "tmp")); !os.IsNotExist(err) {
+		t.Errorf("ReadFile made build tmp dir, Stat err: %v", err)
+	}
+	wantFilename := file.Name() + " (district: southcal, group: a)"
+	if got := f.Name(2); got != wantFilename {
+		t.Errorf("Name got: %s, want: %s", got, wantFilename)
+	}
+	e, err := f.Load(2)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	defer e.Release()
+	if e.File.Name() != wantFilename {
+		t.Errorf("Load got File: %s, want: %s", e.File.Name(), wantFilename)
+	}
+}
+
+func TestMakeMatrixCells(t *testing.T) {
+	matrix := map[string][]string{
+		"region": {"north", "south"},
+		"class":  {"a", "b", "c"},
+	}
+	want := []matrixCell{
+		{"class": "a", "region": "north"},
+		{"class": "a", "region": "south"},
+		{"class": "b", "region": "north"},
+		{"class": "b", "region": "south"},
+		{"class": "c", "region": "north"},
+		{"class": "c", "region": "south"},
+	}
+	got, err := makeMatrixCells(matrix)
+	if err != nil {
+		t.Fatalf("makeMatrixCells: %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("makeMatrixCells got: %v, want: %v", got, want)
+	}
+}
+
+func TestMakeMatrixCells_errors(t *testing.T) {
+	cases := []struct {
+		matrix  map[string][]string
+		wantErr string
+	}{
+		{matrix: map[string][]string{"class": {}},
+			wantErr: "class: no values",
+		},
+		{matrix: map[string][]string{"class": {"a", "b", "a"}},
+			wantErr: "class: duplicate value: a",
+		},
+		{matrix: map[string][]string{"my class": {"a"}},
+			wantErr: "invalid variable: my class",
+		},
+	}
+	for i, c := range cases {
+		_, err := makeMatrixCells(c.matrix)
+		if err == nil || err.Error() != c.wantErr {
+			t.Errorf("(%d) makeMatrixCells err: %v, want: %s", i, err, c.wantErr)
+		}
+	}
+}
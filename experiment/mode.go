@@ -4,25 +4,39 @@
 package experiment
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/lawrencewoodman/ddataset"
 	"github.com/lawrencewoodman/ddataset/dcopy"
-	"github.com/lawrencewoodman/ddataset/dcsv"
 	"github.com/lawrencewoodman/ddataset/dsql"
 	"github.com/lawrencewoodman/ddataset/dtruncate"
 	"github.com/lawrencewoodman/dexpr"
+	"github.com/lawrencewoodman/dlit"
 	"github.com/vlifesystems/rhkit/aggregator"
 	"github.com/vlifesystems/rhkit/assessment"
 	"github.com/vlifesystems/rhkit/goal"
 	"github.com/vlifesystems/rhkit/rule"
 	"github.com/vlifesystems/rulehunter/config"
 	"github.com/vlifesystems/rulehunter/fileinfo"
+	"github.com/vlifesystems/rulehunter/internal/dataset/darrow"
+	"github.com/vlifesystems/rulehunter/internal/dataset/dcsv"
+	"github.com/vlifesystems/rulehunter/internal/dataset/dderive"
+	"github.com/vlifesystems/rulehunter/internal/dataset/dfilter"
+	"github.com/vlifesystems/rulehunter/internal/dataset/dfixedwidth"
+	"github.com/vlifesystems/rulehunter/internal/dataset/djsonl"
+	"github.com/vlifesystems/rulehunter/internal/dataset/dnull"
+	"github.com/vlifesystems/rulehunter/internal/dataset/dparquet"
+	"github.com/vlifesystems/rulehunter/internal/dataset/dsample"
+	"github.com/vlifesystems/rulehunter/internal/dataset/dsplit"
+	"github.com/vlifesystems/rulehunter/internal/dataset/dxlsx"
 	"github.com/vlifesystems/rulehunter/progress"
 	"github.com/vlifesystems/rulehunter/quitter"
 	"github.com/vlifesystems/rulehunter/report"
@@ -37,21 +51,156 @@ type Mode interface {
 }
 
 type datasetDesc struct {
-	CSV    *csvDesc `yaml:"csv"`
-	SQL    *sqlDesc `yaml:"sql"`
+	CSV        *csvDesc        `yaml:"csv"`
+	SQL        *sqlDesc        `yaml:"sql"`
+	JSONL      *jsonlDesc      `yaml:"jsonl"`
+	Parquet    *parquetDesc    `yaml:"parquet"`
+	Arrow      *arrowDesc      `yaml:"arrow"`
+	XLSX       *xlsxDesc       `yaml:"xlsx"`
+	FixedWidth *fixedWidthDesc `yaml:"fixedWidth"`
+	Command    *commandDesc    `yaml:"command"`
+	// The fields of the dataset, if empty they are taken from the header
+	// of a csv file or the columns returned by an sql query
 	Fields []string `yaml:"fields"`
+	// Maps field names to the type to treat them as when generating
+	// rules, one of: number, string or ignore
+	FieldTypes map[string]string `yaml:"fieldTypes"`
+	// Lookup joins to secondary datasets that add fields to each record
+	Joins []*joinDesc `yaml:"joins"`
+	// Maps field names to how missing values in those fields are handled
+	Nulls map[string]*nullDesc `yaml:"nulls"`
+	// Maps the names of derived fields to expressions over the fields above
+	DerivedFields map[string]string `yaml:"derivedFields"`
+	// An expression that a record must satisfy to be included
+	Where string `yaml:"where"`
+	// Overrides the sample settings of the config
+	Sample *sampleDesc `yaml:"sample"`
+	// The split and partition of the dataset to use, if it is split,
+	// and the copy shared by the partitions
+	split       *dsplit.Spec
+	partition   dsplit.Partition
+	splitSource *splitSource
+	// Whether the dataset is the copy that the partitions of a split are
+	// made from, which keeps the nulls marked and isn't sampled
+	isSplitSource bool
+	// The values of the parameters in sql queries
+	sqlParams map[string]interface{}
+	// Maps the names of kinds registered with RegisterDatasetKind to
+	// their descriptions
+	kinds map[string]DatasetNode
+	// Whether the dataset is the lookup side of a join
+	isLookup bool
+	// Whether only the fields of the dataset are needed, so that it can
+	// be validated without being built
+	isDescribeOnly bool
+}
+
+// splitDesc describes how to split a dataset into train and test
+// partitions
+type splitDesc struct {
+	// The fraction of records to hold out for testing
+	Holdout float64 `yaml:"holdout"`
+	Seed    int64   `yaml:"seed"`
+	// A field whose values should be in the same proportions in each partition
+	Stratify string `yaml:"stratify"`
+	// A field to order the records by, so that the latest are used for testing
+	TimeField string `yaml:"timeField"`
+}
+
+// nullDesc describes which values of a field are missing and what
+// to do with them
+type nullDesc struct {
+	// The values that indicate a missing value, if empty this is ""
+	Tokens []string `yaml:"tokens"`
+	// One of: skip, default or category.  With category, missing values
+	// become "null", so a value that isn't missing can't be "null".
+	Policy string `yaml:"policy"`
+	// The value to use in place of a missing value with the default policy
+	Default string `yaml:"default"`
+}
+
+type sampleDesc struct {
+	Method string `yaml:"method"`
+	Field  string `yaml:"field"`
+	Seed   int64  `yaml:"seed"`
+	// The number of records to sample, if not set config.MaxNumRecords is used
+	NumRecords int64 `yaml:"numRecords"`
 }
 
 type csvDesc struct {
+	// Each filename may be a glob pattern such as: csv/calls-2018-*.csv
+	Filename  fileList `yaml:"filename"`
+	HasHeader bool     `yaml:"hasHeader"`
+	Separator string   `yaml:"separator"`
+}
+
+// fileList is a list of filenames that can also be given as a single
+// filename
+type fileList []string
+
+type sqlDesc struct {
+	// The name of a data source in the config to use in place of
+	// driverName and dataSourceName
+	Source     string `yaml:"source"`
+	DriverName string `yaml:"driverName"`
+	// Any references in dataSourceName are redacted as it usually
+	// contains a password
+	DataSourceName string `yaml:"dataSourceName" interpolate:"secret"`
+	// Query may contain parameters such as :lastRunStamp, which can be
+	// any of the variables available to when expressions
+	Query string `yaml:"query"`
+	// NewRowsQuery is an optional query used by the hasNewRows when
+	// variable that returns a count of the rows added since the last run
+	NewRowsQuery string `yaml:"newRowsQuery"`
+	// CacheFor is how long a copy of the rows returned by the query may
+	// be reused from the dataset cache such as: 1h.  If empty the rows
+	// aren't cached because they can change while the query doesn't.
+	CacheFor string `yaml:"cacheFor"`
+}
+
+type jsonlDesc struct {
+	Filename string `yaml:"filename"`
+	// Maps field names to dot separated key paths within each JSON object
+	FieldPaths map[string]string `yaml:"fieldPaths"`
+}
+
+type parquetDesc struct {
+	Filename string `yaml:"filename"`
+}
+
+// arrowDesc describes an Arrow IPC file in either the file or stream format
+type arrowDesc struct {
+	Filename string `yaml:"filename"`
+}
+
+type xlsxDesc struct {
+	Filename string `yaml:"filename"`
+	// The name of the sheet to use, if empty the first sheet is used
+	Sheet     string `yaml:"sheet"`
+	HasHeader bool   `yaml:"hasHeader"`
+	// An optional cell range such as: B2:F100
+	Range string `yaml:"range"`
+}
+
+// fixedWidthDesc describes a text file in which each field is at a fixed
+// position within each line
+type fixedWidthDesc struct {
 	Filename  string `yaml:"filename"`
 	HasHeader bool   `yaml:"hasHeader"`
-	Separator string `yaml:"separator"`
+	// How spaces are trimmed from values, one of: both (the default),
+	// left, right or none
+	Trim string `yaml:"trim"`
+	// Maps field names to their columns
+	Columns map[string]*columnDesc `yaml:"columns"`
 }
 
-type sqlDesc struct {
-	DriverName     string `yaml:"driverName"`
-	DataSourceName string `yaml:"dataSourceName"`
-	Query          string `yaml:"query"`
+// columnDesc describes the position of a field within a line
+type columnDesc struct {
+	// The position of the first character, where a line starts at 1
+	Start  int `yaml:"start"`
+	Length int `yaml:"length"`
+	// Overrides the trim of the fixedWidth description
+	Trim string `yaml:"trim"`
 }
 
 type InvalidWhenExprError string
@@ -63,6 +212,78 @@ func (e InvalidWhenExprError) Error() string {
 func makeDataset(
 	cfg *config.Config,
 	dd *datasetDesc,
+) (ddataset.Dataset, error) {
+	d, err := makeLazyDataset(cfg, dd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.get(); err != nil {
+		d.Release()
+		return nil, err
+	}
+	return d, nil
+}
+
+// makeModeDataset returns the dataset described by dd for a mode.  If
+// when uses hasNewRows the dataset isn't copied until it is first used,
+// so that nothing is copied unless the mode is processed.
+func makeModeDataset(
+	cfg *config.Config,
+	dd *datasetDesc,
+	when *dexpr.Expr,
+) (ddataset.Dataset, error) {
+	if dd.isDescribeOnly {
+		return describeDataset(cfg, dd)
+	}
+	if dd.split != nil {
+		return makeSplitDataset(cfg, dd, when)
+	}
+	if dd.newRowsFunc(cfg) != nil && usesHasNewRows(when) {
+		return makeLazyDataset(cfg, dd)
+	}
+	return makeDataset(cfg, dd)
+}
+
+// makeLazyDataset returns the dataset described by dd, which will be
+// copied to get a stable version when it is first used
+func makeLazyDataset(
+	cfg *config.Config,
+	dd *datasetDesc,
+) (*lazyDataset, error) {
+	source, err := makeSourceDataset(cfg, dd)
+	if err != nil {
+		return nil, err
+	}
+	pipeline, err := makePipelineDataset(cfg, dd, source)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]string, 0, len(pipeline.Fields()))
+	for _, f := range pipeline.Fields() {
+		if f != dnull.MarkField || dd.isSplitSource {
+			fields = append(fields, f)
+		}
+	}
+	return newLazyDataset(
+		fields,
+		func() (ddataset.Dataset, error) {
+			return copyPipelineDataset(cfg, dd, source, pipeline)
+		},
+		func() {
+			if pipeline != source {
+				pipeline.Release()
+			}
+		},
+	), nil
+}
+
+// copyPipelineDataset returns a stable copy of pipeline, which has been
+// made from source as described by dd
+func copyPipelineDataset(
+	cfg *config.Config,
+	dd *datasetDesc,
+	source ddataset.Dataset,
+	pipeline ddataset.Dataset,
 ) (ddataset.Dataset, error) {
 	// File mode permission:
 	// No special permission bits
@@ -70,61 +291,712 @@ func makeDataset(
 	// Group: None
 	// Other: None
 	const modePerm = 0700
-	var dataset ddataset.Dataset
-	if dd.CSV != nil && dd.SQL != nil {
-		return nil, errors.New("can't specify csv and sql source")
+	// Releasing the pipeline releases the lookup datasets of any joins
+	if pipeline != source {
+		defer pipeline.Release()
 	}
-	if dd.CSV == nil && dd.SQL == nil {
-		return nil,
-			errors.New("has no csv or sql field")
+	if cache := getDatasetCache(cfg); cache != nil && dd.isCacheable() {
+		copyDataset, err := makeCachedDataset(cfg, cache, dd, pipeline)
+		if err != nil {
+			return nil, err
+		}
+		return dd.unmarkNulls(copyDataset), nil
 	}
-	if dd.CSV != nil {
-		if dd.CSV.Filename == "" {
-			return nil, errors.New("csv: missing filename")
+
+	// Copy dataset to get stable version
+	buildTmpDir := filepath.Join(cfg.BuildDir, "tmp")
+	if err := os.MkdirAll(buildTmpDir, modePerm); err != nil {
+		return nil, err
+	}
+	copyDataset, err := dcopy.New(pipeline, buildTmpDir)
+	if err != nil {
+		return nil, err
+	}
+	return dd.unmarkNulls(copyDataset), nil
+}
+
+// unmarkNulls returns the copy of the pipeline of dd without the field
+// that marks which values were missing, if dd has any null policies and
+// isn't the source of a split
+func (dd *datasetDesc) unmarkNulls(d ddataset.Dataset) ddataset.Dataset {
+	if len(dd.Nulls) == 0 || dd.isSplitSource {
+		return d
+	}
+	fields := make([]string, 0, len(dd.Nulls))
+	for field := range dd.Nulls {
+		fields = append(fields, field)
+	}
+	return dnull.Unmark(d, fields)
+}
+
+// makePipelineDataset returns dataset with the joins, null handling,
+// derived fields, where, split and sample of dd applied in turn
+func makePipelineDataset(
+	cfg *config.Config,
+	dd *datasetDesc,
+	dataset ddataset.Dataset,
+) (ddataset.Dataset, error) {
+	dataset, joins, err := makeJoinDataset(cfg, dd, dataset)
+	if err != nil {
+		return nil, err
+	}
+	dataset, err = makeStagesDataset(cfg, dd, dataset)
+	if err != nil {
+		releaseAll(joins)
+		return nil, err
+	}
+	if len(joins) > 0 {
+		return &joinedDataset{Dataset: dataset, joins: joins}, nil
+	}
+	return dataset, nil
+}
+
+// makeStagesDataset returns dataset with the null handling, derived
+// fields, where, split and sample of dd applied in turn
+func makeStagesDataset(
+	cfg *config.Config,
+	dd *datasetDesc,
+	dataset ddataset.Dataset,
+) (ddataset.Dataset, error) {
+	var err error
+
+	if len(dd.Nulls) > 0 {
+		specs, err := makeNullSpecs(dd.Nulls, dataset.Fields())
+		if err != nil {
+			return nil, err
 		}
-		if dd.CSV.Separator == "" {
-			return nil, errors.New("csv: missing separator")
+		dataset = dnull.NewMarked(dataset, specs)
+	}
+	if len(dd.DerivedFields) > 0 {
+		derived, err := makeDerivedFields(dd.DerivedFields, dataset.Fields())
+		if err != nil {
+			return nil, err
 		}
-		dataset = dcsv.New(
-			dd.CSV.Filename,
-			dd.CSV.HasHeader,
-			rune(dd.CSV.Separator[0]),
-			dd.Fields,
-		)
-	} else if dd.SQL != nil {
-		if dd.SQL.DriverName == "" {
-			return nil, errors.New("sql: missing driverName")
+		dataset = dderive.New(dataset, derived)
+	}
+	if dd.Where != "" {
+		where, err := dexpr.New(dd.Where, map[string]dexpr.CallFun{})
+		if err != nil {
+			return nil, fmt.Errorf("where: %s", err)
 		}
-		if dd.SQL.DataSourceName == "" {
-			return nil, errors.New("sql: missing dataSourceName")
+		dataset = dfilter.New(dataset, where)
+	}
+	if dd.split != nil {
+		for _, f := range []string{dd.split.Stratify, dd.split.TimeField} {
+			if f != "" && !hasField(dataset.Fields(), f) {
+				return nil, fmt.Errorf("split: %s", dsplit.UnknownFieldError(f))
+			}
 		}
-		if dd.SQL.Query == "" {
-			return nil, errors.New("sql: missing query")
+		dataset = dsplit.New(dataset, *dd.split, dd.partition)
+	}
+	if sample := dd.sample(cfg); sample != nil {
+		dataset, err = makeSampleDataset(dataset, sample)
+		if err != nil {
+			return nil, fmt.Errorf("sample: %s", err)
 		}
-		sqlHandler, err := newSQLHandler(
-			dd.SQL.DriverName,
-			dd.SQL.DataSourceName,
-			dd.SQL.Query,
-		)
+	}
+	return dataset, nil
+}
+
+// makeSourceDataset returns the dataset described by dd before any
+// missing values, derived fields, filtering or sampling are handled.
+// If dd doesn't list its fields, the fields of the returned dataset are
+// those inferred from the source and dd is left unchanged.
+func makeSourceDataset(
+	cfg *config.Config,
+	dd *datasetDesc,
+) (ddataset.Dataset, error) {
+	sources := dd.sources()
+	if len(sources) > 1 {
+		return nil, fmt.Errorf("can't specify %s and %s source",
+			sources[0], sources[1])
+	}
+	switch {
+	case dd.CSV != nil:
+		return makeCSVDataset(dd.CSV, dd.Fields)
+	case dd.SQL != nil:
+		return makeSQLDataset(cfg, dd.SQL, dd.Fields, dd.sqlParams)
+	case dd.JSONL != nil:
+		return makeJSONLDataset(dd.JSONL, dd.Fields)
+	case dd.Parquet != nil:
+		return makeParquetDataset(dd.Parquet, dd.Fields)
+	case dd.Arrow != nil:
+		return makeArrowDataset(dd.Arrow, dd.Fields)
+	case dd.XLSX != nil:
+		return makeXLSXDataset(dd.XLSX, dd.Fields)
+	case dd.FixedWidth != nil:
+		return makeFixedWidthDataset(dd.FixedWidth, dd.Fields)
+	case dd.Command != nil:
+		return makeCommandDataset(cfg, dd.Command, dd.Fields)
+	case len(dd.kinds) == 1:
+		name := dd.kindNames()[0]
+		return makeKindDataset(name, dd.kinds[name], dd.Fields)
+	}
+	return nil, errors.New("has no csv, sql, jsonl, parquet, arrow, xlsx, fixedWidth or command field")
+}
+
+// interpolate resolves environment variable and secret file references
+// in the source of the dataset
+func (dd *datasetDesc) interpolate(ip *interpolator) error {
+	sources := []struct {
+		name string
+		desc interface{}
+	}{
+		{"csv", dd.CSV},
+		{"sql", dd.SQL},
+		{"jsonl", dd.JSONL},
+		{"parquet", dd.Parquet},
+		{"arrow", dd.Arrow},
+		{"xlsx", dd.XLSX},
+		{"fixedWidth", dd.FixedWidth},
+		{"command", dd.Command},
+	}
+	for _, s := range sources {
+		if err := ip.walk(s.desc, s.name+": "); err != nil {
+			return err
+		}
+	}
+	for _, name := range dd.kindNames() {
+		node, err := dd.kinds[name].interpolate(ip)
 		if err != nil {
-			return nil, fmt.Errorf("sql: %s", err)
+			return fmt.Errorf("%s: %s", name, err)
 		}
-		dataset = dsql.New(sqlHandler, dd.Fields)
+		dd.kinds[name] = node
 	}
+	for i, jd := range dd.Joins {
+		if jd == nil || jd.Dataset == nil {
+			continue
+		}
+		if err := jd.Dataset.interpolate(ip); err != nil {
+			return fmt.Errorf("joins: %d: dataset: %s", i, err)
+		}
+	}
+	return nil
+}
 
-	if cfg.MaxNumRecords >= 1 {
-		dataset = dtruncate.New(dataset, cfg.MaxNumRecords)
+// setSQLParams sets the parameters used by sql queries of the dataset
+// and those it joins to
+func (dd *datasetDesc) setSQLParams(params map[string]interface{}) {
+	dd.sqlParams = params
+	for _, jd := range dd.Joins {
+		if jd != nil && jd.Dataset != nil {
+			jd.Dataset.setSQLParams(params)
+		}
 	}
-	// Copy dataset to get stable version
-	buildTmpDir := filepath.Join(cfg.BuildDir, "tmp")
-	if err := os.MkdirAll(buildTmpDir, modePerm); err != nil {
+}
+
+func makeNullSpecs(
+	nulls map[string]*nullDesc,
+	fields []string,
+) (map[string]dnull.Spec, error) {
+	specs := make(map[string]dnull.Spec, len(nulls))
+	for field, nd := range nulls {
+		if !hasField(fields, field) {
+			return nil, fmt.Errorf("nulls: %s: unknown field", field)
+		}
+		if nd == nil {
+			return nil, fmt.Errorf("nulls: %s: missing policy", field)
+		}
+		spec := dnull.Spec{Tokens: nd.Tokens}
+		switch nd.Policy {
+		case "skip":
+			spec.Policy = dnull.Skip
+		case "default":
+			spec.Policy = dnull.Default
+			spec.Default = dlit.NewString(nd.Default)
+		case "category":
+			spec.Policy = dnull.Category
+		case "":
+			return nil, fmt.Errorf("nulls: %s: missing policy", field)
+		default:
+			return nil, fmt.Errorf("nulls: %s: invalid policy: %s", field, nd.Policy)
+		}
+		specs[field] = spec
+	}
+	return specs, nil
+}
+
+// countNulls returns the number of missing values in each field of d,
+// which was made by makeDataset, that has a null policy.  The values are
+// counted in the records of d before they were handled.
+func countNulls(d ddataset.Dataset) (map[string]int64, error) {
+	if s, ok := d.(*splitDataset); ok {
+		d = s.Dataset
+	}
+	if l, ok := d.(*lazyDataset); ok {
+		var err error
+		if d, err = l.get(); err != nil {
+			return nil, err
+		}
+	}
+	if u, ok := d.(*dnull.DUnmark); ok {
+		return u.CountNulls()
+	}
+	return nil, nil
+}
+
+// makeDerivedFields returns the derived fields sorted by name
+func makeDerivedFields(
+	derivedFields map[string]string,
+	fields []string,
+) ([]dderive.Field, error) {
+	names := make([]string, 0, len(derivedFields))
+	for name := range derivedFields {
+		if hasField(fields, name) {
+			return nil, fmt.Errorf("derivedFields: %s: clashes with field", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	derived := make([]dderive.Field, len(names))
+	for i, name := range names {
+		expr, err := dexpr.New(derivedFields[name], map[string]dexpr.CallFun{})
+		if err != nil {
+			return nil, fmt.Errorf("derivedFields: %s: %s", name, err)
+		}
+		derived[i] = dderive.Field{Name: name, Expr: expr}
+	}
+	return derived, nil
+}
+
+// withSplit returns a copy of the dataset description that uses
+// partition of the dataset split according to sd from the copy in source
+func (dd datasetDesc) withSplit(
+	sd *splitDesc,
+	partition dsplit.Partition,
+	source *splitSource,
+) *datasetDesc {
+	dd.split = &dsplit.Spec{
+		Holdout:   sd.Holdout,
+		Seed:      sd.Seed,
+		Stratify:  sd.Stratify,
+		TimeField: sd.TimeField,
+	}
+	dd.partition = partition
+	dd.splitSource = source
+	return &dd
+}
+
+// sample returns how the dataset is to be sampled or nil if it
+// isn't to be sampled
+func (dd *datasetDesc) sample(cfg *config.Config) *report.Sample {
+	if dd.isSplitSource {
+		return nil
+	}
+	s := config.Sample{
+		Method: cfg.Sample.Method,
+		Field:  cfg.Sample.Field,
+		Seed:   cfg.Sample.Seed,
+	}
+	numRecords := cfg.MaxNumRecords
+	if dd.isLookup {
+		numRecords = 0
+	}
+	if dd.Sample != nil {
+		s = config.Sample{
+			Method: dd.Sample.Method,
+			Field:  dd.Sample.Field,
+			Seed:   dd.Sample.Seed,
+		}
+		if dd.Sample.NumRecords >= 1 {
+			numRecords = dd.Sample.NumRecords
+		}
+	}
+	if numRecords < 1 {
+		return nil
+	}
+	if s.Method == "" {
+		s.Method = config.SampleHead
+	}
+	return &report.Sample{
+		Method:     s.Method,
+		Field:      s.Field,
+		Seed:       s.Seed,
+		NumRecords: numRecords,
+	}
+}
+
+func makeSampleDataset(
+	dataset ddataset.Dataset,
+	sample *report.Sample,
+) (ddataset.Dataset, error) {
+	s := config.Sample{
+		Method: sample.Method,
+		Field:  sample.Field,
+		Seed:   sample.Seed,
+	}
+	if err := s.Check(); err != nil {
+		return nil, err
+	}
+	switch s.Method {
+	case config.SampleReservoir:
+		return dsample.NewReservoir(dataset, sample.NumRecords, s.Seed), nil
+	case config.SampleStratified:
+		if !hasField(dataset.Fields(), s.Field) {
+			return nil, dsample.UnknownFieldError(s.Field)
+		}
+		return dsample.NewStratified(
+			dataset,
+			s.Field,
+			sample.NumRecords,
+			s.Seed,
+		), nil
+	}
+	return dtruncate.New(dataset, sample.NumRecords), nil
+}
+
+func hasField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// sources returns the names of the dataset sources specified
+func (dd *datasetDesc) sources() []string {
+	sources := []string{}
+	if dd.CSV != nil {
+		sources = append(sources, "csv")
+	}
+	if dd.SQL != nil {
+		sources = append(sources, "sql")
+	}
+	if dd.JSONL != nil {
+		sources = append(sources, "jsonl")
+	}
+	if dd.Parquet != nil {
+		sources = append(sources, "parquet")
+	}
+	if dd.Arrow != nil {
+		sources = append(sources, "arrow")
+	}
+	if dd.XLSX != nil {
+		sources = append(sources, "xlsx")
+	}
+	if dd.FixedWidth != nil {
+		sources = append(sources, "fixedWidth")
+	}
+	if dd.Command != nil {
+		sources = append(sources, "command")
+	}
+	return append(sources, dd.kindNames()...)
+}
+
+func makeCSVDataset(
+	desc *csvDesc,
+	fields []string,
+) (ddataset.Dataset, error) {
+	if len(desc.Filename) == 0 {
+		return nil, errors.New("csv: missing filename")
+	}
+	if desc.Separator == "" {
+		return nil, errors.New("csv: missing separator")
+	}
+	separator := rune(desc.Separator[0])
+	filenames, err := desc.Filename.expand()
+	if err != nil {
+		return nil, fmt.Errorf("csv: filename: %s", err)
+	}
+	if len(fields) == 0 && desc.HasHeader {
+		if fields, err = dcsv.ReadHeader(filenames[0], separator); err != nil {
+			return nil, err
+		}
+	}
+	return dcsv.NewMulti(filenames, desc.HasHeader, separator, fields), nil
+}
+
+func (l *fileList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var filename string
+	if err := unmarshal(&filename); err == nil {
+		*l = fileList{filename}
+		return nil
+	}
+	var filenames []string
+	if err := unmarshal(&filenames); err != nil {
+		return err
+	}
+	*l = fileList(filenames)
+	return nil
+}
+
+func (l *fileList) UnmarshalJSON(data []byte) error {
+	var filename string
+	if err := json.Unmarshal(data, &filename); err == nil {
+		*l = fileList{filename}
+		return nil
+	}
+	var filenames []string
+	if err := json.Unmarshal(data, &filenames); err != nil {
+		return err
+	}
+	*l = fileList(filenames)
+	return nil
+}
+
+// expand returns the filenames with any glob patterns replaced by the
+// files that match them in lexical order.  A pattern that doesn't
+// match any files is an error.
+func (l fileList) expand() ([]string, error) {
+	filenames := []string{}
+	for _, filename := range l {
+		if filename == "" {
+			return nil, errors.New("empty filename")
+		}
+		if !strings.ContainsAny(filename, "*?[") {
+			filenames = append(filenames, filename)
+			continue
+		}
+		matches, err := filepath.Glob(filename)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", err, filename)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match: %s", filename)
+		}
+		filenames = append(filenames, matches...)
+	}
+	return filenames, nil
+}
+
+func makeSQLDataset(
+	cfg *config.Config,
+	desc *sqlDesc,
+	fields []string,
+	params map[string]interface{},
+) (ddataset.Dataset, error) {
+	source, err := desc.source(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("sql: %s", err)
+	}
+	if desc.Query == "" {
+		return nil, errors.New("sql: missing query")
+	}
+	if _, err := desc.cacheFor(); err != nil {
+		return nil, fmt.Errorf("sql: %s", err)
+	}
+	sqlHandler, err := newSQLHandler(source, desc.Query, params)
+	if err != nil {
+		return nil, fmt.Errorf("sql: %s", err)
+	}
+	if len(fields) == 0 {
+		if fields, err = sqlColumns(sqlHandler); err != nil {
+			return nil, err
+		}
+	}
+	return dsql.New(sqlHandler, fields), nil
+}
+
+// cacheFor returns how long a copy of the rows returned by the query may
+// be cached, 0 if they aren't to be cached
+func (desc *sqlDesc) cacheFor() (time.Duration, error) {
+	if desc.CacheFor == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(desc.CacheFor)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid cacheFor: %s", desc.CacheFor)
+	}
+	return d, nil
+}
+
+// sqlColumns returns the names of the columns returned by the query of h.
+// The query is wrapped so that no rows are returned by the database.
+func sqlColumns(h *sqlHandler) ([]string, error) {
+	if err := h.Open(); err != nil {
 		return nil, err
 	}
-	copyDataset, err := dcopy.New(dataset, buildTmpDir)
+	defer h.Close()
+	rows, cancel, err := h.source.query(sqlColumnsQuery(h.query), h.args...)
 	if err != nil {
 		return nil, err
 	}
-	return copyDataset, nil
+	defer cancel()
+	defer rows.Close()
+	return rows.Columns()
+}
+
+// sqlColumnsQuery returns query wrapped so that it returns its columns
+// without any rows
+func sqlColumnsQuery(query string) string {
+	query = strings.TrimRight(strings.TrimSpace(query), "; \t\r\n")
+	return "SELECT * FROM (" + query + ") rulehunter_columns WHERE 1=0"
+}
+
+// source returns the database described by desc, which is shared if
+// it is a named data source of the config
+func (desc *sqlDesc) source(cfg *config.Config) (*sqlSource, error) {
+	if desc.Source != "" {
+		if desc.DriverName != "" || desc.DataSourceName != "" {
+			return nil,
+				errors.New("can't specify source with driverName or dataSourceName")
+		}
+		ds, ok := cfg.DataSources[desc.Source]
+		if !ok {
+			return nil, fmt.Errorf("unknown source: %s", desc.Source)
+		}
+		return getSQLSource(desc.Source, ds), nil
+	}
+	if desc.DriverName == "" {
+		return nil, errors.New("missing driverName")
+	}
+	if desc.DataSourceName == "" {
+		return nil, errors.New("missing dataSourceName")
+	}
+	return newSQLSource(desc.DriverName, desc.DataSourceName, 0, 0), nil
+}
+
+// newRowsFunc returns a function to find out if there are new rows in
+// the dataset by running the sql newRowsQuery.  If the dataset doesn't
+// have a newRowsQuery it returns nil.
+func (dd *datasetDesc) newRowsFunc(
+	cfg *config.Config,
+) func() (bool, error) {
+	if dd.SQL == nil || dd.SQL.NewRowsQuery == "" {
+		return nil
+	}
+	return func() (bool, error) {
+		n, err := dd.SQL.countNewRows(cfg, dd.sqlParams)
+		if err != nil {
+			return false, fmt.Errorf("hasNewRows: %s", err)
+		}
+		return n > 0, nil
+	}
+}
+
+// countNewRows runs the newRowsQuery, which should return a count as
+// its first column
+func (desc *sqlDesc) countNewRows(
+	cfg *config.Config,
+	params map[string]interface{},
+) (int64, error) {
+	var n int64
+	source, err := desc.source(cfg)
+	if err != nil {
+		return 0, err
+	}
+	h, err := newSQLHandler(source, desc.NewRowsQuery, params)
+	if err != nil {
+		return 0, err
+	}
+	if err := h.Open(); err != nil {
+		return 0, err
+	}
+	defer h.Close()
+	rows, err := h.Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("newRowsQuery returned no rows")
+	}
+	if err := rows.Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, rows.Close()
+}
+
+func makeJSONLDataset(
+	desc *jsonlDesc,
+	fields []string,
+) (ddataset.Dataset, error) {
+	if desc.Filename == "" {
+		return nil, errors.New("jsonl: missing filename")
+	}
+	for field := range desc.FieldPaths {
+		if !hasField(fields, field) {
+			return nil, fmt.Errorf("jsonl: fieldPaths: unknown field: %s", field)
+		}
+	}
+	return djsonl.New(desc.Filename, fields, desc.FieldPaths), nil
+}
+
+func makeParquetDataset(
+	desc *parquetDesc,
+	fields []string,
+) (ddataset.Dataset, error) {
+	if desc.Filename == "" {
+		return nil, errors.New("parquet: missing filename")
+	}
+	return dparquet.New(desc.Filename, fields), nil
+}
+
+func makeArrowDataset(
+	desc *arrowDesc,
+	fields []string,
+) (ddataset.Dataset, error) {
+	if desc.Filename == "" {
+		return nil, errors.New("arrow: missing filename")
+	}
+	return darrow.New(desc.Filename, fields), nil
+}
+
+func makeXLSXDataset(
+	desc *xlsxDesc,
+	fields []string,
+) (ddataset.Dataset, error) {
+	if desc.Filename == "" {
+		return nil, errors.New("xlsx: missing filename")
+	}
+	cellRange := dxlsx.Range{}
+	if desc.Range != "" {
+		var err error
+		if cellRange, err = dxlsx.ParseRange(desc.Range); err != nil {
+			return nil, fmt.Errorf("xlsx: %s", err)
+		}
+	}
+	return dxlsx.New(
+		desc.Filename,
+		desc.Sheet,
+		desc.HasHeader,
+		cellRange,
+		fields,
+	), nil
+}
+
+func makeFixedWidthDataset(
+	desc *fixedWidthDesc,
+	fields []string,
+) (ddataset.Dataset, error) {
+	if desc.Filename == "" {
+		return nil, errors.New("fixedWidth: missing filename")
+	}
+	trim, err := dfixedwidth.ParseTrim(desc.Trim)
+	if err != nil {
+		return nil, fmt.Errorf("fixedWidth: %s", err)
+	}
+	for field := range desc.Columns {
+		if !hasField(fields, field) {
+			return nil, fmt.Errorf("fixedWidth: columns: unknown field: %s", field)
+		}
+	}
+	columns := make(map[string]dfixedwidth.Column, len(fields))
+	for _, field := range fields {
+		cd, ok := desc.Columns[field]
+		if !ok || cd == nil {
+			return nil, fmt.Errorf("fixedWidth: columns: %s: missing", field)
+		}
+		column := dfixedwidth.Column{Start: cd.Start, Length: cd.Length}
+		if column.Trim, err = dfixedwidth.ParseTrim(cd.Trim); err != nil {
+			return nil, fmt.Errorf("fixedWidth: columns: %s: %s", field, err)
+		}
+		if err := column.Check(); err != nil {
+			return nil, fmt.Errorf("fixedWidth: columns: %s: %s", field, err)
+		}
+		columns[field] = column
+	}
+	return dfixedwidth.New(
+		desc.Filename,
+		desc.HasHeader,
+		trim,
+		fields,
+		columns,
+	), nil
 }
 
 func startWorkers(
@@ -216,6 +1088,7 @@ func assessRules(
 	pm *progress.Monitor,
 	q *quitter.Quitter,
 	cfg *config.Config,
+	refine bool,
 ) (*assessment.Assessment, error) {
 	const subRulesStep = 1000
 	var wg sync.WaitGroup
@@ -281,7 +1154,9 @@ func assessRules(
 			}
 		}
 		subResult.Sort(e.SortOrder)
-		subResult.Refine()
+		if refine {
+			subResult.Refine()
+		}
 		return subResult, nil
 	}
 
@@ -316,7 +1191,9 @@ func assessRules(
 	}
 
 	result.Sort(e.SortOrder)
-	result.Refine()
+	if refine {
+		result.Refine()
+	}
 	return result, nil
 }
 
@@ -344,9 +1221,21 @@ func shouldProcessMode(
 	file fileinfo.FileInfo,
 	isFinished bool,
 	pmStamp time.Time,
+	hasNewRows func() (bool, error),
 ) (bool, error) {
+	isFinished, pmStamp = runStatus(file, isFinished, pmStamp)
+	return evalWhenExpr(time.Now(), isFinished, pmStamp, when, hasNewRows)
+}
+
+// runStatus returns whether the experiment in file has finished running
+// and when, taking into account whether file has changed since then
+func runStatus(
+	file fileinfo.FileInfo,
+	isFinished bool,
+	pmStamp time.Time,
+) (bool, time.Time) {
 	if isFinished && file.ModTime().After(pmStamp) {
-		isFinished, pmStamp = false, time.Now()
+		return false, time.Now()
 	}
-	return evalWhenExpr(time.Now(), isFinished, pmStamp, when)
+	return isFinished, pmStamp
 }
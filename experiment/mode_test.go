@@ -1,9 +1,11 @@
 package experiment
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 	"syscall"
@@ -16,7 +18,10 @@ import (
 	"github.com/lawrencewoodman/dexpr"
 	"github.com/vlifesystems/rulehunter/config"
 	"github.com/vlifesystems/rulehunter/fileinfo"
+	"github.com/vlifesystems/rulehunter/internal/dataset"
 	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+	"github.com/vlifesystems/rulehunter/report"
+	"gopkg.in/yaml.v2"
 )
 
 func TestShouldProcessMode(t *testing.T) {
@@ -75,7 +80,7 @@ func TestShouldProcessMode(t *testing.T) {
 	}
 
 	for i, c := range cases {
-		got, err := shouldProcessMode(c.when, c.file, c.isFinished, c.pmStamp)
+		got, err := shouldProcessMode(c.when, c.file, c.isFinished, c.pmStamp, nil)
 		if err != nil {
 			t.Errorf("(%d) shouldProcessMode: %s", i, err)
 			continue
@@ -175,8 +180,293 @@ func TestMakeDataset(t *testing.T) {
 				[]string{"grp", "district", "flow"},
 			),
 		},
+		{desc: &datasetDesc{
+			JSONL: &jsonlDesc{
+				Filename:   filepath.Join("fixtures", "flow.jsonl"),
+				FieldPaths: map[string]string{"district": "location.district"},
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+		},
+			config: &config.Config{
+				MaxNumRecords: -1,
+				BuildDir:      filepath.Join(tmpDir, "build"),
+			},
+			want: dcsv.New(
+				filepath.Join("fixtures", "flow.csv"),
+				true,
+				rune(','),
+				[]string{"group", "district", "height", "flow"},
+			),
+		},
+		{desc: &datasetDesc{
+			Parquet: &parquetDesc{
+				Filename: filepath.Join("fixtures", "flow.parquet"),
+			},
+			Fields: []string{
+				"group", "district", "height", "id", "flow", "ok", "day",
+			},
+		},
+			config: &config.Config{
+				MaxNumRecords: -1,
+				BuildDir:      filepath.Join(tmpDir, "build"),
+			},
+			want: dcsv.New(
+				filepath.Join("fixtures", "flow_typed.csv"),
+				true,
+				rune(','),
+				[]string{"group", "district", "height", "id", "flow", "ok", "day"},
+			),
+		},
+		{desc: &datasetDesc{
+			Arrow: &arrowDesc{
+				Filename: filepath.Join("fixtures", "flow.arrow"),
+			},
+			Fields: []string{
+				"group", "district", "height", "id", "flow", "ok", "day",
+			},
+		},
+			config: &config.Config{
+				MaxNumRecords: 4,
+				BuildDir:      filepath.Join(tmpDir, "build"),
+			},
+			want: dtruncate.New(
+				dcsv.New(
+					filepath.Join("fixtures", "flow_typed.csv"),
+					true,
+					rune(','),
+					[]string{"group", "district", "height", "id", "flow", "ok", "day"},
+				),
+				4,
+			),
+		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv.gz")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+		},
+			config: &config.Config{
+				MaxNumRecords: -1,
+				BuildDir:      filepath.Join(tmpDir, "build"),
+			},
+			want: dcsv.New(
+				filepath.Join("fixtures", "flow.csv"),
+				true,
+				rune(','),
+				[]string{"group", "district", "height", "flow"},
+			),
+		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv.zst")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+		},
+			config: &config.Config{
+				MaxNumRecords: -1,
+				BuildDir:      filepath.Join(tmpDir, "build"),
+			},
+			want: dcsv.New(
+				filepath.Join("fixtures", "flow.csv"),
+				true,
+				rune(','),
+				[]string{"group", "district", "height", "flow"},
+			),
+		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename: fileList{
+					filepath.Join("fixtures", "calls-2026-01-0[12].csv"),
+					filepath.Join("fixtures", "flow.csv.gz"),
+				},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+		},
+			config: &config.Config{
+				MaxNumRecords: 4,
+				BuildDir:      filepath.Join(tmpDir, "build"),
+			},
+			want: dcsv.New(
+				filepath.Join("fixtures", "calls-2026-01.csv"),
+				true,
+				rune(','),
+				[]string{"group", "district", "height", "flow"},
+			),
+		},
+		{desc: &datasetDesc{
+			XLSX: &xlsxDesc{
+				Filename:  filepath.Join("fixtures", "flow.xlsx"),
+				Sheet:     "flow",
+				HasHeader: true,
+				Range:     "B3:E8",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+		},
+			config: &config.Config{
+				MaxNumRecords: -1,
+				BuildDir:      filepath.Join(tmpDir, "build"),
+			},
+			want: dcsv.New(
+				filepath.Join("fixtures", "flow_xlsx.csv"),
+				true,
+				rune(','),
+				[]string{"group", "district", "height", "flow"},
+			),
+		},
+		{desc: &datasetDesc{
+			FixedWidth: &fixedWidthDesc{
+				Filename:  filepath.Join("fixtures", "flow.txt"),
+				HasHeader: true,
+				Columns: map[string]*columnDesc{
+					"group":    {Start: 1, Length: 6},
+					"district": {Start: 7, Length: 10},
+					"height":   {Start: 17, Length: 8},
+					"flow":     {Start: 25, Length: 6},
+				},
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+		},
+			config: &config.Config{
+				MaxNumRecords: -1,
+				BuildDir:      filepath.Join(tmpDir, "build"),
+			},
+			want: dcsv.New(
+				filepath.Join("fixtures", "flow.csv"),
+				true,
+				rune(','),
+				[]string{"group", "district", "height", "flow"},
+			),
+		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+			DerivedFields: map[string]string{
+				"isHigh":  "height > 100",
+				"heightM": "height / 10",
+			},
+		},
+			config: &config.Config{
+				MaxNumRecords: -1,
+				BuildDir:      filepath.Join(tmpDir, "build"),
+			},
+			want: dcsv.New(
+				filepath.Join("fixtures", "flow_derived.csv"),
+				true,
+				rune(','),
+				[]string{"group", "district", "height", "flow", "heightM", "isHigh"},
+			),
+		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields:        []string{"group", "district", "height", "flow"},
+			DerivedFields: map[string]string{"heightM": "height / 10"},
+			Where:         "heightM > 10",
+		},
+			config: &config.Config{
+				MaxNumRecords: -1,
+				BuildDir:      filepath.Join(tmpDir, "build"),
+			},
+			want: dcsv.New(
+				filepath.Join("fixtures", "flow_where.csv"),
+				true,
+				rune(','),
+				[]string{"group", "district", "height", "flow", "heightM"},
+			),
+		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+		},
+			config: &config.Config{
+				MaxNumRecords: 4,
+				BuildDir:      filepath.Join(tmpDir, "build"),
+				Sample:        config.Sample{Method: "reservoir", Seed: 3},
+			},
+			want: dcsv.New(
+				filepath.Join("fixtures", "flow_reservoir.csv"),
+				true,
+				rune(','),
+				[]string{"group", "district", "height", "flow"},
+			),
+		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+			Sample: &sampleDesc{
+				Method:     "stratified",
+				Field:      "group",
+				Seed:       1,
+				NumRecords: 6,
+			},
+		},
+			config: &config.Config{
+				MaxNumRecords: 4,
+				BuildDir:      filepath.Join(tmpDir, "build"),
+				Sample:        config.Sample{Method: "reservoir", Seed: 3},
+			},
+			want: dcsv.New(
+				filepath.Join("fixtures", "flow_stratified.csv"),
+				true,
+				rune(','),
+				[]string{"group", "district", "height", "flow"},
+			),
+		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow_nulls.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+			Nulls: map[string]*nullDesc{
+				"group":    &nullDesc{Policy: "category"},
+				"district": &nullDesc{Policy: "skip"},
+				"height": &nullDesc{
+					Tokens:  []string{"NA"},
+					Policy:  "default",
+					Default: "0",
+				},
+			},
+		},
+			config: &config.Config{
+				MaxNumRecords: -1,
+				BuildDir:      filepath.Join(tmpDir, "build"),
+			},
+			want: dcsv.New(
+				filepath.Join("fixtures", "flow_nulls_handled.csv"),
+				true,
+				rune(','),
+				[]string{"group", "district", "height", "flow"},
+			),
+		},
 	}
 	for i, c := range cases {
+		if !dataset.ZstdSupported && c.desc.CSV != nil &&
+			strings.HasSuffix(c.desc.CSV.Filename[0], ".zst") {
+			continue
+		}
 		got, err := makeDataset(c.config, c.desc)
 		if err != nil {
 			t.Errorf("(%d) makeDataset: %s", i, err)
@@ -205,7 +495,7 @@ func TestMakeDataset_err(t *testing.T) {
 		},
 		{desc: &datasetDesc{
 			CSV: &csvDesc{
-				Filename:  filepath.Join("fixtures", "nonexistant.csv"),
+				Filename:  fileList{filepath.Join("fixtures", "nonexistant.csv")},
 				HasHeader: false,
 				Separator: ",",
 			},
@@ -229,10 +519,210 @@ func TestMakeDataset_err(t *testing.T) {
 				),
 			),
 		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields:        []string{"group", "district", "height", "flow"},
+			DerivedFields: map[string]string{"height": "flow * 2"},
+		},
+			wantOpenErrRegexp: regexp.MustCompile(
+				"^derivedFields: height: clashes with field$",
+			),
+		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields:        []string{"group", "district", "height", "flow"},
+			DerivedFields: map[string]string{"bad": "flow *"},
+		},
+			wantOpenErrRegexp: regexp.MustCompile("^derivedFields: bad: .*$"),
+		},
+		{desc: &datasetDesc{
+			FixedWidth: &fixedWidthDesc{
+				Filename: filepath.Join("fixtures", "flow.txt"),
+				Trim:     "middle",
+				Columns: map[string]*columnDesc{
+					"group": {Start: 1, Length: 6},
+				},
+			},
+			Fields: []string{"group"},
+		},
+			wantOpenErrRegexp: regexp.MustCompile(
+				"^fixedWidth: invalid trim: middle$",
+			),
+		},
+		{desc: &datasetDesc{
+			FixedWidth: &fixedWidthDesc{
+				Filename: filepath.Join("fixtures", "flow.txt"),
+				Columns: map[string]*columnDesc{
+					"group":  {Start: 1, Length: 6},
+					"height": {Start: 0, Length: 8},
+				},
+			},
+			Fields: []string{"group", "height"},
+		},
+			wantOpenErrRegexp: regexp.MustCompile(
+				"^fixedWidth: columns: height: invalid start: 0$",
+			),
+		},
+		{desc: &datasetDesc{
+			FixedWidth: &fixedWidthDesc{
+				Filename: filepath.Join("fixtures", "flow.txt"),
+				Columns: map[string]*columnDesc{
+					"group":  {Start: 1, Length: 6},
+					"region": {Start: 7, Length: 10},
+				},
+			},
+			Fields: []string{"group"},
+		},
+			wantOpenErrRegexp: regexp.MustCompile(
+				"^fixedWidth: columns: unknown field: region$",
+			),
+		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields:        []string{"group", "district", "height", "flow"},
+			DerivedFields: map[string]string{"bad": "width * 2"},
+		},
+			wantOpenErrRegexp: regexp.MustCompile(
+				"^derived field: bad: invalid expression: width \\* 2 " +
+					"\\(variable doesn't exist: width\\)$",
+			),
+		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+			Where:  "height >",
+		},
+			wantOpenErrRegexp: regexp.MustCompile("^where: .*$"),
+		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+			Where:  "height + 1",
+		},
+			wantOpenErrRegexp: regexp.MustCompile(
+				"^where: invalid expression: height \\+ 1 \\(incompatible types\\)$",
+			),
+		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+			Sample: &sampleDesc{Method: "random", NumRecords: 3},
+		},
+			wantOpenErrRegexp: regexp.MustCompile("^sample: invalid method: random$"),
+		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+			Sample: &sampleDesc{
+				Method:     "stratified",
+				Field:      "region",
+				NumRecords: 3,
+			},
+		},
+			wantOpenErrRegexp: regexp.MustCompile("^sample: unknown field: region$"),
+		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+			Nulls:  map[string]*nullDesc{"region": &nullDesc{Policy: "skip"}},
+		},
+			wantOpenErrRegexp: regexp.MustCompile("^nulls: region: unknown field$"),
+		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+			Nulls:  map[string]*nullDesc{"height": &nullDesc{Policy: "mean"}},
+		},
+			wantOpenErrRegexp: regexp.MustCompile(
+				"^nulls: height: invalid policy: mean$",
+			),
+		},
+		{desc: &datasetDesc{
+			CSV: &csvDesc{
+				Filename:  fileList{filepath.Join("fixtures", "flow.csv")},
+				HasHeader: true,
+				Separator: ",",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+			Nulls:  map[string]*nullDesc{"height": &nullDesc{}},
+		},
+			wantOpenErrRegexp: regexp.MustCompile("^nulls: height: missing policy$"),
+		},
+		{desc: &datasetDesc{
+			SQL: &sqlDesc{
+				Source: "warehouse",
+				Query:  "select * from flow",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+		},
+			wantOpenErrRegexp: regexp.MustCompile("^sql: unknown source: warehouse$"),
+		},
+		{desc: &datasetDesc{
+			SQL: &sqlDesc{
+				Source:     "flow",
+				DriverName: "sqlite3",
+				Query:      "select * from flow",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+		},
+			wantOpenErrRegexp: regexp.MustCompile(
+				"^sql: can't specify source with driverName or dataSourceName$",
+			),
+		},
+		{desc: &datasetDesc{
+			SQL: &sqlDesc{
+				Source: "flow",
+			},
+			Fields: []string{"group", "district", "height", "flow"},
+		},
+			wantOpenErrRegexp: regexp.MustCompile("^sql: missing query$"),
+		},
 	}
 	cfg := &config.Config{
 		MaxNumRecords: -1,
 		BuildDir:      filepath.Join(tmpDir, "build"),
+		DataSources: map[string]config.DataSource{
+			"flow": config.DataSource{
+				DriverName:     "sqlite3",
+				DataSourceName: filepath.Join("fixtures", "flow.db"),
+			},
+		},
 	}
 	for i, c := range cases {
 		_, err := makeDataset(cfg, c.desc)
@@ -241,3 +731,180 @@ func TestMakeDataset_err(t *testing.T) {
 		}
 	}
 }
+
+func TestDatasetDescSample(t *testing.T) {
+	cases := []struct {
+		desc *datasetDesc
+		cfg  *config.Config
+		want *report.Sample
+	}{
+		{desc: &datasetDesc{},
+			cfg:  &config.Config{MaxNumRecords: -1},
+			want: nil,
+		},
+		{desc: &datasetDesc{},
+			cfg:  &config.Config{MaxNumRecords: 100},
+			want: &report.Sample{Method: "head", NumRecords: 100},
+		},
+		{desc: &datasetDesc{},
+			cfg: &config.Config{
+				MaxNumRecords: 100,
+				Sample:        config.Sample{Method: "stratified", Field: "group", Seed: 5},
+			},
+			want: &report.Sample{
+				Method:     "stratified",
+				Field:      "group",
+				Seed:       5,
+				NumRecords: 100,
+			},
+		},
+		{desc: &datasetDesc{
+			Sample: &sampleDesc{Method: "reservoir", Seed: 9},
+		},
+			cfg: &config.Config{
+				MaxNumRecords: 100,
+				Sample:        config.Sample{Method: "stratified", Field: "group", Seed: 5},
+			},
+			want: &report.Sample{Method: "reservoir", Seed: 9, NumRecords: 100},
+		},
+		{desc: &datasetDesc{
+			Sample: &sampleDesc{Method: "reservoir", Seed: 9, NumRecords: 20},
+		},
+			cfg:  &config.Config{MaxNumRecords: -1},
+			want: &report.Sample{Method: "reservoir", Seed: 9, NumRecords: 20},
+		},
+	}
+	for i, c := range cases {
+		got := c.desc.sample(c.cfg)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("(%d) sample got: %v, want: %v", i, got, c.want)
+		}
+	}
+}
+
+func TestCountNulls(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cases := []struct {
+		where string
+		nulls map[string]*nullDesc
+		want  map[string]int64
+	}{
+		{nulls: map[string]*nullDesc{
+			"district": &nullDesc{Policy: "category"},
+			"height": &nullDesc{
+				Tokens:  []string{"NA"},
+				Policy:  "default",
+				Default: "0",
+			},
+		},
+			want: map[string]int64{"district": 2, "height": 2},
+		},
+		{where: "group != \"a\"",
+			nulls: map[string]*nullDesc{
+				"district": &nullDesc{Policy: "category"},
+				"height": &nullDesc{
+					Tokens:  []string{"NA"},
+					Policy:  "default",
+					Default: "0",
+				},
+			},
+			want: map[string]int64{"district": 1, "height": 1},
+		},
+		{where: "group != \"a\"",
+			nulls: map[string]*nullDesc{
+				"district": &nullDesc{Policy: "skip"},
+				"height":   &nullDesc{Tokens: []string{"NA"}, Policy: "category"},
+			},
+			want: map[string]int64{"district": 0, "height": 1},
+		},
+		{where: "group != \"a\"",
+			want: nil,
+		},
+	}
+	for i, c := range cases {
+		for _, maxCacheSize := range []int64{-1, 0} {
+			cfg := &config.Config{
+				BuildDir:     filepath.Join(tmpDir, "build"),
+				DatasetCache: config.DatasetCache{MaxSize: maxCacheSize},
+			}
+			dd := &datasetDesc{
+				CSV: &csvDesc{
+					Filename:  fileList{filepath.Join("fixtures", "flow_nulls.csv")},
+					HasHeader: true,
+					Separator: ",",
+				},
+				Fields: []string{"group", "district", "height", "flow"},
+				Nulls:  c.nulls,
+				Where:  c.where,
+			}
+			d, err := makeDataset(cfg, dd)
+			if err != nil {
+				t.Fatalf("(%d) makeDataset: %s", i, err)
+			}
+			if !reflect.DeepEqual(d.Fields(), dd.Fields) {
+				t.Errorf("(%d) Fields got: %v, want: %v", i, d.Fields(), dd.Fields)
+			}
+			got, err := countNulls(d)
+			if err != nil {
+				t.Errorf("(%d) countNulls: %s", i, err)
+			} else if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("(%d) countNulls got: %v, want: %v", i, got, c.want)
+			}
+			d.Release()
+		}
+	}
+}
+
+func TestFileListUnmarshal(t *testing.T) {
+	cases := []struct {
+		yaml string
+		json string
+		want fileList
+	}{
+		{yaml: `filename: "flow.csv"`,
+			json: `{"filename": "flow.csv"}`,
+			want: fileList{"flow.csv"},
+		},
+		{yaml: `filename: ["calls-*.csv", "flow.csv"]`,
+			json: `{"filename": ["calls-*.csv", "flow.csv"]}`,
+			want: fileList{"calls-*.csv", "flow.csv"},
+		},
+	}
+	for i, c := range cases {
+		var gotYAML, gotJSON csvDesc
+		if err := yaml.Unmarshal([]byte(c.yaml), &gotYAML); err != nil {
+			t.Errorf("(%d) yaml.Unmarshal: %s", i, err)
+		} else if !reflect.DeepEqual(gotYAML.Filename, c.want) {
+			t.Errorf("(%d) yaml.Unmarshal got: %v, want: %v",
+				i, gotYAML.Filename, c.want)
+		}
+		if err := json.Unmarshal([]byte(c.json), &gotJSON); err != nil {
+			t.Errorf("(%d) json.Unmarshal: %s", i, err)
+		} else if !reflect.DeepEqual(gotJSON.Filename, c.want) {
+			t.Errorf("(%d) json.Unmarshal got: %v, want: %v",
+				i, gotJSON.Filename, c.want)
+		}
+	}
+}
+
+func TestSQLColumnsQuery(t *testing.T) {
+	cases := []struct {
+		query string
+		want  string
+	}{
+		{query: "select grp, district from flow",
+			want: "SELECT * FROM (select grp, district from flow) " +
+				"rulehunter_columns WHERE 1=0",
+		},
+		{query: " select * from flow where height > ?;\n",
+			want: "SELECT * FROM (select * from flow where height > ?) " +
+				"rulehunter_columns WHERE 1=0",
+		},
+	}
+	for i, c := range cases {
+		if got := sqlColumnsQuery(c.query); got != c.want {
+			t.Errorf("(%d) sqlColumnsQuery got: %s, want: %s", i, got, c.want)
+		}
+	}
+}
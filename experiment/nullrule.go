@@ -0,0 +1,79 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package experiment
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/vlifesystems/rhkit/description"
+	"github.com/vlifesystems/rhkit/rule"
+	"github.com/vlifesystems/rulehunter/internal/dataset/dnull"
+)
+
+// isNullRule represents a rule determining if a field has a missing
+// value that is being treated as a category of its own
+type isNullRule struct {
+	field string
+}
+
+var isNullRuleRegexp = regexp.MustCompile(`^\s*isNull\(\s*(\w+)\s*\)\s*$`)
+
+func newIsNullRule(field string) rule.Rule {
+	return &isNullRule{field: field}
+}
+
+func (r *isNullRule) String() string {
+	return fmt.Sprintf("isNull(%s)", r.field)
+}
+
+func (r *isNullRule) IsTrue(record ddataset.Record) (bool, error) {
+	value, ok := record[r.field]
+	if !ok {
+		return false, rule.InvalidRuleError{Rule: r}
+	}
+	return value.String() == dnull.Value, nil
+}
+
+func (r *isNullRule) Fields() []string {
+	return []string{r.field}
+}
+
+// generateNullRules returns an isNull rule for each of fields that
+// has missing values treated as a category of their own
+func generateNullRules(
+	desc *description.Description,
+	fields []string,
+) []rule.Rule {
+	rules := []rule.Rule{}
+	for _, field := range fields {
+		fd, ok := desc.Fields[field]
+		if !ok {
+			continue
+		}
+		if _, hasNull := fd.Values[dnull.Value]; hasNull {
+			rules = append(rules, newIsNullRule(field))
+		}
+	}
+	return rules
+}
+
+// makeRules makes the rules from the rules field of an experiment,
+// handling isNull rules which aren't understood by dynamic rules
+func makeRules(exprs []string) ([]rule.Rule, error) {
+	rules := make([]rule.Rule, 0, len(exprs))
+	for _, expr := range exprs {
+		if m := isNullRuleRegexp.FindStringSubmatch(expr); m != nil {
+			rules = append(rules, newIsNullRule(m[1]))
+			continue
+		}
+		r, err := rule.NewDynamic(expr)
+		if err != nil {
+			return rules, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
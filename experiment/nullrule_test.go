@@ -0,0 +1,98 @@
+package experiment
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/dlit"
+	"github.com/vlifesystems/rhkit/description"
+	"github.com/vlifesystems/rhkit/rule"
+)
+
+func TestIsNullRuleIsTrue(t *testing.T) {
+	cases := []struct {
+		record ddataset.Record
+		want   bool
+	}{
+		{record: ddataset.Record{"group": dlit.NewString("null")}, want: true},
+		{record: ddataset.Record{"group": dlit.NewString("a")}, want: false},
+		{record: ddataset.Record{"group": dlit.NewString("")}, want: false},
+	}
+	r := newIsNullRule("group")
+	for i, c := range cases {
+		got, err := r.IsTrue(c.record)
+		if err != nil {
+			t.Errorf("(%d) IsTrue: %s", i, err)
+		} else if got != c.want {
+			t.Errorf("(%d) IsTrue got: %t, want: %t", i, got, c.want)
+		}
+	}
+}
+
+func TestIsNullRuleIsTrue_error(t *testing.T) {
+	r := newIsNullRule("region")
+	wantErr := rule.InvalidRuleError{Rule: r}
+	record := ddataset.Record{"group": dlit.NewString("null")}
+	if _, err := r.IsTrue(record); err != wantErr {
+		t.Errorf("IsTrue got err: %v, want: %v", err, wantErr)
+	}
+}
+
+func TestIsNullRuleString(t *testing.T) {
+	r := newIsNullRule("group")
+	want := "isNull(group)"
+	if got := r.String(); got != want {
+		t.Errorf("String got: %s, want: %s", got, want)
+	}
+	if got := r.Fields(); !reflect.DeepEqual(got, []string{"group"}) {
+		t.Errorf("Fields got: %v, want: [group]", got)
+	}
+}
+
+func TestGenerateNullRules(t *testing.T) {
+	desc := &description.Description{
+		Fields: map[string]*description.Field{
+			"group": &description.Field{
+				Kind: description.String,
+				Values: map[string]description.Value{
+					"a":    description.Value{Value: dlit.NewString("a"), Num: 3},
+					"null": description.Value{Value: dlit.NewString("null"), Num: 1},
+				},
+			},
+			"district": &description.Field{
+				Kind: description.String,
+				Values: map[string]description.Value{
+					"northcal": description.Value{
+						Value: dlit.NewString("northcal"),
+						Num:   4,
+					},
+				},
+			},
+		},
+	}
+	got := generateNullRules(desc, []string{"district", "group", "height"})
+	want := []rule.Rule{newIsNullRule("group")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("generateNullRules got: %v, want: %v", got, want)
+	}
+}
+
+func TestMakeRules(t *testing.T) {
+	exprs := []string{"isNull(group)", "height > 100", " isNull( district ) "}
+	want := []string{"isNull(group)", "height > 100", "isNull(district)"}
+	rules, err := makeRules(exprs)
+	if err != nil {
+		t.Fatalf("makeRules: %s", err)
+	}
+	got := make([]string, len(rules))
+	for i, r := range rules {
+		got[i] = r.String()
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("makeRules got: %v, want: %v", got, want)
+	}
+	if _, err := makeRules([]string{"height >"}); err == nil {
+		t.Errorf("makeRules got: nil, want: error")
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package experiment
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vlifesystems/rhkit/rule"
+	"github.com/vlifesystems/rulehunter/config"
+)
+
+// rulesFromDesc describes where to load rules from to add to the rules
+// of an experiment.  Either File or Experiment must be given.
+type rulesFromDesc struct {
+	// File is a text file with one rule per line, or a JSON file with an
+	// array of rules.  In a text file blank lines and lines starting
+	// with '#' are ignored.  If relative it is relative to the
+	// experiments directory.
+	File string `yaml:"file"`
+	// Experiment is an experiment file, relative to the experiments
+	// directory, whose latest train report the best rules are taken from
+	Experiment string `yaml:"experiment"`
+	// NumRules is the maximum number of rules to use.  It must be given
+	// for an experiment, for a file 0 means all of its rules.
+	NumRules int `yaml:"numRules"`
+	// Whether the experiment is only being validated, so that its
+	// reports needn't exist yet
+	isDescribeOnly bool
+}
+
+// makeRulesFrom returns the rules loaded from the sources described by
+// descs, leaving out any duplicates
+func makeRulesFrom(
+	cfg *config.Config,
+	descs []*rulesFromDesc,
+) ([]rule.Rule, error) {
+	exprs := []string{}
+	for _, d := range descs {
+		var sourceExprs []string
+		var err error
+		switch {
+		case d.File != "" && d.Experiment != "":
+			return nil, errors.New("can't have both file and experiment")
+		case d.File != "":
+			filename := d.File
+			if !filepath.IsAbs(filename) {
+				filename = filepath.Join(cfg.ExperimentsDir, filename)
+			}
+			sourceExprs, err = loadRulesFile(filename, d.NumRules)
+			if err != nil {
+				return nil, fmt.Errorf("file: %s", err)
+			}
+		case d.Experiment != "":
+			sourceExprs, err = loadReportRules(
+				cfg,
+				d.Experiment,
+				d.NumRules,
+				d.isDescribeOnly,
+			)
+			if err != nil {
+				return nil, fmt.Errorf("experiment: %s: %s", d.Experiment, err)
+			}
+		default:
+			return nil, errors.New("missing file or experiment")
+		}
+		for _, expr := range sourceExprs {
+			if !hasField(exprs, expr) {
+				exprs = append(exprs, expr)
+			}
+		}
+	}
+	return makeRules(exprs)
+}
+
+// loadReportRules returns up to numRules of the best rules from the
+// latest train report of the experiment in filename.  An error is
+// returned if the experiment doesn't have a train report.  If
+// isDescribeOnly the reports aren't read and no rules are returned.
+func loadReportRules(
+	cfg *config.Config,
+	filename string,
+	numRules int,
+	isDescribeOnly bool,
+) ([]string, error) {
+	ext := filepath.Ext(filename)
+	if ext != ".json" && ext != ".yaml" {
+		return nil, InvalidExtError(ext)
+	}
+	if numRules < 1 {
+		return nil, errors.New("numRules: must be at least 1")
+	}
+	if isDescribeOnly {
+		return []string{}, nil
+	}
+	latest, err := latestTrainReports(cfg, filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(latest) == 0 {
+		return nil, errors.New("no train report found")
+	}
+	return reportsBestRules(latest, numRules), nil
+}
+
+// loadRulesFile returns up to numRules of the rules in filename, or all
+// of them if numRules is 0
+func loadRulesFile(filename string, numRules int) ([]string, error) {
+	if numRules < 0 {
+		return nil, errors.New("numRules: must be at least 0")
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	exprs := []string{}
+	if filepath.Ext(filename) == ".json" {
+		if err := json.NewDecoder(f).Decode(&exprs); err != nil {
+			return nil, fmt.Errorf("%s: %s", filename, err)
+		}
+	} else {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			exprs = append(exprs, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %s", filename, err)
+		}
+	}
+	if numRules > 0 && len(exprs) > numRules {
+		exprs = exprs[:numRules]
+	}
+	return exprs, nil
+}
+
+// appendNewRules appends the rules in newRules to rules that aren't
+// already in it
+func appendNewRules(rules []rule.Rule, newRules ...rule.Rule) []rule.Rule {
+	for _, nr := range newRules {
+		isNew := true
+		for _, r := range rules {
+			if r.String() == nr.String() {
+				isNew = false
+				break
+			}
+		}
+		if isNew {
+			rules = append(rules, nr)
+		}
+	}
+	return rules
+}
@@ -0,0 +1,183 @@
+package experiment
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vlifesystems/rhkit/rule"
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+	"github.com/vlifesystems/rulehunter/report"
+)
+
+func TestLoad_rulesFrom(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	reports := []*report.Report{
+		{Mode: report.Train,
+			Title:              "old",
+			Stamp:              time.Now().Add(-time.Hour),
+			ExperimentFilename: "flow.yaml",
+			Assessments: []*report.Assessment{
+				{Rule: "height > 5"},
+			},
+		},
+		{Mode: report.Train,
+			Title:              "new",
+			Stamp:              time.Now(),
+			ExperimentFilename: "flow.yaml",
+			Assessments: []*report.Assessment{
+				{Rule: "flow < 9.42"},
+				{Rule: "true()"},
+				{Rule: "height >= 10"},
+				{Rule: "height >= 20"},
+			},
+		},
+		{Mode: report.Test,
+			Title:              "new",
+			Stamp:              time.Now(),
+			ExperimentFilename: "flow.yaml",
+			Assessments: []*report.Assessment{
+				{Rule: "height > 30"},
+			},
+		},
+	}
+	for _, r := range reports {
+		if err := r.WriteJSON(cfg); err != nil {
+			t.Fatalf("WriteJSON: %s", err)
+		}
+	}
+
+	file := testhelpers.NewFileInfo(
+		filepath.Join("fixtures", "flow_rulesfrom.yaml"),
+		time.Now(),
+	)
+	e, err := Load(cfg, file)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	defer e.Release()
+	got := make([]string, len(e.Rules))
+	for i, r := range e.Rules {
+		got[i] = r.String()
+	}
+	want := []string{
+		"group == \"a\"",
+		"height > 67",
+		"district != \"northcal\" && group == \"b\"",
+		"flow < 9.42",
+		"height >= 10",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load: Rules got: %q, want: %q", got, want)
+	}
+}
+
+func TestMakeRulesFrom_workingDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd: %s", err)
+	}
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		ExperimentsDir: wd,
+		MaxNumRecords:  -1,
+		BuildDir:       filepath.Join(tmpDir, "build"),
+	}
+	// The file is relative to the experiments directory rather than
+	// the working directory
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Chdir: %s", err)
+	}
+	defer os.Chdir(wd)
+	desc := &rulesFromDesc{File: filepath.Join("fixtures", "flow_rules.txt")}
+	rules, err := makeRulesFrom(cfg, []*rulesFromDesc{desc})
+	if err != nil {
+		t.Fatalf("makeRulesFrom: %s", err)
+	}
+	got := make([]string, len(rules))
+	for i, r := range rules {
+		got[i] = r.String()
+	}
+	want := []string{
+		"height > 67",
+		"group == \"a\"",
+		"district != \"northcal\" && group == \"b\"",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("makeRulesFrom got: %q, want: %q", got, want)
+	}
+}
+
+func TestMakeRulesFrom_errors(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	cases := []struct {
+		desc    *rulesFromDesc
+		wantErr error
+	}{
+		{desc: &rulesFromDesc{},
+			wantErr: errors.New("missing file or experiment"),
+		},
+		{desc: &rulesFromDesc{
+			File:       filepath.Join("fixtures", "flow_rules.txt"),
+			Experiment: "flow.yaml",
+		},
+			wantErr: errors.New("can't have both file and experiment"),
+		},
+		{desc: &rulesFromDesc{
+			File:     filepath.Join("fixtures", "flow_rules.txt"),
+			NumRules: -1,
+		},
+			wantErr: errors.New("file: numRules: must be at least 0"),
+		},
+		{desc: &rulesFromDesc{File: filepath.Join("fixtures", "nonexistent.txt")},
+			wantErr: errors.New("file: open " +
+				filepath.Join("fixtures", "nonexistent.txt") +
+				": no such file or directory"),
+		},
+		{desc: &rulesFromDesc{
+			File: filepath.Join("fixtures", "flow_rules_invalid.txt"),
+		},
+			wantErr: rule.InvalidExprError{Expr: "flow < <= 9.42"},
+		},
+		{desc: &rulesFromDesc{File: filepath.Join("fixtures", "flow.json")},
+			wantErr: errors.New("file: " + filepath.Join("fixtures", "flow.json") +
+				": json: cannot unmarshal object into Go value of type []string"),
+		},
+		{desc: &rulesFromDesc{Experiment: "flow.yaml"},
+			wantErr: errors.New(
+				"experiment: flow.yaml: numRules: must be at least 1",
+			),
+		},
+		{desc: &rulesFromDesc{Experiment: "flow.csv", NumRules: 1},
+			wantErr: errors.New(
+				"experiment: flow.csv: invalid extension: .csv",
+			),
+		},
+		{desc: &rulesFromDesc{Experiment: "nonexistent.yaml", NumRules: 1},
+			wantErr: errors.New(
+				"experiment: nonexistent.yaml: no train report found",
+			),
+		},
+	}
+	for i, c := range cases {
+		_, err := makeRulesFrom(cfg, []*rulesFromDesc{c.desc})
+		if err == nil || err.Error() != c.wantErr.Error() {
+			t.Errorf("(%d) makeRulesFrom err: %v, wantErr: %v", i, err, c.wantErr)
+		}
+	}
+}
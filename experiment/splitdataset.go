@@ -0,0 +1,112 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package experiment
+
+import (
+	"sync"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/vlifesystems/rulehunter/config"
+)
+
+// splitSource is the copy of a dataset that the partitions of a split
+// are made from.  It is only copied once, so that the partitions are
+// made from the same records even if the source changes between reads.
+type splitSource struct {
+	mu       sync.Mutex
+	dataset  *lazyDataset
+	numUsers int
+}
+
+// splitDataset is a partition of a split dataset
+type splitDataset struct {
+	ddataset.Dataset
+	source *splitSource
+}
+
+func newSplitSource() *splitSource {
+	return &splitSource{}
+}
+
+// acquire returns the copy of the dataset described by dd before it is
+// split, making it the first time that it is acquired.  It must be
+// released once finished with.
+func (s *splitSource) acquire(
+	cfg *config.Config,
+	dd *datasetDesc,
+) (*lazyDataset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dataset == nil {
+		sourceDesc := *dd
+		sourceDesc.split = nil
+		sourceDesc.isSplitSource = true
+		d, err := makeLazyDataset(cfg, &sourceDesc)
+		if err != nil {
+			return nil, err
+		}
+		s.dataset = d
+	}
+	s.numUsers++
+	return s.dataset, nil
+}
+
+// release releases the copy once it has been released by all the
+// partitions that acquired it
+func (s *splitSource) release() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.numUsers--
+	if s.numUsers > 0 {
+		return nil
+	}
+	err := s.dataset.Release()
+	s.dataset = nil
+	return err
+}
+
+// makeSplitDataset returns the partition of the dataset described by
+// dd, which is split from the copy shared by the partitions and then
+// sampled.  If when uses hasNewRows the dataset isn't copied until it
+// is first used.
+func makeSplitDataset(
+	cfg *config.Config,
+	dd *datasetDesc,
+	when *dexpr.Expr,
+) (ddataset.Dataset, error) {
+	source, err := dd.splitSource.acquire(cfg, dd)
+	if err != nil {
+		return nil, err
+	}
+	partitionDesc := &datasetDesc{
+		Sample:    dd.Sample,
+		split:     dd.split,
+		partition: dd.partition,
+	}
+	dataset, err := makeStagesDataset(cfg, partitionDesc, source)
+	if err != nil {
+		dd.splitSource.release()
+		return nil, err
+	}
+	if dd.newRowsFunc(cfg) == nil || !usesHasNewRows(when) {
+		if _, err := source.get(); err != nil {
+			dd.splitSource.release()
+			return nil, err
+		}
+	}
+	return &splitDataset{
+		Dataset: dd.unmarkNulls(dataset),
+		source:  dd.splitSource,
+	}, nil
+}
+
+// Release releases any resources associated with the Dataset d,
+// rendering it unusable in the future.
+func (d *splitDataset) Release() error {
+	if err := d.Dataset.Release(); err != nil {
+		return err
+	}
+	return d.source.release()
+}
@@ -8,10 +8,10 @@
 package experiment
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	"os"
 	"sync"
 
 	_ "github.com/denisenkom/go-mssqldb"
@@ -22,31 +22,39 @@ import (
 var errDatabaseNotOpen = errors.New("connection to database not open")
 
 type sqlHandler struct {
-	driverName     string
-	dataSourceName string
-	query          string
-	db             *sql.DB
-	openConn       int
+	source   *sqlSource
+	query    string
+	args     []interface{}
+	openConn int
+	// Cancels the queries of the connections opened by the handler
+	cancels []context.CancelFunc
 	sync.Mutex
 }
 
+// newSQLHandler returns a handler to run query on source.  Any :name
+// parameters in query are replaced by their values from params.
 func newSQLHandler(
-	driverName string,
-	dataSourceName string,
+	source *sqlSource,
 	query string,
+	params map[string]interface{},
 ) (*sqlHandler, error) {
+	driverName := source.driverName
 	if driverName == "sqlite3" {
 		return nil, fmt.Errorf("invalid driverName: sqlite3, this is temporarily disabled in this release")
 	}
 	validSQLDriverNames := []string{"sqlite3", "mysql", "mssql", "postgres"}
 	for _, name := range validSQLDriverNames {
 		if name == driverName {
+			boundQuery, args, err := bindSQLParams(driverName, query, params)
+			if err != nil {
+				return nil, fmt.Errorf("query: %s", err)
+			}
 			return &sqlHandler{
-				driverName:     driverName,
-				dataSourceName: dataSourceName,
-				query:          query,
-				db:             nil,
-				openConn:       0,
+				source:   source,
+				query:    boundQuery,
+				args:     args,
+				openConn: 0,
+				cancels:  []context.CancelFunc{},
 			}, nil
 		}
 	}
@@ -54,32 +62,30 @@ func newSQLHandler(
 }
 
 func (s *sqlHandler) Open() error {
+	if err := s.source.open(); err != nil {
+		return err
+	}
 	s.Lock()
 	defer s.Unlock()
-	if s.openConn == 0 {
-		if s.driverName == "sqlite3" && !fileExists(s.dataSourceName) {
-			return fmt.Errorf("database doesn't exist: %s", s.dataSourceName)
-		}
-		db, err := sql.Open(s.driverName, s.dataSourceName)
-		s.db = db
-		if err != nil {
-			return err
-		}
-	}
 	s.openConn++
 	return nil
 }
 
 func (s *sqlHandler) Close() error {
 	s.Lock()
-	defer s.Unlock()
-	if s.openConn >= 1 {
-		s.openConn--
-		if s.openConn == 0 {
-			return s.db.Close()
+	if s.openConn < 1 {
+		s.Unlock()
+		return nil
+	}
+	s.openConn--
+	if s.openConn == 0 {
+		for _, cancel := range s.cancels {
+			cancel()
 		}
+		s.cancels = []context.CancelFunc{}
 	}
-	return nil
+	s.Unlock()
+	return s.source.close()
 }
 
 func (s *sqlHandler) Rows() (*sql.Rows, error) {
@@ -89,17 +95,13 @@ func (s *sqlHandler) Rows() (*sql.Rows, error) {
 		return nil, errDatabaseNotOpen
 	}
 	s.Unlock()
-	rows, err := s.db.Query(s.query)
+	rows, cancel, err := s.source.query(s.query, s.args...)
 	if err != nil {
 		s.Close()
+		return nil, err
 	}
-	return rows, err
-}
-
-func fileExists(path string) bool {
-	fi, err := os.Stat(path)
-	if err != nil {
-		return false
-	}
-	return fi.Mode().IsRegular()
+	s.Lock()
+	s.cancels = append(s.cancels, cancel)
+	s.Unlock()
+	return rows, nil
 }
@@ -28,7 +28,11 @@ func TestOpenRowsClose(t *testing.T) {
 	}
 
 	filename := filepath.Join("fixtures", "flow.db")
-	h, err := newSQLHandler("sqlite3", filename, "select * from flow")
+	h, err := newSQLHandler(
+		newSQLSource("sqlite3", filename, 0, 0),
+		"select * from flow",
+		nil,
+	)
 	if err != nil {
 		t.Fatalf("newSQLHandler: err: %v", err)
 	}
@@ -70,7 +74,11 @@ func TestOpenRowsClose(t *testing.T) {
 
 func TestOpenRowsClose_errors(t *testing.T) {
 	filename := filepath.Join("fixtures", "flow.db")
-	h, err := newSQLHandler("sqlite3", filename, "select * from flow")
+	h, err := newSQLHandler(
+		newSQLSource("sqlite3", filename, 0, 0),
+		"select * from flow",
+		nil,
+	)
 	if err != nil {
 		t.Fatalf("newSQLHandler: err: %v", err)
 	}
@@ -0,0 +1,123 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package experiment
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// UnknownSQLParamError indicates that a query refers to a parameter
+// that doesn't exist
+type UnknownSQLParamError string
+
+func (e UnknownSQLParamError) Error() string {
+	return "unknown parameter: " + string(e)
+}
+
+// makeSQLParams returns the parameters available to sql queries.  These
+// are the variables available to when expressions along with
+// lastRunStamp, which is the zero time if the experiment hasn't run.
+func makeSQLParams(
+	now time.Time,
+	isFinished bool,
+	stamp time.Time,
+) map[string]interface{} {
+	params := whenVars(now, isFinished, stamp)
+	if isFinished {
+		params["lastRunStamp"] = stamp
+	} else {
+		params["lastRunStamp"] = time.Time{}
+	}
+	return params
+}
+
+// bindSQLParams replaces the :name parameters in query with the
+// placeholders used by driverName and returns the query along with
+// the arguments to pass with it.  Quoted text and comments are left
+// as they are.
+func bindSQLParams(
+	driverName string,
+	query string,
+	params map[string]interface{},
+) (string, []interface{}, error) {
+	var r bytes.Buffer
+	args := []interface{}{}
+	var quote rune
+	runes := []rune(query)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			j := skipUntil(runes, i+2, "\n")
+			r.WriteString(string(runes[i:j]))
+			i = j - 1
+			continue
+		case c == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			j := skipUntil(runes, i+2, "*/")
+			r.WriteString(string(runes[i:j]))
+			i = j - 1
+			continue
+		case c == ':' && i+1 < len(runes) && runes[i+1] == ':':
+			// A postgres type cast such as: value::date
+			r.WriteString("::")
+			i++
+			continue
+		case c == ':' && i+1 < len(runes) && isParamStart(runes[i+1]):
+			j := i + 1
+			for j < len(runes) && isParamChar(runes[j]) {
+				j++
+			}
+			name := string(runes[i+1 : j])
+			value, ok := params[name]
+			if !ok {
+				return "", nil, UnknownSQLParamError(name)
+			}
+			args = append(args, value)
+			r.WriteString(sqlPlaceholder(driverName, len(args)))
+			i = j - 1
+			continue
+		}
+		r.WriteRune(c)
+	}
+	return r.String(), args, nil
+}
+
+// skipUntil returns the index in runes after the first end found from
+// start or the length of runes if it isn't found
+func skipUntil(runes []rune, start int, end string) int {
+	endRunes := []rune(end)
+	for i := start; i+len(endRunes) <= len(runes); i++ {
+		if string(runes[i:i+len(endRunes)]) == end {
+			return i + len(endRunes)
+		}
+	}
+	return len(runes)
+}
+
+// sqlPlaceholder returns the placeholder for the nth argument of a query
+func sqlPlaceholder(driverName string, n int) string {
+	switch driverName {
+	case "postgres":
+		return fmt.Sprintf("$%d", n)
+	case "mssql":
+		return fmt.Sprintf("@p%d", n)
+	}
+	return "?"
+}
+
+func isParamStart(c rune) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isParamChar(c rune) bool {
+	return isParamStart(c) || (c >= '0' && c <= '9')
+}
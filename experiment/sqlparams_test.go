@@ -0,0 +1,120 @@
+package experiment
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMakeSQLParams(t *testing.T) {
+	now := time.Date(2018, time.March, 14, 10, 30, 0, 0, time.UTC)
+	stamp := time.Date(2018, time.March, 14, 8, 0, 0, 0, time.UTC)
+	cases := []struct {
+		isFinished       bool
+		wantLastRunStamp time.Time
+		wantHasRunToday  bool
+	}{
+		{isFinished: true, wantLastRunStamp: stamp, wantHasRunToday: true},
+		{isFinished: false, wantLastRunStamp: time.Time{}, wantHasRunToday: false},
+	}
+	for i, c := range cases {
+		params := makeSQLParams(now, c.isFinished, stamp)
+		if got := params["lastRunStamp"]; got != c.wantLastRunStamp {
+			t.Errorf("(%d) lastRunStamp got: %v, want: %v",
+				i, got, c.wantLastRunStamp)
+		}
+		if got := params["hasRunToday"]; got != c.wantHasRunToday {
+			t.Errorf("(%d) hasRunToday got: %v, want: %t",
+				i, got, c.wantHasRunToday)
+		}
+		if got := params["sinceLastRunMinutes"]; got != int64(150) {
+			t.Errorf("(%d) sinceLastRunMinutes got: %v, want: 150", i, got)
+		}
+	}
+}
+
+func TestBindSQLParams(t *testing.T) {
+	stamp := time.Date(2018, time.March, 14, 8, 0, 0, 0, time.UTC)
+	params := map[string]interface{}{
+		"lastRunStamp": stamp,
+		"hasRun":       true,
+	}
+	cases := []struct {
+		driverName string
+		query      string
+		wantQuery  string
+		wantArgs   []interface{}
+	}{
+		{driverName: "sqlite3",
+			query:     "select * from flow",
+			wantQuery: "select * from flow",
+			wantArgs:  []interface{}{},
+		},
+		{driverName: "sqlite3",
+			query:     "select * from flow where stamp > :lastRunStamp",
+			wantQuery: "select * from flow where stamp > ?",
+			wantArgs:  []interface{}{stamp},
+		},
+		{driverName: "mysql",
+			query:     "select * from flow where stamp > :lastRunStamp or :hasRun=0",
+			wantQuery: "select * from flow where stamp > ? or ?=0",
+			wantArgs:  []interface{}{stamp, true},
+		},
+		{driverName: "postgres",
+			query: "select * from flow where stamp::date > :lastRunStamp " +
+				"and :hasRun",
+			wantQuery: "select * from flow where stamp::date > $1 and $2",
+			wantArgs:  []interface{}{stamp, true},
+		},
+		{driverName: "mssql",
+			query:     "select * from flow where stamp > :lastRunStamp",
+			wantQuery: "select * from flow where stamp > @p1",
+			wantArgs:  []interface{}{stamp},
+		},
+		{driverName: "sqlite3",
+			query: "select * from flow where name = ':notParam' " +
+				`and "col:x" = 'it''s :notParam' and stamp > :lastRunStamp`,
+			wantQuery: "select * from flow where name = ':notParam' " +
+				`and "col:x" = 'it''s :notParam' and stamp > ?`,
+			wantArgs: []interface{}{stamp},
+		},
+		{driverName: "mysql",
+			query: "select * from flow -- skip :notParam's\n" +
+				"where /* :notParam\n:notParam */ stamp > :lastRunStamp " +
+				"and `col:x` = 1 /* :notParam",
+			wantQuery: "select * from flow -- skip :notParam's\n" +
+				"where /* :notParam\n:notParam */ stamp > ? " +
+				"and `col:x` = 1 /* :notParam",
+			wantArgs: []interface{}{stamp},
+		},
+		{driverName: "postgres",
+			query:     "select * from flow where height - -1 > 0 -- :notParam",
+			wantQuery: "select * from flow where height - -1 > 0 -- :notParam",
+			wantArgs:  []interface{}{},
+		},
+	}
+	for i, c := range cases {
+		gotQuery, gotArgs, err := bindSQLParams(c.driverName, c.query, params)
+		if err != nil {
+			t.Errorf("(%d) bindSQLParams: %s", i, err)
+			continue
+		}
+		if gotQuery != c.wantQuery {
+			t.Errorf("(%d) bindSQLParams got query: %s, want: %s",
+				i, gotQuery, c.wantQuery)
+		}
+		if !reflect.DeepEqual(gotArgs, c.wantArgs) {
+			t.Errorf("(%d) bindSQLParams got args: %v, want: %v",
+				i, gotArgs, c.wantArgs)
+		}
+	}
+}
+
+func TestBindSQLParams_errors(t *testing.T) {
+	query := "select * from flow where stamp > :lastRunTime"
+	wantErr := UnknownSQLParamError("lastRunTime")
+	_, _, err := bindSQLParams("sqlite3", query, map[string]interface{}{})
+	if err != wantErr {
+		t.Errorf("bindSQLParams got err: %v, want: %v", err, wantErr)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package experiment
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vlifesystems/rulehunter/config"
+)
+
+// sqlSource is a connection pool to a database.  Those created from
+// the named dataSources of the config are shared by every experiment
+// that refers to them and kept open until they are replaced or
+// CloseDataSources is called.  Others are closed once they aren't used.
+type sqlSource struct {
+	driverName     string
+	dataSourceName string
+	maxOpenConns   int
+	queryTimeout   time.Duration
+	db             *sql.DB
+	openConn       int
+	isShared       bool
+	isReplaced     bool
+	sync.Mutex
+}
+
+var (
+	sqlSourcesMu sync.Mutex
+	sqlSources   = map[string]*sqlSource{}
+)
+
+func newSQLSource(
+	driverName string,
+	dataSourceName string,
+	maxOpenConns int,
+	queryTimeout time.Duration,
+) *sqlSource {
+	return &sqlSource{
+		driverName:     driverName,
+		dataSourceName: dataSourceName,
+		maxOpenConns:   maxOpenConns,
+		queryTimeout:   queryTimeout,
+		db:             nil,
+		openConn:       0,
+	}
+}
+
+// getSQLSource returns the shared sqlSource for the named data source ds.
+// If the settings of ds have changed the old source is closed once it is
+// no longer used.
+func getSQLSource(name string, ds config.DataSource) *sqlSource {
+	sqlSourcesMu.Lock()
+	defer sqlSourcesMu.Unlock()
+	old, ok := sqlSources[name]
+	if ok &&
+		old.driverName == ds.DriverName &&
+		old.dataSourceName == ds.DataSourceName &&
+		old.maxOpenConns == ds.MaxOpenConns &&
+		old.queryTimeout == ds.QueryTimeout {
+		return old
+	}
+	if ok {
+		old.replace()
+	}
+	s := newSQLSource(
+		ds.DriverName,
+		ds.DataSourceName,
+		ds.MaxOpenConns,
+		ds.QueryTimeout,
+	)
+	s.isShared = true
+	sqlSources[name] = s
+	return s
+}
+
+// CloseDataSources closes the connection pools to the named dataSources
+// of the config, which are kept open between experiments.  It should be
+// called once no more experiments are to be processed.
+func CloseDataSources() error {
+	sqlSourcesMu.Lock()
+	defer sqlSourcesMu.Unlock()
+	var firstErr error
+	for name, s := range sqlSources {
+		s.Lock()
+		if err := s.closeDB(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		s.Unlock()
+		delete(sqlSources, name)
+	}
+	return firstErr
+}
+
+// replace marks the source as no longer shared, closing it now if it
+// isn't in use or otherwise once it is no longer used
+func (s *sqlSource) replace() {
+	s.Lock()
+	defer s.Unlock()
+	s.isReplaced = true
+	if s.openConn == 0 {
+		s.closeDB()
+	}
+}
+
+func (s *sqlSource) open() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.db == nil {
+		if s.driverName == "sqlite3" && !fileExists(s.dataSourceName) {
+			return fmt.Errorf("database doesn't exist: %s", s.dataSourceName)
+		}
+		db, err := sql.Open(s.driverName, s.dataSourceName)
+		if err != nil {
+			return err
+		}
+		db.SetMaxOpenConns(s.maxOpenConns)
+		s.db = db
+	}
+	s.openConn++
+	return nil
+}
+
+func (s *sqlSource) close() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.openConn >= 1 {
+		s.openConn--
+		if s.openConn == 0 && (!s.isShared || s.isReplaced) {
+			return s.closeDB()
+		}
+	}
+	return nil
+}
+
+// closeDB closes the connection pool, if it is open.  The source must be
+// locked.
+func (s *sqlSource) closeDB() error {
+	if s.db == nil {
+		return nil
+	}
+	err := s.db.Close()
+	s.db = nil
+	return err
+}
+
+// query runs query with args on the database.  The returned cancel
+// function must be called once the rows are no longer needed.
+func (s *sqlSource) query(
+	query string,
+	args ...interface{},
+) (*sql.Rows, context.CancelFunc, error) {
+	s.Lock()
+	if s.openConn < 1 {
+		s.Unlock()
+		return nil, nil, errDatabaseNotOpen
+	}
+	db := s.db
+	s.Unlock()
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if s.queryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, s.queryTimeout)
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return rows, cancel, nil
+}
+
+func fileExists(path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return fi.Mode().IsRegular()
+}
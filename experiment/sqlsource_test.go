@@ -0,0 +1,142 @@
+package experiment
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vlifesystems/rulehunter/config"
+)
+
+func TestGetSQLSource(t *testing.T) {
+	ds := config.DataSource{
+		DriverName:     "mysql",
+		DataSourceName: "fred:secret@tcp(127.0.0.1:9999)/master",
+		MaxOpenConns:   2,
+		QueryTimeout:   time.Minute,
+	}
+	s1 := getSQLSource("testwarehouse", ds)
+	s2 := getSQLSource("testwarehouse", ds)
+	if s1 != s2 {
+		t.Errorf("getSQLSource didn't return the shared source")
+	}
+	if s := getSQLSource("testwarehouse2", ds); s == s1 {
+		t.Errorf("getSQLSource returned the same source for a different name")
+	}
+	ds.MaxOpenConns = 4
+	s3 := getSQLSource("testwarehouse", ds)
+	if s3 == s1 {
+		t.Errorf("getSQLSource returned the old source for changed settings")
+	}
+	if s3.maxOpenConns != 4 || s3.queryTimeout != time.Minute {
+		t.Errorf("getSQLSource got maxOpenConns: %d, queryTimeout: %s, want: 4, 1m",
+			s3.maxOpenConns, s3.queryTimeout)
+	}
+}
+
+func TestGetSQLSource_keptOpen(t *testing.T) {
+	defer CloseDataSources()
+	ds := config.DataSource{
+		DriverName:     "mysql",
+		DataSourceName: "fred:secret@tcp(127.0.0.1:9999)/master",
+		MaxOpenConns:   2,
+	}
+	s1 := getSQLSource("keptopen", ds)
+	if err := s1.open(); err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	db := s1.db
+	if err := s1.close(); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+	// The pool is kept open for the next experiment that uses it
+	if s1.db != db {
+		t.Fatalf("shared source closed once not in use")
+	}
+	if err := s1.open(); err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	if s1.db != db {
+		t.Errorf("shared source reopened")
+	}
+
+	// A replaced source is closed once it is no longer used
+	ds.MaxOpenConns = 4
+	s2 := getSQLSource("keptopen", ds)
+	if s1.db == nil {
+		t.Errorf("replaced source closed while in use")
+	}
+	if err := s1.close(); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+	if s1.db != nil {
+		t.Errorf("replaced source not closed once not in use")
+	}
+
+	if err := s2.open(); err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	if err := s2.close(); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+	if err := CloseDataSources(); err != nil {
+		t.Fatalf("CloseDataSources: %s", err)
+	}
+	if s2.db != nil {
+		t.Errorf("CloseDataSources didn't close source")
+	}
+	if s := getSQLSource("keptopen", ds); s == s2 {
+		t.Errorf("getSQLSource returned a closed source")
+	}
+}
+
+func TestSQLHandlerOpenClose_sharedSource(t *testing.T) {
+	source := newSQLSource(
+		"mysql",
+		"fred:secret@tcp(127.0.0.1:9999)/master",
+		2,
+		0,
+	)
+	h1, err := newSQLHandler(source, "select * from flow", nil)
+	if err != nil {
+		t.Fatalf("newSQLHandler: %s", err)
+	}
+	h2, err := newSQLHandler(source, "select * from height", nil)
+	if err != nil {
+		t.Fatalf("newSQLHandler: %s", err)
+	}
+	if err := h1.Open(); err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	if err := h2.Open(); err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	db := source.db
+	if err := h2.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+	// Closing a handler that isn't open mustn't close the source of others
+	if err := h2.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+	if source.openConn != 1 {
+		t.Errorf("source openConn got: %d, want: 1", source.openConn)
+	}
+	if err := h1.Open(); err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	if source.db != db {
+		t.Errorf("source reopened while in use")
+	}
+	if err := h1.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+	if err := h1.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+	if source.openConn != 0 {
+		t.Errorf("source openConn got: %d, want: 0", source.openConn)
+	}
+	if _, err := h1.Rows(); err != errDatabaseNotOpen {
+		t.Errorf("Rows got err: %v, want: %v", err, errDatabaseNotOpen)
+	}
+}
@@ -17,8 +17,11 @@ import (
 )
 
 type TestMode struct {
-	dataset ddataset.Dataset
-	when    *dexpr.Expr
+	dataset    ddataset.Dataset
+	where      string
+	sample     *report.Sample
+	when       *dexpr.Expr
+	hasNewRows func() (bool, error)
 }
 
 type testModeDesc struct {
@@ -28,17 +31,20 @@ type testModeDesc struct {
 }
 
 func newTestMode(cfg *config.Config, desc *testModeDesc) (*TestMode, error) {
-	d, err := makeDataset(cfg, desc.Dataset)
-	if err != nil {
-		return nil, fmt.Errorf("dataset: %s", err)
-	}
 	when, err := makeWhenExpr(desc.When)
 	if err != nil {
 		return nil, InvalidWhenExprError(desc.When)
 	}
+	d, err := makeModeDataset(cfg, desc.Dataset, when)
+	if err != nil {
+		return nil, fmt.Errorf("dataset: %s", err)
+	}
 	return &TestMode{
-		dataset: d,
-		when:    when,
+		dataset:    d,
+		where:      desc.Dataset.Where,
+		sample:     desc.Dataset.sample(cfg),
+		when:       when,
+		hasNewRows: desc.Dataset.newRowsFunc(cfg),
 	}, nil
 }
 
@@ -81,7 +87,11 @@ func (m *TestMode) Process(
 	if err != nil {
 		return fmt.Errorf("Couldn't describe test dataset: %s", err)
 	}
-	ass, err := assessRules(e, m, 1, rules, pm, q, cfg)
+	nullCounts, err := countNulls(m.dataset)
+	if err != nil {
+		return fmt.Errorf("Couldn't count nulls in test dataset: %s", err)
+	}
+	ass, err := assessRules(e, m, 1, rules, pm, q, cfg, true)
 	if err != nil {
 		return fmt.Errorf("Couldn't assess rules: %s", err)
 	}
@@ -89,6 +99,8 @@ func (m *TestMode) Process(
 		report.Test,
 		e.Title,
 		desc,
+		m.where,
+		m.sample,
 		ass,
 		e.Aggregators,
 		e.SortOrder,
@@ -96,6 +108,8 @@ func (m *TestMode) Process(
 		e.Tags,
 		e.Category,
 	)
+	testReport.NullCounts = nullCounts
+	testReport.Matrix = e.Matrix
 	if err := testReport.WriteJSON(cfg); err != nil {
 		return fmt.Errorf("Couldn't write JSON test report: %s", err)
 	}
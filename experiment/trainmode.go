@@ -21,12 +21,19 @@ import (
 
 type TrainMode struct {
 	dataset        ddataset.Dataset
+	where          string
+	sample         *report.Sample
 	when           *dexpr.Expr
+	hasNewRows     func() (bool, error)
 	ruleGeneration ruleGeneration
 }
 
 type ruleGenerationDesc struct {
-	Fields            []string `yaml:"fields"`
+	// The fields to generate rules for, which may be patterns such as: *
+	// or: height_*
+	Fields []string `yaml:"fields"`
+	// Patterns of fields to exclude from those above
+	Exclude           []string `yaml:"exclude"`
 	Arithmetic        bool     `yaml:"arithmetic"`
 	CombinationLength int      `yaml:"combinationLength"`
 }
@@ -35,6 +42,8 @@ type ruleGeneration struct {
 	fields            []string
 	arithmetic        bool
 	combinationLength int
+	// Overrides the types of fields found when describing the dataset
+	fieldTypes map[string]description.FieldType
 }
 
 func (rg ruleGeneration) Fields() []string {
@@ -45,6 +54,33 @@ func (rg ruleGeneration) Arithmetic() bool {
 	return rg.arithmetic
 }
 
+// makeRuleGeneration returns the rule generation described by desc for
+// the dataset described by dd with fields
+func makeRuleGeneration(
+	desc ruleGenerationDesc,
+	dd *datasetDesc,
+	fields []string,
+) (ruleGeneration, error) {
+	ruleFields, err := matchFields(desc.Fields, fields)
+	if err != nil {
+		return ruleGeneration{}, fmt.Errorf("ruleGeneration: fields: %s", err)
+	}
+	ruleFields, err = excludeFields(ruleFields, desc.Exclude)
+	if err != nil {
+		return ruleGeneration{}, fmt.Errorf("ruleGeneration: exclude: %s", err)
+	}
+	fieldTypes, err := makeFieldTypes(dd.FieldTypes, fields)
+	if err != nil {
+		return ruleGeneration{}, fmt.Errorf("dataset: %s", err)
+	}
+	return ruleGeneration{
+		fields:            ruleFields,
+		arithmetic:        desc.Arithmetic,
+		combinationLength: desc.CombinationLength,
+		fieldTypes:        fieldTypes,
+	}, nil
+}
+
 type trainModeDesc struct {
 	Dataset *datasetDesc `yaml:"dataset"`
 	// An expression that works out whether to run the experiment for this mode
@@ -60,22 +96,26 @@ func newTrainMode(
 	goals []*goal.Goal,
 	sortOrder []assessment.SortOrder,
 ) (*TrainMode, error) {
-	d, err := makeDataset(cfg, desc.Dataset)
+	when, err := makeWhenExpr(desc.When)
+	if err != nil {
+		return nil, InvalidWhenExprError(desc.When)
+	}
+	d, err := makeModeDataset(cfg, desc.Dataset, when)
 	if err != nil {
 		return nil, fmt.Errorf("dataset: %s", err)
 	}
-	when, err := makeWhenExpr(desc.When)
+	rg, err := makeRuleGeneration(desc.RuleGeneration, desc.Dataset, d.Fields())
 	if err != nil {
-		return nil, InvalidWhenExprError(desc.When)
+		d.Release()
+		return nil, err
 	}
 	return &TrainMode{
-		dataset: d,
-		when:    when,
-		ruleGeneration: ruleGeneration{
-			fields:            desc.RuleGeneration.Fields,
-			arithmetic:        desc.RuleGeneration.Arithmetic,
-			combinationLength: desc.RuleGeneration.CombinationLength,
-		},
+		dataset:        d,
+		where:          desc.Dataset.Where,
+		sample:         desc.Dataset.sample(cfg),
+		when:           when,
+		hasNewRows:     desc.Dataset.newRowsFunc(cfg),
+		ruleGeneration: rg,
 	}, nil
 }
 
@@ -105,8 +145,51 @@ func (m *TrainMode) Process(
 	q *quitter.Quitter,
 	rules []rule.Rule,
 ) ([]rule.Rule, error) {
+	noRules := []rule.Rule{}
+	desc, ass, err := trainRules(e, m, m.ruleGeneration, cfg, pm, q, rules)
+	if err != nil {
+		return noRules, err
+	}
+	nullCounts, err := countNulls(m.dataset)
+	if err != nil {
+		return noRules, fmt.Errorf("Couldn't count nulls in train dataset: %s", err)
+	}
+
+	r := report.New(
+		report.Train,
+		e.Title,
+		desc,
+		m.where,
+		m.sample,
+		ass,
+		e.Aggregators,
+		e.SortOrder,
+		e.File.Name(),
+		e.Tags,
+		e.Category,
+	)
+	r.NullCounts = nullCounts
+	r.Matrix = e.Matrix
+	if err := r.WriteJSON(cfg); err != nil {
+		return noRules, fmt.Errorf("Couldn't write JSON train report: %s", err)
+	}
+	return ass.Rules(), nil
+}
+
+// trainRules describes the dataset of m and then generates, tweaks and
+// combines rules to find the rules that best meet the sort order of
+// the experiment
+func trainRules(
+	e *Experiment,
+	m Mode,
+	rg ruleGeneration,
+	cfg *config.Config,
+	pm *progress.Monitor,
+	q *quitter.Quitter,
+	rules []rule.Rule,
+) (*description.Description, *assessment.Assessment, error) {
 	reportProgress := func(msg string, percent float64) error {
-		return pm.ReportProgress(e.File.Name(), report.Train, msg, percent)
+		return pm.ReportProgress(e.File.Name(), m.Kind(), msg, percent)
 	}
 	quitReceived := func() bool {
 		select {
@@ -116,29 +199,31 @@ func (m *TrainMode) Process(
 			return false
 		}
 	}
-	noRules := []rule.Rule{}
 	rt := newRuleTracker()
 
 	if err := reportProgress("Describing train dataset", 0); err != nil {
-		return noRules, err
+		return nil, nil, err
 	}
 
 	if quitReceived() {
-		return noRules, ErrQuitReceived
+		return nil, nil, ErrQuitReceived
 	}
 	desc, err := description.DescribeDataset(m.Dataset())
 	if err != nil {
-		return noRules, fmt.Errorf("Couldn't describe train dataset: %s", err)
+		return nil, nil, fmt.Errorf("Couldn't describe train dataset: %s", err)
+	}
+	if err := applyFieldTypes(desc, rg.fieldTypes); err != nil {
+		return nil, nil, fmt.Errorf("Couldn't describe train dataset: %s", err)
 	}
 
 	if quitReceived() {
-		return noRules, ErrQuitReceived
+		return nil, nil, ErrQuitReceived
 	}
 	rt.track(rules)
 	userRules := append(rules, rule.NewTrue())
-	ass, err := assessRules(e, m, 1, userRules, pm, q, cfg)
+	ass, err := assessRules(e, m, 1, userRules, pm, q, cfg, true)
 	if err != nil {
-		return noRules, fmt.Errorf("Couldn't assess rules: %s", err)
+		return nil, nil, fmt.Errorf("Couldn't assess rules: %s", err)
 	}
 
 	assessRules := func(
@@ -147,7 +232,7 @@ func (m *TrainMode) Process(
 	) (*assessment.Assessment, error) {
 		newRules := rt.track(rules)
 		newAss, err :=
-			assessRules(e, m, stage, newRules, pm, q, cfg)
+			assessRules(e, m, stage, newRules, pm, q, cfg, true)
 		if err != nil {
 			return nil, fmt.Errorf("Couldn't assess rules: %s", err)
 		}
@@ -162,63 +247,64 @@ func (m *TrainMode) Process(
 	}
 
 	if err := reportProgress("Generating rules", 0); err != nil {
-		return noRules, err
+		return nil, nil, err
 	}
-	generatedRules, err := rule.Generate(desc, m.ruleGeneration)
+	generatedRules, err := rule.Generate(desc, rg)
 	if err != nil {
-		return noRules, fmt.Errorf("Couldn't generate rules: %s", err)
+		return nil, nil, fmt.Errorf("Couldn't generate rules: %s", err)
 	}
+	generatedRules = append(generatedRules, generateNullRules(desc, rg.fields)...)
 
 	if quitReceived() {
-		return noRules, ErrQuitReceived
+		return nil, nil, ErrQuitReceived
 	}
 
 	if _, err := assessRules(2, generatedRules); err != nil {
-		return noRules, err
+		return nil, nil, err
 	}
 
 	if quitReceived() {
-		return noRules, ErrQuitReceived
+		return nil, nil, ErrQuitReceived
 	}
 
 	if err := reportProgress("Tweaking rules", 0); err != nil {
-		return noRules, err
+		return nil, nil, err
 	}
 	tweakableRules := rule.Tweak(1, ass.Rules(), desc)
 
 	if _, err := assessRules(3, tweakableRules); err != nil {
-		return noRules, err
+		return nil, nil, err
 	}
 
 	if quitReceived() {
-		return noRules, ErrQuitReceived
+		return nil, nil, ErrQuitReceived
 	}
 
 	if err := reportProgress("Reduce DP of rules", 0); err != nil {
-		return noRules, err
+		return nil, nil, err
 	}
 	reducedDPRules := rule.ReduceDP(ass.Rules())
 
 	if _, err := assessRules(4, reducedDPRules); err != nil {
-		return noRules, err
+		return nil, nil, err
 	}
 
 	if quitReceived() {
-		return noRules, ErrQuitReceived
+		return nil, nil, ErrQuitReceived
 	}
 
 	ruleAssessments := []*assessment.RuleAssessment{ass.RuleAssessments[0]}
-	for i := 0; i < m.ruleGeneration.combinationLength; i++ {
+	for i := 0; i < rg.combinationLength; i++ {
 		if err := reportProgress("Combining rules", 0); err != nil {
-			return noRules, err
+			return nil, nil, err
 		}
 		combinedRules := rule.Combine(ass.Rules(), 10000)
 		combinedAss, err := assessRules(5+i, combinedRules)
 		if err != nil {
-			return noRules, err
+			return nil, nil, err
 		}
 		if quitReceived() {
-			return noRules, ErrQuitReceived
+			return nil, nil, ErrQuitReceived
 		}
 		combinedAss.Sort(e.SortOrder)
 		combinedAss.Refine()
@@ -246,22 +332,7 @@ func (m *TrainMode) Process(
 	ass.Refine()
 	// TODO: Remove ruleAssessments that have longer combinationLength than
 	// previous ruleAssessment?
-
-	r := report.New(
-		report.Train,
-		e.Title,
-		desc,
-		ass,
-		e.Aggregators,
-		e.SortOrder,
-		e.File.Name(),
-		e.Tags,
-		e.Category,
-	)
-	if err := r.WriteJSON(cfg); err != nil {
-		return noRules, fmt.Errorf("Couldn't write JSON train report: %s", err)
-	}
-	return ass.Rules(), nil
+	return desc, ass, nil
 }
 
 func getTrueRuleAssessment(
@@ -0,0 +1,415 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package experiment
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/lawrencewoodman/dlit"
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/fileinfo"
+	"gopkg.in/yaml.v2"
+)
+
+// Validate checks the experiment in file without processing it and
+// returns any problems found.  As well as the error that Load would
+// return, it reports fields that aren't recognised, goals that refer to
+// unknown aggregators, aggregator and rule fields that are missing from
+// the datasets and when expressions that can't be evaluated.  The
+// datasets aren't built, their fields are those listed in the file or
+// inferred from their sources.
+func Validate(cfg *config.Config, file fileinfo.FileInfo) []error {
+	fullFilename := filepath.Join(cfg.ExperimentsDir, file.Name())
+	errs, err := checkFields(fullFilename)
+	if err != nil {
+		return []error{err}
+	}
+	f, err := ReadFile(cfg, file, nil)
+	if err != nil {
+		return append(errs, err)
+	}
+	for i, x := range f.expansions {
+		x.desc.setDescribeOnly()
+		e, err := f.Load(i)
+		if err != nil {
+			if x.matrix != nil {
+				err = fmt.Errorf("(%s) %s", x.cell, err)
+			}
+			errs = append(errs, err)
+			continue
+		}
+		for _, err := range e.lint() {
+			if x.matrix != nil {
+				err = fmt.Errorf("(%s) %s", x.cell, err)
+			}
+			errs = append(errs, err)
+		}
+		e.Release()
+	}
+	return errs
+}
+
+// FieldError indicates a field in an experiment file that isn't
+// recognised
+type FieldError struct {
+	Line int
+	Path []string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("line %d: unknown field: %s",
+		e.Line, strings.Join(e.Path, ": "))
+}
+
+// checkFields returns an error for each field in filename that isn't
+// part of an experiment description.  The lines of the fields are found
+// by searching for their names after the line of their parent.  If
+// filename can't be decoded an error is returned instead.
+func checkFields(filename string) ([]error, error) {
+	var doc interface{}
+	ext := filepath.Ext(filename)
+	if ext != ".json" && ext != ".yaml" {
+		return nil, InvalidExtError(ext)
+	}
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	isJSON := ext == ".json"
+	if isJSON {
+		if err := json.Unmarshal(src, &doc); err != nil {
+			return nil, jsonLineError(src, err)
+		}
+	} else {
+		if err := yaml.Unmarshal(src, &doc); err != nil {
+			return nil, err
+		}
+	}
+	c := &fieldChecker{
+		lines:  strings.Split(string(src), "\n"),
+		isJSON: isJSON,
+		errs:   []FieldError{},
+	}
+	c.check(doc, reflect.TypeOf(descFile{}), []string{}, 0)
+	sort.SliceStable(c.errs, func(i, j int) bool {
+		return c.errs[i].Line < c.errs[j].Line
+	})
+	errs := make([]error, len(c.errs))
+	for i, err := range c.errs {
+		errs[i] = err
+	}
+	return errs, nil
+}
+
+// jsonLineError returns err with the line that it occurred on if known
+func jsonLineError(src []byte, err error) error {
+	var offset int64
+	switch x := err.(type) {
+	case *json.SyntaxError:
+		offset = x.Offset
+	case *json.UnmarshalTypeError:
+		offset = x.Offset
+	default:
+		return err
+	}
+	// The offset is just after the byte that caused the error
+	if offset > 0 {
+		offset--
+	}
+	line := bytes.Count(src[:offset], []byte("\n")) + 1
+	return fmt.Errorf("line %d: %s", line, err)
+}
+
+type fieldChecker struct {
+	lines  []string
+	isJSON bool
+	errs   []FieldError
+}
+
+var yamlUnmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// check checks that the keys of any mappings in v are fields of t.  line
+// is the index of the line that v starts on.
+func (c *fieldChecker) check(
+	v interface{},
+	t reflect.Type,
+	path []string,
+	line int,
+) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch x := v.(type) {
+	case []interface{}:
+		if t.Kind() == reflect.Slice {
+			for _, e := range x {
+				c.check(e, t.Elem(), path, line)
+			}
+		}
+		return
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			m[fmt.Sprintf("%v", k)] = e
+		}
+		c.checkMap(m, t, path, line)
+	case map[string]interface{}:
+		c.checkMap(x, t, path, line)
+	}
+}
+
+func (c *fieldChecker) checkMap(
+	m map[string]interface{},
+	t reflect.Type,
+	path []string,
+	line int,
+) {
+	if t.Kind() != reflect.Map && t.Kind() != reflect.Struct {
+		return
+	}
+	// Types that unmarshal themselves, other than datasetDesc, aren't checked
+	isDataset := t == reflect.TypeOf(datasetDesc{})
+	if !isDataset && reflect.PtrTo(t).Implements(yamlUnmarshalerType) {
+		return
+	}
+	for _, k := range sortedKeys(m) {
+		keyPath := append(append([]string{}, path...), k)
+		keyLine := c.findKey(k, line)
+		if t.Kind() == reflect.Map {
+			c.check(m[k], t.Elem(), keyPath, keyLine)
+			continue
+		}
+		if f, ok := c.structField(t, k); ok {
+			c.check(m[k], f.Type, keyPath, keyLine)
+			continue
+		}
+		if isDataset {
+			if _, ok := getDatasetKind(k); ok {
+				continue
+			}
+		}
+		c.errs = append(c.errs, FieldError{Line: keyLine + 1, Path: keyPath})
+	}
+}
+
+// structField returns the field of t that key is decoded into.  JSON
+// field names are matched case insensitively.
+func (c *fieldChecker) structField(
+	t reflect.Type,
+	key string,
+) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		yamlName := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if yamlName == "" {
+			yamlName = strings.ToLower(f.Name)
+		}
+		if key == yamlName || (c.isJSON && strings.EqualFold(key, f.Name)) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// findKey returns the index of the first line from start that contains
+// key as the key of a mapping, or start if one can't be found
+func (c *fieldChecker) findKey(key string, start int) int {
+	quoted := regexp.QuoteMeta(key)
+	re := regexp.MustCompile(
+		`^\s*(- )?("` + quoted + `"|'` + quoted + `'|` + quoted + `)\s*:`,
+	)
+	if c.isJSON {
+		re = regexp.MustCompile(`"` + quoted + `"\s*:`)
+	}
+	for i := start; i < len(c.lines); i++ {
+		if re.MatchString(c.lines[i]) {
+			return i
+		}
+	}
+	return start
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lint returns any problems with the loaded experiment that would only
+// be found while processing it
+func (e *Experiment) lint() []error {
+	errs := []error{}
+	aggregatorNames := []string{"numRecords"}
+	for _, a := range e.Aggregators {
+		if a.Kind() == "calc" {
+			for _, v := range exprVars(a.Arg()) {
+				if !hasField(aggregatorNames, v) {
+					errs = append(errs, fmt.Errorf(
+						"experiment field: aggregators: %s: unknown aggregator: %s",
+						a.Name(), v,
+					))
+				}
+			}
+		}
+		aggregatorNames = append(aggregatorNames, a.Name())
+	}
+	for _, g := range e.Goals {
+		for _, v := range exprVars(g.String()) {
+			if !hasField(aggregatorNames, v) {
+				errs = append(errs, fmt.Errorf(
+					"experiment field: goals: %s: unknown aggregator: %s", g, v,
+				))
+			}
+		}
+	}
+
+	type lintMode struct {
+		name       string
+		mode       Mode
+		when       *dexpr.Expr
+		hasNewRows func() (bool, error)
+		ruleFields []string
+	}
+	modes := []lintMode{}
+	if e.Train != nil {
+		modes = append(modes, lintMode{
+			"train", e.Train, e.Train.when, e.Train.hasNewRows,
+			e.Train.ruleGeneration.fields,
+		})
+	}
+	if e.Test != nil {
+		modes = append(modes, lintMode{
+			"test", e.Test, e.Test.when, e.Test.hasNewRows, []string{},
+		})
+	}
+	if e.CrossValidation != nil {
+		modes = append(modes, lintMode{
+			"crossValidation", e.CrossValidation, e.CrossValidation.when,
+			e.CrossValidation.hasNewRows,
+			e.CrossValidation.ruleGeneration.fields,
+		})
+	}
+	for _, m := range modes {
+		fields := m.mode.Dataset().Fields()
+		for _, a := range e.Aggregators {
+			if a.Kind() == "calc" {
+				continue
+			}
+			for _, v := range exprVars(a.Arg()) {
+				if !hasField(fields, v) {
+					errs = append(errs, fmt.Errorf(
+						"experiment field: aggregators: %s: field not in %s dataset: %s",
+						a.Name(), m.name, v,
+					))
+				}
+			}
+		}
+		for _, r := range e.Rules {
+			for _, f := range exprVars(r.String()) {
+				if !hasField(fields, f) {
+					errs = append(errs, fmt.Errorf(
+						"experiment field: rules: %s: field not in %s dataset: %s",
+						r, m.name, f,
+					))
+				}
+			}
+		}
+		for _, f := range m.ruleFields {
+			if !hasField(fields, f) {
+				errs = append(errs, fmt.Errorf(
+					"experiment field: %s: ruleGeneration: field not in dataset: %s",
+					m.name, f,
+				))
+			}
+		}
+		if err := lintWhen(m.when, m.hasNewRows); err != nil {
+			errs = append(errs,
+				fmt.Errorf("experiment field: %s: when: %s", m.name, err))
+		}
+	}
+	return errs
+}
+
+// lintWhen returns an error if when refers to variables that aren't
+// available or doesn't evaluate to a bool
+func lintWhen(when *dexpr.Expr, hasNewRows func() (bool, error)) error {
+	now := time.Now()
+	vars := map[string]*dlit.Literal{}
+	for name, v := range whenVars(now, false, now) {
+		vars[name] = dlit.MustNew(v)
+	}
+	if hasNewRows != nil {
+		vars["hasNewRows"] = dlit.MustNew(false)
+	}
+	for _, v := range exprVars(when.String()) {
+		if _, ok := vars[v]; !ok {
+			return fmt.Errorf("unknown variable: %s", v)
+		}
+	}
+	if _, err := when.EvalBool(vars); err != nil {
+		return err
+	}
+	return nil
+}
+
+// exprNonVars are the identifiers of dexpr expressions that aren't
+// variables: the boolean constants and the names of the functions
+var exprNonVars = []string{
+	"true", "false",
+	"if", "iferr", "in", "ni", "min", "max", "pow", "roundto", "sqrt",
+}
+
+// exprVars returns the sorted names of the variables used by expr.  The
+// boolean constants and the names of functions aren't included.
+func exprVars(expr string) []string {
+	node, err := parser.ParseExpr(expr)
+	if err != nil {
+		return []string{}
+	}
+	// Identifiers that aren't variables
+	funcs := map[*ast.Ident]bool{}
+	vars := []string{}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.CallExpr:
+			if ident, ok := x.Fun.(*ast.Ident); ok {
+				funcs[ident] = true
+			}
+		case *ast.CompositeLit:
+			// The type of a list such as: []lit{1, 2} isn't a variable
+			ast.Inspect(x.Type, func(n ast.Node) bool {
+				if ident, ok := n.(*ast.Ident); ok {
+					funcs[ident] = true
+				}
+				return true
+			})
+		case *ast.Ident:
+			if !funcs[x] && !hasField(exprNonVars, x.Name) &&
+				!hasField(vars, x.Name) {
+				vars = append(vars, x.Name)
+			}
+		}
+		return true
+	})
+	sort.Strings(vars)
+	return vars
+}
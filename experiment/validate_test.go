@@ -0,0 +1,129 @@
+package experiment
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+)
+
+func TestValidate(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	cases := []struct {
+		filename string
+		want     []string
+	}{
+		{filename: "flow.yaml", want: []string{}},
+		{filename: "flow.json", want: []string{}},
+		{filename: "flow_matrix.yaml", want: []string{}},
+		{filename: "flow_rulesfrom.yaml", want: []string{}},
+		{filename: "flow_validate_unknown_fields.yaml",
+			want: []string{
+				"line 8: unknown field: train: dataset: csv: hasheader",
+				"line 20: unknown field: train: ruleGeneration: combinatonLength",
+				"line 25: unknown field: aggregators: args",
+				"line 28: unknown field: sortorder",
+			},
+		},
+		{filename: "flow_validate_unknown_fields.json",
+			want: []string{
+				"line 14: unknown field: train: ruleGeneration: arithmetics",
+			},
+		},
+		{filename: "flow_validate_syntax.json",
+			want: []string{
+				"line 8: invalid character '\"' after object key:value pair",
+			},
+		},
+		{filename: "flow_invalid.yaml",
+			want: []string{
+				"yaml: line 3: did not find expected key",
+			},
+		},
+		{filename: "flow_validate_lint.yaml",
+			want: []string{
+				"experiment field: aggregators: meanFlowPerHeight: unknown aggregator: meanFlow",
+				"experiment field: goals: goodFlowAccuracy > 0.5: unknown aggregator: goodFlowAccuracy",
+				"experiment field: rules: depth < 5: field not in train dataset: depth",
+				"experiment field: train: ruleGeneration: field not in dataset: altitude",
+				"experiment field: train: when: unknown variable: isWeekend",
+				"experiment field: aggregators: goodFlowMcc: field not in test dataset: flow",
+				"experiment field: aggregators: meanFlow: field not in test dataset: flow",
+				"experiment field: rules: depth < 5: field not in test dataset: depth",
+				"experiment field: test: when: invalid expression: hasRun + 2 (incompatible types)",
+			},
+		},
+	}
+	for _, c := range cases {
+		file := testhelpers.NewFileInfo(
+			filepath.Join("fixtures", c.filename),
+			time.Now(),
+		)
+		errs := Validate(cfg, file)
+		got := make([]string, len(errs))
+		for i, err := range errs {
+			got[i] = err.Error()
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Validate(%s) got: %q, want: %q", c.filename, got, c.want)
+		}
+	}
+}
+
+func TestValidate_noBuild(t *testing.T) {
+	os.Setenv("RULEHUNTER_TEST_COMMAND", os.Args[0])
+	defer os.Unsetenv("RULEHUNTER_TEST_COMMAND")
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		MaxNumRecords: -1,
+		BuildDir:      filepath.Join(tmpDir, "build"),
+	}
+	// The command would fail if it were run
+	filenames := []string{"flow.yaml", "flow_command_fail.yaml"}
+	for _, filename := range filenames {
+		file := testhelpers.NewFileInfo(
+			filepath.Join("fixtures", filename),
+			time.Now(),
+		)
+		if errs := Validate(cfg, file); len(errs) != 0 {
+			t.Errorf("Validate(%s) got: %v, want: []", filename, errs)
+		}
+	}
+	_, err := os.Stat(filepath.Join(cfg.BuildDir, "tmp"))
+	if !os.IsNotExist(err) {
+		t.Errorf("Validate wrote to build directory, Stat err: %v", err)
+	}
+}
+
+func TestExprVars(t *testing.T) {
+	cases := []struct {
+		expr string
+		want []string
+	}{
+		{expr: "flow > 60", want: []string{"flow"}},
+		{expr: "true()", want: []string{}},
+		{expr: "roundto(b / a, 2) + iferr(a, c)", want: []string{"a", "b", "c"}},
+		{expr: "in(group, []lit{\"a\", district})",
+			want: []string{"district", "group"},
+		},
+		{expr: "flow >", want: []string{}},
+		{expr: "ok == true || ok == false", want: []string{"ok"}},
+		{expr: "min == max", want: []string{}},
+	}
+	for _, c := range cases {
+		got := exprVars(c.expr)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("exprVars(%s) got: %v, want: %v", c.expr, got, c.want)
+		}
+	}
+}
@@ -24,36 +24,28 @@ func makeWhenExpr(expr string) (*dexpr.Expr, error) {
 // TODO: Add sinceLastRunDays try working out using:
 //         https://play.golang.org/p/nTcjGZQKAa
 //         https://groups.google.com/forum/#!topic/golang-nuts/O2NaRAH94GI
+//
+// evalWhenExpr evaluates whenExpr using the variables from whenVars.
+// hasNewRows is used to find the value of the hasNewRows variable and is
+// only called if whenExpr uses it.  If hasNewRows is nil the variable
+// isn't available.
 func evalWhenExpr(
 	now time.Time,
 	isFinished bool,
 	stamp time.Time,
 	whenExpr *dexpr.Expr,
+	hasNewRows func() (bool, error),
 ) (bool, error) {
-	nISOWeekYear, nISOWeekWeek := now.ISOWeek()
-	stampISOWeekYear, stampISOWeekWeek := stamp.ISOWeek()
-
-	vars := map[string]*dlit.Literal{
-		"hasRun": dlit.MustNew(isFinished),
-		"hasRunToday": dlit.MustNew(
-			isFinished &&
-				stamp.Year() == now.Year() &&
-				stamp.YearDay() == now.YearDay(),
-		),
-		"hasRunThisWeek": dlit.MustNew(
-			isFinished &&
-				stampISOWeekYear == nISOWeekYear &&
-				stampISOWeekWeek == nISOWeekWeek,
-		),
-		"hasRunThisMonth": dlit.MustNew(
-			isFinished && stamp.Year() == now.Year() && stamp.Month() == now.Month(),
-		),
-		"hasRunThisYear":      dlit.MustNew(isFinished && stamp.Year() == now.Year()),
-		"sinceLastRunMinutes": dlit.MustNew(int64(now.Sub(stamp).Minutes())),
-		"sinceLastRunHours":   dlit.MustNew(int64(now.Sub(stamp).Hours())),
-		"isWeekday": dlit.MustNew(
-			now.Weekday() != time.Saturday && now.Weekday() != time.Sunday,
-		),
+	vars := map[string]*dlit.Literal{}
+	for name, v := range whenVars(now, isFinished, stamp) {
+		vars[name] = dlit.MustNew(v)
+	}
+	if hasNewRows != nil && usesHasNewRows(whenExpr) {
+		newRows, err := hasNewRows()
+		if err != nil {
+			return false, err
+		}
+		vars["hasNewRows"] = dlit.MustNew(newRows)
 	}
 	ok, err := whenExpr.EvalBool(vars)
 	if err != nil {
@@ -61,3 +53,36 @@ func evalWhenExpr(
 	}
 	return ok, nil
 }
+
+// usesHasNewRows returns whether whenExpr uses the hasNewRows variable
+func usesHasNewRows(whenExpr *dexpr.Expr) bool {
+	return hasField(exprVars(whenExpr.String()), "hasNewRows")
+}
+
+// whenVars returns the variables available to when expressions.  These
+// are also available as parameters to sql queries.
+func whenVars(
+	now time.Time,
+	isFinished bool,
+	stamp time.Time,
+) map[string]interface{} {
+	nISOWeekYear, nISOWeekWeek := now.ISOWeek()
+	stampISOWeekYear, stampISOWeekWeek := stamp.ISOWeek()
+	return map[string]interface{}{
+		"hasRun": isFinished,
+		"hasRunToday": isFinished &&
+			stamp.Year() == now.Year() &&
+			stamp.YearDay() == now.YearDay(),
+		"hasRunThisWeek": isFinished &&
+			stampISOWeekYear == nISOWeekYear &&
+			stampISOWeekWeek == nISOWeekWeek,
+		"hasRunThisMonth": isFinished &&
+			stamp.Year() == now.Year() &&
+			stamp.Month() == now.Month(),
+		"hasRunThisYear":      isFinished && stamp.Year() == now.Year(),
+		"sinceLastRunMinutes": int64(now.Sub(stamp).Minutes()),
+		"sinceLastRunHours":   int64(now.Sub(stamp).Hours()),
+		"isWeekday": now.Weekday() != time.Saturday &&
+			now.Weekday() != time.Sunday,
+	}
+}
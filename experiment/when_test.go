@@ -1,6 +1,7 @@
 package experiment
 
 import (
+	"errors"
 	"github.com/lawrencewoodman/dexpr"
 	"testing"
 	"time"
@@ -200,7 +201,7 @@ func TestEvalWhenExpr(t *testing.T) {
 	funcs := map[string]dexpr.CallFun{}
 	for _, c := range evalWhenExprCases {
 		whenExpr := dexpr.MustNew(c.when, funcs)
-		got, err := evalWhenExpr(c.now, c.isFinished, c.stamp, whenExpr)
+		got, err := evalWhenExpr(c.now, c.isFinished, c.stamp, whenExpr, nil)
 		if err != nil {
 			t.Errorf("evalWhenExpr(%v, %t, %v, %v) err: %v",
 				c.now, c.isFinished, c.stamp, c.when, err)
@@ -224,7 +225,7 @@ func TestEvalWhenExpr_errors(t *testing.T) {
 		Err:  dexpr.VarNotExistError("hasTwoLegs"),
 	}
 	whenExpr := dexpr.MustNew(when, funcs)
-	got, err := evalWhenExpr(now, isFinished, stamp, whenExpr)
+	got, err := evalWhenExpr(now, isFinished, stamp, whenExpr, nil)
 	if got != false {
 		t.Errorf("evalWhenExpr(%v, %t, %v, %v) got: %t, want: %t",
 			now, isFinished, stamp, when, got, false)
@@ -235,6 +236,79 @@ func TestEvalWhenExpr_errors(t *testing.T) {
 	}
 }
 
+func TestEvalWhenExpr_hasNewRows(t *testing.T) {
+	funcs := map[string]dexpr.CallFun{}
+	now := time.Now()
+	errNewRows := errors.New("can't count rows")
+	cases := []struct {
+		when       string
+		hasNewRows func() (bool, error)
+		want       bool
+		wantErr    error
+	}{
+		{when: "hasNewRows",
+			hasNewRows: func() (bool, error) { return true, nil },
+			want:       true,
+		},
+		{when: "!hasRun || hasNewRows",
+			hasNewRows: func() (bool, error) { return false, nil },
+			want:       false,
+		},
+		{when: "hasNewRows",
+			hasNewRows: func() (bool, error) { return false, errNewRows },
+			want:       false,
+			wantErr:    errNewRows,
+		},
+		{when: "hasRun",
+			hasNewRows: func() (bool, error) { return false, errNewRows },
+			want:       true,
+		},
+		{when: "hasRun && \"hasNewRows\" != \"\"",
+			hasNewRows: func() (bool, error) { return false, errNewRows },
+			want:       true,
+		},
+		{when: "hasNewRows",
+			hasNewRows: nil,
+			want:       false,
+			wantErr: dexpr.InvalidExprError{
+				Expr: "hasNewRows",
+				Err:  dexpr.VarNotExistError("hasNewRows"),
+			},
+		},
+	}
+	for i, c := range cases {
+		whenExpr := dexpr.MustNew(c.when, funcs)
+		got, err := evalWhenExpr(now, true, now, whenExpr, c.hasNewRows)
+		if err != c.wantErr {
+			t.Errorf("(%d) evalWhenExpr err: %v, want: %v", i, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("(%d) evalWhenExpr got: %t, want: %t", i, got, c.want)
+		}
+	}
+}
+
+func TestUsesHasNewRows(t *testing.T) {
+	funcs := map[string]dexpr.CallFun{}
+	cases := []struct {
+		when string
+		want bool
+	}{
+		{when: "hasNewRows", want: true},
+		{when: "!hasRun || hasNewRows", want: true},
+		{when: "hasRun", want: false},
+		{when: "hasRun && \"hasNewRows\" != \"\"", want: false},
+	}
+	for i, c := range cases {
+		got := usesHasNewRows(dexpr.MustNew(c.when, funcs))
+		if got != c.want {
+			t.Errorf("(%d) usesHasNewRows(%s) got: %t, want: %t",
+				i, c.when, got, c.want)
+		}
+	}
+}
+
 /***********************
    Helper functions
 ************************/
@@ -15,3 +15,16 @@ type FileInfo interface {
 func IsEqual(a, b FileInfo) bool {
 	return a.Name() == b.Name() && a.ModTime().Equal(b.ModTime())
 }
+
+type fileInfo struct {
+	name    string
+	modTime time.Time
+}
+
+// New returns a FileInfo with the given name and modified time
+func New(name string, modTime time.Time) FileInfo {
+	return fileInfo{name: name, modTime: modTime}
+}
+
+func (f fileInfo) Name() string       { return f.name }
+func (f fileInfo) ModTime() time.Time { return f.modTime }
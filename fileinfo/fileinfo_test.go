@@ -69,3 +69,12 @@ func TestIsEqual(t *testing.T) {
 		}
 	}
 }
+
+func TestNew(t *testing.T) {
+	modTime := testhelpers.MustParse(time.RFC822, "02 Jan 16 11:20 GMT")
+	f := New("hello.txt", modTime)
+	if f.Name() != "hello.txt" || !f.ModTime().Equal(modTime) {
+		t.Errorf("New got: %s %s, want: hello.txt %s",
+			f.Name(), f.ModTime(), modTime)
+	}
+}
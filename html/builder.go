@@ -93,6 +93,7 @@ func (b *Builder) generateAll() error {
 		generateReports,
 		generateTagPages,
 		generateCategoryPages,
+		generateMatrixPages,
 	}
 	return b.generate(generators)
 }
@@ -112,6 +113,7 @@ func (b *Builder) generateReports() error {
 		generateReports,
 		generateTagPages,
 		generateCategoryPages,
+		generateMatrixPages,
 	}
 	return b.generate(generators)
 }
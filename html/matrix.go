@@ -0,0 +1,157 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package html
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/progress"
+	"github.com/vlifesystems/rulehunter/report"
+)
+
+// TplMatrixReport is a row of a matrix summary page
+type TplMatrixReport struct {
+	Values     []string
+	Mode       string
+	Title      string
+	Filename   string
+	NumRecords int64
+	// The best rule and the values of the first aggregator of the sort
+	// order for it and for the whole dataset
+	Rule          string
+	Aggregator    string
+	OriginalValue string
+	RuleValue     string
+}
+
+// generateMatrixPages generates a summary page for each experiment file
+// with a matrix, comparing the reports of each combination of values
+func generateMatrixPages(
+	cfg *config.Config,
+	pm *progress.Monitor,
+) error {
+	reportFiles, err := ioutil.ReadDir(filepath.Join(cfg.BuildDir, "reports"))
+	if err != nil {
+		return err
+	}
+
+	reports := map[string][]*report.Report{}
+	for _, file := range reportFiles {
+		if !file.IsDir() {
+			r, err := report.LoadJSON(cfg, file.Name(), maxReportLoadAttempts)
+			if err != nil {
+				return err
+			}
+			if r.Matrix != nil {
+				reports[r.Matrix.Filename] = append(reports[r.Matrix.Filename], r)
+			}
+		}
+	}
+	for filename, rs := range reports {
+		if err := generateMatrixPage(cfg, filename, rs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func generateMatrixPage(
+	cfg *config.Config,
+	filename string,
+	reports []*report.Report,
+) error {
+	type TplData struct {
+		Filename  string
+		Variables []string
+		Reports   []*TplMatrixReport
+		Html      map[string]template.HTML
+	}
+
+	variables := matrixVariables(reports)
+	tplReports := make([]*TplMatrixReport, len(reports))
+	for i, r := range reports {
+		tplReports[i] = newTplMatrixReport(r, variables)
+	}
+	sort.SliceStable(tplReports, func(i, j int) bool {
+		a, b := tplReports[i], tplReports[j]
+		for k := range a.Values {
+			if a.Values[k] != b.Values[k] {
+				return a.Values[k] < b.Values[k]
+			}
+		}
+		return a.Mode < b.Mode
+	})
+	tplData := TplData{
+		Filename:  filename,
+		Variables: variables,
+		Reports:   tplReports,
+		Html:      makeHtml(cfg, "reports"),
+	}
+	outputFilename := filepath.Join(
+		"reports",
+		"matrix",
+		escapeString(filename),
+		"index.html",
+	)
+	return writeTemplate(cfg, outputFilename, matrixTpl, tplData)
+}
+
+func newTplMatrixReport(
+	r *report.Report,
+	variables []string,
+) *TplMatrixReport {
+	values := make([]string, len(variables))
+	for i, variable := range variables {
+		values[i] = r.Matrix.Values[variable]
+	}
+	tr := &TplMatrixReport{
+		Values:     values,
+		Mode:       r.Mode.String(),
+		Title:      r.Title,
+		Filename:   genReportURLDir(r.Mode, r.Category, r.Title),
+		NumRecords: r.NumRecords,
+	}
+	if len(r.Assessments) == 0 {
+		return tr
+	}
+	best := r.Assessments[0]
+	tr.Rule = best.Rule
+	if len(r.SortOrder) == 0 {
+		return tr
+	}
+	tr.Aggregator = r.SortOrder[0].Aggregator
+	for _, a := range best.Aggregators {
+		if a.Name == tr.Aggregator {
+			tr.OriginalValue = a.OriginalValue
+			tr.RuleValue = a.RuleValue
+		}
+	}
+	return tr
+}
+
+// matrixVariables returns the sorted names of the matrix variables
+// used by reports
+func matrixVariables(reports []*report.Report) []string {
+	seen := map[string]bool{}
+	variables := []string{}
+	for _, r := range reports {
+		for variable := range r.Matrix.Values {
+			if !seen[variable] {
+				seen[variable] = true
+				variables = append(variables, variable)
+			}
+		}
+	}
+	sort.Strings(variables)
+	return variables
+}
+
+func makeMatrixLink(filename string) string {
+	return fmt.Sprintf("reports/matrix/%s/", escapeString(filename))
+}
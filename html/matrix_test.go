@@ -0,0 +1,112 @@
+package html
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	rhkassessment "github.com/vlifesystems/rhkit/assessment"
+	"github.com/vlifesystems/rulehunter/config"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+	"github.com/vlifesystems/rulehunter/progress"
+	"github.com/vlifesystems/rulehunter/report"
+)
+
+func TestGenerateMatrixPages(t *testing.T) {
+	tmpDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(tmpDir)
+	cfg := &config.Config{
+		WWWDir:   filepath.Join(tmpDir, "www"),
+		BuildDir: filepath.Join(tmpDir, "build"),
+	}
+	pm, err := progress.NewMonitor(filepath.Join(cfg.BuildDir, "progress"))
+	if err != nil {
+		t.Fatalf("NewMonitor: %s", err)
+	}
+	reports := []*report.Report{
+		newMatrixReport("Is it Iris-virginica?", "Iris-virginica", "0.91"),
+		newMatrixReport("Is it Iris-setosa?", "Iris-setosa", "1"),
+		{Mode: report.Train,
+			Title:    "Is it an iris?",
+			Category: "botany",
+			Stamp:    time.Now(),
+		},
+	}
+	for _, r := range reports {
+		if err := r.WriteJSON(cfg); err != nil {
+			t.Fatalf("WriteJSON: %s", err)
+		}
+	}
+	if err := generateMatrixPages(cfg, pm); err != nil {
+		t.Fatalf("generateMatrixPages: %s", err)
+	}
+
+	matrixFiles, err :=
+		ioutil.ReadDir(filepath.Join(cfg.WWWDir, "reports", "matrix"))
+	if err != nil {
+		t.Fatalf("ReadDir: %s", err)
+	}
+	if len(matrixFiles) != 1 || matrixFiles[0].Name() != "irisyaml" {
+		t.Fatalf("matrix pages got: %v, want: [irisyaml]", matrixFiles)
+	}
+	filename := filepath.Join(
+		cfg.WWWDir,
+		"reports",
+		"matrix",
+		"irisyaml",
+		"index.html",
+	)
+	wantUrls := []string{
+		"reports/category/botany/is-it-irissetosa/train/",
+		"reports/category/botany/is-it-irisvirginica/train/",
+	}
+	gotUrls, err := getReportUrls(filename)
+	if err != nil {
+		t.Fatalf("getReportUrls: %s", err)
+	}
+	if !reflect.DeepEqual(gotUrls, wantUrls) {
+		t.Errorf("getReportUrls got: %v, want: %v", gotUrls, wantUrls)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	for _, s := range []string{"class", "height &gt; 7", "0.91", "mccClass"} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("matrix page doesn't contain: %s", s)
+		}
+	}
+}
+
+/*************************
+ *   Helper functions
+ *************************/
+
+func newMatrixReport(title, class, mcc string) *report.Report {
+	return &report.Report{
+		Mode:               report.Train,
+		Title:              title,
+		Category:           "botany",
+		Stamp:              time.Now(),
+		ExperimentFilename: "iris.yaml (class: " + class + ")",
+		Matrix: &report.Matrix{
+			Filename: "iris.yaml",
+			Values:   map[string]string{"class": class},
+		},
+		NumRecords: 150,
+		SortOrder: []rhkassessment.SortOrder{
+			{Aggregator: "mccClass"},
+		},
+		Assessments: []*report.Assessment{
+			{Rule: "height > 7",
+				Aggregators: []*report.Aggregator{
+					{Name: "mccClass", OriginalValue: "0", RuleValue: mcc},
+				},
+			},
+		},
+	}
+}
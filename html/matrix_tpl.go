@@ -0,0 +1,58 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package html
+
+const matrixTpl = `
+<!DOCTYPE html>
+<html>
+	<head>
+		{{ index .Html "head" }}
+		<title>Matrix summary for: {{ .Filename }}</title>
+	</head>
+
+	<body>
+		{{ index .Html "nav" }}
+
+		<div id="content">
+			<div class="container">
+				<h1>Matrix summary for: {{ .Filename }}</h1>
+
+				<table class="table table-bordered matrix">
+					<tr>
+						{{range .Variables}}
+							<th>{{ . }}</th>
+						{{end}}
+						<th>Mode</th>
+						<th>Report</th>
+						<th>Records</th>
+						<th>Best rule</th>
+						<th>Aggregator</th>
+						<th>Original value</th>
+						<th>Rule value</th>
+					</tr>
+					{{range .Reports}}
+						<tr>
+							{{range .Values}}
+								<td>{{ . }}</td>
+							{{end}}
+							<td>{{ .Mode }}</td>
+							<td><a class="title" href="{{ .Filename }}">{{ .Title }}</a></td>
+							<td>{{ .NumRecords }}</td>
+							<td><code>{{ .Rule }}</code></td>
+							<td>{{ .Aggregator }}</td>
+							<td>{{ .OriginalValue }}</td>
+							<td>{{ .RuleValue }}</td>
+						</tr>
+					{{end}}
+				</table>
+			</div>
+		</div>
+
+		<div id="footer" class="container">
+			{{ index .Html "footer" }}
+		</div>
+
+		{{ index .Html "bootstrapJS" }}
+	</body>
+</html>`
@@ -23,7 +23,12 @@ func generateReport(r *report.Report, config *config.Config) (string, error) {
 		CategoryURL        string
 		DateTime           string
 		ExperimentFilename string
+		MatrixURL          string
 		NumRecords         int64
+		NumFolds           int
+		NullCounts         map[string]int64
+		Where              string
+		Sample             *report.Sample
 		Description        *description.Description
 		SortOrder          []assessment.SortOrder
 		Aggregators        []report.AggregatorDesc
@@ -40,6 +45,10 @@ func generateReport(r *report.Report, config *config.Config) (string, error) {
 		DateTime:           r.Stamp.Format(time.RFC822),
 		ExperimentFilename: r.ExperimentFilename,
 		NumRecords:         r.NumRecords,
+		NumFolds:           r.NumFolds,
+		NullCounts:         r.NullCounts,
+		Where:              r.Where,
+		Sample:             r.Sample,
 		Description:        r.Description,
 		SortOrder:          r.SortOrder,
 		Aggregators:        r.Aggregators,
@@ -47,6 +56,10 @@ func generateReport(r *report.Report, config *config.Config) (string, error) {
 		Html:               makeHtml(config, "reports"),
 	}
 
+	if r.Matrix != nil {
+		tplData.MatrixURL = makeMatrixLink(r.Matrix.Filename)
+	}
+
 	reportURLDir := genReportURLDir(r.Mode, r.Category, r.Title)
 	reportFilename := genReportFilename(r.Mode, r.Category, r.Title)
 	err := writeTemplate(config, reportFilename, reportTpl, tplData)
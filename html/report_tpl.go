@@ -83,13 +83,21 @@ const reportTpl = `
 										<tr>
 											<th>Aggregator</th>
 											<th>Original Value</th>
+											{{if $.NumFolds}}
+											<th>Fold Values</th>
+											<th>Mean Rule Value</th>
+											{{else}}
 											<th>Rule Value</th>
+											{{end}}
 											<th>Change</th>
 										</tr>
 										{{ range $a.Aggregators }}
 										<tr>
 											<td>{{ .Name }}</td>
 											<td>{{ .OriginalValue }}</td>
+											{{if $.NumFolds}}
+											<td>{{ range $j, $v := .FoldValues }}{{if $j}}, {{end}}{{if $v}}{{ $v }}{{else}}-{{end}}{{ end }}</td>
+											{{end}}
 											<td>{{ .RuleValue }}</td>
 											<td>{{ .Difference }}</td>
 										</tr>
@@ -128,6 +136,9 @@ const reportTpl = `
 			<div class="container">
 				<h2>Experiment Details</h2>
 				<p>Experiment file: {{ .ExperimentFilename }}</p>
+				{{if .MatrixURL}}
+					<p><a href="{{ .MatrixURL }}">Matrix summary</a></p>
+				{{end}}
 				<br />
 				<table class="table table-bordered table-nonfluid">
 					<tr>
@@ -157,6 +168,18 @@ const reportTpl = `
 			<div class="container">
 				<h2>Data Set</h2>
 				The data set contained {{ .NumRecords }} records.</br />
+				{{if .NumFolds}}
+					Rules were cross validated using {{ .NumFolds }} folds<br />
+				{{end}}
+				{{if .Where}}
+					Records were filtered by: {{ .Where }}<br />
+				{{end}}
+				{{if .Sample}}
+					Up to {{ .Sample.NumRecords }} records were sampled using
+					{{ .Sample.Method }} sampling
+					{{- if .Sample.Field}} by {{ .Sample.Field }}{{end -}}
+					, seed: {{ .Sample.Seed }}<br />
+				{{end}}
 				<br />
 				<table class="table table-bordered">
 					<tr>
@@ -165,6 +188,9 @@ const reportTpl = `
 						<th>Min</th>
 						<th>Max</th>
 						<th>MaxDP</th>
+						{{if .NullCounts}}
+						<th>Nulls</th>
+						{{end}}
 						<th>Values - ('value', freq)</th>
 					</tr>
 					{{range $field, $fd := .Description.Fields}}
@@ -178,6 +204,9 @@ const reportTpl = `
 							{{else}}
 								<td>N/A</td><td>N/A</td><td>N/A</td>
 							{{end}}
+							{{if $.NullCounts}}
+								<td>{{ index $.NullCounts $field }}</td>
+							{{end}}
 							<td>
 								{{range $value, $valueDesc := $fd.Values}}
 							    ('{{ $value }}', {{ $valueDesc.Num }}) &nbsp;
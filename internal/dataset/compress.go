@@ -0,0 +1,121 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package dataset
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+)
+
+// compression is the compression format of a file
+type compression int
+
+const (
+	compressionNone compression = iota
+	compressionGzip
+	compressionBzip2
+	compressionXz
+	compressionZstd
+)
+
+// compressionMagic holds the magic bytes at the start of each format.
+// The '?' of the bzip2 magic is the block size, which is a digit.
+var compressionMagic = []struct {
+	kind  compression
+	magic []byte
+}{
+	{compressionGzip, []byte{0x1f, 0x8b, 0x08}},
+	{compressionBzip2, []byte("BZh?")},
+	{compressionXz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{compressionZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+}
+
+var compressionExts = map[string]compression{
+	".gz":  compressionGzip,
+	".bz2": compressionBzip2,
+	".xz":  compressionXz,
+	".zst": compressionZstd,
+}
+
+// OpenFile opens a file for reading, decompressing it as it is read if
+// it is compressed.  The compression format is detected from the magic
+// bytes at the start of the file or, failing that, the file extension.
+func OpenFile(filename string) (io.ReadCloser, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	r, err := newDecompressor(detectCompression(filename, br), br)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &decompressReadCloser{Reader: r, file: f}, nil
+}
+
+// detectCompression returns the compression format of a file by peeking
+// at the magic bytes at the start of r or, failing that, by looking at
+// the extension of filename
+func detectCompression(filename string, r *bufio.Reader) compression {
+	for _, m := range compressionMagic {
+		b, err := r.Peek(len(m.magic))
+		if err == nil && matchMagic(b, m.magic) {
+			return m.kind
+		}
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	if c, ok := compressionExts[ext]; ok {
+		return c
+	}
+	return compressionNone
+}
+
+func matchMagic(b []byte, magic []byte) bool {
+	for i, m := range magic {
+		if m == '?' {
+			if b[i] < '1' || b[i] > '9' {
+				return false
+			}
+		} else if b[i] != m {
+			return false
+		}
+	}
+	return true
+}
+
+func newDecompressor(c compression, r io.Reader) (io.Reader, error) {
+	switch c {
+	case compressionGzip:
+		return gzip.NewReader(r)
+	case compressionBzip2:
+		return bzip2.NewReader(r), nil
+	case compressionXz:
+		return xz.NewReader(r)
+	case compressionZstd:
+		return newZstdReader(r)
+	}
+	return r, nil
+}
+
+// decompressReadCloser closes the decompressor, if it can be closed,
+// as well as the file
+type decompressReadCloser struct {
+	io.Reader
+	file *os.File
+}
+
+func (d *decompressReadCloser) Close() error {
+	if c, ok := d.Reader.(io.Closer); ok {
+		c.Close()
+	}
+	return d.file.Close()
+}
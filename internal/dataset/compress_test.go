@@ -0,0 +1,32 @@
+package dataset
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestDetectCompression(t *testing.T) {
+	cases := []struct {
+		filename string
+		data     string
+		want     compression
+	}{
+		{filename: "flow.csv", data: "group,district", want: compressionNone},
+		{filename: "flow.csv", data: "\x1f\x8b\x08\x00", want: compressionGzip},
+		{filename: "flow.csv.gz", data: "group,district", want: compressionGzip},
+		{filename: "flow.csv", data: "BZh91AY&SY", want: compressionBzip2},
+		{filename: "flow.csv", data: "BZhx,district", want: compressionNone},
+		{filename: "flow.CSV.BZ2", data: "", want: compressionBzip2},
+		{filename: "flow", data: "\xfd7zXZ\x00\x00", want: compressionXz},
+		{filename: "flow.csv.xz", data: "", want: compressionXz},
+		{filename: "flow", data: "\x28\xb5\x2f\xfd", want: compressionZstd},
+		{filename: "flow.csv.zst", data: "group", want: compressionZstd},
+	}
+	for i, c := range cases {
+		r := bufio.NewReader(strings.NewReader(c.data))
+		if got := detectCompression(c.filename, r); got != c.want {
+			t.Errorf("(%d) detectCompression got: %d, want: %d", i, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,858 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+// Package darrow handles access to an Arrow IPC file as a Dataset.
+// Both the file format and the stream format are supported and the
+// format is detected from the contents of the file.  The record batches
+// are read in turn and the values of each column are converted to
+// Literals using the column's type, so that numbers remain numbers.
+// Only flat schemas are supported, that is ones without nested columns.
+// Each field name given refers to the column in the same position in
+// the file, in the same way as the header of a CSV file is handled.
+package darrow
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/dlit"
+)
+
+const fileMagic = "ARROW1"
+
+// Message header types
+const (
+	headerSchema          = 1
+	headerDictionaryBatch = 2
+	headerRecordBatch     = 3
+)
+
+// Field types
+const (
+	typeInt           = 2
+	typeFloatingPoint = 3
+	typeBinary        = 4
+	typeUtf8          = 5
+	typeBool          = 6
+	typeDecimal       = 7
+	typeDate          = 8
+	typeTimestamp     = 10
+	typeLargeBinary   = 19
+	typeLargeUtf8     = 20
+)
+
+// ErrNotArrow indicates that a file isn't an Arrow IPC file
+var ErrNotArrow = errors.New("not an arrow file")
+
+var errInvalid = errors.New("invalid arrow data")
+
+// UnsupportedError indicates that a file uses a feature of Arrow
+// that isn't supported
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string {
+	return "unsupported arrow feature: " + string(e)
+}
+
+// DArrow represents an Arrow IPC file Dataset
+type DArrow struct {
+	filename   string
+	fieldNames []string
+	isReleased bool
+}
+
+// DArrowConn represents a connection to a DArrow Dataset
+type DArrowConn struct {
+	dataset       *DArrow
+	file          *os.File
+	reader        *messageReader
+	columns       []*column
+	dictionaries  map[int64][]*dlit.Literal
+	values        [][]*dlit.Literal
+	rowNum        int
+	numRows       int
+	currentRecord ddataset.Record
+	err           error
+}
+
+// column describes a column of the schema
+type column struct {
+	name     string
+	typeType uint8
+	typ      fbTable
+	// For dictionary encoded columns
+	isDict      bool
+	dictID      int64
+	indexWidth  int
+	indexSigned bool
+}
+
+// New creates a new DArrow Dataset
+func New(filename string, fieldNames []string) ddataset.Dataset {
+	return &DArrow{
+		filename:   filename,
+		fieldNames: fieldNames,
+		isReleased: false,
+	}
+}
+
+// Open creates a connection to the Dataset
+func (d *DArrow) Open() (ddataset.Conn, error) {
+	if d.isReleased {
+		return nil, ddataset.ErrReleased
+	}
+	f, r, columns, err := openFile(d.filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) != len(d.fieldNames) {
+		f.Close()
+		return nil, ddataset.ErrWrongNumFields
+	}
+	return &DArrowConn{
+		dataset:       d,
+		file:          f,
+		reader:        r,
+		columns:       columns,
+		dictionaries:  map[int64][]*dlit.Literal{},
+		currentRecord: make(ddataset.Record, len(d.fieldNames)),
+		err:           nil,
+	}, nil
+}
+
+// Fields returns the field names used by the Dataset
+func (d *DArrow) Fields() []string {
+	return d.fieldNames
+}
+
+// NumRecords returns the number of records in the Dataset.  If there is
+// a problem getting the number of records it returns -1.  NOTE: The returned
+// value can change if the underlying Dataset changes.
+func (d *DArrow) NumRecords() int64 {
+	f, r, _, err := openFile(d.filename)
+	if err != nil {
+		return -1
+	}
+	defer f.Close()
+	numRecords := int64(0)
+	for {
+		headerType, header, _, err := r.next()
+		if err == io.EOF {
+			return numRecords
+		}
+		if err != nil {
+			return -1
+		}
+		if headerType == headerRecordBatch {
+			n, err := batchLength(header)
+			if err != nil {
+				return -1
+			}
+			numRecords += n
+		}
+	}
+}
+
+// Release releases any resources associated with the Dataset d,
+// rendering it unusable in the future.
+func (d *DArrow) Release() error {
+	if !d.isReleased {
+		d.isReleased = true
+		return nil
+	}
+	return ddataset.ErrReleased
+}
+
+// Next returns whether there is a Record to be Read
+func (c *DArrowConn) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	if c.file == nil {
+		c.err = ddataset.ErrConnClosed
+		return false
+	}
+	for c.rowNum >= c.numRows {
+		more, err := c.readBatch()
+		if err != nil {
+			c.Close()
+			c.err = err
+			return false
+		}
+		if !more {
+			return false
+		}
+	}
+	for i, field := range c.dataset.fieldNames {
+		c.currentRecord[field] = c.values[i][c.rowNum]
+	}
+	c.rowNum++
+	return true
+}
+
+// Err returns any errors from the connection
+func (c *DArrowConn) Err() error {
+	return c.err
+}
+
+// Read returns the current Record
+func (c *DArrowConn) Read() ddataset.Record {
+	return c.currentRecord
+}
+
+// Close closes the connection
+func (c *DArrowConn) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	c.values = nil
+	return err
+}
+
+// readBatch reads messages until the next record batch has been read,
+// returning false if there are no more record batches
+func (c *DArrowConn) readBatch() (bool, error) {
+	for {
+		headerType, header, body, err := c.reader.next()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		switch headerType {
+		case headerDictionaryBatch:
+			if err := c.readDictionary(header, body); err != nil {
+				return false, err
+			}
+		case headerRecordBatch:
+			b, err := newBatch(header, body)
+			if err != nil {
+				return false, err
+			}
+			values := make([][]*dlit.Literal, len(c.columns))
+			for i, col := range c.columns {
+				if values[i], err = b.readColumn(col, c.dictionaries); err != nil {
+					return false, fmt.Errorf("column: %s: %s", col.name, err)
+				}
+				if len(values[i]) != b.length {
+					return false, fmt.Errorf("column: %s: %s", col.name, errInvalid)
+				}
+			}
+			c.values = values
+			c.rowNum = 0
+			c.numRows = b.length
+			return true, nil
+		}
+	}
+}
+
+func (c *DArrowConn) readDictionary(header fbTable, body []byte) error {
+	id := header.int64(0, 0)
+	isDelta := header.bool(2, false)
+	data, ok := header.table(1)
+	if !ok || header.err() != nil {
+		return errInvalid
+	}
+	var col *column
+	for _, cl := range c.columns {
+		if cl.isDict && cl.dictID == id {
+			col = &column{name: cl.name, typeType: cl.typeType, typ: cl.typ}
+			break
+		}
+	}
+	if col == nil {
+		return fmt.Errorf("unknown dictionary: %d", id)
+	}
+	b, err := newBatch(data, body)
+	if err != nil {
+		return err
+	}
+	values, err := b.readColumn(col, nil)
+	if err != nil {
+		return fmt.Errorf("dictionary: %d: %s", id, err)
+	}
+	if isDelta {
+		c.dictionaries[id] = append(c.dictionaries[id], values...)
+	} else {
+		c.dictionaries[id] = values
+	}
+	return nil
+}
+
+// openFile opens the file and reads the schema from it
+func openFile(filename string) (*os.File, *messageReader, []*column, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	r, err := newMessageReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, nil, err
+	}
+	headerType, header, _, err := r.next()
+	if err == io.EOF || (err == nil && headerType != headerSchema) {
+		err = ErrNotArrow
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, nil, err
+	}
+	columns, err := makeColumns(header)
+	if err != nil {
+		f.Close()
+		return nil, nil, nil, err
+	}
+	return f, r, columns, nil
+}
+
+// makeColumns makes the columns from a schema message header
+func makeColumns(schema fbTable) ([]*column, error) {
+	if schema.int16(0, 0) != 0 {
+		return nil, UnsupportedError("big endian data")
+	}
+	fields := schema.tables(1)
+	columns := make([]*column, len(fields))
+	for i, field := range fields {
+		name := field.string(0)
+		if _, n := field.vector(5, 4); n > 0 {
+			return nil, UnsupportedError("nested column: " + name)
+		}
+		typ, ok := field.table(3)
+		if !ok {
+			return nil, errInvalid
+		}
+		col := &column{name: name, typeType: field.uint8(2, 0), typ: typ}
+		if dict, ok := field.table(4); ok {
+			col.isDict = true
+			col.dictID = dict.int64(0, 0)
+			col.indexWidth = 32
+			col.indexSigned = true
+			if indexType, ok := dict.table(1); ok {
+				col.indexWidth = int(indexType.int32(0, 32))
+				col.indexSigned = indexType.bool(1, false)
+			}
+		}
+		columns[i] = col
+	}
+	if err := schema.err(); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+// messageReader reads the encapsulated messages of the stream format,
+// which is also found after the magic string of the file format
+type messageReader struct {
+	r *bufio.Reader
+}
+
+func newMessageReader(f *os.File) (*messageReader, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	magic := make([]byte, len(fileMagic))
+	if _, err := f.ReadAt(magic, 0); err != nil || string(magic) != fileMagic {
+		return &messageReader{r: bufio.NewReader(f)}, nil
+	}
+	// The file format has the magic string padded to 8 bytes, followed by
+	// the messages, the footer, the footer length and the magic string
+	tail := make([]byte, 4+len(fileMagic))
+	if size < 8+int64(len(tail)) {
+		return nil, ErrNotArrow
+	}
+	if _, err := f.ReadAt(tail, size-int64(len(tail))); err != nil {
+		return nil, err
+	}
+	if string(tail[4:]) != fileMagic {
+		return nil, ErrNotArrow
+	}
+	footerLen := int64(int32(binary.LittleEndian.Uint32(tail)))
+	end := size - int64(len(tail)) - footerLen
+	if footerLen < 0 || end < 8 {
+		return nil, ErrNotArrow
+	}
+	r := io.NewSectionReader(f, 8, end-8)
+	return &messageReader{r: bufio.NewReader(r)}, nil
+}
+
+// next returns the header type, header and body of the next message.
+// It returns io.EOF if there are no more messages.
+func (mr *messageReader) next() (uint8, fbTable, []byte, error) {
+	length, err := mr.readInt32()
+	if err == io.EOF {
+		return 0, fbTable{}, nil, io.EOF
+	}
+	if err != nil {
+		return 0, fbTable{}, nil, err
+	}
+	if length == -1 {
+		// Continuation marker used from version 0.15.0
+		if length, err = mr.readInt32(); err != nil {
+			return 0, fbTable{}, nil, err
+		}
+	}
+	if length == 0 {
+		return 0, fbTable{}, nil, io.EOF
+	}
+	if length < 0 {
+		return 0, fbTable{}, nil, errInvalid
+	}
+	buf, err := mr.readN(int64(length))
+	if err != nil {
+		return 0, fbTable{}, nil, err
+	}
+	message := fbRoot(buf)
+	headerType := message.uint8(1, 0)
+	header, ok := message.table(2)
+	bodyLength := message.int64(3, 0)
+	if !ok || message.err() != nil || bodyLength < 0 {
+		return 0, fbTable{}, nil, errInvalid
+	}
+	body, err := mr.readN(bodyLength)
+	if err != nil {
+		return 0, fbTable{}, nil, err
+	}
+	return headerType, header, body, nil
+}
+
+// readN reads n bytes.  The buffer grows as the bytes are read so that
+// a corrupt length can't cause a huge allocation.
+func (mr *messageReader) readN(n int64) ([]byte, error) {
+	buf, err := ioutil.ReadAll(io.LimitReader(mr.r, n))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) != n {
+		return nil, errInvalid
+	}
+	return buf, nil
+}
+
+func (mr *messageReader) readInt32() (int32, error) {
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(mr.r, b); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, errInvalid
+		}
+		return 0, err
+	}
+	return int32(binary.LittleEndian.Uint32(b)), nil
+}
+
+// batchLength returns the number of rows in a record batch
+func batchLength(header fbTable) (int64, error) {
+	n := header.int64(0, 0)
+	if err := header.err(); err != nil || n < 0 {
+		return 0, errInvalid
+	}
+	return n, nil
+}
+
+// batch is a record batch whose nodes and buffers are used in turn
+// as each column is read
+type batch struct {
+	length  int
+	nodes   [][]byte
+	buffers [][]byte
+	body    []byte
+}
+
+func newBatch(header fbTable, body []byte) (*batch, error) {
+	if header.has(3) {
+		return nil, UnsupportedError("body compression")
+	}
+	length, err := batchLength(header)
+	if err != nil {
+		return nil, err
+	}
+	b := &batch{
+		length:  int(length),
+		nodes:   header.structs(1, 16),
+		buffers: header.structs(2, 16),
+		body:    body,
+	}
+	if err := header.err(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// nextNode returns the length and null count of the next field node
+func (b *batch) nextNode() (int, int, error) {
+	if len(b.nodes) == 0 {
+		return 0, 0, errInvalid
+	}
+	node := b.nodes[0]
+	b.nodes = b.nodes[1:]
+	length := int64(binary.LittleEndian.Uint64(node))
+	nullCount := int64(binary.LittleEndian.Uint64(node[8:]))
+	if length < 0 || nullCount < 0 {
+		return 0, 0, errInvalid
+	}
+	return int(length), int(nullCount), nil
+}
+
+func (b *batch) nextBuffer() ([]byte, error) {
+	if len(b.buffers) == 0 {
+		return nil, errInvalid
+	}
+	buf := b.buffers[0]
+	b.buffers = b.buffers[1:]
+	offset := int64(binary.LittleEndian.Uint64(buf))
+	length := int64(binary.LittleEndian.Uint64(buf[8:]))
+	if offset < 0 || length < 0 || offset > int64(len(b.body)) ||
+		length > int64(len(b.body))-offset {
+		return nil, errInvalid
+	}
+	return b.body[offset : offset+length], nil
+}
+
+// readColumn reads the values of the next column in the batch.  Nulls
+// become empty strings.
+func (b *batch) readColumn(
+	col *column,
+	dictionaries map[int64][]*dlit.Literal,
+) ([]*dlit.Literal, error) {
+	length, nullCount, err := b.nextNode()
+	if err != nil {
+		return nil, err
+	}
+	validity, err := b.nextBuffer()
+	if err != nil {
+		return nil, err
+	}
+	if nullCount != 0 && len(validity) != 0 {
+		if err := checkBits(validity, length); err != nil {
+			return nil, err
+		}
+	}
+	isValid := func(i int) bool {
+		if nullCount == 0 || len(validity) == 0 {
+			return true
+		}
+		return validity[i/8]&(1<<uint(i%8)) != 0
+	}
+
+	var value func(i int) *dlit.Literal
+	if col.isDict {
+		value, err = b.dictValueFunc(col, dictionaries, length)
+	} else {
+		value, err = b.valueFunc(col, length)
+	}
+	if err != nil {
+		return nil, err
+	}
+	values := make([]*dlit.Literal, length)
+	for i := range values {
+		if isValid(i) {
+			values[i] = value(i)
+		} else {
+			values[i] = dlit.NewString("")
+		}
+	}
+	return values, nil
+}
+
+// dictValueFunc returns a function to return the value at a given position
+// of a dictionary encoded column of length values
+func (b *batch) dictValueFunc(
+	col *column,
+	dictionaries map[int64][]*dlit.Literal,
+	length int,
+) (func(i int) *dlit.Literal, error) {
+	dictionary, ok := dictionaries[col.dictID]
+	if !ok {
+		return nil, fmt.Errorf("missing dictionary: %d", col.dictID)
+	}
+	data, err := b.nextBuffer()
+	if err != nil {
+		return nil, err
+	}
+	index, err := intFunc(data, col.indexWidth, col.indexSigned, length)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < length; i++ {
+		if n := index(i); n < 0 || n >= int64(len(dictionary)) {
+			return nil, errInvalid
+		}
+	}
+	return func(i int) *dlit.Literal {
+		return dictionary[index(i)]
+	}, nil
+}
+
+// valueFunc returns a function to return the value at a given position
+// of a column of length values.  The buffers are checked to be large
+// enough for length values before the function is returned.
+func (b *batch) valueFunc(
+	col *column,
+	length int,
+) (func(i int) *dlit.Literal, error) {
+	switch col.typeType {
+	case typeUtf8, typeBinary, typeLargeUtf8, typeLargeBinary:
+		offsets, err := b.nextBuffer()
+		if err != nil {
+			return nil, err
+		}
+		data, err := b.nextBuffer()
+		if err != nil {
+			return nil, err
+		}
+		offsetWidth := 4
+		offset := func(i int) int64 {
+			return int64(int32(binary.LittleEndian.Uint32(offsets[i*4:])))
+		}
+		if col.typeType == typeLargeUtf8 || col.typeType == typeLargeBinary {
+			offsetWidth = 8
+			offset = func(i int) int64 {
+				return int64(binary.LittleEndian.Uint64(offsets[i*8:]))
+			}
+		}
+		if length == 0 {
+			return func(i int) *dlit.Literal { return dlit.NewString("") }, nil
+		}
+		if err := checkWidth(offsets, length+1, offsetWidth); err != nil {
+			return nil, err
+		}
+		for i := 0; i < length; i++ {
+			start, end := offset(i), offset(i+1)
+			if start < 0 || start > end || end > int64(len(data)) {
+				return nil, errInvalid
+			}
+		}
+		return func(i int) *dlit.Literal {
+			return dlit.NewString(string(data[offset(i):offset(i+1)]))
+		}, nil
+	}
+
+	data, err := b.nextBuffer()
+	if err != nil {
+		return nil, err
+	}
+	switch col.typeType {
+	case typeInt:
+		width := int(col.typ.int32(0, 0))
+		signed := col.typ.bool(1, false)
+		if err := col.typ.err(); err != nil {
+			return nil, err
+		}
+		v, err := intFunc(data, width, signed, length)
+		if err != nil {
+			return nil, err
+		}
+		return func(i int) *dlit.Literal {
+			n := v(i)
+			if !signed && width == 64 && n < 0 {
+				return dlit.NewString(strconv.FormatUint(uint64(n), 10))
+			}
+			return dlit.MustNew(n)
+		}, nil
+	case typeFloatingPoint:
+		precision := col.typ.int16(0, 0)
+		if err := col.typ.err(); err != nil {
+			return nil, err
+		}
+		switch precision {
+		case 1:
+			if err := checkWidth(data, length, 4); err != nil {
+				return nil, err
+			}
+			return func(i int) *dlit.Literal {
+				bits := binary.LittleEndian.Uint32(data[i*4:])
+				return float32ToLiteral(math.Float32frombits(bits))
+			}, nil
+		case 2:
+			if err := checkWidth(data, length, 8); err != nil {
+				return nil, err
+			}
+			return func(i int) *dlit.Literal {
+				bits := binary.LittleEndian.Uint64(data[i*8:])
+				return dlit.MustNew(math.Float64frombits(bits))
+			}, nil
+		}
+		return nil, UnsupportedError("half precision float")
+	case typeBool:
+		if err := checkBits(data, length); err != nil {
+			return nil, err
+		}
+		return func(i int) *dlit.Literal {
+			return dlit.MustNew(data[i/8]&(1<<uint(i%8)) != 0)
+		}, nil
+	case typeDecimal:
+		scale := int(col.typ.int32(1, 0))
+		width := int(col.typ.int32(2, 128)) / 8
+		if err := col.typ.err(); err != nil {
+			return nil, err
+		}
+		if width <= 0 {
+			return nil, errInvalid
+		}
+		if err := checkWidth(data, length, width); err != nil {
+			return nil, err
+		}
+		return func(i int) *dlit.Literal {
+			return decimalToLiteral(data[i*width:(i+1)*width], scale)
+		}, nil
+	case typeDate:
+		unit := col.typ.int16(0, 1)
+		if err := col.typ.err(); err != nil {
+			return nil, err
+		}
+		if unit == 0 {
+			if err := checkWidth(data, length, 4); err != nil {
+				return nil, err
+			}
+			return func(i int) *dlit.Literal {
+				days := int64(int32(binary.LittleEndian.Uint32(data[i*4:])))
+				t := time.Unix(days*24*60*60, 0).UTC()
+				return dlit.NewString(t.Format("2006-01-02"))
+			}, nil
+		}
+		if err := checkWidth(data, length, 8); err != nil {
+			return nil, err
+		}
+		return func(i int) *dlit.Literal {
+			ms := int64(binary.LittleEndian.Uint64(data[i*8:]))
+			t := time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)).UTC()
+			return dlit.NewString(t.Format("2006-01-02"))
+		}, nil
+	case typeTimestamp:
+		units := []time.Duration{
+			time.Second, time.Millisecond, time.Microsecond, time.Nanosecond,
+		}
+		unitNum := int(col.typ.int16(0, 0))
+		if err := col.typ.err(); err != nil {
+			return nil, err
+		}
+		if unitNum < 0 || unitNum >= len(units) {
+			return nil, errInvalid
+		}
+		if err := checkWidth(data, length, 8); err != nil {
+			return nil, err
+		}
+		perSecond := int64(time.Second / units[unitNum])
+		return func(i int) *dlit.Literal {
+			v := int64(binary.LittleEndian.Uint64(data[i*8:]))
+			t := time.Unix(v/perSecond, (v%perSecond)*int64(units[unitNum]))
+			return dlit.NewString(t.UTC().Format(time.RFC3339Nano))
+		}, nil
+	}
+	return nil, UnsupportedError(fmt.Sprintf("type: %d", col.typeType))
+}
+
+// intFunc returns a function to return the integer at a given position
+// of data, which must hold at least length integers
+func intFunc(
+	data []byte,
+	width int,
+	signed bool,
+	length int,
+) (func(i int) int64, error) {
+	switch width {
+	case 8, 16, 32, 64:
+		if err := checkWidth(data, length, width/8); err != nil {
+			return nil, err
+		}
+	}
+	switch width {
+	case 8:
+		if signed {
+			return func(i int) int64 { return int64(int8(data[i])) }, nil
+		}
+		return func(i int) int64 { return int64(data[i]) }, nil
+	case 16:
+		if signed {
+			return func(i int) int64 {
+				return int64(int16(binary.LittleEndian.Uint16(data[i*2:])))
+			}, nil
+		}
+		return func(i int) int64 {
+			return int64(binary.LittleEndian.Uint16(data[i*2:]))
+		}, nil
+	case 32:
+		if signed {
+			return func(i int) int64 {
+				return int64(int32(binary.LittleEndian.Uint32(data[i*4:])))
+			}, nil
+		}
+		return func(i int) int64 {
+			return int64(binary.LittleEndian.Uint32(data[i*4:]))
+		}, nil
+	case 64:
+		return func(i int) int64 {
+			return int64(binary.LittleEndian.Uint64(data[i*8:]))
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid integer bit width: %d", width)
+}
+
+// checkWidth returns errInvalid if data is too short to hold length
+// values of width bytes each
+func checkWidth(data []byte, length int, width int) error {
+	if length > len(data)/width {
+		return errInvalid
+	}
+	return nil
+}
+
+// checkBits returns errInvalid if data is too short to be a bitmap
+// of length values
+func checkBits(data []byte, length int) error {
+	if length > len(data)*8 {
+		return errInvalid
+	}
+	return nil
+}
+
+func float32ToLiteral(f float32) *dlit.Literal {
+	// Use the shortest representation of the float32 so that, for example,
+	// 1.1 doesn't become 1.100000023841858
+	s := strconv.FormatFloat(float64(f), 'g', -1, 32)
+	f64, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return dlit.NewString(s)
+	}
+	return dlit.MustNew(f64)
+}
+
+// decimalToLiteral converts a little-endian two's complement decimal
+func decimalToLiteral(b []byte, scale int) *dlit.Literal {
+	be := make([]byte, len(b))
+	for i, v := range b {
+		be[len(b)-1-i] = v
+	}
+	n := new(big.Int).SetBytes(be)
+	if len(be) > 0 && be[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(be)*8)))
+	}
+	if scale <= 0 {
+		return dlit.NewString(n.String())
+	}
+	s := new(big.Int).Abs(n).String()
+	if len(s) <= scale {
+		s = strings.Repeat("0", scale-len(s)+1) + s
+	}
+	s = s[:len(s)-scale] + "." + s[len(s)-scale:]
+	if n.Sign() < 0 {
+		s = "-" + s
+	}
+	return dlit.NewString(s)
+}
@@ -0,0 +1,147 @@
+package darrow
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lawrencewoodman/ddataset"
+)
+
+var flowFields = []string{
+	"group", "district", "height", "id", "flow", "ok", "day",
+}
+
+var flowRecords = [][]string{
+	{"a", "northcal", "120", "1", "16.5", "true", "2018-01-02"},
+	{"a", "", "128", "2", "19", "false", "2018-01-03"},
+	{"b", "southcal", "18", "3", "5", "true", "2018-02-01"},
+	{"b", "northcal", "220", "4000000000", "20.73", "false", "2018-02-02"},
+	{"c", "midcal", "328", "5", "82.4", "true", "2018-03-03"},
+	{"c", "southcal", "38", "-6", "1", "false", "2018-03-04"},
+}
+
+func TestOpenNextRead(t *testing.T) {
+	filenames := []string{"flow.arrow", "flow.arrows", "flow_dict.arrow"}
+	for _, filename := range filenames {
+		ds := New(filepath.Join("fixtures", filename), flowFields)
+		conn, err := ds.Open()
+		if err != nil {
+			t.Fatalf("(%s) Open: %s", filename, err)
+		}
+		got := [][]string{}
+		for conn.Next() {
+			record := conn.Read()
+			row := make([]string, len(flowFields))
+			for i, f := range flowFields {
+				row[i] = record[f].String()
+			}
+			got = append(got, row)
+		}
+		if err := conn.Err(); err != nil {
+			t.Fatalf("(%s) Err: %s", filename, err)
+		}
+		conn.Close()
+		if !reflect.DeepEqual(got, flowRecords) {
+			t.Errorf("(%s) got: %v, want: %v", filename, got, flowRecords)
+		}
+		if n := ds.NumRecords(); n != 6 {
+			t.Errorf("(%s) NumRecords got: %d, want: 6", filename, n)
+		}
+	}
+}
+
+func TestOpen_errors(t *testing.T) {
+	cases := []struct {
+		filename string
+		fields   []string
+		wantErr  error
+	}{
+		{filename: "flow.arrow",
+			fields:  []string{"group", "district"},
+			wantErr: ddataset.ErrWrongNumFields,
+		},
+		{filename: "flow.txt",
+			fields:  flowFields,
+			wantErr: errInvalid,
+		},
+	}
+	for i, c := range cases {
+		ds := New(filepath.Join("fixtures", c.filename), c.fields)
+		if _, err := ds.Open(); err != c.wantErr {
+			t.Errorf("(%d) Open got: %v, want: %s", i, err, c.wantErr)
+		}
+		if n := ds.NumRecords(); c.filename == "flow.txt" && n != -1 {
+			t.Errorf("(%d) NumRecords got: %d, want: -1", i, n)
+		}
+	}
+}
+
+func TestNext_closed(t *testing.T) {
+	ds := New(filepath.Join("fixtures", "flow.arrow"), flowFields)
+	conn, err := ds.Open()
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	conn.Close()
+	if conn.Next() {
+		t.Errorf("Next got: true, want: false")
+	}
+	if err := conn.Err(); err != ddataset.ErrConnClosed {
+		t.Errorf("Err got: %v, want: %s", err, ddataset.ErrConnClosed)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	ds := New(filepath.Join("fixtures", "flow.arrow"), flowFields)
+	if err := ds.Release(); err != nil {
+		t.Errorf("Release: %s", err)
+	}
+	if _, err := ds.Open(); err != ddataset.ErrReleased {
+		t.Errorf("Open got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+	if err := ds.Release(); err != ddataset.ErrReleased {
+		t.Errorf("Release got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+}
+
+func TestNext_corrupt(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "darrow_test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	filenames := []string{"flow.arrow", "flow.arrows", "flow_dict.arrow"}
+	for _, filename := range filenames {
+		src, err := ioutil.ReadFile(filepath.Join("fixtures", filename))
+		if err != nil {
+			t.Fatalf("ReadFile: %s", err)
+		}
+		corrupt := filepath.Join(tmpDir, filename)
+		// Truncate the file at each position and then corrupt each byte.
+		// Neither should cause a panic.
+		for i := 0; i < len(src)*2; i++ {
+			var data []byte
+			if i < len(src) {
+				data = src[:i]
+			} else {
+				data = append([]byte{}, src...)
+				data[i-len(src)] ^= 0xff
+			}
+			if err := ioutil.WriteFile(corrupt, data, 0644); err != nil {
+				t.Fatalf("WriteFile: %s", err)
+			}
+			ds := New(corrupt, flowFields)
+			conn, err := ds.Open()
+			if err != nil {
+				continue
+			}
+			for conn.Next() {
+				conn.Read()
+			}
+			conn.Close()
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package darrow
+
+import (
+	"encoding/binary"
+)
+
+// fbBuffer is the buffer of a flatbuffer.  A read outside of the buffer
+// returns a zero value and records errInvalid, so that a sequence of
+// reads can be checked once they are done.
+type fbBuffer struct {
+	buf []byte
+	err error
+}
+
+// fbTable is a flatbuffers table.  This is only as complete as is needed
+// to read the Arrow IPC metadata.  If a field can't be read because it is
+// outside of the buffer its default is returned and err reports it.
+type fbTable struct {
+	b   *fbBuffer
+	pos int
+}
+
+// fbRoot returns the root table of a flatbuffer
+func fbRoot(buf []byte) fbTable {
+	b := &fbBuffer{buf: buf}
+	return fbTable{b: b, pos: int(b.uint32(0))}
+}
+
+// bytes returns the n bytes of the buffer starting at pos
+func (b *fbBuffer) bytes(pos int, n int) []byte {
+	if b == nil {
+		return nil
+	}
+	if pos < 0 || n < 0 || pos > len(b.buf) || n > len(b.buf)-pos {
+		b.invalid()
+		return nil
+	}
+	return b.buf[pos : pos+n]
+}
+
+// invalid records that the flatbuffer is invalid
+func (b *fbBuffer) invalid() {
+	if b.err == nil {
+		b.err = errInvalid
+	}
+}
+
+func (b *fbBuffer) uint8(pos int) uint8 {
+	if p := b.bytes(pos, 1); p != nil {
+		return p[0]
+	}
+	return 0
+}
+
+func (b *fbBuffer) uint16(pos int) uint16 {
+	if p := b.bytes(pos, 2); p != nil {
+		return binary.LittleEndian.Uint16(p)
+	}
+	return 0
+}
+
+func (b *fbBuffer) uint32(pos int) uint32 {
+	if p := b.bytes(pos, 4); p != nil {
+		return binary.LittleEndian.Uint32(p)
+	}
+	return 0
+}
+
+func (b *fbBuffer) uint64(pos int) uint64 {
+	if p := b.bytes(pos, 8); p != nil {
+		return binary.LittleEndian.Uint64(p)
+	}
+	return 0
+}
+
+// err returns errInvalid if any read of the flatbuffer that t is part of
+// was outside of its buffer
+func (t fbTable) err() error {
+	if t.b == nil {
+		return nil
+	}
+	return t.b.err
+}
+
+// offset returns the position of field i within the table or 0 if the
+// field isn't present
+func (t fbTable) offset(i int) int {
+	vtable := t.pos - int(int32(t.b.uint32(t.pos)))
+	vtableSize := int(t.b.uint16(vtable))
+	o := 4 + 2*i
+	if o >= vtableSize {
+		return 0
+	}
+	if off := int(t.b.uint16(vtable + o)); off != 0 && t.err() == nil {
+		return t.pos + off
+	}
+	return 0
+}
+
+func (t fbTable) has(i int) bool {
+	return t.offset(i) != 0
+}
+
+func (t fbTable) uint8(i int, def uint8) uint8 {
+	if o := t.offset(i); o != 0 {
+		return t.b.uint8(o)
+	}
+	return def
+}
+
+func (t fbTable) bool(i int, def bool) bool {
+	if o := t.offset(i); o != 0 {
+		return t.b.uint8(o) != 0
+	}
+	return def
+}
+
+func (t fbTable) int16(i int, def int16) int16 {
+	if o := t.offset(i); o != 0 {
+		return int16(t.b.uint16(o))
+	}
+	return def
+}
+
+func (t fbTable) int32(i int, def int32) int32 {
+	if o := t.offset(i); o != 0 {
+		return int32(t.b.uint32(o))
+	}
+	return def
+}
+
+func (t fbTable) int64(i int, def int64) int64 {
+	if o := t.offset(i); o != 0 {
+		return int64(t.b.uint64(o))
+	}
+	return def
+}
+
+// indirect returns the position pointed to by the offset at o
+func (t fbTable) indirect(o int) int {
+	return o + int(t.b.uint32(o))
+}
+
+func (t fbTable) table(i int) (fbTable, bool) {
+	o := t.offset(i)
+	if o == 0 {
+		return fbTable{}, false
+	}
+	return fbTable{b: t.b, pos: t.indirect(o)}, true
+}
+
+func (t fbTable) string(i int) string {
+	o := t.offset(i)
+	if o == 0 {
+		return ""
+	}
+	p := t.indirect(o)
+	n := int(t.b.uint32(p))
+	return string(t.b.bytes(p+4, n))
+}
+
+// vector returns the position of the first element of vector field i,
+// whose elements are each size bytes, and the number of elements in it.
+// If the vector doesn't fit in the buffer it is treated as empty.
+func (t fbTable) vector(i int, size int) (int, int) {
+	o := t.offset(i)
+	if o == 0 {
+		return 0, 0
+	}
+	p := t.indirect(o)
+	n := int(t.b.uint32(p))
+	if n > len(t.b.buf)/size {
+		t.b.invalid()
+		return 0, 0
+	}
+	if t.b.bytes(p+4, n*size) == nil {
+		return 0, 0
+	}
+	return p + 4, n
+}
+
+// tables returns the tables in vector field i
+func (t fbTable) tables(i int) []fbTable {
+	p, n := t.vector(i, 4)
+	r := make([]fbTable, n)
+	for j := range r {
+		r[j] = fbTable{b: t.b, pos: t.indirect(p + 4*j)}
+	}
+	return r
+}
+
+// structs returns the raw bytes of each struct in vector field i
+func (t fbTable) structs(i int, size int) [][]byte {
+	p, n := t.vector(i, size)
+	r := make([][]byte, n)
+	for j := range r {
+		r[j] = t.b.bytes(p+size*j, size)
+	}
+	return r
+}
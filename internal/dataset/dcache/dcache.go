@@ -0,0 +1,315 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+// Package dcache keeps copies of Datasets on disk so that a source only
+// has to be copied once while it remains unchanged.  Each copy is stored
+// under a key, which should be a fingerprint of the source, and the least
+// recently used copies are evicted when the cache grows beyond its
+// maximum size.
+package dcache
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/ddataset/dcsv"
+	"github.com/vlifesystems/rulehunter/internal/dataset"
+)
+
+// The name of the file in an entry's directory holding the copy
+const dataFilename = "data.csv"
+
+// The suffix of directories holding copies that are still being made
+const tmpSuffix = ".tmp"
+
+// DefaultMaxSize is the maximum size of a Cache if none is given
+const DefaultMaxSize = 1 << 30
+
+// Cache represents a directory of Dataset copies
+type Cache struct {
+	dir      string
+	maxSize  int64
+	inUse    map[string]int
+	keyLocks map[string]*sync.Mutex
+	mu       sync.Mutex
+}
+
+// DCache represents a Dataset held in a Cache
+type DCache struct {
+	cache      *Cache
+	key        string
+	dataset    ddataset.Dataset
+	numRecords int64
+	isReleased bool
+}
+
+// InvalidKeyError indicates that a key can't be used as a directory name
+type InvalidKeyError string
+
+func (e InvalidKeyError) Error() string {
+	return "invalid key: " + string(e)
+}
+
+// New creates a Cache stored in dir, which will be created if it doesn't
+// exist.  Once the copies take up more than maxSize bytes the least
+// recently used are removed.  If maxSize is 0 DefaultMaxSize is used and
+// if maxSize < 0 the size isn't limited.  Any partial copies left in dir,
+// by a process that stopped while copying, are removed.
+func New(dir string, maxSize int64) *Cache {
+	if maxSize == 0 {
+		maxSize = DefaultMaxSize
+	}
+	removePartialCopies(dir)
+	return &Cache{
+		dir:      dir,
+		maxSize:  maxSize,
+		inUse:    map[string]int{},
+		keyLocks: map[string]*sync.Mutex{},
+	}
+}
+
+// Dataset returns the copy stored under key, first copying d into the
+// cache if there isn't one.  The returned Dataset must be released once
+// it is no longer needed so that its copy may be evicted.
+func (c *Cache) Dataset(key string, d ddataset.Dataset) (ddataset.Dataset, error) {
+	if key == "" || strings.ContainsAny(key, `/\.`) {
+		return nil, InvalidKeyError(key)
+	}
+	// File mode permission:
+	// No special permission bits
+	// User: Read, Write Execute
+	// Group: None
+	// Other: None
+	const modePerm = 0700
+	if err := os.MkdirAll(c.dir, modePerm); err != nil {
+		return nil, err
+	}
+
+	keyLock := c.keyLock(key)
+	keyLock.Lock()
+	defer keyLock.Unlock()
+
+	filename := filepath.Join(c.dir, key, dataFilename)
+	if fileExists(filename) {
+		now := time.Now()
+		if err := os.Chtimes(filename, now, now); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := c.store(key, d); err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	c.inUse[key]++
+	c.mu.Unlock()
+	if err := c.evict(); err != nil {
+		c.release(key)
+		return nil, err
+	}
+	return &DCache{
+		cache:      c,
+		key:        key,
+		dataset:    dcsv.New(filename, false, ',', d.Fields()),
+		numRecords: -1,
+		isReleased: false,
+	}, nil
+}
+
+// keyLock returns the mutex used to stop key being copied more than once
+// at the same time
+func (c *Cache) keyLock(key string) *sync.Mutex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l, ok := c.keyLocks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		c.keyLocks[key] = l
+	}
+	return l
+}
+
+// store copies d into a temporary directory which is then renamed to key
+// so that a partial copy is never used
+func (c *Cache) store(key string, d ddataset.Dataset) error {
+	tmpDir, err := ioutil.TempDir(c.dir, key+tmpSuffix)
+	if err != nil {
+		return err
+	}
+	if err := writeCSV(filepath.Join(tmpDir, dataFilename), d); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	entryDir := filepath.Join(c.dir, key)
+	if err := os.RemoveAll(entryDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	if err := os.Rename(tmpDir, entryDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	return nil
+}
+
+// removePartialCopies removes the temporary directories in dir that
+// hold copies which were never finished
+func removePartialCopies(dir string) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if file.IsDir() && strings.Contains(file.Name(), tmpSuffix) {
+			os.RemoveAll(filepath.Join(dir, file.Name()))
+		}
+	}
+}
+
+func writeCSV(filename string, d ddataset.Dataset) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+
+	conn, err := d.Open()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	fields := d.Fields()
+	strRecord := make([]string, len(fields))
+	for conn.Next() {
+		record := conn.Read()
+		for i, field := range fields {
+			strRecord[i] = record[field].String()
+		}
+		if err := w.Write(strRecord); err != nil {
+			return fmt.Errorf("error writing record to cache: %s", err)
+		}
+	}
+	if err := conn.Err(); err != nil {
+		return err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+type entry struct {
+	key     string
+	size    int64
+	modTime time.Time
+}
+
+// evict removes the least recently used copies that aren't in use until
+// the cache is no larger than its maximum size
+func (c *Cache) evict() error {
+	if c.maxSize < 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	entries := []entry{}
+	size := int64(0)
+	for _, file := range files {
+		if !file.IsDir() || strings.Contains(file.Name(), tmpSuffix) {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(c.dir, file.Name(), dataFilename))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry{file.Name(), fi.Size(), fi.ModTime()})
+		size += fi.Size()
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+	for _, e := range entries {
+		if size <= c.maxSize {
+			break
+		}
+		if c.inUse[e.key] > 0 {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(c.dir, e.key)); err != nil {
+			return err
+		}
+		size -= e.size
+	}
+	return nil
+}
+
+func (c *Cache) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inUse[key]--
+	if c.inUse[key] < 1 {
+		delete(c.inUse, key)
+	}
+}
+
+// Open creates a connection to the Dataset
+func (d *DCache) Open() (ddataset.Conn, error) {
+	if d.isReleased {
+		return nil, ddataset.ErrReleased
+	}
+	return d.dataset.Open()
+}
+
+// Fields returns the field names used by the Dataset
+func (d *DCache) Fields() []string {
+	if d.isReleased {
+		return []string{}
+	}
+	return d.dataset.Fields()
+}
+
+// NumRecords returns the number of records in the Dataset.  If there is
+// a problem getting the number of records it returns -1.
+func (d *DCache) NumRecords() int64 {
+	if d.numRecords != -1 {
+		return d.numRecords
+	}
+	d.numRecords = dataset.CountNumRecords(d)
+	return d.numRecords
+}
+
+// Release releases any resources associated with the Dataset d,
+// rendering it unusable in the future.  The copy remains in the cache
+// for others to use.
+func (d *DCache) Release() error {
+	if !d.isReleased {
+		d.isReleased = true
+		d.cache.release(d.key)
+		return nil
+	}
+	return ddataset.ErrReleased
+}
+
+func fileExists(path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return fi.Mode().IsRegular()
+}
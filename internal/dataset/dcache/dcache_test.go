@@ -0,0 +1,187 @@
+package dcache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/ddataset/dcsv"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+)
+
+// countingDataset counts the number of times it is opened
+type countingDataset struct {
+	ddataset.Dataset
+	numOpen int
+}
+
+func (d *countingDataset) Open() (ddataset.Conn, error) {
+	d.numOpen++
+	return d.Dataset.Open()
+}
+
+func TestCacheDataset(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "dcache_test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	c := New(filepath.Join(tmpDir, "cache"), 0)
+	source := &countingDataset{Dataset: testhelpers.NewFlowDataset()}
+	d1, err := c.Dataset("flow", source)
+	if err != nil {
+		t.Fatalf("Dataset: %s", err)
+	}
+	d2, err := c.Dataset("flow", source)
+	if err != nil {
+		t.Fatalf("Dataset: %s", err)
+	}
+	if source.numOpen != 1 {
+		t.Errorf("source opened %d times, want: 1", source.numOpen)
+	}
+	if err := d1.Release(); err != nil {
+		t.Fatalf("Release: %s", err)
+	}
+	if err := d1.Release(); err != ddataset.ErrReleased {
+		t.Errorf("Release got err: %v, want: %v", err, ddataset.ErrReleased)
+	}
+	if !reflect.DeepEqual(d2.Fields(), testhelpers.FlowFields) {
+		t.Errorf("Fields got: %v, want: %v", d2.Fields(), testhelpers.FlowFields)
+	}
+	if got := d2.NumRecords(); got != 9 {
+		t.Errorf("NumRecords got: %d, want: 9", got)
+	}
+	got := testhelpers.ReadField(t, d2, "height")
+	want := testhelpers.ReadField(t, testhelpers.NewFlowDataset(), "height")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records got: %v, want: %v", got, want)
+	}
+	if err := d2.Release(); err != nil {
+		t.Fatalf("Release: %s", err)
+	}
+	if _, err := d2.Open(); err != ddataset.ErrReleased {
+		t.Errorf("Open got err: %v, want: %v", err, ddataset.ErrReleased)
+	}
+
+	// A new Cache using the same directory must use the existing copy
+	c = New(filepath.Join(tmpDir, "cache"), 0)
+	d3, err := c.Dataset("flow", source)
+	if err != nil {
+		t.Fatalf("Dataset: %s", err)
+	}
+	defer d3.Release()
+	if source.numOpen != 1 {
+		t.Errorf("source opened %d times, want: 1", source.numOpen)
+	}
+}
+
+func TestCacheDataset_evict(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "dcache_test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	// Only large enough for one copy of flow
+	c := New(tmpDir, 200)
+	d1, err := c.Dataset("flow1", testhelpers.NewFlowDataset())
+	if err != nil {
+		t.Fatalf("Dataset: %s", err)
+	}
+	d2, err := c.Dataset("flow2", testhelpers.NewFlowDataset())
+	if err != nil {
+		t.Fatalf("Dataset: %s", err)
+	}
+	// flow1 is in use so can't be evicted
+	assertEntries(t, tmpDir, []string{"flow1", "flow2"})
+	if err := d1.Release(); err != nil {
+		t.Fatalf("Release: %s", err)
+	}
+	d3, err := c.Dataset("flow3", testhelpers.NewFlowDataset())
+	if err != nil {
+		t.Fatalf("Dataset: %s", err)
+	}
+	assertEntries(t, tmpDir, []string{"flow2", "flow3"})
+	d2.Release()
+	d3.Release()
+	d4, err := c.Dataset("flow4", testhelpers.NewFlowDataset())
+	if err != nil {
+		t.Fatalf("Dataset: %s", err)
+	}
+	defer d4.Release()
+	assertEntries(t, tmpDir, []string{"flow4"})
+}
+
+func TestNew(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "dcache_test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	c := New(tmpDir, 0)
+	if c.maxSize != DefaultMaxSize {
+		t.Errorf("maxSize got: %d, want: %d", c.maxSize, DefaultMaxSize)
+	}
+	d, err := c.Dataset("flow", testhelpers.NewFlowDataset())
+	if err != nil {
+		t.Fatalf("Dataset: %s", err)
+	}
+	defer d.Release()
+	// A copy left unfinished by a process that was stopped
+	partialDir := filepath.Join(tmpDir, "flow2"+tmpSuffix+"123")
+	if err := os.Mkdir(partialDir, 0700); err != nil {
+		t.Fatalf("Mkdir: %s", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(partialDir, dataFilename), []byte("1"), 0600)
+	if err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	New(tmpDir, 0)
+	assertEntries(t, tmpDir, []string{"flow"})
+}
+
+func TestCacheDataset_errors(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "dcache_test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	c := New(tmpDir, 0)
+	for _, key := range []string{"", "../flow", "flow.tmp"} {
+		_, err := c.Dataset(key, testhelpers.NewFlowDataset())
+		if err != InvalidKeyError(key) {
+			t.Errorf("Dataset(%s) got err: %v, want: %v",
+				key, err, InvalidKeyError(key))
+		}
+	}
+	missing := dcsv.New(
+		filepath.Join("fixtures", "nonexistant.csv"),
+		true,
+		',',
+		testhelpers.FlowFields,
+	)
+	if _, err := c.Dataset("missing", missing); err == nil {
+		t.Errorf("Dataset got err: nil, want: error")
+	}
+	assertEntries(t, tmpDir, []string{})
+}
+
+/*************************
+ *   Helper functions
+ *************************/
+
+func assertEntries(t *testing.T, dir string, want []string) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %s", err)
+	}
+	got := []string{}
+	for _, f := range files {
+		got = append(got, f.Name())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries got: %v, want: %v", got, want)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+// Package dcommand handles access to the output of an external command
+// as a Dataset.  The command is run the first time the Dataset is opened
+// and its standard output, which must be CSV or JSON Lines, is saved to
+// a temporary file that is read by any connections to the Dataset.
+package dcommand
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/vlifesystems/rulehunter/internal/dataset"
+	"github.com/vlifesystems/rulehunter/internal/dataset/dcsv"
+	"github.com/vlifesystems/rulehunter/internal/dataset/djsonl"
+)
+
+// Format is the format of the output of a command
+type Format int
+
+const (
+	CSV Format = iota
+	JSONL
+)
+
+// The most bytes of standard error to include in an ExitError
+const maxStderrLen = 1024
+
+// Spec describes a command and its output
+type Spec struct {
+	// The executable to run, which is looked up in the PATH if it doesn't
+	// contain a path separator
+	Path string
+	Args []string
+	// The working directory of the command, if empty the current
+	// directory is used
+	Dir string
+	// The longest the command may run for, if 0 there is no limit
+	Timeout time.Duration
+	Format  Format
+	// HasHeader and Separator are used by the CSV format
+	HasHeader bool
+	Separator rune
+	// FieldPaths is used by the JSONL format, see djsonl.New
+	FieldPaths map[string]string
+	// The directory in which to save the output, if empty the default
+	// system temporary directory is used
+	TmpDir string
+}
+
+// DCommand represents the output of an external command as a Dataset
+type DCommand struct {
+	spec       Spec
+	fieldNames []string
+	outputDir  string
+	output     ddataset.Dataset
+	mu         sync.Mutex
+	isReleased bool
+}
+
+// ExitError indicates that a command exited with a non-zero exit code
+type ExitError struct {
+	Path     string
+	ExitCode int
+	// Stderr is the standard error of the command, which is truncated
+	// if it is long
+	Stderr string
+}
+
+func (e ExitError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("%s: exit code %d", e.Path, e.ExitCode)
+	}
+	return fmt.Sprintf("%s: exit code %d: %s", e.Path, e.ExitCode, e.Stderr)
+}
+
+// TimeoutError indicates that a command took too long and was killed
+type TimeoutError struct {
+	Path    string
+	Timeout time.Duration
+	Stderr  string
+}
+
+func (e TimeoutError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("%s: timed out after %s", e.Path, e.Timeout)
+	}
+	return fmt.Sprintf("%s: timed out after %s: %s", e.Path, e.Timeout, e.Stderr)
+}
+
+// New creates a new DCommand Dataset
+func New(spec Spec, fieldNames []string) ddataset.Dataset {
+	return &DCommand{
+		spec:       spec,
+		fieldNames: fieldNames,
+		isReleased: false,
+	}
+}
+
+// Open creates a connection to the Dataset, running the command if it
+// hasn't already been run
+func (d *DCommand) Open() (ddataset.Conn, error) {
+	if d.isReleased {
+		return nil, ddataset.ErrReleased
+	}
+	if err := d.run(); err != nil {
+		return nil, err
+	}
+	return d.output.Open()
+}
+
+// Fields returns the field names used by the Dataset
+func (d *DCommand) Fields() []string {
+	return d.fieldNames
+}
+
+// NumRecords returns the number of records in the Dataset.  If there is
+// a problem getting the number of records it returns -1.  NOTE: The returned
+// value can change if the underlying Dataset changes.
+func (d *DCommand) NumRecords() int64 {
+	return dataset.CountNumRecords(d)
+}
+
+// Release releases any resources associated with the Dataset d,
+// rendering it unusable in the future.  This removes the saved output.
+func (d *DCommand) Release() error {
+	if d.isReleased {
+		return ddataset.ErrReleased
+	}
+	d.isReleased = true
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.output == nil {
+		return nil
+	}
+	if err := d.output.Release(); err != nil {
+		return err
+	}
+	d.output = nil
+	return os.RemoveAll(d.outputDir)
+}
+
+// run runs the command and saves its output if it hasn't been run
+// successfully already
+func (d *DCommand) run() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.output != nil {
+		return nil
+	}
+	dir, err := ioutil.TempDir(d.spec.TmpDir, "dcommand")
+	if err != nil {
+		return err
+	}
+	outputFilename := filepath.Join(dir, "stdout")
+	if err := d.runCommand(outputFilename, filepath.Join(dir, "stderr")); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	d.outputDir = dir
+	switch d.spec.Format {
+	case JSONL:
+		d.output = djsonl.New(outputFilename, d.fieldNames, d.spec.FieldPaths)
+	default:
+		d.output = dcsv.New(
+			outputFilename,
+			d.spec.HasHeader,
+			d.spec.Separator,
+			d.fieldNames,
+		)
+	}
+	return nil
+}
+
+// runCommand runs the command, writing its standard output and error to
+// files so that nothing is left blocked on a pipe if the command is killed
+func (d *DCommand) runCommand(stdoutFilename, stderrFilename string) error {
+	ctx := context.Background()
+	if d.spec.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.spec.Timeout)
+		defer cancel()
+	}
+	stdout, err := os.Create(stdoutFilename)
+	if err != nil {
+		return err
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(stderrFilename)
+	if err != nil {
+		return err
+	}
+	defer stderr.Close()
+
+	cmd := exec.CommandContext(ctx, d.spec.Path, d.spec.Args...)
+	cmd.Dir = d.spec.Dir
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	runErr := cmd.Run()
+	if runErr == nil {
+		return stdout.Close()
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return TimeoutError{
+			Path:    d.spec.Path,
+			Timeout: d.spec.Timeout,
+			Stderr:  readStderr(stderrFilename),
+		}
+	}
+	if exitErr, ok := runErr.(*exec.ExitError); ok {
+		exitCode := -1
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			exitCode = status.ExitStatus()
+		}
+		return ExitError{
+			Path:     d.spec.Path,
+			ExitCode: exitCode,
+			Stderr:   readStderr(stderrFilename),
+		}
+	}
+	return runErr
+}
+
+// readStderr returns the trimmed contents of the standard error file,
+// truncated to maxStderrLen bytes
+func readStderr(filename string) string {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+	s := strings.TrimSpace(string(b))
+	if len(s) > maxStderrLen {
+		s = strings.TrimSpace(s[:maxStderrLen]) + "..."
+	}
+	return s
+}
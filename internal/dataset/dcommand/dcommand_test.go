@@ -0,0 +1,206 @@
+package dcommand
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+)
+
+func TestOpenNextRead(t *testing.T) {
+	cases := []struct {
+		spec   Spec
+		fields []string
+		want   [][]string
+	}{
+		{spec: helperSpec("cat", testhelpers.FlowFilename()),
+			fields: []string{"group", "district", "height", "flow"},
+			want: [][]string{
+				{"a", "northcal", "120", "16.5"},
+				{"a", "midcal", "128", "19"},
+				{"a", "southcal", "18", "5"},
+				{"b", "northcal", "20", "19.25"},
+				{"b", "midcal", "28", "10"},
+				{"b", "southcal", "8", "7"},
+				{"c", "northcal", "320", "20.73"},
+				{"c", "midcal", "328", "82.4"},
+				{"c", "southcal", "38", "1"},
+			},
+		},
+		{spec: func() Spec {
+			s := helperSpec("cat", filepath.Join("fixtures", "flow.jsonl"))
+			s.Format = JSONL
+			s.FieldPaths = map[string]string{"district": "location.district"}
+			return s
+		}(),
+			fields: []string{"group", "district", "height", "flow"},
+			want: [][]string{
+				{"a", "northcal", "9.5", "10"},
+				{"b", "southcal", "87", "32.7"},
+				{"a", "southcal", "129", "60"},
+			},
+		},
+	}
+	for i, c := range cases {
+		ds := New(c.spec, c.fields)
+		for n := 0; n < 2; n++ {
+			got, err := readAll(ds)
+			if err != nil {
+				t.Fatalf("(%d) readAll: %s", i, err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(c.want) {
+				t.Errorf("(%d) got: %v, want: %v", i, got, c.want)
+			}
+		}
+		if err := ds.Release(); err != nil {
+			t.Errorf("(%d) Release: %s", i, err)
+		}
+	}
+}
+
+func TestOpen_errors(t *testing.T) {
+	cases := []struct {
+		spec    Spec
+		wantErr error
+	}{
+		{spec: helperSpec("fail", "3", "can't connect to warehouse"),
+			wantErr: ExitError{Path: os.Args[0], ExitCode: 3, Stderr: "can't connect to warehouse"},
+		},
+		{spec: helperSpec("fail", "1", ""),
+			wantErr: ExitError{Path: os.Args[0], ExitCode: 1},
+		},
+		{spec: func() Spec {
+			s := helperSpec("sleep", "10s")
+			s.Timeout = 100 * time.Millisecond
+			return s
+		}(),
+			wantErr: TimeoutError{
+				Path:    os.Args[0],
+				Timeout: 100 * time.Millisecond,
+				Stderr:  "sleeping",
+			},
+		},
+	}
+	for i, c := range cases {
+		ds := New(c.spec, []string{"group"})
+		_, err := ds.Open()
+		if err != c.wantErr {
+			t.Errorf("(%d) Open err: %v, want: %v", i, err, c.wantErr)
+		}
+		if err := ds.Release(); err != nil {
+			t.Errorf("(%d) Release: %s", i, err)
+		}
+	}
+}
+
+func TestOpen_missingCommand(t *testing.T) {
+	ds := New(Spec{Path: filepath.Join("fixtures", "nonexistent")}, []string{})
+	if _, err := ds.Open(); err == nil {
+		t.Error("Open: expected an error")
+	}
+}
+
+func TestRelease(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "dcommand_test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	spec := helperSpec("cat", testhelpers.FlowFilename())
+	spec.TmpDir = tmpDir
+	ds := New(spec, []string{"group", "district", "height", "flow"})
+	if _, err := readAll(ds); err != nil {
+		t.Fatalf("readAll: %s", err)
+	}
+	assertNumFiles(t, tmpDir, 1)
+	if err := ds.Release(); err != nil {
+		t.Errorf("Release: %s", err)
+	}
+	assertNumFiles(t, tmpDir, 0)
+	if _, err := ds.Open(); err != ddataset.ErrReleased {
+		t.Errorf("Open got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+	if err := ds.Release(); err != ddataset.ErrReleased {
+		t.Errorf("Release got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+}
+
+// TestHelperProcess isn't a real test, it is run as the command by the
+// other tests so that they don't depend on commands of the OS
+func TestHelperProcess(t *testing.T) {
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		return
+	}
+	args = args[1:]
+	switch args[0] {
+	case "cat":
+		b, err := ioutil.ReadFile(args[1])
+		if err != nil {
+			fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(b)
+	case "fail":
+		code, _ := strconv.Atoi(args[1])
+		fmt.Fprintln(os.Stderr, args[2])
+		os.Exit(code)
+	case "sleep":
+		d, _ := time.ParseDuration(args[1])
+		fmt.Fprintln(os.Stderr, "sleeping")
+		time.Sleep(d)
+	}
+	os.Exit(0)
+}
+
+/*************************
+ *   Helper functions
+ *************************/
+
+func helperSpec(args ...string) Spec {
+	return Spec{
+		Path:      os.Args[0],
+		Args:      append([]string{"-test.run=TestHelperProcess", "--"}, args...),
+		Format:    CSV,
+		HasHeader: true,
+		Separator: ',',
+	}
+}
+
+func readAll(ds ddataset.Dataset) ([][]string, error) {
+	conn, err := ds.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	got := [][]string{}
+	for conn.Next() {
+		r := conn.Read()
+		values := make([]string, len(ds.Fields()))
+		for i, f := range ds.Fields() {
+			values[i] = r[f].String()
+		}
+		got = append(got, values)
+	}
+	return got, conn.Err()
+}
+
+func assertNumFiles(t *testing.T, dir string, want int) {
+	t.Helper()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %s", err)
+	}
+	if len(files) != want {
+		t.Errorf("number of files in %s got: %d, want: %d", dir, len(files), want)
+	}
+}
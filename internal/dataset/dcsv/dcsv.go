@@ -0,0 +1,255 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+// Package dcsv handles access to one or more CSV files as a Dataset.
+// This behaves in the same way as ddataset/dcsv except that the files
+// may be compressed using gzip, bzip2, xz or zstd, in which case they
+// are decompressed as they are read.
+package dcsv
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/dlit"
+	"github.com/vlifesystems/rulehunter/internal/dataset"
+)
+
+// DCSV represents a CSV file Dataset
+type DCSV struct {
+	filenames  []string
+	fieldNames []string
+	hasHeader  bool
+	separator  rune
+	isReleased bool
+}
+
+// DCSVConn represents a connection to a DCSV Dataset
+type DCSVConn struct {
+	dataset       *DCSV
+	fileNum       int
+	file          io.ReadCloser
+	reader        *csv.Reader
+	header        []string
+	currentRecord ddataset.Record
+	err           error
+}
+
+// HeaderMismatchError indicates that the header of a file doesn't match
+// the header of the first file
+type HeaderMismatchError struct {
+	Filename      string
+	Header        []string
+	FirstFilename string
+	FirstHeader   []string
+}
+
+func (e HeaderMismatchError) Error() string {
+	return fmt.Sprintf(
+		"header of %s: %s, doesn't match header of %s: %s",
+		e.Filename,
+		strings.Join(e.Header, ","),
+		e.FirstFilename,
+		strings.Join(e.FirstHeader, ","),
+	)
+}
+
+// New creates a new DCSV Dataset
+func New(
+	filename string,
+	hasHeader bool,
+	separator rune,
+	fieldNames []string,
+) ddataset.Dataset {
+	return NewMulti([]string{filename}, hasHeader, separator, fieldNames)
+}
+
+// NewMulti creates a new DCSV Dataset that reads each of the files in
+// turn as if they were one file.  If hasHeader is true then each file
+// must have the same header as the first file.  If there is more than
+// one file, errors reading a file are prefixed by the file's name.
+func NewMulti(
+	filenames []string,
+	hasHeader bool,
+	separator rune,
+	fieldNames []string,
+) ddataset.Dataset {
+	return &DCSV{
+		filenames:  filenames,
+		fieldNames: fieldNames,
+		hasHeader:  hasHeader,
+		separator:  separator,
+		isReleased: false,
+	}
+}
+
+// ReadHeader returns the header of the CSV file, which may be compressed
+func ReadHeader(filename string, separator rune) ([]string, error) {
+	f, err := dataset.OpenFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comma = separator
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%s: missing header", filename)
+	}
+	return header, err
+}
+
+// Open creates a connection to the Dataset
+func (d *DCSV) Open() (ddataset.Conn, error) {
+	if d.isReleased {
+		return nil, ddataset.ErrReleased
+	}
+	c := &DCSVConn{
+		dataset:       d,
+		fileNum:       0,
+		currentRecord: make(ddataset.Record, len(d.fieldNames)),
+		err:           nil,
+	}
+	if err := c.openFile(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Fields returns the field names used by the Dataset
+func (d *DCSV) Fields() []string {
+	return d.fieldNames
+}
+
+// NumRecords returns the number of records in the Dataset.  If there is
+// a problem getting the number of records it returns -1.  NOTE: The returned
+// value can change if the underlying Dataset changes.
+func (d *DCSV) NumRecords() int64 {
+	return dataset.CountNumRecords(d)
+}
+
+// Release releases any resources associated with the Dataset d,
+// rendering it unusable in the future.
+func (d *DCSV) Release() error {
+	if !d.isReleased {
+		d.isReleased = true
+		return nil
+	}
+	return ddataset.ErrReleased
+}
+
+// Next returns whether there is a Record to be Read
+func (c *DCSVConn) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	if c.reader == nil {
+		c.err = ddataset.ErrConnClosed
+		return false
+	}
+	row, err := c.reader.Read()
+	for err == io.EOF {
+		if c.fileNum+1 >= len(c.dataset.filenames) {
+			return false
+		}
+		c.file.Close()
+		c.fileNum++
+		if err := c.openFile(); err != nil {
+			c.Close()
+			c.err = err
+			return false
+		}
+		row, err = c.reader.Read()
+	}
+	if err != nil {
+		c.Close()
+		c.err = c.fileError(err)
+		return false
+	}
+	if len(row) != len(c.dataset.fieldNames) {
+		c.Close()
+		c.err = c.fileError(ddataset.ErrWrongNumFields)
+		return false
+	}
+	for i, field := range row {
+		c.currentRecord[c.dataset.fieldNames[i]] = dlit.NewString(field)
+	}
+	return true
+}
+
+// Err returns any errors from the connection
+func (c *DCSVConn) Err() error {
+	return c.err
+}
+
+// Read returns the current Record
+func (c *DCSVConn) Read() ddataset.Record {
+	return c.currentRecord
+}
+
+// Close closes the connection
+func (c *DCSVConn) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	c.reader = nil
+	return err
+}
+
+// openFile opens the current file and checks its header
+func (c *DCSVConn) openFile() error {
+	filename := c.dataset.filenames[c.fileNum]
+	f, err := dataset.OpenFile(filename)
+	if err != nil {
+		return err
+	}
+	r := csv.NewReader(f)
+	r.Comma = c.dataset.separator
+	if c.dataset.hasHeader {
+		header, err := r.Read()
+		if err != nil {
+			f.Close()
+			return c.fileError(err)
+		}
+		if c.fileNum == 0 {
+			c.header = header
+		} else if !equalStrings(header, c.header) {
+			f.Close()
+			return HeaderMismatchError{
+				Filename:      filename,
+				Header:        header,
+				FirstFilename: c.dataset.filenames[0],
+				FirstHeader:   c.header,
+			}
+		}
+	}
+	c.file = f
+	c.reader = r
+	return nil
+}
+
+// fileError prefixes err with the name of the current file if there
+// is more than one file
+func (c *DCSVConn) fileError(err error) error {
+	if len(c.dataset.filenames) == 1 {
+		return err
+	}
+	return fmt.Errorf("%s: %s", c.dataset.filenames[c.fileNum], err)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, s := range a {
+		if s != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,234 @@
+package dcsv
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/vlifesystems/rulehunter/internal/dataset"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+)
+
+func TestOpenNextRead(t *testing.T) {
+	fields := testhelpers.FlowFields
+	want := [][]string{
+		{"a", "northcal", "120", "16.5"},
+		{"a", "midcal", "128", "19"},
+		{"a", "southcal", "18", "5"},
+	}
+	filenames := []string{
+		testhelpers.FlowFilename(),
+		filepath.Join("fixtures", "flow.csv.gz"),
+		filepath.Join("fixtures", "flow.csv.bz2"),
+		filepath.Join("fixtures", "flow.csv.xz"),
+		filepath.Join("fixtures", "flow_gzip.csv"),
+	}
+	if dataset.ZstdSupported {
+		filenames = append(filenames, filepath.Join("fixtures", "flow.csv.zst"))
+	}
+	for _, filename := range filenames {
+		ds := New(filename, true, ',', fields)
+		conn, err := ds.Open()
+		if err != nil {
+			t.Fatalf("(%s) Open: %s", filename, err)
+		}
+		got := [][]string{}
+		for conn.Next() {
+			record := conn.Read()
+			row := make([]string, len(fields))
+			for i, f := range fields {
+				row[i] = record[f].String()
+			}
+			got = append(got, row)
+		}
+		if err := conn.Err(); err != nil {
+			t.Fatalf("(%s) Err: %s", filename, err)
+		}
+		conn.Close()
+		if len(got) != 9 {
+			t.Fatalf("(%s) got %d records, want: 9", filename, len(got))
+		}
+		if !reflect.DeepEqual(got[:len(want)], want) {
+			t.Errorf("(%s) got: %v, want: %v", filename, got[:len(want)], want)
+		}
+		if n := ds.NumRecords(); n != 9 {
+			t.Errorf("(%s) NumRecords got: %d, want: 9", filename, n)
+		}
+	}
+}
+
+func TestNewMulti(t *testing.T) {
+	fields := []string{"group", "district", "height", "flow"}
+	filenames := []string{
+		filepath.Join("fixtures", "calls-2026-01-01.csv"),
+		filepath.Join("fixtures", "calls-2026-01-02.csv.gz"),
+	}
+	want := [][]string{
+		{"a", "northcal", "120", "16.5"},
+		{"b", "northcal", "87", "32.7"},
+		{"b", "midcal", "78", "53"},
+	}
+	ds := NewMulti(filenames, true, ',', fields)
+	conn, err := ds.Open()
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer conn.Close()
+	got := [][]string{}
+	for conn.Next() {
+		record := conn.Read()
+		row := make([]string, len(fields))
+		for i, f := range fields {
+			row[i] = record[f].String()
+		}
+		got = append(got, row)
+	}
+	if err := conn.Err(); err != nil {
+		t.Fatalf("Err: %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+	if n := ds.NumRecords(); n != 3 {
+		t.Errorf("NumRecords got: %d, want: 3", n)
+	}
+}
+
+func TestNewMulti_errors(t *testing.T) {
+	cases := []struct {
+		filenames []string
+		hasHeader bool
+		wantErr   error
+	}{
+		{filenames: []string{
+			filepath.Join("fixtures", "calls-2026-01-02.csv"),
+			filepath.Join("fixtures", "calls-2026-01-03.csv"),
+		},
+			hasHeader: true,
+			wantErr: HeaderMismatchError{
+				Filename:      filepath.Join("fixtures", "calls-2026-01-03.csv"),
+				Header:        []string{"group", "district", "height"},
+				FirstFilename: filepath.Join("fixtures", "calls-2026-01-02.csv"),
+				FirstHeader:   []string{"group", "district", "height", "flow"},
+			},
+		},
+		{filenames: []string{
+			filepath.Join("fixtures", "calls-2026-01-02.csv"),
+			filepath.Join("fixtures", "calls-2026-01-03.csv"),
+		},
+			hasHeader: false,
+			wantErr: fmt.Errorf(
+				"%s: %s",
+				filepath.Join("fixtures", "calls-2026-01-03.csv"),
+				ddataset.ErrWrongNumFields,
+			),
+		},
+	}
+	for i, c := range cases {
+		ds := NewMulti(
+			c.filenames,
+			c.hasHeader,
+			',',
+			[]string{"group", "district", "height", "flow"},
+		)
+		conn, err := ds.Open()
+		if err != nil {
+			t.Fatalf("(%d) Open: %s", i, err)
+		}
+		for conn.Next() {
+		}
+		if err := conn.Err(); err == nil || err.Error() != c.wantErr.Error() {
+			t.Errorf("(%d) Err got: %v, want: %s", i, err, c.wantErr)
+		}
+		conn.Close()
+	}
+}
+
+func TestOpen_errors(t *testing.T) {
+	ds := New(
+		filepath.Join("fixtures", "flow_invalid.csv.gz"),
+		true,
+		',',
+		[]string{"group", "district", "height", "flow"},
+	)
+	wantErr := errors.New("gzip: invalid header")
+	if _, err := ds.Open(); err == nil || err.Error() != wantErr.Error() {
+		t.Errorf("Open got: %v, want: %s", err, wantErr)
+	}
+}
+
+func TestNext_errors(t *testing.T) {
+	ds := New(
+		filepath.Join("fixtures", "flow_wrong_num_fields.csv"),
+		false,
+		',',
+		[]string{"group", "district", "height"},
+	)
+	conn, err := ds.Open()
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	if conn.Next() {
+		t.Errorf("Next got: true, want: false")
+	}
+	if err := conn.Err(); err != ddataset.ErrWrongNumFields {
+		t.Errorf("Err got: %v, want: %s", err, ddataset.ErrWrongNumFields)
+	}
+}
+
+func TestReadHeader(t *testing.T) {
+	filenames := []string{
+		testhelpers.FlowFilename(),
+		filepath.Join("fixtures", "flow.csv.gz"),
+	}
+	for _, filename := range filenames {
+		got, err := ReadHeader(filename, ',')
+		if err != nil {
+			t.Errorf("ReadHeader(%s): %s", filename, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, testhelpers.FlowFields) {
+			t.Errorf("ReadHeader(%s) got: %v, want: %v",
+				filename, got, testhelpers.FlowFields)
+		}
+	}
+}
+
+func TestReadHeader_errors(t *testing.T) {
+	cases := []struct {
+		filename string
+		wantErr  error
+	}{
+		{filename: filepath.Join("fixtures", "flow_invalid.csv.gz"),
+			wantErr: errors.New("gzip: invalid header"),
+		},
+		{filename: filepath.Join("fixtures", "empty.csv"),
+			wantErr: fmt.Errorf(
+				"%s: missing header",
+				filepath.Join("fixtures", "empty.csv"),
+			),
+		},
+	}
+	for i, c := range cases {
+		_, err := ReadHeader(c.filename, ',')
+		if err == nil || err.Error() != c.wantErr.Error() {
+			t.Errorf("(%d) ReadHeader got: %v, want: %s", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestRelease(t *testing.T) {
+	ds := New(testhelpers.FlowFilename(), true, ',', []string{"group"})
+	if err := ds.Release(); err != nil {
+		t.Errorf("Release: %s", err)
+	}
+	if _, err := ds.Open(); err != ddataset.ErrReleased {
+		t.Errorf("Open got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+	if err := ds.Release(); err != ddataset.ErrReleased {
+		t.Errorf("Release got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+// Package dderive adds derived fields to a Dataset.  Each derived field
+// is calculated from an expression over the fields of the underlying
+// Dataset and is added after those fields.
+package dderive
+
+import (
+	"fmt"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/vlifesystems/rulehunter/internal/dataset"
+)
+
+// Field is a derived field
+type Field struct {
+	Name string
+	Expr *dexpr.Expr
+}
+
+// DDerive represents a Dataset with derived fields
+type DDerive struct {
+	dataset    ddataset.Dataset
+	derived    []Field
+	fieldNames []string
+	isReleased bool
+}
+
+// DDeriveConn represents a connection to a DDerive Dataset
+type DDeriveConn struct {
+	dataset       *DDerive
+	conn          ddataset.Conn
+	currentRecord ddataset.Record
+	err           error
+}
+
+// FieldError indicates that a derived field couldn't be calculated
+type FieldError struct {
+	Name string
+	Err  error
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("derived field: %s: %s", e.Name, e.Err)
+}
+
+// New creates a new DDerive Dataset
+func New(d ddataset.Dataset, derived []Field) ddataset.Dataset {
+	fieldNames := append([]string{}, d.Fields()...)
+	for _, f := range derived {
+		fieldNames = append(fieldNames, f.Name)
+	}
+	return &DDerive{
+		dataset:    d,
+		derived:    derived,
+		fieldNames: fieldNames,
+		isReleased: false,
+	}
+}
+
+// Open creates a connection to the Dataset
+func (d *DDerive) Open() (ddataset.Conn, error) {
+	if d.isReleased {
+		return nil, ddataset.ErrReleased
+	}
+	conn, err := d.dataset.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &DDeriveConn{
+		dataset:       d,
+		conn:          conn,
+		currentRecord: make(ddataset.Record, len(d.fieldNames)),
+		err:           nil,
+	}, nil
+}
+
+// Fields returns the field names used by the Dataset
+func (d *DDerive) Fields() []string {
+	return d.fieldNames
+}
+
+// NumRecords returns the number of records in the Dataset.  If there is
+// a problem getting the number of records it returns -1.  NOTE: The returned
+// value can change if the underlying Dataset changes.
+func (d *DDerive) NumRecords() int64 {
+	return dataset.CountNumRecords(d)
+}
+
+// Release releases any resources associated with the Dataset d,
+// rendering it unusable in the future.
+func (d *DDerive) Release() error {
+	if !d.isReleased {
+		d.isReleased = true
+		return nil
+	}
+	return ddataset.ErrReleased
+}
+
+// Next returns whether there is a Record to be Read
+func (c *DDeriveConn) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	if !c.conn.Next() {
+		return false
+	}
+	record := c.conn.Read()
+	for field, l := range record {
+		c.currentRecord[field] = l
+	}
+	for _, f := range c.dataset.derived {
+		l := f.Expr.Eval(record)
+		if err := l.Err(); err != nil {
+			c.err = FieldError{Name: f.Name, Err: err}
+			return false
+		}
+		c.currentRecord[f.Name] = l
+	}
+	return true
+}
+
+// Err returns any errors from the connection
+func (c *DDeriveConn) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.conn.Err()
+}
+
+// Read returns the current Record
+func (c *DDeriveConn) Read() ddataset.Record {
+	return c.currentRecord
+}
+
+// Close closes the connection
+func (c *DDeriveConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,93 @@
+package dderive
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/ddataset/dcsv"
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+)
+
+func TestOpenNextRead(t *testing.T) {
+	ds := New(
+		testhelpers.NewFlowDataset(),
+		[]Field{
+			{Name: "heightM", Expr: dexpr.MustNew("height / 100", nil)},
+			{Name: "isHigh", Expr: dexpr.MustNew("height > 100", nil)},
+		},
+	)
+	wantFields := []string{
+		"group", "district", "height", "flow", "heightM", "isHigh",
+	}
+	if got := ds.Fields(); !reflect.DeepEqual(got, wantFields) {
+		t.Errorf("Fields got: %v, want: %v", got, wantFields)
+	}
+	want := [][]string{
+		{"a", "northcal", "120", "16.5", "1.2", "true"},
+		{"a", "midcal", "128", "19", "1.28", "true"},
+		{"a", "southcal", "18", "5", "0.18", "false"},
+	}
+	conn, err := ds.Open()
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer conn.Close()
+	got := [][]string{}
+	for conn.Next() {
+		record := conn.Read()
+		row := make([]string, len(wantFields))
+		for i, f := range wantFields {
+			row[i] = record[f].String()
+		}
+		got = append(got, row)
+	}
+	if err := conn.Err(); err != nil {
+		t.Fatalf("Err: %s", err)
+	}
+	if len(got) != 9 {
+		t.Fatalf("got %d records, want: 9", len(got))
+	}
+	if !reflect.DeepEqual(got[:len(want)], want) {
+		t.Errorf("got: %v, want: %v", got[:len(want)], want)
+	}
+	if n := ds.NumRecords(); n != 9 {
+		t.Errorf("NumRecords got: %d, want: 9", n)
+	}
+}
+
+func TestNext_error(t *testing.T) {
+	ds := New(
+		testhelpers.NewFlowDataset(),
+		[]Field{{Name: "bad", Expr: dexpr.MustNew("width * 2", nil)}},
+	)
+	conn, err := ds.Open()
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer conn.Close()
+	if conn.Next() {
+		t.Errorf("Next got: true, want: false")
+	}
+	wantErr := "derived field: bad: invalid expression: width * 2 (variable doesn't exist: width)"
+	if err := conn.Err(); err == nil || err.Error() != wantErr {
+		t.Errorf("Err got: %v, want: %s", err, wantErr)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	ds := New(
+		dcsv.New(testhelpers.FlowFilename(), true, ',', []string{"group"}),
+		[]Field{},
+	)
+	if err := ds.Release(); err != nil {
+		t.Errorf("Release: %s", err)
+	}
+	if _, err := ds.Open(); err != ddataset.ErrReleased {
+		t.Errorf("Open got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+	if err := ds.Release(); err != ddataset.ErrReleased {
+		t.Errorf("Release got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+// Package dfilter filters the records of a Dataset using an expression.
+// Only records for which the expression is true are returned.
+package dfilter
+
+import (
+	"fmt"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/vlifesystems/rulehunter/internal/dataset"
+)
+
+// DFilter represents a filtered Dataset
+type DFilter struct {
+	dataset    ddataset.Dataset
+	expr       *dexpr.Expr
+	isReleased bool
+}
+
+// DFilterConn represents a connection to a DFilter Dataset
+type DFilterConn struct {
+	dataset *DFilter
+	conn    ddataset.Conn
+	err     error
+}
+
+// New creates a new DFilter Dataset containing only the records of d
+// for which expr is true
+func New(d ddataset.Dataset, expr *dexpr.Expr) ddataset.Dataset {
+	return &DFilter{
+		dataset:    d,
+		expr:       expr,
+		isReleased: false,
+	}
+}
+
+// Open creates a connection to the Dataset
+func (d *DFilter) Open() (ddataset.Conn, error) {
+	if d.isReleased {
+		return nil, ddataset.ErrReleased
+	}
+	conn, err := d.dataset.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &DFilterConn{
+		dataset: d,
+		conn:    conn,
+		err:     nil,
+	}, nil
+}
+
+// Fields returns the field names used by the Dataset
+func (d *DFilter) Fields() []string {
+	return d.dataset.Fields()
+}
+
+// NumRecords returns the number of records in the Dataset.  If there is
+// a problem getting the number of records it returns -1.  NOTE: The returned
+// value can change if the underlying Dataset changes.
+func (d *DFilter) NumRecords() int64 {
+	return dataset.CountNumRecords(d)
+}
+
+// Release releases any resources associated with the Dataset d,
+// rendering it unusable in the future.
+func (d *DFilter) Release() error {
+	if !d.isReleased {
+		d.isReleased = true
+		return nil
+	}
+	return ddataset.ErrReleased
+}
+
+// Next returns whether there is a Record to be Read
+func (c *DFilterConn) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	for c.conn.Next() {
+		match, err := c.dataset.expr.EvalBool(c.conn.Read())
+		if err != nil {
+			c.err = fmt.Errorf("where: %s", err)
+			return false
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns any errors from the connection
+func (c *DFilterConn) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.conn.Err()
+}
+
+// Read returns the current Record
+func (c *DFilterConn) Read() ddataset.Record {
+	return c.conn.Read()
+}
+
+// Close closes the connection
+func (c *DFilterConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,99 @@
+package dfilter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+)
+
+func TestOpenNextRead(t *testing.T) {
+	cases := []struct {
+		expr string
+		want []string
+	}{
+		{expr: "group == \"b\"",
+			want: []string{"northcal", "midcal", "southcal"},
+		},
+		{expr: "height > 100 && district != \"midcal\"",
+			want: []string{"northcal", "northcal"},
+		},
+		{expr: "flow > 1000", want: []string{}},
+	}
+	for i, c := range cases {
+		ds := New(
+			testhelpers.NewFlowDataset(),
+			dexpr.MustNew(c.expr, nil),
+		)
+		if got := ds.Fields(); !reflect.DeepEqual(got, testhelpers.FlowFields) {
+			t.Errorf("(%d) Fields got: %v, want: %v", i, got, testhelpers.FlowFields)
+		}
+		conn, err := ds.Open()
+		if err != nil {
+			t.Fatalf("(%d) Open: %s", i, err)
+		}
+		got := []string{}
+		for conn.Next() {
+			got = append(got, conn.Read()["district"].String())
+		}
+		if err := conn.Err(); err != nil {
+			t.Errorf("(%d) Err: %s", i, err)
+		}
+		conn.Close()
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("(%d) got: %v, want: %v", i, got, c.want)
+		}
+		if n := ds.NumRecords(); n != int64(len(c.want)) {
+			t.Errorf("(%d) NumRecords got: %d, want: %d", i, n, len(c.want))
+		}
+	}
+}
+
+func TestNext_error(t *testing.T) {
+	cases := []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: "width > 2",
+			wantErr: "where: invalid expression: width > 2 (variable doesn't exist: width)",
+		},
+		{expr: "height + 2",
+			wantErr: "where: invalid expression: height + 2 (incompatible types)",
+		},
+	}
+	for i, c := range cases {
+		ds := New(
+			testhelpers.NewFlowDataset(),
+			dexpr.MustNew(c.expr, nil),
+		)
+		conn, err := ds.Open()
+		if err != nil {
+			t.Fatalf("(%d) Open: %s", i, err)
+		}
+		if conn.Next() {
+			t.Errorf("(%d) Next got: true, want: false", i)
+		}
+		if err := conn.Err(); err == nil || err.Error() != c.wantErr {
+			t.Errorf("(%d) Err got: %v, want: %s", i, err, c.wantErr)
+		}
+		conn.Close()
+	}
+}
+
+func TestRelease(t *testing.T) {
+	ds := New(
+		testhelpers.NewFlowDataset(),
+		dexpr.MustNew("true", nil),
+	)
+	if err := ds.Release(); err != nil {
+		t.Errorf("Release: %s", err)
+	}
+	if _, err := ds.Open(); err != ddataset.ErrReleased {
+		t.Errorf("Open got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+	if err := ds.Release(); err != ddataset.ErrReleased {
+		t.Errorf("Release got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+// Package dfixedwidth handles access to a fixed-width text file as a
+// Dataset.  Each line of the file is a record and each field is taken
+// from a column at a fixed position within the line.  Positions are
+// counted in characters rather than bytes.
+package dfixedwidth
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/dlit"
+	"github.com/vlifesystems/rulehunter/internal/dataset"
+)
+
+// Trim is how spaces are trimmed from the value of a column
+type Trim int
+
+const (
+	// TrimDefault uses the Dataset's trim for a column
+	TrimDefault Trim = iota
+	TrimBoth
+	TrimLeft
+	TrimRight
+	TrimNone
+)
+
+// Column is the position of a field within each line
+type Column struct {
+	// Start is the position of the first character of the column,
+	// where the first character of a line is 1
+	Start int
+	// Length is the number of characters in the column
+	Length int
+	Trim   Trim
+}
+
+// DFixedWidth represents a fixed-width text file Dataset
+type DFixedWidth struct {
+	filename   string
+	hasHeader  bool
+	trim       Trim
+	fieldNames []string
+	columns    map[string]Column
+	isReleased bool
+}
+
+// DFixedWidthConn represents a connection to a DFixedWidth Dataset
+type DFixedWidthConn struct {
+	dataset       *DFixedWidth
+	file          *os.File
+	reader        *bufio.Reader
+	lineNum       int
+	currentRecord ddataset.Record
+	err           error
+}
+
+// ShortLineError indicates that a line of the file ends before the
+// start of a field's column
+type ShortLineError struct {
+	LineNum int
+	Field   string
+}
+
+func (e ShortLineError) Error() string {
+	return fmt.Sprintf("line %d: too short for field: %s", e.LineNum, e.Field)
+}
+
+// InvalidTrimError indicates that a trim isn't recognized
+type InvalidTrimError string
+
+func (e InvalidTrimError) Error() string {
+	return "invalid trim: " + string(e)
+}
+
+// ParseTrim returns the Trim named by s, which is one of: both, left,
+// right or none.  An empty string is TrimDefault.
+func ParseTrim(s string) (Trim, error) {
+	switch s {
+	case "":
+		return TrimDefault, nil
+	case "both":
+		return TrimBoth, nil
+	case "left":
+		return TrimLeft, nil
+	case "right":
+		return TrimRight, nil
+	case "none":
+		return TrimNone, nil
+	}
+	return TrimDefault, InvalidTrimError(s)
+}
+
+// Check returns an error if the Column isn't valid
+func (c Column) Check() error {
+	if c.Start < 1 {
+		return fmt.Errorf("invalid start: %d", c.Start)
+	}
+	if c.Length < 1 {
+		return fmt.Errorf("invalid length: %d", c.Length)
+	}
+	return nil
+}
+
+// New creates a new DFixedWidth Dataset.  columns must contain a Column
+// for each field.  If hasHeader is true the first line of the file is
+// skipped.  trim is used for any column whose Trim is TrimDefault, if
+// trim is also TrimDefault then TrimBoth is used.
+func New(
+	filename string,
+	hasHeader bool,
+	trim Trim,
+	fieldNames []string,
+	columns map[string]Column,
+) ddataset.Dataset {
+	if trim == TrimDefault {
+		trim = TrimBoth
+	}
+	return &DFixedWidth{
+		filename:   filename,
+		hasHeader:  hasHeader,
+		trim:       trim,
+		fieldNames: fieldNames,
+		columns:    columns,
+		isReleased: false,
+	}
+}
+
+// Open creates a connection to the Dataset
+func (d *DFixedWidth) Open() (ddataset.Conn, error) {
+	if d.isReleased {
+		return nil, ddataset.ErrReleased
+	}
+	f, err := os.Open(d.filename)
+	if err != nil {
+		return nil, err
+	}
+	conn := &DFixedWidthConn{
+		dataset:       d,
+		file:          f,
+		reader:        bufio.NewReader(f),
+		lineNum:       0,
+		currentRecord: make(ddataset.Record, len(d.fieldNames)),
+		err:           nil,
+	}
+	if d.hasHeader {
+		if _, err := conn.readLine(); err != nil && err != io.EOF {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// Fields returns the field names used by the Dataset
+func (d *DFixedWidth) Fields() []string {
+	return d.fieldNames
+}
+
+// NumRecords returns the number of records in the Dataset.  If there is
+// a problem getting the number of records it returns -1.  NOTE: The returned
+// value can change if the underlying Dataset changes.
+func (d *DFixedWidth) NumRecords() int64 {
+	return dataset.CountNumRecords(d)
+}
+
+// Release releases any resources associated with the Dataset d,
+// rendering it unusable in the future.
+func (d *DFixedWidth) Release() error {
+	if !d.isReleased {
+		d.isReleased = true
+		return nil
+	}
+	return ddataset.ErrReleased
+}
+
+// Next returns whether there is a Record to be Read
+func (c *DFixedWidthConn) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	if c.reader == nil {
+		c.err = ddataset.ErrConnClosed
+		return false
+	}
+	for {
+		line, err := c.readLine()
+		if err == io.EOF {
+			return false
+		}
+		if err != nil {
+			c.Close()
+			c.err = err
+			return false
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if err := c.makeLineCurrentRecord([]rune(line)); err != nil {
+			c.Close()
+			c.err = err
+			return false
+		}
+		return true
+	}
+}
+
+// readLine returns the next line without its line ending.  ReadString
+// is used rather than a bufio.Scanner so that lines aren't limited in
+// length.  It returns io.EOF if there are no more lines.
+func (c *DFixedWidthConn) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	c.lineNum++
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Err returns any errors from the connection
+func (c *DFixedWidthConn) Err() error {
+	return c.err
+}
+
+// Read returns the current Record
+func (c *DFixedWidthConn) Read() ddataset.Record {
+	return c.currentRecord
+}
+
+// Close closes the connection
+func (c *DFixedWidthConn) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	c.reader = nil
+	return err
+}
+
+// makeLineCurrentRecord sets the current record from line.  A line
+// that ends part way through a column is treated as though it had
+// trailing spaces, but it must reach the start of every column.
+func (c *DFixedWidthConn) makeLineCurrentRecord(line []rune) error {
+	for _, field := range c.dataset.fieldNames {
+		col := c.dataset.columns[field]
+		start := col.Start - 1
+		end := start + col.Length
+		if start >= len(line) {
+			return ShortLineError{LineNum: c.lineNum, Field: field}
+		}
+		if end > len(line) {
+			end = len(line)
+		}
+		trim := col.Trim
+		if trim == TrimDefault {
+			trim = c.dataset.trim
+		}
+		c.currentRecord[field] = dlit.NewString(trimValue(string(line[start:end]), trim))
+	}
+	return nil
+}
+
+func trimValue(s string, trim Trim) string {
+	switch trim {
+	case TrimLeft:
+		return strings.TrimLeft(s, " \t")
+	case TrimRight:
+		return strings.TrimRight(s, " \t")
+	case TrimNone:
+		return s
+	}
+	return strings.Trim(s, " \t")
+}
@@ -0,0 +1,231 @@
+package dfixedwidth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lawrencewoodman/ddataset"
+)
+
+func TestOpenNextRead(t *testing.T) {
+	fields := []string{"group", "district", "height", "flow"}
+	cases := []struct {
+		hasHeader bool
+		trim      Trim
+		columns   map[string]Column
+		want      [][]string
+	}{
+		{hasHeader: true,
+			trim: TrimDefault,
+			columns: map[string]Column{
+				"group":    {Start: 1, Length: 6},
+				"district": {Start: 7, Length: 10},
+				"height":   {Start: 17, Length: 8},
+				"flow":     {Start: 25, Length: 6},
+			},
+			want: [][]string{
+				{"a", "northcal", "120", "16.5"},
+				{"a", "mídcal", "128", "19"},
+				{"b", "southcal", "18", "5"},
+			},
+		},
+		{hasHeader: false,
+			trim: TrimNone,
+			columns: map[string]Column{
+				"group":    {Start: 1, Length: 2, Trim: TrimRight},
+				"district": {Start: 7, Length: 10, Trim: TrimDefault},
+				"height":   {Start: 17, Length: 8, Trim: TrimLeft},
+				"flow":     {Start: 25, Length: 6, Trim: TrimBoth},
+			},
+			want: [][]string{
+				{"gr", "district  ", "height", "flow"},
+				{"a", "northcal  ", "120", "16.5"},
+				{"a", "mídcal    ", "128", "19"},
+				{"b", "southcal  ", "18", "5"},
+			},
+		},
+	}
+	for i, c := range cases {
+		ds := New(
+			filepath.Join("fixtures", "flow.txt"),
+			c.hasHeader,
+			c.trim,
+			fields,
+			c.columns,
+		)
+		conn, err := ds.Open()
+		if err != nil {
+			t.Fatalf("(%d) Open: %s", i, err)
+		}
+		got := [][]string{}
+		for conn.Next() {
+			r := conn.Read()
+			values := make([]string, len(fields))
+			for j, f := range fields {
+				values[j] = r[f].String()
+			}
+			got = append(got, values)
+		}
+		if err := conn.Err(); err != nil {
+			t.Errorf("(%d) Err: %s", i, err)
+		}
+		conn.Close()
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("(%d) got: %q, want: %q", i, got, c.want)
+		}
+		if n := ds.NumRecords(); n != int64(len(c.want)) {
+			t.Errorf("(%d) NumRecords got: %d, want: %d", i, n, len(c.want))
+		}
+	}
+}
+
+func TestParseTrim(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    Trim
+		wantErr error
+	}{
+		{in: "", want: TrimDefault},
+		{in: "both", want: TrimBoth},
+		{in: "left", want: TrimLeft},
+		{in: "right", want: TrimRight},
+		{in: "none", want: TrimNone},
+		{in: "middle", want: TrimDefault, wantErr: InvalidTrimError("middle")},
+	}
+	for i, c := range cases {
+		got, err := ParseTrim(c.in)
+		if err != c.wantErr {
+			t.Errorf("(%d) ParseTrim err: %v, want: %v", i, err, c.wantErr)
+		}
+		if got != c.want {
+			t.Errorf("(%d) ParseTrim got: %d, want: %d", i, got, c.want)
+		}
+	}
+}
+
+func TestColumnCheck(t *testing.T) {
+	cases := []struct {
+		column  Column
+		wantErr string
+	}{
+		{column: Column{Start: 1, Length: 1}},
+		{column: Column{Start: 0, Length: 1}, wantErr: "invalid start: 0"},
+		{column: Column{Start: 3, Length: 0}, wantErr: "invalid length: 0"},
+	}
+	for i, c := range cases {
+		err := c.column.Check()
+		if (err == nil && c.wantErr != "") ||
+			(err != nil && err.Error() != c.wantErr) {
+			t.Errorf("(%d) Check got: %v, want: %s", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestOpen_errors(t *testing.T) {
+	ds := New(filepath.Join("fixtures", "missing.txt"), false, TrimDefault,
+		[]string{"group"}, map[string]Column{"group": {Start: 1, Length: 1}})
+	if _, err := ds.Open(); err == nil {
+		t.Error("Open: expected an error")
+	}
+}
+
+func TestNext_longLine(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "dfixedwidth_test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	// Longer than the 64KB line limit of a bufio.Scanner
+	line := strings.Repeat(" ", 100000) + "a"
+	filename := filepath.Join(tmpDir, "long.txt")
+	if err := ioutil.WriteFile(filename, []byte(line+"\nb\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	ds := New(filename, false, TrimDefault, []string{"group"},
+		map[string]Column{"group": {Start: 1, Length: len(line)}})
+	conn, err := ds.Open()
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer conn.Close()
+	got := []string{}
+	for conn.Next() {
+		got = append(got, conn.Read()["group"].String())
+	}
+	if err := conn.Err(); err != nil {
+		t.Fatalf("Err: %s", err)
+	}
+	want := []string{"a", "b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestNext_shortLine(t *testing.T) {
+	ds := New(filepath.Join("fixtures", "flow_short.txt"), true, TrimDefault,
+		[]string{"group", "district", "height"},
+		map[string]Column{
+			"group":    {Start: 1, Length: 6},
+			"district": {Start: 7, Length: 10},
+			"height":   {Start: 17, Length: 8},
+		},
+	)
+	conn, err := ds.Open()
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer conn.Close()
+	numRecords := 0
+	for conn.Next() {
+		numRecords++
+	}
+	if numRecords != 1 {
+		t.Errorf("got %d records, want: 1", numRecords)
+	}
+	wantErr := ShortLineError{LineNum: 3, Field: "height"}
+	if err := conn.Err(); err != wantErr {
+		t.Errorf("Err got: %v, want: %s", err, wantErr)
+	}
+}
+
+func TestShortLineErrorError(t *testing.T) {
+	err := ShortLineError{LineNum: 3, Field: "height"}
+	want := "line 3: too short for field: height"
+	if got := err.Error(); got != want {
+		t.Errorf("Error got: %s, want: %s", got, want)
+	}
+}
+
+func TestNext_closed(t *testing.T) {
+	ds := New(filepath.Join("fixtures", "flow.txt"), false, TrimDefault,
+		[]string{"group"}, map[string]Column{"group": {Start: 1, Length: 1}})
+	conn, err := ds.Open()
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	conn.Close()
+	if conn.Next() {
+		t.Error("Next got: true, want: false")
+	}
+	if err := conn.Err(); err != ddataset.ErrConnClosed {
+		t.Errorf("Err got: %v, want: %s", err, ddataset.ErrConnClosed)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	ds := New(filepath.Join("fixtures", "flow.txt"), false, TrimDefault,
+		[]string{"group"}, map[string]Column{"group": {Start: 1, Length: 1}})
+	if err := ds.Release(); err != nil {
+		t.Errorf("Release: %s", err)
+	}
+	if _, err := ds.Open(); err != ddataset.ErrReleased {
+		t.Errorf("Open got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+	if err := ds.Release(); err != ddataset.ErrReleased {
+		t.Errorf("Release got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+}
@@ -0,0 +1,369 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+// Package djoin adds fields to a Dataset by looking them up in another
+// Dataset using key fields that are in both.  The lookup Dataset is read
+// into an index the first time the Dataset is opened.  If it has too many
+// records to hold in memory the values are spilled to a file on disk and
+// only the keys are kept in memory.
+package djoin
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/dlit"
+	"github.com/vlifesystems/rulehunter/internal/dataset"
+)
+
+// Kind is the kind of join
+type Kind int
+
+const (
+	// Left keeps records without a match, with the added fields empty
+	Left Kind = iota
+	// Inner skips records without a match
+	Inner
+)
+
+// Spec describes a join
+type Spec struct {
+	// The key fields, which must be in both Datasets
+	On []string
+	// The fields of the lookup Dataset to add
+	Fields []string
+	// A prefix to add to the names of the added fields
+	Prefix string
+	Kind   Kind
+	// The maximum number of lookup records to hold in memory before they
+	// are spilled to disk.  If < 1 they are always held in memory.
+	MaxInMemory int64
+	// The directory in which to create the spill file, if empty the
+	// default system temporary directory is used
+	TmpDir string
+}
+
+// DJoin represents a Dataset joined to a lookup Dataset
+type DJoin struct {
+	dataset    ddataset.Dataset
+	lookup     ddataset.Dataset
+	spec       Spec
+	fieldNames []string
+	index      *index
+	mu         sync.Mutex
+	isReleased bool
+}
+
+// DJoinConn represents a connection to a DJoin Dataset
+type DJoinConn struct {
+	dataset       *DJoin
+	conn          ddataset.Conn
+	currentRecord ddataset.Record
+	err           error
+}
+
+// index maps keys to the values of the fields added from the lookup
+// Dataset.  The values are either held in memory or in spillFile.
+type index struct {
+	values    map[string][]*dlit.Literal
+	spans     map[string]span
+	spillDir  string
+	spillFile *os.File
+}
+
+// span is the position of a record in the spill file
+type span struct {
+	offset int64
+	length int64
+}
+
+// New creates a new DJoin Dataset which adds the fields of lookup given
+// by spec to the records of d.  The lookup Dataset is released when the
+// DJoin Dataset is released.  If there is more than one record in lookup
+// with the same key the first is used.
+func New(d ddataset.Dataset, lookup ddataset.Dataset, spec Spec) ddataset.Dataset {
+	fieldNames := append([]string{}, d.Fields()...)
+	for _, f := range spec.Fields {
+		fieldNames = append(fieldNames, spec.Prefix+f)
+	}
+	return &DJoin{
+		dataset:    d,
+		lookup:     lookup,
+		spec:       spec,
+		fieldNames: fieldNames,
+		index:      nil,
+		isReleased: false,
+	}
+}
+
+// Open creates a connection to the Dataset
+func (d *DJoin) Open() (ddataset.Conn, error) {
+	if d.isReleased {
+		return nil, ddataset.ErrReleased
+	}
+	if err := d.buildIndex(); err != nil {
+		return nil, err
+	}
+	conn, err := d.dataset.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &DJoinConn{
+		dataset:       d,
+		conn:          conn,
+		currentRecord: make(ddataset.Record, len(d.fieldNames)),
+		err:           nil,
+	}, nil
+}
+
+// Fields returns the field names used by the Dataset
+func (d *DJoin) Fields() []string {
+	return d.fieldNames
+}
+
+// NumRecords returns the number of records in the Dataset.  If there is
+// a problem getting the number of records it returns -1.  NOTE: The returned
+// value can change if the underlying Dataset changes.
+func (d *DJoin) NumRecords() int64 {
+	return dataset.CountNumRecords(d)
+}
+
+// Release releases any resources associated with the Dataset d,
+// rendering it unusable in the future.  This removes any spill file and
+// releases the lookup Dataset.
+func (d *DJoin) Release() error {
+	if d.isReleased {
+		return ddataset.ErrReleased
+	}
+	d.isReleased = true
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.index != nil {
+		if err := d.index.close(); err != nil {
+			return err
+		}
+		d.index = nil
+	}
+	return d.lookup.Release()
+}
+
+func (d *DJoin) buildIndex() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.index != nil {
+		return nil
+	}
+	conn, err := d.lookup.Open()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	idx := &index{values: map[string][]*dlit.Literal{}}
+	numRecords := int64(0)
+	for conn.Next() {
+		record := conn.Read()
+		key := makeKey(record, d.spec.On)
+		if idx.has(key) {
+			continue
+		}
+		values := make([]*dlit.Literal, len(d.spec.Fields))
+		for i, f := range d.spec.Fields {
+			values[i] = record[f]
+		}
+		numRecords++
+		if idx.spillFile == nil &&
+			d.spec.MaxInMemory >= 1 &&
+			numRecords > d.spec.MaxInMemory {
+			if err := idx.spill(d.spec.TmpDir); err != nil {
+				idx.close()
+				return err
+			}
+		}
+		if err := idx.add(key, values); err != nil {
+			idx.close()
+			return err
+		}
+	}
+	if err := conn.Err(); err != nil {
+		idx.close()
+		return err
+	}
+	d.index = idx
+	return nil
+}
+
+// makeKey returns a key made from the values of fields in record
+func makeKey(record ddataset.Record, fields []string) string {
+	values := make([]string, len(fields))
+	for i, f := range fields {
+		if l, ok := record[f]; ok {
+			values[i] = l.String()
+		}
+	}
+	return strings.Join(values, "\x1f")
+}
+
+func (idx *index) has(key string) bool {
+	if idx.spillFile != nil {
+		_, ok := idx.spans[key]
+		return ok
+	}
+	_, ok := idx.values[key]
+	return ok
+}
+
+func (idx *index) add(key string, values []*dlit.Literal) error {
+	if idx.spillFile == nil {
+		idx.values[key] = values
+		return nil
+	}
+	s, err := idx.writeValues(values)
+	if err != nil {
+		return err
+	}
+	idx.spans[key] = s
+	return nil
+}
+
+// spill moves the values held in memory to a file in tmpDir
+func (idx *index) spill(tmpDir string) error {
+	dir, err := ioutil.TempDir(tmpDir, "djoin")
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(dir, "lookup.csv"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	idx.spillDir = dir
+	idx.spillFile = f
+	idx.spans = make(map[string]span, len(idx.values))
+	for key, values := range idx.values {
+		if err := idx.add(key, values); err != nil {
+			return err
+		}
+	}
+	idx.values = nil
+	return nil
+}
+
+// writeValues appends values to the end of the spill file
+func (idx *index) writeValues(values []*dlit.Literal) (span, error) {
+	offset, err := idx.spillFile.Seek(0, io.SeekEnd)
+	if err != nil {
+		return span{}, err
+	}
+	strValues := make([]string, len(values))
+	for i, l := range values {
+		if l != nil {
+			strValues[i] = l.String()
+		}
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(strValues); err != nil {
+		return span{}, err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return span{}, err
+	}
+	n, err := idx.spillFile.Write(buf.Bytes())
+	if err != nil {
+		return span{}, err
+	}
+	return span{offset: offset, length: int64(n)}, nil
+}
+
+// lookup returns the values for key and whether they were found
+func (idx *index) lookup(key string) ([]*dlit.Literal, bool, error) {
+	if idx.spillFile == nil {
+		values, ok := idx.values[key]
+		return values, ok, nil
+	}
+	s, ok := idx.spans[key]
+	if !ok {
+		return nil, false, nil
+	}
+	buf := make([]byte, s.length)
+	if _, err := idx.spillFile.ReadAt(buf, s.offset); err != nil {
+		return nil, false, err
+	}
+	r := csv.NewReader(bytes.NewReader(buf))
+	strValues, err := r.Read()
+	if err != nil {
+		return nil, false, err
+	}
+	values := make([]*dlit.Literal, len(strValues))
+	for i, v := range strValues {
+		values[i] = dlit.NewString(v)
+	}
+	return values, true, nil
+}
+
+func (idx *index) close() error {
+	if idx.spillFile == nil {
+		return nil
+	}
+	if err := idx.spillFile.Close(); err != nil {
+		return err
+	}
+	return os.RemoveAll(idx.spillDir)
+}
+
+// Next returns whether there is a Record to be Read
+func (c *DJoinConn) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	spec := c.dataset.spec
+	for c.conn.Next() {
+		record := c.conn.Read()
+		values, ok, err := c.dataset.index.lookup(makeKey(record, spec.On))
+		if err != nil {
+			c.err = err
+			return false
+		}
+		if !ok && spec.Kind == Inner {
+			continue
+		}
+		for field, l := range record {
+			c.currentRecord[field] = l
+		}
+		for i, f := range spec.Fields {
+			if ok && values[i] != nil {
+				c.currentRecord[spec.Prefix+f] = values[i]
+			} else {
+				c.currentRecord[spec.Prefix+f] = dlit.NewString("")
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Err returns any errors from the connection
+func (c *DJoinConn) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.conn.Err()
+}
+
+// Read returns the current Record
+func (c *DJoinConn) Read() ddataset.Record {
+	return c.currentRecord
+}
+
+// Close closes the connection
+func (c *DJoinConn) Close() error {
+	return c.conn.Close()
+}
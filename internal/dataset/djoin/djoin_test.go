@@ -0,0 +1,144 @@
+package djoin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/ddataset/dcsv"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+)
+
+var groupsFields = []string{"group", "district", "name", "rate"}
+
+func newGroups() ddataset.Dataset {
+	return dcsv.New(
+		filepath.Join("fixtures", "groups.csv"),
+		true,
+		',',
+		groupsFields,
+	)
+}
+
+func TestOpenNextRead(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "djoin_test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	cases := []struct {
+		spec       Spec
+		wantFields []string
+		field      string
+		want       []string
+	}{
+		{spec: Spec{On: []string{"group"}, Fields: []string{"name"}},
+			wantFields: []string{"group", "district", "height", "flow", "name"},
+			field:      "name",
+			want: []string{
+				"alpha north", "alpha north", "alpha north",
+				"beta north", "beta north", "beta north",
+				"gamma south", "gamma south", "gamma south",
+			},
+		},
+		{spec: Spec{
+			On:     []string{"group", "district"},
+			Fields: []string{"name", "rate"},
+			Prefix: "g_",
+		},
+			wantFields: []string{
+				"group", "district", "height", "flow", "g_name", "g_rate",
+			},
+			field: "g_rate",
+			want:  []string{"1.5", "2", "", "3", "", "", "", "", "5.5"},
+		},
+		{spec: Spec{
+			On:     []string{"group", "district"},
+			Fields: []string{"name"},
+			Kind:   Inner,
+		},
+			wantFields: []string{"group", "district", "height", "flow", "name"},
+			field:      "height",
+			want:       []string{"120", "128", "20", "38"},
+		},
+		{spec: Spec{
+			On:          []string{"group", "district"},
+			Fields:      []string{"name", "rate"},
+			MaxInMemory: 2,
+			TmpDir:      tmpDir,
+		},
+			wantFields: []string{
+				"group", "district", "height", "flow", "name", "rate",
+			},
+			field: "name",
+			want: []string{
+				"alpha north", "alpha mid", "", "beta north", "", "", "", "",
+				"gamma south",
+			},
+		},
+	}
+	for i, c := range cases {
+		ds := New(testhelpers.NewFlowDataset(), newGroups(), c.spec)
+		if got := ds.Fields(); !reflect.DeepEqual(got, c.wantFields) {
+			t.Errorf("(%d) Fields got: %v, want: %v", i, got, c.wantFields)
+		}
+		// Open twice to check that the index is reused
+		for j := 0; j < 2; j++ {
+			got := testhelpers.ReadField(t, ds, c.field)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("(%d) got: %v, want: %v", i, got, c.want)
+			}
+		}
+		if err := ds.Release(); err != nil {
+			t.Errorf("(%d) Release: %s", i, err)
+		}
+		if err := ds.Release(); err != ddataset.ErrReleased {
+			t.Errorf("(%d) Release got err: %v, want: %v",
+				i, err, ddataset.ErrReleased)
+		}
+		// The spill file must have been removed
+		files, err := ioutil.ReadDir(tmpDir)
+		if err != nil {
+			t.Fatalf("ReadDir: %s", err)
+		}
+		if len(files) != 0 {
+			t.Errorf("(%d) spill files left: %d", i, len(files))
+		}
+	}
+}
+
+func TestOpen_errors(t *testing.T) {
+	lookup := dcsv.New(
+		filepath.Join("fixtures", "nonexistant.csv"),
+		true,
+		',',
+		groupsFields,
+	)
+	ds := New(testhelpers.NewFlowDataset(), lookup, Spec{On: []string{"group"}})
+	if _, err := ds.Open(); err == nil {
+		t.Errorf("Open got err: nil, want: error")
+	}
+	ds.Release()
+	if _, err := ds.Open(); err != ddataset.ErrReleased {
+		t.Errorf("Open got err: %v, want: %v", err, ddataset.ErrReleased)
+	}
+}
+
+func TestNumRecords(t *testing.T) {
+	ds := New(
+		testhelpers.NewFlowDataset(),
+		newGroups(),
+		Spec{On: []string{"group", "district"}, Kind: Inner},
+	)
+	defer ds.Release()
+	if got := ds.NumRecords(); got != 4 {
+		t.Errorf("NumRecords got: %d, want: 4", got)
+	}
+}
+
+/*************************
+ *   Helper functions
+ *************************/
@@ -0,0 +1,216 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+// Package djsonl handles access to a JSON Lines file as a Dataset.
+// Each line of the file must contain a single JSON object and each
+// field is taken from a key of that object.  Nested keys can be
+// referred to using a dot separated path such as: "caller.region".
+// A missing key is treated in the same way as a null value.
+package djsonl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/dlit"
+	"github.com/vlifesystems/rulehunter/internal/dataset"
+)
+
+// DJSONL represents a JSON Lines file Dataset
+type DJSONL struct {
+	filename   string
+	fieldNames []string
+	fieldPaths map[string][]string
+	isReleased bool
+}
+
+// DJSONLConn represents a connection to a DJSONL Dataset
+type DJSONLConn struct {
+	dataset       *DJSONL
+	file          *os.File
+	reader        *bufio.Reader
+	lineNum       int
+	currentRecord ddataset.Record
+	err           error
+}
+
+// New creates a new DJSONL Dataset.  fieldPaths maps field names to
+// dot separated key paths, any field not in fieldPaths is taken from
+// the top level key of the same name.
+func New(
+	filename string,
+	fieldNames []string,
+	fieldPaths map[string]string,
+) ddataset.Dataset {
+	paths := make(map[string][]string, len(fieldNames))
+	for _, field := range fieldNames {
+		path, ok := fieldPaths[field]
+		if !ok || path == "" {
+			path = field
+		}
+		paths[field] = strings.Split(path, ".")
+	}
+	return &DJSONL{
+		filename:   filename,
+		fieldNames: fieldNames,
+		fieldPaths: paths,
+		isReleased: false,
+	}
+}
+
+// Open creates a connection to the Dataset
+func (d *DJSONL) Open() (ddataset.Conn, error) {
+	if d.isReleased {
+		return nil, ddataset.ErrReleased
+	}
+	f, err := os.Open(d.filename)
+	if err != nil {
+		return nil, err
+	}
+	return &DJSONLConn{
+		dataset:       d,
+		file:          f,
+		reader:        bufio.NewReader(f),
+		lineNum:       0,
+		currentRecord: make(ddataset.Record, len(d.fieldNames)),
+		err:           nil,
+	}, nil
+}
+
+// Fields returns the field names used by the Dataset
+func (d *DJSONL) Fields() []string {
+	return d.fieldNames
+}
+
+// NumRecords returns the number of records in the Dataset.  If there is
+// a problem getting the number of records it returns -1.  NOTE: The returned
+// value can change if the underlying Dataset changes.
+func (d *DJSONL) NumRecords() int64 {
+	return dataset.CountNumRecords(d)
+}
+
+// Release releases any resources associated with the Dataset d,
+// rendering it unusable in the future.
+func (d *DJSONL) Release() error {
+	if !d.isReleased {
+		d.isReleased = true
+		return nil
+	}
+	return ddataset.ErrReleased
+}
+
+// Next returns whether there is a Record to be Read
+func (c *DJSONLConn) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	if c.reader == nil {
+		c.err = ddataset.ErrConnClosed
+		return false
+	}
+	for {
+		// ReadBytes is used rather than a bufio.Scanner so that lines
+		// aren't limited in length
+		line, err := c.reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			c.Close()
+			c.err = err
+			return false
+		}
+		if len(line) == 0 && err == io.EOF {
+			return false
+		}
+		c.lineNum++
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if err := c.makeLineCurrentRecord(line); err != nil {
+			c.Close()
+			c.err = err
+			return false
+		}
+		return true
+	}
+}
+
+// Err returns any errors from the connection
+func (c *DJSONLConn) Err() error {
+	return c.err
+}
+
+// Read returns the current Record
+func (c *DJSONLConn) Read() ddataset.Record {
+	return c.currentRecord
+}
+
+// Close closes the connection
+func (c *DJSONLConn) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	c.reader = nil
+	return err
+}
+
+func (c *DJSONLConn) makeLineCurrentRecord(line []byte) error {
+	var obj map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return fmt.Errorf("line %d: %s", c.lineNum, err)
+	}
+	for _, field := range c.dataset.fieldNames {
+		path := c.dataset.fieldPaths[field]
+		l, err := valueToLiteral(lookupPath(obj, path))
+		if err != nil {
+			return fmt.Errorf("line %d: %s: %s", c.lineNum, field, err)
+		}
+		c.currentRecord[field] = l
+	}
+	return nil
+}
+
+// lookupPath returns the value at path in obj or nil if it is missing
+func lookupPath(obj map[string]interface{}, path []string) interface{} {
+	var v interface{} = obj
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+// valueToLiteral coerces a decoded JSON value into a Literal.  Numbers
+// are kept in their original textual form so that their precision is
+// preserved, null becomes an empty string and arrays or objects are
+// kept as JSON text.
+func valueToLiteral(v interface{}) (*dlit.Literal, error) {
+	switch x := v.(type) {
+	case nil:
+		return dlit.NewString(""), nil
+	case string:
+		return dlit.NewString(x), nil
+	case json.Number:
+		return dlit.NewString(x.String()), nil
+	case bool:
+		return dlit.New(x)
+	default:
+		b, err := json.Marshal(x)
+		if err != nil {
+			return nil, err
+		}
+		return dlit.NewString(string(b)), nil
+	}
+}
@@ -0,0 +1,179 @@
+package djsonl
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/dlit"
+)
+
+func TestOpenNextRead(t *testing.T) {
+	fields := []string{"group", "district", "height", "flow"}
+	ds := New(
+		filepath.Join("fixtures", "flow.jsonl"),
+		fields,
+		map[string]string{"district": "location.district"},
+	)
+	want := []ddataset.Record{
+		{"group": dlit.NewString("a"), "district": dlit.NewString("northcal"),
+			"height": dlit.NewString("9.5"), "flow": dlit.NewString("10")},
+		{"group": dlit.NewString("b"), "district": dlit.NewString("southcal"),
+			"height": dlit.NewString("87"), "flow": dlit.NewString("32.7")},
+		{"group": dlit.NewString("a"), "district": dlit.NewString("southcal"),
+			"height": dlit.NewString("129"), "flow": dlit.NewString("60")},
+	}
+	conn, err := ds.Open()
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer conn.Close()
+	got := []ddataset.Record{}
+	for conn.Next() {
+		got = append(got, conn.Read().Clone())
+	}
+	if err := conn.Err(); err != nil {
+		t.Fatalf("Err: %s", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d records, want: %d", len(got), len(want))
+	}
+	for i, r := range got {
+		for _, f := range fields {
+			if r[f].String() != want[i][f].String() {
+				t.Errorf("(%d) field: %s, got: %s, want: %s",
+					i, f, r[f], want[i][f])
+			}
+		}
+	}
+	if n := ds.NumRecords(); n != 3 {
+		t.Errorf("NumRecords got: %d, want: 3", n)
+	}
+}
+
+func TestNext_longLine(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "djsonl_test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	// Longer than the 64KB line limit of a bufio.Scanner
+	group := strings.Repeat("a", 100000)
+	filename := filepath.Join(tmpDir, "long.jsonl")
+	content := fmt.Sprintf("{\"group\": \"%s\"}\n{\"group\": \"b\"}", group)
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	ds := New(filename, []string{"group"}, nil)
+	conn, err := ds.Open()
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer conn.Close()
+	got := []string{}
+	for conn.Next() {
+		got = append(got, conn.Read()["group"].String())
+	}
+	if err := conn.Err(); err != nil {
+		t.Fatalf("Err: %s", err)
+	}
+	want := []string{group, "b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %d records, want: %d", len(got), len(want))
+	}
+}
+
+func TestNext_missingKey(t *testing.T) {
+	ds := New(
+		filepath.Join("fixtures", "flow_missing_key.jsonl"),
+		[]string{"group", "district"},
+		map[string]string{"district": "location.district"},
+	)
+	conn, err := ds.Open()
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer conn.Close()
+	got := []string{}
+	for conn.Next() {
+		got = append(got, conn.Read()["district"].String())
+	}
+	if err := conn.Err(); err != nil {
+		t.Fatalf("Err: %s", err)
+	}
+	// A missing key is read in the same way as null
+	want := []string{"northcal", "", ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestNext_errors(t *testing.T) {
+	cases := []struct {
+		filename string
+		wantErr  error
+	}{
+		{filename: "flow_invalid.jsonl",
+			wantErr: errors.New("line 2: unexpected EOF"),
+		},
+	}
+	for i, c := range cases {
+		ds := New(
+			filepath.Join("fixtures", c.filename),
+			[]string{"group", "district", "height", "flow"},
+			map[string]string{"district": "location.district"},
+		)
+		conn, err := ds.Open()
+		if err != nil {
+			t.Fatalf("(%d) Open: %s", i, err)
+		}
+		for conn.Next() {
+		}
+		if err := conn.Err(); err == nil || err.Error() != c.wantErr.Error() {
+			t.Errorf("(%d) Err got: %v, want: %s", i, err, c.wantErr)
+		}
+		conn.Close()
+	}
+}
+
+func TestValueToLiteral(t *testing.T) {
+	cases := []struct {
+		in   interface{}
+		want string
+	}{
+		{in: nil, want: ""},
+		{in: "hello", want: "hello"},
+		{in: true, want: "true"},
+		{in: []interface{}{"a", "b"}, want: `["a","b"]`},
+		{in: map[string]interface{}{"a": "b"}, want: `{"a":"b"}`},
+	}
+	for i, c := range cases {
+		got, err := valueToLiteral(c.in)
+		if err != nil {
+			t.Errorf("(%d) valueToLiteral: %s", i, err)
+			continue
+		}
+		if got.String() != c.want {
+			t.Errorf("(%d) valueToLiteral got: %s, want: %s", i, got, c.want)
+		}
+	}
+}
+
+func TestRelease(t *testing.T) {
+	ds := New(filepath.Join("fixtures", "flow.jsonl"), []string{"group"}, nil)
+	if err := ds.Release(); err != nil {
+		t.Errorf("Release: %s", err)
+	}
+	if _, err := ds.Open(); err != ddataset.ErrReleased {
+		t.Errorf("Open got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+	if err := ds.Release(); !reflect.DeepEqual(err, ddataset.ErrReleased) {
+		t.Errorf("Release got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+// Package dnull handles missing values in the fields of a Dataset.
+// A value is missing if it matches one of the null tokens of its field
+// and is then dealt with according to the Policy of that field.
+package dnull
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/dlit"
+	"github.com/vlifesystems/rulehunter/internal/dataset"
+)
+
+// Value is what a missing value is replaced with when using the
+// Category policy.  A field using the Category policy mustn't have
+// Value as a value that isn't missing, otherwise the two couldn't be
+// told apart.
+const Value = "null"
+
+// MarkField is the field added by NewMarked to record which fields of a
+// record had a missing value.  It can't be used in an expression so
+// won't clash with a field of the Dataset.
+const MarkField = "nulls()"
+
+// Policy describes what to do with a missing value
+type Policy int
+
+const (
+	// Skip removes records that have a missing value
+	Skip Policy = iota
+	// Default replaces a missing value with a default value
+	Default
+	// Category replaces a missing value with Value so that it is
+	// treated as a category of its own
+	Category
+)
+
+// Spec describes which values of a field are missing and what
+// should be done with them
+type Spec struct {
+	// Tokens are the values that indicate a missing value.  If empty
+	// then only an empty value is missing.  Note that SQL NULLs are
+	// read as empty values.
+	Tokens  []string
+	Policy  Policy
+	Default *dlit.Literal
+}
+
+// DNull represents a Dataset with missing values handled
+type DNull struct {
+	dataset    ddataset.Dataset
+	specs      map[string]Spec
+	markFields []string
+	isReleased bool
+}
+
+// DNullConn represents a connection to a DNull Dataset
+type DNullConn struct {
+	dataset       *DNull
+	conn          ddataset.Conn
+	currentRecord ddataset.Record
+	err           error
+}
+
+// UnknownFieldError indicates that a field doesn't exist in the Dataset
+type UnknownFieldError string
+
+func (e UnknownFieldError) Error() string {
+	return "unknown field: " + string(e)
+}
+
+// ValueClashError indicates that a field using the Category policy has
+// Value as a value that isn't missing
+type ValueClashError string
+
+func (e ValueClashError) Error() string {
+	return fmt.Sprintf(
+		"field: %s, has value: %s, which isn't missing, add it to the tokens or use another policy",
+		string(e), Value,
+	)
+}
+
+// New creates a new DNull Dataset which handles the missing values
+// of the fields of d described by specs
+func New(d ddataset.Dataset, specs map[string]Spec) ddataset.Dataset {
+	return &DNull{
+		dataset:    d,
+		specs:      specs,
+		markFields: nil,
+		isReleased: false,
+	}
+}
+
+// NewMarked creates a new DNull Dataset like New, which also adds
+// MarkField to each record to record which of the fields described by
+// specs had a missing value.  MarkField can be removed and the missing
+// values counted, after any further processing, by Unmark.
+func NewMarked(d ddataset.Dataset, specs map[string]Spec) ddataset.Dataset {
+	return &DNull{
+		dataset:    d,
+		specs:      specs,
+		markFields: sortedFields(specs),
+		isReleased: false,
+	}
+}
+
+// Open creates a connection to the Dataset
+func (d *DNull) Open() (ddataset.Conn, error) {
+	if d.isReleased {
+		return nil, ddataset.ErrReleased
+	}
+	if err := checkFields(d.dataset.Fields(), d.specs); err != nil {
+		return nil, err
+	}
+	if d.markFields != nil && hasField(d.dataset.Fields(), MarkField) {
+		return nil, fmt.Errorf("field already exists: %s", MarkField)
+	}
+	conn, err := d.dataset.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &DNullConn{
+		dataset:       d,
+		conn:          conn,
+		currentRecord: make(ddataset.Record, len(d.Fields())),
+		err:           nil,
+	}, nil
+}
+
+// Fields returns the field names used by the Dataset
+func (d *DNull) Fields() []string {
+	if d.markFields == nil {
+		return d.dataset.Fields()
+	}
+	return append(append([]string{}, d.dataset.Fields()...), MarkField)
+}
+
+// NumRecords returns the number of records in the Dataset.  If there is
+// a problem getting the number of records it returns -1.  NOTE: The returned
+// value can change if the underlying Dataset changes.
+func (d *DNull) NumRecords() int64 {
+	return dataset.CountNumRecords(d)
+}
+
+// Release releases any resources associated with the Dataset d,
+// rendering it unusable in the future.
+func (d *DNull) Release() error {
+	if !d.isReleased {
+		d.isReleased = true
+		return nil
+	}
+	return ddataset.ErrReleased
+}
+
+// Next returns whether there is a Record to be Read
+func (c *DNullConn) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	for c.conn.Next() {
+		if c.handleRecord(c.conn.Read()) {
+			return true
+		}
+		if c.err != nil {
+			return false
+		}
+	}
+	return false
+}
+
+// handleRecord copies record to the current record, replacing missing
+// values.  It returns false if the record should be skipped.
+func (c *DNullConn) handleRecord(record ddataset.Record) bool {
+	for field, l := range record {
+		spec, ok := c.dataset.specs[field]
+		if !ok || !spec.IsNull(l) {
+			if ok && spec.Policy == Category && l.String() == Value {
+				c.err = ValueClashError(field)
+				return false
+			}
+			c.currentRecord[field] = l
+			continue
+		}
+		switch spec.Policy {
+		case Skip:
+			return false
+		case Default:
+			c.currentRecord[field] = spec.Default
+		case Category:
+			c.currentRecord[field] = dlit.NewString(Value)
+		default:
+			panic(fmt.Sprintf("unsupported policy: %d", spec.Policy))
+		}
+	}
+	if c.dataset.markFields != nil {
+		c.currentRecord[MarkField] = dlit.NewString(c.mark(record))
+	}
+	return true
+}
+
+// mark returns the value of MarkField for record, which has a '1' for
+// each of the fields of the Dataset's specs, in name order, that has a
+// missing value and a '0' for each that hasn't
+func (c *DNullConn) mark(record ddataset.Record) string {
+	mark := make([]byte, len(c.dataset.markFields))
+	for i, field := range c.dataset.markFields {
+		if c.dataset.specs[field].IsNull(record[field]) {
+			mark[i] = '1'
+		} else {
+			mark[i] = '0'
+		}
+	}
+	return string(mark)
+}
+
+// Err returns any errors from the connection
+func (c *DNullConn) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.conn.Err()
+}
+
+// Read returns the current Record
+func (c *DNullConn) Read() ddataset.Record {
+	return c.currentRecord
+}
+
+// Close closes the connection
+func (c *DNullConn) Close() error {
+	return c.conn.Close()
+}
+
+// IsNull returns whether l is a missing value according to s
+func (s Spec) IsNull(l *dlit.Literal) bool {
+	v := l.String()
+	if len(s.Tokens) == 0 {
+		return v == ""
+	}
+	for _, t := range s.Tokens {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+func checkFields(fields []string, specs map[string]Spec) error {
+	for field := range specs {
+		if !hasField(fields, field) {
+			return UnknownFieldError(field)
+		}
+	}
+	return nil
+}
+
+func hasField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedFields(specs map[string]Spec) []string {
+	fields := make([]string, 0, len(specs))
+	for field := range specs {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
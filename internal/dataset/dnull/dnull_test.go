@@ -0,0 +1,184 @@
+package dnull
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/ddataset/dcsv"
+	"github.com/lawrencewoodman/dlit"
+)
+
+var flowFields = []string{"group", "district", "height"}
+
+func TestOpenNextRead(t *testing.T) {
+	cases := []struct {
+		specs map[string]Spec
+		field string
+		want  []string
+	}{
+		{specs: map[string]Spec{},
+			field: "district",
+			want: []string{
+				"northcal", "", "southcal", "northcal", "midcal",
+				"southcal", "northcal", "midcal", "",
+			},
+		},
+		{specs: map[string]Spec{"district": Spec{Policy: Skip}},
+			field: "height",
+			want:  []string{"120", "NA", "20", "28", "8", "320", "NA"},
+		},
+		{specs: map[string]Spec{
+			"height": Spec{
+				Tokens:  []string{"NA"},
+				Policy:  Default,
+				Default: dlit.MustNew(0),
+			},
+		},
+			field: "height",
+			want:  []string{"120", "128", "0", "20", "28", "8", "320", "0", "38"},
+		},
+		{specs: map[string]Spec{
+			"group":  Spec{Policy: Category},
+			"height": Spec{Tokens: []string{"NA"}, Policy: Skip},
+		},
+			field: "group",
+			want:  []string{"a", "a", "b", "null", "b", "c", "c"},
+		},
+	}
+	for i, c := range cases {
+		ds := New(newNullsFlow(), c.specs)
+		if got := ds.Fields(); !reflect.DeepEqual(got, flowFields) {
+			t.Errorf("(%d) Fields got: %v, want: %v", i, got, flowFields)
+		}
+		conn, err := ds.Open()
+		if err != nil {
+			t.Fatalf("(%d) Open: %s", i, err)
+		}
+		got := []string{}
+		for conn.Next() {
+			got = append(got, conn.Read()[c.field].String())
+		}
+		if err := conn.Err(); err != nil {
+			t.Errorf("(%d) Err: %s", i, err)
+		}
+		conn.Close()
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("(%d) got: %v, want: %v", i, got, c.want)
+		}
+		if n := ds.NumRecords(); n != int64(len(c.want)) {
+			t.Errorf("(%d) NumRecords got: %d, want: %d", i, n, len(c.want))
+		}
+	}
+}
+
+func TestNewMarked(t *testing.T) {
+	specs := map[string]Spec{
+		"group":    Spec{Policy: Category},
+		"district": Spec{Policy: Category},
+		"height":   Spec{Tokens: []string{"NA", ""}, Policy: Skip},
+	}
+	ds := NewMarked(newNullsFlow(), specs)
+	wantFields := append(append([]string{}, flowFields...), MarkField)
+	if got := ds.Fields(); !reflect.DeepEqual(got, wantFields) {
+		t.Errorf("Fields got: %v, want: %v", got, wantFields)
+	}
+	conn, err := ds.Open()
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer conn.Close()
+	got := []string{}
+	for conn.Next() {
+		got = append(got, conn.Read()[MarkField].String())
+	}
+	if err := conn.Err(); err != nil {
+		t.Errorf("Err: %s", err)
+	}
+	// The fields are marked in the order: district, group, height
+	want := []string{"000", "100", "000", "010", "000", "000", "100"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestNext_valueClash(t *testing.T) {
+	ds := New(
+		dcsv.New(filepath.Join("fixtures", "clash.csv"), true, ',', flowFields),
+		map[string]Spec{"district": Spec{Policy: Category}},
+	)
+	conn, err := ds.Open()
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer conn.Close()
+	numRecords := 0
+	for conn.Next() {
+		numRecords++
+	}
+	wantErr := ValueClashError("district")
+	if err := conn.Err(); err != wantErr {
+		t.Errorf("Err got: %v, want: %s", err, wantErr)
+	}
+	if numRecords != 1 {
+		t.Errorf("numRecords got: %d, want: 1", numRecords)
+	}
+}
+
+func TestOpen_errors(t *testing.T) {
+	ds := New(newNullsFlow(), map[string]Spec{"region": Spec{}})
+	wantErr := UnknownFieldError("region")
+	if _, err := ds.Open(); err != wantErr {
+		t.Errorf("Open got: %v, want: %s", err, wantErr)
+	}
+	ds = New(
+		dcsv.New(filepath.Join("fixtures", "missing.csv"), true, ',', flowFields),
+		map[string]Spec{},
+	)
+	if _, err := ds.Open(); err == nil {
+		t.Errorf("Open got: nil, want: error")
+	}
+}
+
+func TestRelease(t *testing.T) {
+	ds := New(newNullsFlow(), map[string]Spec{})
+	if err := ds.Release(); err != nil {
+		t.Errorf("Release: %s", err)
+	}
+	if _, err := ds.Open(); err != ddataset.ErrReleased {
+		t.Errorf("Open got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+	if err := ds.Release(); err != ddataset.ErrReleased {
+		t.Errorf("Release got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+}
+
+func TestValueClashErrorError(t *testing.T) {
+	err := ValueClashError("district")
+	want := "field: district, has value: null, which isn't missing, add it to the tokens or use another policy"
+	if got := err.Error(); got != want {
+		t.Errorf("Error() got: %s, want: %s", got, want)
+	}
+}
+
+func TestUnknownFieldErrorError(t *testing.T) {
+	err := UnknownFieldError("region")
+	want := "unknown field: region"
+	if got := err.Error(); got != want {
+		t.Errorf("Error() got: %s, want: %s", got, want)
+	}
+}
+
+/*************************
+ *  Helper functions
+ *************************/
+
+func newNullsFlow() ddataset.Dataset {
+	return dcsv.New(
+		filepath.Join("fixtures", "flow_nulls.csv"),
+		true,
+		',',
+		flowFields,
+	)
+}
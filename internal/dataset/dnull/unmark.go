@@ -0,0 +1,146 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package dnull
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/lawrencewoodman/ddataset"
+)
+
+// DUnmark represents a Dataset made by NewMarked, or a copy of one,
+// with MarkField removed
+type DUnmark struct {
+	dataset    ddataset.Dataset
+	markFields []string
+	fields     []string
+	isReleased bool
+}
+
+// DUnmarkConn represents a connection to a DUnmark Dataset
+type DUnmarkConn struct {
+	conn          ddataset.Conn
+	fields        []string
+	currentRecord ddataset.Record
+}
+
+// Unmark creates a new DUnmark Dataset from d, which has been made by
+// NewMarked with specs for nullFields, or derived from such a Dataset.
+// Releasing the DUnmark Dataset also releases d.
+func Unmark(d ddataset.Dataset, nullFields []string) *DUnmark {
+	markFields := append([]string{}, nullFields...)
+	sort.Strings(markFields)
+	fields := make([]string, 0, len(d.Fields()))
+	for _, f := range d.Fields() {
+		if f != MarkField {
+			fields = append(fields, f)
+		}
+	}
+	return &DUnmark{
+		dataset:    d,
+		markFields: markFields,
+		fields:     fields,
+		isReleased: false,
+	}
+}
+
+// Open creates a connection to the Dataset
+func (d *DUnmark) Open() (ddataset.Conn, error) {
+	if d.isReleased {
+		return nil, ddataset.ErrReleased
+	}
+	conn, err := d.dataset.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &DUnmarkConn{
+		conn:          conn,
+		fields:        d.fields,
+		currentRecord: make(ddataset.Record, len(d.fields)),
+	}, nil
+}
+
+// Fields returns the field names used by the Dataset
+func (d *DUnmark) Fields() []string {
+	return d.fields
+}
+
+// NumRecords returns the number of records in the Dataset.  If there is
+// a problem getting the number of records it returns -1.
+func (d *DUnmark) NumRecords() int64 {
+	return d.dataset.NumRecords()
+}
+
+// Release releases any resources associated with the Dataset d,
+// including the Dataset it was made from, rendering it unusable in
+// the future.
+func (d *DUnmark) Release() error {
+	if !d.isReleased {
+		d.isReleased = true
+		return d.dataset.Release()
+	}
+	return ddataset.ErrReleased
+}
+
+// CountNulls returns the number of missing values in each of the null
+// fields of the records in the Dataset, as marked by NewMarked.  Values
+// in records that were skipped, either because of a missing value or
+// by later processing, aren't counted.
+func (d *DUnmark) CountNulls() (map[string]int64, error) {
+	if d.isReleased {
+		return nil, ddataset.ErrReleased
+	}
+	if !hasField(d.dataset.Fields(), MarkField) {
+		return nil, UnknownFieldError(MarkField)
+	}
+	conn, err := d.dataset.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	counts := make(map[string]int64, len(d.markFields))
+	for _, field := range d.markFields {
+		counts[field] = 0
+	}
+	for conn.Next() {
+		mark := conn.Read()[MarkField].String()
+		if len(mark) != len(d.markFields) {
+			return nil, fmt.Errorf("invalid %s value: %s", MarkField, mark)
+		}
+		for i, field := range d.markFields {
+			if mark[i] == '1' {
+				counts[field]++
+			}
+		}
+	}
+	return counts, conn.Err()
+}
+
+// Next returns whether there is a Record to be Read
+func (c *DUnmarkConn) Next() bool {
+	if !c.conn.Next() {
+		return false
+	}
+	record := c.conn.Read()
+	for _, f := range c.fields {
+		c.currentRecord[f] = record[f]
+	}
+	return true
+}
+
+// Err returns any errors from the connection
+func (c *DUnmarkConn) Err() error {
+	return c.conn.Err()
+}
+
+// Read returns the current Record
+func (c *DUnmarkConn) Read() ddataset.Record {
+	return c.currentRecord
+}
+
+// Close closes the connection
+func (c *DUnmarkConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,88 @@
+package dnull
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lawrencewoodman/ddataset"
+)
+
+func TestUnmark(t *testing.T) {
+	specs := map[string]Spec{
+		"district": Spec{Policy: Category},
+		"height":   Spec{Tokens: []string{"NA"}, Policy: Skip},
+	}
+	ds := Unmark(NewMarked(newNullsFlow(), specs), []string{"height", "district"})
+	if got := ds.Fields(); !reflect.DeepEqual(got, flowFields) {
+		t.Errorf("Fields got: %v, want: %v", got, flowFields)
+	}
+	conn, err := ds.Open()
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer conn.Close()
+	got := []string{}
+	for conn.Next() {
+		record := conn.Read()
+		if _, ok := record[MarkField]; ok {
+			t.Errorf("record has field: %s", MarkField)
+		}
+		got = append(got, record["district"].String())
+	}
+	if err := conn.Err(); err != nil {
+		t.Errorf("Err: %s", err)
+	}
+	want := []string{
+		"northcal", "null", "northcal", "midcal", "southcal", "northcal", "null",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+	if n := ds.NumRecords(); n != int64(len(want)) {
+		t.Errorf("NumRecords got: %d, want: %d", n, len(want))
+	}
+}
+
+func TestCountNulls(t *testing.T) {
+	specs := map[string]Spec{
+		"group":    Spec{Policy: Category},
+		"district": Spec{Policy: Category},
+		"height":   Spec{Tokens: []string{"NA", ""}, Policy: Skip},
+	}
+	ds := Unmark(NewMarked(newNullsFlow(), specs), flowFields)
+	// The records with a missing height are skipped so aren't counted
+	want := map[string]int64{"group": 1, "district": 2, "height": 0}
+	got, err := ds.CountNulls()
+	if err != nil {
+		t.Fatalf("CountNulls: %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CountNulls got: %v, want: %v", got, want)
+	}
+}
+
+func TestCountNulls_errors(t *testing.T) {
+	ds := Unmark(newNullsFlow(), []string{"district"})
+	wantErr := UnknownFieldError(MarkField)
+	if _, err := ds.CountNulls(); err != wantErr {
+		t.Errorf("CountNulls got: %v, want: %s", err, wantErr)
+	}
+}
+
+func TestUnmarkRelease(t *testing.T) {
+	d := NewMarked(newNullsFlow(), map[string]Spec{})
+	ds := Unmark(d, []string{})
+	if err := ds.Release(); err != nil {
+		t.Errorf("Release: %s", err)
+	}
+	if _, err := ds.Open(); err != ddataset.ErrReleased {
+		t.Errorf("Open got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+	if _, err := d.Open(); err != ddataset.ErrReleased {
+		t.Errorf("Open of marked dataset got: %v, want: %s",
+			err, ddataset.ErrReleased)
+	}
+	if err := ds.Release(); err != ddataset.ErrReleased {
+		t.Errorf("Release got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+}
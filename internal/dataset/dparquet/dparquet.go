@@ -0,0 +1,502 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+// Package dparquet handles access to a Parquet file as a Dataset.
+// The file is read a row group at a time and the values of each column
+// are converted to Literals using the column's type, so that numbers
+// remain numbers.  Only flat schemas are supported, that is ones without
+// nested or repeated columns.  Each field name given refers to the
+// column in the same position in the file, in the same way as the
+// header of a CSV file is handled.
+package dparquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/dlit"
+	"github.com/vlifesystems/rulehunter/internal/dataset"
+)
+
+const magic = "PAR1"
+
+// Parquet compression codecs
+const (
+	codecUncompressed = 0
+	codecSnappy       = 1
+	codecGzip         = 2
+	codecZstd         = 6
+)
+
+// Parquet page types
+const (
+	pageData       = 0
+	pageDictionary = 2
+	pageDataV2     = 3
+)
+
+// Parquet encodings
+const (
+	encodingPlain           = 0
+	encodingPlainDictionary = 2
+	encodingRLEDictionary   = 8
+)
+
+// ErrNotParquet indicates that a file isn't a Parquet file
+var ErrNotParquet = errors.New("not a parquet file")
+
+// UnsupportedError indicates that a file uses a feature of Parquet
+// that isn't supported
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string {
+	return "unsupported parquet feature: " + string(e)
+}
+
+// DParquet represents a Parquet file Dataset
+type DParquet struct {
+	filename   string
+	fieldNames []string
+	isReleased bool
+}
+
+// DParquetConn represents a connection to a DParquet Dataset
+type DParquetConn struct {
+	dataset       *DParquet
+	file          *os.File
+	columns       []*column
+	rowGroups     []interface{}
+	rowGroupNum   int
+	values        [][]*dlit.Literal
+	rowNum        int
+	numRows       int
+	currentRecord ddataset.Record
+	err           error
+}
+
+// New creates a new DParquet Dataset
+func New(filename string, fieldNames []string) ddataset.Dataset {
+	return &DParquet{
+		filename:   filename,
+		fieldNames: fieldNames,
+		isReleased: false,
+	}
+}
+
+// Open creates a connection to the Dataset
+func (d *DParquet) Open() (ddataset.Conn, error) {
+	if d.isReleased {
+		return nil, ddataset.ErrReleased
+	}
+	f, err := os.Open(d.filename)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := readFileMetaData(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	columns, err := makeColumns(meta.list(2))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if len(columns) != len(d.fieldNames) {
+		f.Close()
+		return nil, ddataset.ErrWrongNumFields
+	}
+	return &DParquetConn{
+		dataset:       d,
+		file:          f,
+		columns:       columns,
+		rowGroups:     meta.list(4),
+		rowGroupNum:   0,
+		currentRecord: make(ddataset.Record, len(d.fieldNames)),
+		err:           nil,
+	}, nil
+}
+
+// Fields returns the field names used by the Dataset
+func (d *DParquet) Fields() []string {
+	return d.fieldNames
+}
+
+// NumRecords returns the number of records in the Dataset.  If there is
+// a problem getting the number of records it returns -1.  NOTE: The returned
+// value can change if the underlying Dataset changes.
+func (d *DParquet) NumRecords() int64 {
+	f, err := os.Open(d.filename)
+	if err != nil {
+		return -1
+	}
+	defer f.Close()
+	meta, err := readFileMetaData(f)
+	if err != nil {
+		return -1
+	}
+	return meta.int(3)
+}
+
+// Release releases any resources associated with the Dataset d,
+// rendering it unusable in the future.
+func (d *DParquet) Release() error {
+	if !d.isReleased {
+		d.isReleased = true
+		return nil
+	}
+	return ddataset.ErrReleased
+}
+
+// Next returns whether there is a Record to be Read
+func (c *DParquetConn) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	if c.file == nil {
+		c.err = ddataset.ErrConnClosed
+		return false
+	}
+	for c.rowNum >= c.numRows {
+		if c.rowGroupNum >= len(c.rowGroups) {
+			return false
+		}
+		if err := c.readRowGroup(); err != nil {
+			c.Close()
+			c.err = err
+			return false
+		}
+	}
+	for i, field := range c.dataset.fieldNames {
+		c.currentRecord[field] = c.values[i][c.rowNum]
+	}
+	c.rowNum++
+	return true
+}
+
+// Err returns any errors from the connection
+func (c *DParquetConn) Err() error {
+	return c.err
+}
+
+// Read returns the current Record
+func (c *DParquetConn) Read() ddataset.Record {
+	return c.currentRecord
+}
+
+// Close closes the connection
+func (c *DParquetConn) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	c.values = nil
+	return err
+}
+
+// readRowGroup reads the values for every column of the next row group
+func (c *DParquetConn) readRowGroup() error {
+	rg, ok := c.rowGroups[c.rowGroupNum].(tStructV)
+	if !ok {
+		return errors.New("invalid row group")
+	}
+	c.rowGroupNum++
+	numRows := int(rg.int(3))
+	if numRows < 0 {
+		return errors.New("invalid row group")
+	}
+	chunks := rg.list(1)
+	if len(chunks) != len(c.columns) {
+		return errors.New("row group has wrong number of columns")
+	}
+	values := make([][]*dlit.Literal, len(c.columns))
+	for i, col := range c.columns {
+		chunk, ok := chunks[i].(tStructV)
+		if !ok {
+			return errors.New("invalid column chunk")
+		}
+		if chunk.string(1) != "" {
+			return UnsupportedError("column chunk in external file")
+		}
+		v, err := readColumnChunk(c.file, col, chunk.structV(3), numRows)
+		if err != nil {
+			return fmt.Errorf("column: %s: %s", col.name, err)
+		}
+		if len(v) != numRows {
+			return fmt.Errorf("column: %s: has %d values, want: %d",
+				col.name, len(v), numRows)
+		}
+		values[i] = v
+	}
+	c.values = values
+	c.rowNum = 0
+	c.numRows = numRows
+	return nil
+}
+
+func readFileMetaData(f *os.File) (tStructV, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size < 12 {
+		return nil, ErrNotParquet
+	}
+	tail := make([]byte, 8)
+	if _, err := f.ReadAt(tail, size-8); err != nil {
+		return nil, err
+	}
+	if string(tail[4:]) != magic {
+		return nil, ErrNotParquet
+	}
+	metaLen := int64(binary.LittleEndian.Uint32(tail))
+	if metaLen > size-12 {
+		return nil, ErrNotParquet
+	}
+	buf := make([]byte, metaLen)
+	if _, err := f.ReadAt(buf, size-8-metaLen); err != nil {
+		return nil, err
+	}
+	meta, err := newThriftDecoder(buf).readStruct()
+	if err != nil {
+		return nil, fmt.Errorf("can't read file metadata: %s", err)
+	}
+	return meta, nil
+}
+
+// makeColumns makes the leaf columns from the schema elements
+func makeColumns(schema []interface{}) ([]*column, error) {
+	if len(schema) == 0 {
+		return nil, errors.New("missing schema")
+	}
+	columns := make([]*column, 0, len(schema)-1)
+	for _, e := range schema[1:] {
+		se, ok := e.(tStructV)
+		if !ok {
+			return nil, errors.New("invalid schema")
+		}
+		if se.int(5) > 0 {
+			return nil, UnsupportedError("nested column: " + se.string(4))
+		}
+		if se.int(3) == 2 {
+			return nil, UnsupportedError("repeated column: " + se.string(4))
+		}
+		columns = append(columns, newColumn(se))
+	}
+	return columns, nil
+}
+
+func readColumnChunk(
+	f *os.File,
+	col *column,
+	meta tStructV,
+	numRows int,
+) ([]*dlit.Literal, error) {
+	if meta == nil {
+		return nil, errors.New("missing column metadata")
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	start := meta.int(9)
+	if meta.has(11) && meta.int(11) > 0 && meta.int(11) < start {
+		start = meta.int(11)
+	}
+	size := meta.int(7)
+	if start < 0 || size < 0 || start > fi.Size() || size > fi.Size()-start {
+		return nil, errors.New("invalid column chunk position")
+	}
+	buf := make([]byte, size)
+	if _, err := f.ReadAt(buf, start); err != nil {
+		return nil, err
+	}
+	codec := meta.int(4)
+
+	var dictionary []*dlit.Literal
+	values := make([]*dlit.Literal, 0, numRows)
+	pos := 0
+	for len(values) < numRows && pos < len(buf) {
+		dec := newThriftDecoder(buf[pos:])
+		header, err := dec.readStruct()
+		if err != nil {
+			return nil, fmt.Errorf("can't read page header: %s", err)
+		}
+		pos += dec.pos
+		size := int(header.int(3))
+		if size < 0 || size > len(buf)-pos {
+			return nil, errors.New("page truncated")
+		}
+		page := buf[pos : pos+size]
+		pos += size
+
+		switch header.int(1) {
+		case pageDictionary:
+			dh := header.structV(7)
+			data, err := decompress(codec, page)
+			if err != nil {
+				return nil, err
+			}
+			dictionary, err = col.decodePlain(data, int(dh.int(1)))
+			if err != nil {
+				return nil, fmt.Errorf("dictionary page: %s", err)
+			}
+		case pageData:
+			dh := header.structV(5)
+			data, err := decompress(codec, page)
+			if err != nil {
+				return nil, err
+			}
+			pageValues, err := col.decodeDataPage(
+				data,
+				nil,
+				int(dh.int(1)),
+				dh.int(2),
+				dictionary,
+			)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, pageValues...)
+		case pageDataV2:
+			dh := header.structV(8)
+			repLen := int(dh.int(6))
+			defLen := int(dh.int(5))
+			if repLen < 0 || defLen < 0 || repLen+defLen > len(page) {
+				return nil, errors.New("page truncated")
+			}
+			if repLen > 0 {
+				return nil, UnsupportedError("repetition levels")
+			}
+			levels := page[:defLen]
+			data := page[defLen:]
+			if dh.bool(7, true) {
+				if data, err = decompress(codec, data); err != nil {
+					return nil, err
+				}
+			}
+			pageValues, err := col.decodeDataPage(
+				data,
+				levels,
+				int(dh.int(1)),
+				dh.int(4),
+				dictionary,
+			)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, pageValues...)
+		}
+	}
+	if len(values) != numRows {
+		return nil, errors.New("wrong number of values in column")
+	}
+	return values, nil
+}
+
+// decodeDataPage decodes the values of a data page.  If levels is nil
+// then the definition levels are taken from the start of data, as they
+// are for version 1 data pages.
+func (col *column) decodeDataPage(
+	data []byte,
+	levels []byte,
+	numValues int,
+	encoding int64,
+	dictionary []*dlit.Literal,
+) ([]*dlit.Literal, error) {
+	numNonNull := numValues
+	var defLevels []int
+	if col.optional {
+		if levels == nil {
+			if len(data) < 4 {
+				return nil, errValuesTruncated
+			}
+			n := int(binary.LittleEndian.Uint32(data))
+			if 4+n > len(data) {
+				return nil, errValuesTruncated
+			}
+			levels = data[4 : 4+n]
+			data = data[4+n:]
+		}
+		var err error
+		defLevels, err = decodeRLEHybrid(levels, 1, numValues)
+		if err != nil {
+			return nil, fmt.Errorf("definition levels: %s", err)
+		}
+		numNonNull = 0
+		for _, l := range defLevels {
+			numNonNull += l
+		}
+	}
+
+	var nonNull []*dlit.Literal
+	switch encoding {
+	case encodingPlain:
+		var err error
+		if nonNull, err = col.decodePlain(data, numNonNull); err != nil {
+			return nil, err
+		}
+	case encodingPlainDictionary, encodingRLEDictionary:
+		if dictionary == nil {
+			return nil, errors.New("missing dictionary page")
+		}
+		if len(data) < 1 {
+			return nil, errValuesTruncated
+		}
+		indices, err := decodeRLEHybrid(data[1:], int(data[0]), numNonNull)
+		if err != nil {
+			return nil, fmt.Errorf("dictionary indices: %s", err)
+		}
+		nonNull = make([]*dlit.Literal, numNonNull)
+		for i, index := range indices {
+			if index >= len(dictionary) {
+				return nil, errors.New("dictionary index out of range")
+			}
+			nonNull[i] = dictionary[index]
+		}
+	default:
+		return nil, UnsupportedError(fmt.Sprintf("encoding: %d", encoding))
+	}
+
+	if defLevels == nil {
+		return nonNull, nil
+	}
+	values := make([]*dlit.Literal, numValues)
+	j := 0
+	for i, l := range defLevels {
+		if l == 0 {
+			values[i] = dlit.NewString("")
+		} else {
+			values[i] = nonNull[j]
+			j++
+		}
+	}
+	return values, nil
+}
+
+func decompress(codec int64, data []byte) ([]byte, error) {
+	switch codec {
+	case codecUncompressed:
+		return data, nil
+	case codecSnappy:
+		return snappyDecode(data)
+	case codecGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	case codecZstd:
+		return dataset.DecodeZstd(data)
+	}
+	return nil, UnsupportedError(fmt.Sprintf("compression codec: %d", codec))
+}
@@ -0,0 +1,166 @@
+package dparquet
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/vlifesystems/rulehunter/internal/dataset"
+)
+
+var flowFields = []string{
+	"group", "district", "height", "id", "flow", "ok", "day",
+}
+
+var flowRecords = [][]string{
+	{"a", "northcal", "120", "1", "16.5", "true", "2018-01-02"},
+	{"a", "", "128", "2", "19", "false", "2018-01-03"},
+	{"b", "southcal", "18", "3", "5", "true", "2018-02-01"},
+	{"b", "northcal", "220", "4000000000", "20.73", "false", "2018-02-02"},
+	{"c", "midcal", "328", "5", "82.4", "true", "2018-03-03"},
+	{"c", "southcal", "38", "-6", "1", "false", "2018-03-04"},
+}
+
+func TestOpenNextRead(t *testing.T) {
+	filenames := []string{
+		"flow_snappy.parquet", "flow_gzip_v2.parquet", "flow_plain.parquet",
+	}
+	if dataset.ZstdSupported {
+		filenames = append(filenames, "flow_zstd.parquet")
+	}
+	for _, filename := range filenames {
+		ds := New(filepath.Join("fixtures", filename), flowFields)
+		conn, err := ds.Open()
+		if err != nil {
+			t.Fatalf("(%s) Open: %s", filename, err)
+		}
+		got := [][]string{}
+		for conn.Next() {
+			record := conn.Read()
+			row := make([]string, len(flowFields))
+			for i, f := range flowFields {
+				row[i] = record[f].String()
+			}
+			got = append(got, row)
+		}
+		if err := conn.Err(); err != nil {
+			t.Fatalf("(%s) Err: %s", filename, err)
+		}
+		conn.Close()
+		if !reflect.DeepEqual(got, flowRecords) {
+			t.Errorf("(%s) got: %v, want: %v", filename, got, flowRecords)
+		}
+		if n := ds.NumRecords(); n != 6 {
+			t.Errorf("(%s) NumRecords got: %d, want: 6", filename, n)
+		}
+	}
+}
+
+func TestOpen_errors(t *testing.T) {
+	cases := []struct {
+		filename string
+		fields   []string
+		wantErr  error
+	}{
+		{filename: "flow_plain.parquet",
+			fields:  []string{"group", "district"},
+			wantErr: ddataset.ErrWrongNumFields,
+		},
+		{filename: "flow.txt",
+			fields:  flowFields,
+			wantErr: ErrNotParquet,
+		},
+	}
+	for i, c := range cases {
+		ds := New(filepath.Join("fixtures", c.filename), c.fields)
+		if _, err := ds.Open(); err != c.wantErr {
+			t.Errorf("(%d) Open got: %v, want: %s", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestReadColumnChunk_errors(t *testing.T) {
+	f, err := os.Open(filepath.Join("fixtures", "flow_plain.parquet"))
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatalf("Stat: %s", err)
+	}
+	cases := []struct {
+		meta    tStructV
+		wantErr string
+	}{
+		{meta: nil, wantErr: "missing column metadata"},
+		{meta: tStructV{7: int64(-1), 9: int64(4)},
+			wantErr: "invalid column chunk position",
+		},
+		{meta: tStructV{7: int64(10), 9: int64(-4)},
+			wantErr: "invalid column chunk position",
+		},
+		{meta: tStructV{7: fi.Size(), 9: int64(4)},
+			wantErr: "invalid column chunk position",
+		},
+		{meta: tStructV{7: int64(1 << 62), 9: int64(4)},
+			wantErr: "invalid column chunk position",
+		},
+	}
+	col := &column{name: "group"}
+	for i, c := range cases {
+		_, err := readColumnChunk(f, col, c.meta, 6)
+		if err == nil || err.Error() != c.wantErr {
+			t.Errorf("(%d) readColumnChunk err: %v, want: %s", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestDecompress_unsupported(t *testing.T) {
+	wantErr := "unsupported parquet feature: compression codec: 3"
+	_, err := decompress(3, []byte{})
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("decompress err: %v, want: %s", err, wantErr)
+	}
+}
+
+func TestDecodeRLEHybrid(t *testing.T) {
+	cases := []struct {
+		data      []byte
+		bitWidth  int
+		numValues int
+		want      []int
+	}{
+		// Run of 5 values of 1
+		{data: []byte{0x0a, 0x01}, bitWidth: 1, numValues: 5,
+			want: []int{1, 1, 1, 1, 1}},
+		// Bit-packed group of 8 values: 0..7
+		{data: []byte{0x03, 0x88, 0xc6, 0xfa}, bitWidth: 3, numValues: 8,
+			want: []int{0, 1, 2, 3, 4, 5, 6, 7}},
+	}
+	for i, c := range cases {
+		got, err := decodeRLEHybrid(c.data, c.bitWidth, c.numValues)
+		if err != nil {
+			t.Errorf("(%d) decodeRLEHybrid: %s", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("(%d) decodeRLEHybrid got: %v, want: %v", i, got, c.want)
+		}
+	}
+}
+
+func TestRelease(t *testing.T) {
+	ds := New(filepath.Join("fixtures", "flow_plain.parquet"), flowFields)
+	if err := ds.Release(); err != nil {
+		t.Errorf("Release: %s", err)
+	}
+	if _, err := ds.Open(); err != ddataset.ErrReleased {
+		t.Errorf("Open got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+	if err := ds.Release(); err != ddataset.ErrReleased {
+		t.Errorf("Release got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+}
@@ -0,0 +1,329 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package dparquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lawrencewoodman/dlit"
+)
+
+// Parquet physical types
+const (
+	typeBoolean = iota
+	typeInt32
+	typeInt64
+	typeInt96
+	typeFloat
+	typeDouble
+	typeByteArray
+	typeFixedLenByteArray
+)
+
+// Parquet converted types used when making literals
+const (
+	convertedDecimal         = 5
+	convertedDate            = 6
+	convertedTimestampMillis = 9
+	convertedTimestampMicros = 10
+	convertedUint8           = 11
+	convertedUint16          = 12
+	convertedUint32          = 13
+	convertedUint64          = 14
+)
+
+// Parquet logical type union field ids used when making literals
+const (
+	logicalDecimal   = 5
+	logicalDate      = 6
+	logicalTimestamp = 8
+	logicalInteger   = 10
+)
+
+var errValuesTruncated = errors.New("values truncated")
+
+// column describes a leaf column of the parquet schema
+type column struct {
+	name          string
+	physicalType  int64
+	typeLength    int
+	optional      bool
+	convertedType int64
+	hasConverted  bool
+	logicalType   tStructV
+	scale         int
+}
+
+func newColumn(se tStructV) *column {
+	c := &column{
+		name:          se.string(4),
+		physicalType:  se.int(1),
+		typeLength:    int(se.int(2)),
+		optional:      se.int(3) == 1,
+		convertedType: se.int(6),
+		hasConverted:  se.has(6),
+		logicalType:   se.structV(10),
+		scale:         int(se.int(7)),
+	}
+	if d := c.logicalType.structV(logicalDecimal); d != nil {
+		c.scale = int(d.int(1))
+	}
+	return c
+}
+
+func (c *column) isDecimal() bool {
+	return c.logicalType.has(logicalDecimal) ||
+		(c.hasConverted && c.convertedType == convertedDecimal)
+}
+
+func (c *column) isDate() bool {
+	return c.logicalType.has(logicalDate) ||
+		(c.hasConverted && c.convertedType == convertedDate)
+}
+
+func (c *column) isUnsigned() bool {
+	if i := c.logicalType.structV(logicalInteger); i != nil {
+		return !i.bool(2, true)
+	}
+	return c.hasConverted &&
+		c.convertedType >= convertedUint8 &&
+		c.convertedType <= convertedUint64
+}
+
+// timestampUnit returns the duration of one unit of a timestamp column
+// or 0 if the column isn't a timestamp
+func (c *column) timestampUnit() time.Duration {
+	if ts := c.logicalType.structV(logicalTimestamp); ts != nil {
+		unit := ts.structV(2)
+		switch {
+		case unit.has(1):
+			return time.Millisecond
+		case unit.has(2):
+			return time.Microsecond
+		case unit.has(3):
+			return time.Nanosecond
+		}
+	}
+	if c.hasConverted {
+		switch c.convertedType {
+		case convertedTimestampMillis:
+			return time.Millisecond
+		case convertedTimestampMicros:
+			return time.Microsecond
+		}
+	}
+	return 0
+}
+
+// decodePlain decodes numValues PLAIN encoded values from data
+func (c *column) decodePlain(
+	data []byte,
+	numValues int,
+) ([]*dlit.Literal, error) {
+	values := make([]*dlit.Literal, numValues)
+	pos := 0
+	need := func(n int) error {
+		if pos+n > len(data) {
+			return errValuesTruncated
+		}
+		return nil
+	}
+	for i := range values {
+		switch c.physicalType {
+		case typeBoolean:
+			if i/8 >= len(data) {
+				return nil, errValuesTruncated
+			}
+			values[i] = dlit.MustNew(data[i/8]&(1<<uint(i%8)) != 0)
+		case typeInt32:
+			if err := need(4); err != nil {
+				return nil, err
+			}
+			values[i] = c.int32ToLiteral(int32(binary.LittleEndian.Uint32(data[pos:])))
+			pos += 4
+		case typeInt64:
+			if err := need(8); err != nil {
+				return nil, err
+			}
+			values[i] = c.int64ToLiteral(int64(binary.LittleEndian.Uint64(data[pos:])))
+			pos += 8
+		case typeInt96:
+			if err := need(12); err != nil {
+				return nil, err
+			}
+			values[i] = int96ToLiteral(data[pos : pos+12])
+			pos += 12
+		case typeFloat:
+			if err := need(4); err != nil {
+				return nil, err
+			}
+			f := math.Float32frombits(binary.LittleEndian.Uint32(data[pos:]))
+			values[i] = float32ToLiteral(f)
+			pos += 4
+		case typeDouble:
+			if err := need(8); err != nil {
+				return nil, err
+			}
+			f := math.Float64frombits(binary.LittleEndian.Uint64(data[pos:]))
+			values[i] = dlit.MustNew(f)
+			pos += 8
+		case typeByteArray:
+			if err := need(4); err != nil {
+				return nil, err
+			}
+			n := int(binary.LittleEndian.Uint32(data[pos:]))
+			pos += 4
+			if err := need(n); err != nil {
+				return nil, err
+			}
+			values[i] = c.bytesToLiteral(data[pos : pos+n])
+			pos += n
+		case typeFixedLenByteArray:
+			if err := need(c.typeLength); err != nil {
+				return nil, err
+			}
+			values[i] = c.bytesToLiteral(data[pos : pos+c.typeLength])
+			pos += c.typeLength
+		default:
+			return nil, fmt.Errorf("unknown physical type: %d", c.physicalType)
+		}
+	}
+	return values, nil
+}
+
+func (c *column) int32ToLiteral(v int32) *dlit.Literal {
+	switch {
+	case c.isDate():
+		return dlit.NewString(
+			time.Unix(int64(v)*24*60*60, 0).UTC().Format("2006-01-02"),
+		)
+	case c.isDecimal():
+		return decimalToLiteral(big.NewInt(int64(v)), c.scale)
+	case c.isUnsigned():
+		return dlit.MustNew(int64(uint32(v)))
+	}
+	return dlit.MustNew(int64(v))
+}
+
+func (c *column) int64ToLiteral(v int64) *dlit.Literal {
+	if unit := c.timestampUnit(); unit != 0 {
+		perSecond := int64(time.Second / unit)
+		t := time.Unix(v/perSecond, (v%perSecond)*int64(unit))
+		return dlit.NewString(t.UTC().Format(time.RFC3339Nano))
+	}
+	switch {
+	case c.isDecimal():
+		return decimalToLiteral(big.NewInt(v), c.scale)
+	case c.isUnsigned() && v < 0:
+		return dlit.NewString(strconv.FormatUint(uint64(v), 10))
+	}
+	return dlit.MustNew(v)
+}
+
+func (c *column) bytesToLiteral(b []byte) *dlit.Literal {
+	if c.isDecimal() {
+		// Big-endian two's complement
+		n := new(big.Int).SetBytes(b)
+		if len(b) > 0 && b[0]&0x80 != 0 {
+			n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+		}
+		return decimalToLiteral(n, c.scale)
+	}
+	return dlit.NewString(string(b))
+}
+
+func float32ToLiteral(f float32) *dlit.Literal {
+	// Use the shortest representation of the float32 so that, for example,
+	// 1.1 doesn't become 1.100000023841858
+	s := strconv.FormatFloat(float64(f), 'g', -1, 32)
+	f64, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return dlit.NewString(s)
+	}
+	return dlit.MustNew(f64)
+}
+
+// int96ToLiteral converts a legacy INT96 timestamp made up of
+// nanoseconds within the day followed by a julian day number
+func int96ToLiteral(b []byte) *dlit.Literal {
+	const julianUnixEpoch = 2440588
+	nanos := int64(binary.LittleEndian.Uint64(b))
+	days := int64(binary.LittleEndian.Uint32(b[8:])) - julianUnixEpoch
+	t := time.Unix(days*24*60*60, nanos).UTC()
+	return dlit.NewString(t.Format(time.RFC3339Nano))
+}
+
+func decimalToLiteral(n *big.Int, scale int) *dlit.Literal {
+	if scale <= 0 {
+		return dlit.NewString(n.String())
+	}
+	s := new(big.Int).Abs(n).String()
+	if len(s) <= scale {
+		s = strings.Repeat("0", scale-len(s)+1) + s
+	}
+	s = s[:len(s)-scale] + "." + s[len(s)-scale:]
+	if n.Sign() < 0 {
+		s = "-" + s
+	}
+	return dlit.NewString(s)
+}
+
+// decodeRLEHybrid decodes numValues values from the RLE/bit-packing
+// hybrid encoding used for definition levels and dictionary indices
+func decodeRLEHybrid(
+	data []byte,
+	bitWidth int,
+	numValues int,
+) ([]int, error) {
+	values := make([]int, 0, numValues)
+	byteWidth := (bitWidth + 7) / 8
+	pos := 0
+	for len(values) < numValues {
+		header, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return nil, errValuesTruncated
+		}
+		pos += n
+		if header&1 == 0 {
+			count := int(header >> 1)
+			if pos+byteWidth > len(data) {
+				return nil, errValuesTruncated
+			}
+			v := 0
+			for i := 0; i < byteWidth; i++ {
+				v |= int(data[pos+i]) << (8 * uint(i))
+			}
+			pos += byteWidth
+			for i := 0; i < count && len(values) < numValues; i++ {
+				values = append(values, v)
+			}
+		} else {
+			count := int(header>>1) * 8
+			numBytes := int(header>>1) * bitWidth
+			if pos+numBytes > len(data) {
+				return nil, errValuesTruncated
+			}
+			bits := data[pos : pos+numBytes]
+			for i := 0; i < count && len(values) < numValues; i++ {
+				v := 0
+				for b := 0; b < bitWidth; b++ {
+					bit := i*bitWidth + b
+					if bits[bit/8]&(1<<uint(bit%8)) != 0 {
+						v |= 1 << uint(b)
+					}
+				}
+				values = append(values, v)
+			}
+			pos += numBytes
+		}
+	}
+	return values, nil
+}
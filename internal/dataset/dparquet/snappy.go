@@ -0,0 +1,81 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package dparquet
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errSnappyCorrupt = errors.New("snappy: corrupt input")
+
+// snappyDecode decodes a raw snappy block as used by parquet pages
+func snappyDecode(src []byte) ([]byte, error) {
+	dLen, n := binary.Uvarint(src)
+	if n <= 0 || dLen > 0xffffffff {
+		return nil, errSnappyCorrupt
+	}
+	dst := make([]byte, 0, dLen)
+	s := n
+	for s < len(src) {
+		tag := src[s]
+		var length, offset int
+		switch tag & 0x03 {
+		case 0x00:
+			length = int(tag >> 2)
+			s++
+			if length >= 60 {
+				numBytes := length - 59
+				if s+numBytes > len(src) {
+					return nil, errSnappyCorrupt
+				}
+				length = 0
+				for i := 0; i < numBytes; i++ {
+					length |= int(src[s+i]) << (8 * uint(i))
+				}
+				s += numBytes
+			}
+			length++
+			if length <= 0 || s+length > len(src) {
+				return nil, errSnappyCorrupt
+			}
+			dst = append(dst, src[s:s+length]...)
+			s += length
+			continue
+		case 0x01:
+			if s+2 > len(src) {
+				return nil, errSnappyCorrupt
+			}
+			length = 4 + int(tag>>2)&0x07
+			offset = int(tag>>5)<<8 | int(src[s+1])
+			s += 2
+		case 0x02:
+			if s+3 > len(src) {
+				return nil, errSnappyCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[s+1:]))
+			s += 3
+		case 0x03:
+			if s+5 > len(src) {
+				return nil, errSnappyCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[s+1:]))
+			s += 5
+		}
+		if offset <= 0 || offset > len(dst) {
+			return nil, errSnappyCorrupt
+		}
+		// Copies may overlap so must be done a byte at a time
+		start := len(dst) - offset
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[start+i])
+		}
+	}
+	if uint64(len(dst)) != dLen {
+		return nil, errSnappyCorrupt
+	}
+	return dst, nil
+}
@@ -0,0 +1,230 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package dparquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Thrift compact protocol types
+const (
+	tStop         = 0
+	tBooleanTrue  = 1
+	tBooleanFalse = 2
+	tByte         = 3
+	tI16          = 4
+	tI32          = 5
+	tI64          = 6
+	tDouble       = 7
+	tBinary       = 8
+	tList         = 9
+	tSet          = 10
+	tMap          = 11
+	tStruct       = 12
+)
+
+var errThriftTruncated = errors.New("thrift: truncated data")
+
+// tStructV is a decoded thrift struct keyed by field id.  Integer fields
+// are held as int64, binary fields as []byte, lists and sets as
+// []interface{} and maps as map[interface{}]interface{}
+type tStructV map[int16]interface{}
+
+// thriftDecoder decodes data using the thrift compact protocol.  This
+// is only as complete as is needed to read parquet metadata.
+type thriftDecoder struct {
+	buf []byte
+	pos int
+}
+
+func newThriftDecoder(buf []byte) *thriftDecoder {
+	return &thriftDecoder{buf: buf}
+}
+
+func (d *thriftDecoder) readStruct() (tStructV, error) {
+	s := tStructV{}
+	lastID := int16(0)
+	for {
+		b, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		kind := b & 0x0f
+		if kind == tStop {
+			return s, nil
+		}
+		id := lastID + int16(b>>4)
+		if b>>4 == 0 {
+			v, err := d.readVarint()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(zigzag(v))
+		}
+		lastID = id
+		var value interface{}
+		switch kind {
+		case tBooleanTrue:
+			value = true
+		case tBooleanFalse:
+			value = false
+		default:
+			if value, err = d.readValue(kind); err != nil {
+				return nil, err
+			}
+		}
+		s[id] = value
+	}
+}
+
+func (d *thriftDecoder) readValue(kind byte) (interface{}, error) {
+	switch kind {
+	case tBooleanTrue, tBooleanFalse:
+		// Booleans within containers are encoded as a single byte
+		b, err := d.readByte()
+		return b == 1, err
+	case tByte:
+		b, err := d.readByte()
+		return int64(int8(b)), err
+	case tI16, tI32, tI64:
+		v, err := d.readVarint()
+		return zigzag(v), err
+	case tDouble:
+		if d.pos+8 > len(d.buf) {
+			return nil, errThriftTruncated
+		}
+		v := binary.LittleEndian.Uint64(d.buf[d.pos:])
+		d.pos += 8
+		return math.Float64frombits(v), nil
+	case tBinary:
+		n, err := d.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(d.buf)-d.pos) {
+			return nil, errThriftTruncated
+		}
+		b := d.buf[d.pos : d.pos+int(n)]
+		d.pos += int(n)
+		return b, nil
+	case tList, tSet:
+		return d.readList()
+	case tMap:
+		return d.readMap()
+	case tStruct:
+		return d.readStruct()
+	}
+	return nil, fmt.Errorf("thrift: unknown type: %d", kind)
+}
+
+func (d *thriftDecoder) readList() ([]interface{}, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	size := uint64(b >> 4)
+	kind := b & 0x0f
+	if size == 15 {
+		if size, err = d.readVarint(); err != nil {
+			return nil, err
+		}
+	}
+	if size > uint64(len(d.buf)-d.pos) {
+		return nil, errThriftTruncated
+	}
+	l := make([]interface{}, size)
+	for i := range l {
+		if l[i], err = d.readValue(kind); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (d *thriftDecoder) readMap() (map[interface{}]interface{}, error) {
+	size, err := d.readVarint()
+	if err != nil {
+		return nil, err
+	}
+	m := map[interface{}]interface{}{}
+	if size == 0 {
+		return m, nil
+	}
+	kinds, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < size; i++ {
+		k, err := d.readValue(kinds >> 4)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.readValue(kinds & 0x0f)
+		if err != nil {
+			return nil, err
+		}
+		if kb, ok := k.([]byte); ok {
+			k = string(kb)
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+func (d *thriftDecoder) readByte() (byte, error) {
+	if d.pos >= len(d.buf) {
+		return 0, errThriftTruncated
+	}
+	b := d.buf[d.pos]
+	d.pos++
+	return b, nil
+}
+
+func (d *thriftDecoder) readVarint() (uint64, error) {
+	v, n := binary.Uvarint(d.buf[d.pos:])
+	if n <= 0 {
+		return 0, errThriftTruncated
+	}
+	d.pos += n
+	return v, nil
+}
+
+func zigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (s tStructV) int(id int16) int64 {
+	v, _ := s[id].(int64)
+	return v
+}
+
+func (s tStructV) has(id int16) bool {
+	_, ok := s[id]
+	return ok
+}
+
+func (s tStructV) bool(id int16, def bool) bool {
+	if v, ok := s[id].(bool); ok {
+		return v
+	}
+	return def
+}
+
+func (s tStructV) string(id int16) string {
+	v, _ := s[id].([]byte)
+	return string(v)
+}
+
+func (s tStructV) structV(id int16) tStructV {
+	v, _ := s[id].(tStructV)
+	return v
+}
+
+func (s tStructV) list(id int16) []interface{} {
+	v, _ := s[id].([]interface{})
+	return v
+}
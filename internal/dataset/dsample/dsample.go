@@ -0,0 +1,261 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+// Package dsample takes a random sample of the records of a Dataset.
+// The sample is chosen using a fixed seed so that the same records are
+// chosen each time the Dataset is opened and the records are returned
+// in the same order as in the underlying Dataset.
+package dsample
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/vlifesystems/rulehunter/internal/dataset"
+)
+
+// DSample represents a sampled Dataset
+type DSample struct {
+	dataset    ddataset.Dataset
+	numRecords int64
+	field      string
+	seed       int64
+	isReleased bool
+}
+
+// DSampleConn represents a connection to a DSample Dataset
+type DSampleConn struct {
+	dataset   *DSample
+	conn      ddataset.Conn
+	selected  []int64
+	recordNum int64
+	err       error
+}
+
+// UnknownFieldError indicates that the field to stratify by isn't in
+// the Dataset
+type UnknownFieldError string
+
+func (e UnknownFieldError) Error() string {
+	return "unknown field: " + string(e)
+}
+
+// NewReservoir creates a new DSample Dataset containing a simple random
+// sample of numRecords records from d
+func NewReservoir(d ddataset.Dataset, numRecords int64, seed int64) ddataset.Dataset {
+	return NewStratified(d, "", numRecords, seed)
+}
+
+// NewStratified creates a new DSample Dataset containing a random sample
+// of numRecords records from d.  The records are grouped by the value of
+// field and each group is sampled in proportion to its size.  If field is
+// empty this is the same as NewReservoir.
+func NewStratified(
+	d ddataset.Dataset,
+	field string,
+	numRecords int64,
+	seed int64,
+) ddataset.Dataset {
+	return &DSample{
+		dataset:    d,
+		numRecords: numRecords,
+		field:      field,
+		seed:       seed,
+		isReleased: false,
+	}
+}
+
+// Open creates a connection to the Dataset
+func (d *DSample) Open() (ddataset.Conn, error) {
+	if d.isReleased {
+		return nil, ddataset.ErrReleased
+	}
+	selected, err := d.selectRecords()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := d.dataset.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &DSampleConn{
+		dataset:   d,
+		conn:      conn,
+		selected:  selected,
+		recordNum: -1,
+		err:       nil,
+	}, nil
+}
+
+// Fields returns the field names used by the Dataset
+func (d *DSample) Fields() []string {
+	return d.dataset.Fields()
+}
+
+// NumRecords returns the number of records in the Dataset.  If there is
+// a problem getting the number of records it returns -1.  NOTE: The returned
+// value can change if the underlying Dataset changes.
+func (d *DSample) NumRecords() int64 {
+	return dataset.CountNumRecords(d)
+}
+
+// Release releases any resources associated with the Dataset d,
+// rendering it unusable in the future.
+func (d *DSample) Release() error {
+	if !d.isReleased {
+		d.isReleased = true
+		return nil
+	}
+	return ddataset.ErrReleased
+}
+
+// Next returns whether there is a Record to be Read
+func (c *DSampleConn) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	for len(c.selected) > 0 && c.conn.Next() {
+		c.recordNum++
+		if c.recordNum == c.selected[0] {
+			c.selected = c.selected[1:]
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns any errors from the connection
+func (c *DSampleConn) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.conn.Err()
+}
+
+// Read returns the current Record
+func (c *DSampleConn) Read() ddataset.Record {
+	return c.conn.Read()
+}
+
+// Close closes the connection
+func (c *DSampleConn) Close() error {
+	return c.conn.Close()
+}
+
+// stratum is a group of records with the same value for the field
+// being stratified by
+type stratum struct {
+	count     int64
+	quota     int64
+	remainder int64
+	reservoir *reservoir
+}
+
+// selectRecords returns the sorted numbers of the records to include
+// in the sample
+func (d *DSample) selectRecords() ([]int64, error) {
+	rnd := rand.New(rand.NewSource(d.seed))
+	if d.field == "" {
+		r := newReservoir(d.numRecords, rnd)
+		err := d.eachRecord(func(recordNum int64, record ddataset.Record) {
+			r.add(recordNum)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return r.sorted(), nil
+	}
+
+	if !hasField(d.dataset.Fields(), d.field) {
+		return nil, UnknownFieldError(d.field)
+	}
+	strata := map[string]*stratum{}
+	order := []string{}
+	total := int64(0)
+	err := d.eachRecord(func(recordNum int64, record ddataset.Record) {
+		v := record[d.field].String()
+		s, ok := strata[v]
+		if !ok {
+			s = &stratum{}
+			strata[v] = s
+			order = append(order, v)
+		}
+		s.count++
+		total++
+	})
+	if err != nil {
+		return nil, err
+	}
+	allocateQuotas(strata, order, total, d.numRecords)
+	for _, v := range order {
+		strata[v].reservoir = newReservoir(strata[v].quota, rnd)
+	}
+	err = d.eachRecord(func(recordNum int64, record ddataset.Record) {
+		strata[record[d.field].String()].reservoir.add(recordNum)
+	})
+	if err != nil {
+		return nil, err
+	}
+	selected := []int64{}
+	for _, v := range order {
+		selected = append(selected, strata[v].reservoir.sorted()...)
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i] < selected[j]
+	})
+	return selected, nil
+}
+
+// allocateQuotas divides numRecords between the strata in proportion to
+// their size.  Records left over after rounding down are given to the
+// strata with the largest remainders, in order of first appearance.
+func allocateQuotas(
+	strata map[string]*stratum,
+	order []string,
+	total int64,
+	numRecords int64,
+) {
+	if numRecords > total {
+		numRecords = total
+	}
+	allocated := int64(0)
+	for _, v := range order {
+		s := strata[v]
+		s.quota = numRecords * s.count / total
+		s.remainder = numRecords * s.count % total
+		allocated += s.quota
+	}
+	byRemainder := append([]string{}, order...)
+	sort.SliceStable(byRemainder, func(i, j int) bool {
+		return strata[byRemainder[i]].remainder > strata[byRemainder[j]].remainder
+	})
+	for _, v := range byRemainder[:numRecords-allocated] {
+		strata[v].quota++
+	}
+}
+
+func (d *DSample) eachRecord(
+	fn func(recordNum int64, record ddataset.Record),
+) error {
+	conn, err := d.dataset.Open()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	recordNum := int64(0)
+	for conn.Next() {
+		fn(recordNum, conn.Read())
+		recordNum++
+	}
+	return conn.Err()
+}
+
+func hasField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package dsample
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/ddataset/dcsv"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+)
+
+func TestNewReservoir(t *testing.T) {
+	all := testhelpers.ReadField(t, testhelpers.NewFlowDataset(), "height")
+	cases := []struct {
+		numRecords int64
+		wantNum    int
+	}{
+		{numRecords: 0, wantNum: 0},
+		{numRecords: 1, wantNum: 1},
+		{numRecords: 4, wantNum: 4},
+		{numRecords: 9, wantNum: 9},
+		{numRecords: 20, wantNum: 9},
+	}
+	for i, c := range cases {
+		ds := NewReservoir(testhelpers.NewFlowDataset(), c.numRecords, 7)
+		got := testhelpers.ReadField(t, ds, "height")
+		if len(got) != c.wantNum {
+			t.Errorf("(%d) got %d records, want: %d", i, len(got), c.wantNum)
+		}
+		if !isSubsequence(got, all) {
+			t.Errorf("(%d) got: %v, not a subsequence of: %v", i, got, all)
+		}
+		again := testhelpers.ReadField(t, ds, "height")
+		if !reflect.DeepEqual(got, again) {
+			t.Errorf("(%d) reopened got: %v, want: %v", i, again, got)
+		}
+		if n := ds.NumRecords(); n != int64(c.wantNum) {
+			t.Errorf("(%d) NumRecords got: %d, want: %d", i, n, c.wantNum)
+		}
+	}
+}
+
+func TestNewReservoir_seed(t *testing.T) {
+	samples := map[string]bool{}
+	for seed := int64(0); seed < 10; seed++ {
+		ds := NewReservoir(testhelpers.NewFlowDataset(), 3, seed)
+		got := testhelpers.ReadField(t, ds, "height")
+		samples[strings.Join(got, ",")] = true
+	}
+	if len(samples) < 2 {
+		t.Errorf("different seeds all gave the same sample: %v", samples)
+	}
+}
+
+func TestNewStratified(t *testing.T) {
+	cases := []struct {
+		numRecords int64
+		want       map[string]int
+	}{
+		{numRecords: 3, want: map[string]int{"a": 1, "b": 1, "c": 1}},
+		{numRecords: 4, want: map[string]int{"a": 2, "b": 1, "c": 1}},
+		{numRecords: 6, want: map[string]int{"a": 2, "b": 2, "c": 2}},
+		{numRecords: 20, want: map[string]int{"a": 3, "b": 3, "c": 3}},
+	}
+	for i, c := range cases {
+		ds := NewStratified(testhelpers.NewFlowDataset(), "group", c.numRecords, 3)
+		conn, err := ds.Open()
+		if err != nil {
+			t.Fatalf("(%d) Open: %s", i, err)
+		}
+		got := map[string]int{}
+		for conn.Next() {
+			got[conn.Read()["group"].String()]++
+		}
+		if err := conn.Err(); err != nil {
+			t.Errorf("(%d) Err: %s", i, err)
+		}
+		conn.Close()
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("(%d) got: %v, want: %v", i, got, c.want)
+		}
+	}
+}
+
+func TestOpen_errors(t *testing.T) {
+	ds := NewStratified(testhelpers.NewFlowDataset(), "region", 3, 3)
+	wantErr := UnknownFieldError("region")
+	if _, err := ds.Open(); err != wantErr {
+		t.Errorf("Open got: %v, want: %s", err, wantErr)
+	}
+	ds = NewReservoir(
+		dcsv.New(
+			filepath.Join("fixtures", "missing.csv"),
+			true,
+			',',
+			testhelpers.FlowFields,
+		),
+		3,
+		3,
+	)
+	if _, err := ds.Open(); err == nil {
+		t.Errorf("Open got: nil, want: error")
+	}
+}
+
+func TestRelease(t *testing.T) {
+	ds := NewReservoir(testhelpers.NewFlowDataset(), 3, 3)
+	if err := ds.Release(); err != nil {
+		t.Errorf("Release: %s", err)
+	}
+	if _, err := ds.Open(); err != ddataset.ErrReleased {
+		t.Errorf("Open got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+	if err := ds.Release(); err != ddataset.ErrReleased {
+		t.Errorf("Release got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+}
+
+func TestUnknownFieldErrorError(t *testing.T) {
+	err := UnknownFieldError("region")
+	want := "unknown field: region"
+	if got := err.Error(); got != want {
+		t.Errorf("Error() got: %s, want: %s", got, want)
+	}
+}
+
+/*************************
+ *  Helper functions
+ *************************/
+
+func isSubsequence(sub, all []string) bool {
+	i := 0
+	for _, s := range all {
+		if i < len(sub) && sub[i] == s {
+			i++
+		}
+	}
+	return i == len(sub)
+}
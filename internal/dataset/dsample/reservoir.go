@@ -0,0 +1,45 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package dsample
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// reservoir chooses a simple random sample of a fixed size from a stream
+// of record numbers of unknown length
+type reservoir struct {
+	size     int64
+	numSeen  int64
+	selected []int64
+	rnd      *rand.Rand
+}
+
+func newReservoir(size int64, rnd *rand.Rand) *reservoir {
+	return &reservoir{
+		size:     size,
+		numSeen:  0,
+		selected: make([]int64, 0, size),
+		rnd:      rnd,
+	}
+}
+
+func (r *reservoir) add(recordNum int64) {
+	if r.numSeen < r.size {
+		r.selected = append(r.selected, recordNum)
+	} else if j := r.rnd.Int63n(r.numSeen + 1); j < r.size {
+		r.selected[j] = recordNum
+	}
+	r.numSeen++
+}
+
+// sorted returns the selected record numbers in ascending order
+func (r *reservoir) sorted() []int64 {
+	selected := append([]int64{}, r.selected...)
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i] < selected[j]
+	})
+	return selected
+}
@@ -0,0 +1,441 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+// Package dsplit splits a Dataset into train and test partitions, either
+// by holding out a fraction of the records or by holding out one of a
+// number of folds for cross-validation.  The partitions are disjoint and,
+// for a given specification, each record is always put in the same
+// partition.
+package dsplit
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/dlit"
+	"github.com/vlifesystems/rulehunter/internal/dataset"
+)
+
+// Partition is one of the partitions of a split Dataset
+type Partition int
+
+const (
+	Train Partition = iota
+	Test
+)
+
+// Spec describes how to split a Dataset
+type Spec struct {
+	// Holdout is the fraction of records to put in the Test partition
+	Holdout float64
+	Seed    int64
+	// Stratify, if set, is a field whose values should be in the same
+	// proportions in each partition
+	Stratify string
+	// TimeField, if set, is a field used to order the records so that
+	// the latest records are put in the Test partition.  Seed is ignored
+	// in this case.
+	TimeField string
+}
+
+// KFoldSpec describes how to divide a Dataset into folds
+type KFoldSpec struct {
+	NumFolds int
+	Seed     int64
+	// Stratify, if set, is a field whose values should be in the same
+	// proportions in each fold
+	Stratify string
+}
+
+// KFold represents a Dataset divided into folds.  The records are
+// assigned to the folds once and the assignment is shared by the
+// partitions of every fold, so the underlying Dataset should be a
+// stable copy.
+type KFold struct {
+	dataset ddataset.Dataset
+	spec    KFoldSpec
+	mu      sync.Mutex
+	folds   []int
+}
+
+// DSplit represents a partition of a split Dataset.  The records are
+// assigned to the partitions the first time the Dataset is opened and
+// the assignment and number of records are then reused, so the
+// underlying Dataset should be a stable copy.
+type DSplit struct {
+	dataset    ddataset.Dataset
+	spec       Spec
+	kFold      *KFold
+	fold       int
+	partition  Partition
+	isReleased bool
+	mu         sync.Mutex
+	isTest     []bool
+	numRecords int64
+}
+
+// DSplitConn represents a connection to a DSplit Dataset
+type DSplitConn struct {
+	dataset   *DSplit
+	conn      ddataset.Conn
+	isTest    []bool
+	recordNum int
+	err       error
+}
+
+// UnknownFieldError indicates that a field in the Spec isn't in the Dataset
+type UnknownFieldError string
+
+func (e UnknownFieldError) Error() string {
+	return "unknown field: " + string(e)
+}
+
+// New creates a new DSplit Dataset holding partition of d split
+// according to spec
+func New(d ddataset.Dataset, spec Spec, partition Partition) ddataset.Dataset {
+	return &DSplit{
+		dataset:    d,
+		spec:       spec,
+		partition:  partition,
+		isReleased: false,
+		numRecords: -1,
+	}
+}
+
+// NewKFolds creates a new KFold holding d divided into folds according
+// to spec
+func NewKFolds(d ddataset.Dataset, spec KFoldSpec) *KFold {
+	return &KFold{dataset: d, spec: spec}
+}
+
+// NewKFold creates a new DSplit Dataset holding partition of d when
+// it is divided into folds according to spec and fold is held out as
+// the Test partition.  Folds are numbered from 0.
+func NewKFold(
+	d ddataset.Dataset,
+	spec KFoldSpec,
+	fold int,
+	partition Partition,
+) ddataset.Dataset {
+	return NewKFolds(d, spec).Fold(fold, partition)
+}
+
+// Fold returns a DSplit Dataset holding partition of the Dataset when
+// fold is held out as the Test partition.  Folds are numbered from 0.
+func (k *KFold) Fold(fold int, partition Partition) ddataset.Dataset {
+	return &DSplit{
+		dataset:    k.dataset,
+		kFold:      k,
+		fold:       fold,
+		partition:  partition,
+		isReleased: false,
+		numRecords: -1,
+	}
+}
+
+// assignments returns the fold of each record, assigning the records
+// the first time that it is called
+func (k *KFold) assignments() ([]int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.folds != nil {
+		return k.folds, nil
+	}
+	stratify := k.spec.Stratify
+	if stratify != "" && !hasField(k.dataset.Fields(), stratify) {
+		return nil, UnknownFieldError(stratify)
+	}
+	folds, err := assignByStrata(
+		k.dataset,
+		stratify,
+		k.spec.Seed,
+		func(perm []int, parts []int) {
+			for j, i := range perm {
+				parts[i] = j % k.spec.NumFolds
+			}
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	k.folds = folds
+	return folds, nil
+}
+
+// Open creates a connection to the Dataset
+func (d *DSplit) Open() (ddataset.Conn, error) {
+	if d.isReleased {
+		return nil, ddataset.ErrReleased
+	}
+	isTest, err := d.assignments()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := d.dataset.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &DSplitConn{
+		dataset:   d,
+		conn:      conn,
+		isTest:    isTest,
+		recordNum: -1,
+		err:       nil,
+	}, nil
+}
+
+// Fields returns the field names used by the Dataset
+func (d *DSplit) Fields() []string {
+	return d.dataset.Fields()
+}
+
+// NumRecords returns the number of records in the Dataset.  If there is
+// a problem getting the number of records it returns -1.  The records are
+// only counted the first time this is called.
+func (d *DSplit) NumRecords() int64 {
+	d.mu.Lock()
+	numRecords := d.numRecords
+	d.mu.Unlock()
+	if numRecords >= 0 {
+		return numRecords
+	}
+	numRecords = dataset.CountNumRecords(d)
+	if numRecords >= 0 {
+		d.mu.Lock()
+		d.numRecords = numRecords
+		d.mu.Unlock()
+	}
+	return numRecords
+}
+
+// Release releases any resources associated with the Dataset d,
+// rendering it unusable in the future.
+func (d *DSplit) Release() error {
+	if !d.isReleased {
+		d.isReleased = true
+		return nil
+	}
+	return ddataset.ErrReleased
+}
+
+// Next returns whether there is a Record to be Read
+func (c *DSplitConn) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	wantTest := c.dataset.partition == Test
+	for c.conn.Next() {
+		c.recordNum++
+		// Records added since the split was made go in the train partition
+		isTest := c.recordNum < len(c.isTest) && c.isTest[c.recordNum]
+		if isTest == wantTest {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns any errors from the connection
+func (c *DSplitConn) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.conn.Err()
+}
+
+// Read returns the current Record
+func (c *DSplitConn) Read() ddataset.Record {
+	return c.conn.Read()
+}
+
+// Close closes the connection
+func (c *DSplitConn) Close() error {
+	return c.conn.Close()
+}
+
+// assignments returns whether each record is in the Test partition,
+// assigning the records the first time that it is called
+func (d *DSplit) assignments() ([]bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.isTest != nil {
+		return d.isTest, nil
+	}
+	isTest, err := d.assignRecords()
+	if err != nil {
+		return nil, err
+	}
+	d.isTest = isTest
+	return isTest, nil
+}
+
+// assignRecords returns whether each record is in the Test partition
+func (d *DSplit) assignRecords() ([]bool, error) {
+	if d.kFold != nil {
+		folds, err := d.kFold.assignments()
+		if err != nil {
+			return nil, err
+		}
+		isTest := make([]bool, len(folds))
+		for i, fold := range folds {
+			isTest[i] = fold == d.fold
+		}
+		return isTest, nil
+	}
+	for _, field := range []string{d.spec.Stratify, d.spec.TimeField} {
+		if field != "" && !hasField(d.dataset.Fields(), field) {
+			return nil, UnknownFieldError(field)
+		}
+	}
+	if d.spec.TimeField != "" {
+		return d.assignByTime()
+	}
+	parts, err := assignByStrata(
+		d.dataset,
+		d.spec.Stratify,
+		d.spec.Seed,
+		d.assignHoldout,
+	)
+	if err != nil {
+		return nil, err
+	}
+	isTest := make([]bool, len(parts))
+	for i, part := range parts {
+		isTest[i] = part == 1
+	}
+	return isTest, nil
+}
+
+// assignHoldout puts the first Holdout fraction of the shuffled
+// positions of a stratum in the Test partition, part 1
+func (d *DSplit) assignHoldout(perm []int, parts []int) {
+	for _, i := range perm[:d.numTest(len(perm))] {
+		parts[i] = 1
+	}
+}
+
+// assignByStrata shuffles the positions of the records of d within each
+// stratum and uses assign to choose which part each is in.  The strata
+// are shuffled in order of their values so that the parts don't depend
+// on the order in which the strata first appear.  If there is no field
+// to stratify by then all the records are in one stratum.
+func assignByStrata(
+	d ddataset.Dataset,
+	stratify string,
+	seed int64,
+	assign func(perm []int, parts []int),
+) ([]int, error) {
+	strata := map[string]int{}
+	values := []string{}
+	counts := []int{}
+	recordStrata := []int{}
+	err := eachRecord(d, func(record ddataset.Record) {
+		v := ""
+		if stratify != "" {
+			v = record[stratify].String()
+		}
+		s, ok := strata[v]
+		if !ok {
+			s = len(counts)
+			strata[v] = s
+			values = append(values, v)
+			counts = append(counts, 0)
+		}
+		counts[s]++
+		recordStrata = append(recordStrata, s)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(values)
+	rnd := rand.New(rand.NewSource(seed))
+	stratumParts := make([][]int, len(counts))
+	for _, v := range values {
+		s := strata[v]
+		stratumParts[s] = make([]int, counts[s])
+		assign(rnd.Perm(counts[s]), stratumParts[s])
+	}
+	parts := make([]int, len(recordStrata))
+	positions := make([]int, len(counts))
+	for i, s := range recordStrata {
+		parts[i] = stratumParts[s][positions[s]]
+		positions[s]++
+	}
+	return parts, nil
+}
+
+// assignByTime puts the latest Holdout fraction of the records, when
+// ordered by TimeField, in the Test partition
+func (d *DSplit) assignByTime() ([]bool, error) {
+	times := []*dlit.Literal{}
+	err := eachRecord(d.dataset, func(record ddataset.Record) {
+		times = append(times, record[d.spec.TimeField])
+	})
+	if err != nil {
+		return nil, err
+	}
+	order := make([]int, len(times))
+	for i := range order {
+		order[i] = i
+	}
+	less := lessFunc(times)
+	sort.SliceStable(order, func(i, j int) bool {
+		return less(times[order[i]], times[order[j]])
+	})
+	isTest := make([]bool, len(times))
+	numTest := d.numTest(len(times))
+	for _, i := range order[len(order)-numTest:] {
+		isTest[i] = true
+	}
+	return isTest, nil
+}
+
+// numTest returns how many of numRecords records to put in the Test
+// partition
+func (d *DSplit) numTest(numRecords int) int {
+	return int(math.Floor(d.spec.Holdout*float64(numRecords) + 0.5))
+}
+
+func eachRecord(d ddataset.Dataset, fn func(record ddataset.Record)) error {
+	conn, err := d.Open()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for conn.Next() {
+		fn(conn.Read())
+	}
+	return conn.Err()
+}
+
+// lessFunc returns a function to order values.  If they are all numbers
+// they are compared numerically, otherwise they are all compared as
+// strings, which puts dates and times in ISO 8601 format in order.
+// Comparing every pair in the same way keeps the ordering consistent.
+func lessFunc(values []*dlit.Literal) func(a, b *dlit.Literal) bool {
+	for _, v := range values {
+		if _, isFloat := v.Float(); !isFloat {
+			return func(a, b *dlit.Literal) bool {
+				return a.String() < b.String()
+			}
+		}
+	}
+	return func(a, b *dlit.Literal) bool {
+		af, _ := a.Float()
+		bf, _ := b.Float()
+		return af < bf
+	}
+}
+
+func hasField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,300 @@
+package dsplit
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/ddataset/dcsv"
+	"github.com/lawrencewoodman/dlit"
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+)
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		spec     Spec
+		wantNum  [2]int
+		wantTest []string
+	}{
+		{spec: Spec{Holdout: 0.3, Seed: 1}, wantNum: [2]int{6, 3}},
+		{spec: Spec{Holdout: 0.5, Seed: 2}, wantNum: [2]int{4, 5}},
+		{spec: Spec{Holdout: 0.01, Seed: 2}, wantNum: [2]int{9, 0}},
+		{spec: Spec{Holdout: 0.3, Seed: 1, Stratify: "group"},
+			wantNum: [2]int{6, 3},
+		},
+		{spec: Spec{Holdout: 0.3, TimeField: "height"},
+			wantNum:  [2]int{6, 3},
+			wantTest: []string{"128", "320", "328"},
+		},
+		{spec: Spec{Holdout: 0.2, TimeField: "district"},
+			wantNum:  [2]int{7, 2},
+			wantTest: []string{"38", "8"},
+		},
+	}
+	all := testhelpers.ReadField(t, testhelpers.NewFlowDataset(), "height")
+	sort.Strings(all)
+	for i, c := range cases {
+		train := New(testhelpers.NewFlowDataset(), c.spec, Train)
+		test := New(testhelpers.NewFlowDataset(), c.spec, Test)
+		gotTrain := testhelpers.ReadField(t, train, "height")
+		gotTest := testhelpers.ReadField(t, test, "height")
+		if len(gotTrain) != c.wantNum[0] || len(gotTest) != c.wantNum[1] {
+			t.Errorf("(%d) got %d train and %d test records, want: %d and %d",
+				i, len(gotTrain), len(gotTest), c.wantNum[0], c.wantNum[1])
+		}
+		union := append(append([]string{}, gotTrain...), gotTest...)
+		sort.Strings(union)
+		if !reflect.DeepEqual(union, all) {
+			t.Errorf("(%d) partitions got: %v and %v, want disjoint cover of: %v",
+				i, gotTrain, gotTest, all)
+		}
+		again := testhelpers.ReadField(t, test, "height")
+		if !reflect.DeepEqual(gotTest, again) {
+			t.Errorf("(%d) reopened got: %v, want: %v", i, again, gotTest)
+		}
+		if c.wantTest != nil {
+			sort.Strings(gotTest)
+			if !reflect.DeepEqual(gotTest, c.wantTest) {
+				t.Errorf("(%d) test got: %v, want: %v", i, gotTest, c.wantTest)
+			}
+		}
+		if n := test.NumRecords(); n != int64(c.wantNum[1]) {
+			t.Errorf("(%d) NumRecords got: %d, want: %d", i, n, c.wantNum[1])
+		}
+	}
+}
+
+func TestNew_stratify(t *testing.T) {
+	spec := Spec{Holdout: 0.3, Seed: 4, Stratify: "group"}
+	test := New(testhelpers.NewFlowDataset(), spec, Test)
+	conn, err := test.Open()
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer conn.Close()
+	got := map[string]int{}
+	for conn.Next() {
+		got[conn.Read()["group"].String()]++
+	}
+	want := map[string]int{"a": 1, "b": 1, "c": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestNewKFold(t *testing.T) {
+	cases := []struct {
+		spec     KFoldSpec
+		wantNums []int
+	}{
+		{spec: KFoldSpec{NumFolds: 3, Seed: 1}, wantNums: []int{3, 3, 3}},
+		{spec: KFoldSpec{NumFolds: 4, Seed: 2}, wantNums: []int{3, 2, 2, 2}},
+		{spec: KFoldSpec{NumFolds: 3, Seed: 2, Stratify: "group"},
+			wantNums: []int{3, 3, 3},
+		},
+	}
+	all := testhelpers.ReadField(t, testhelpers.NewFlowDataset(), "height")
+	sort.Strings(all)
+	for i, c := range cases {
+		allTest := []string{}
+		for fold, wantNum := range c.wantNums {
+			flow := testhelpers.NewFlowDataset()
+			train := testhelpers.ReadField(t, NewKFold(flow, c.spec, fold, Train), "height")
+			test := testhelpers.ReadField(t, NewKFold(flow, c.spec, fold, Test), "height")
+			if len(test) != wantNum || len(train) != len(all)-wantNum {
+				t.Errorf("(%d) fold: %d, got %d train and %d test records, want: %d and %d",
+					i, fold, len(train), len(test), len(all)-wantNum, wantNum)
+			}
+			union := append(append([]string{}, train...), test...)
+			sort.Strings(union)
+			if !reflect.DeepEqual(union, all) {
+				t.Errorf("(%d) fold: %d, partitions got: %v and %v, want disjoint cover of: %v",
+					i, fold, train, test, all)
+			}
+			allTest = append(allTest, test...)
+		}
+		sort.Strings(allTest)
+		if !reflect.DeepEqual(allTest, all) {
+			t.Errorf("(%d) test folds got: %v, want disjoint cover of: %v",
+				i, allTest, all)
+		}
+	}
+}
+
+func TestNewKFold_stratify(t *testing.T) {
+	spec := KFoldSpec{NumFolds: 3, Seed: 5, Stratify: "group"}
+	for fold := 0; fold < spec.NumFolds; fold++ {
+		conn, err := NewKFold(testhelpers.NewFlowDataset(), spec, fold, Test).Open()
+		if err != nil {
+			t.Fatalf("Open: %s", err)
+		}
+		got := map[string]int{}
+		for conn.Next() {
+			got[conn.Read()["group"].String()]++
+		}
+		conn.Close()
+		want := map[string]int{"a": 1, "b": 1, "c": 1}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("fold: %d, got: %v, want: %v", fold, got, want)
+		}
+	}
+}
+
+func TestNewKFolds(t *testing.T) {
+	flow := &openCounter{Dataset: testhelpers.NewFlowDataset()}
+	spec := KFoldSpec{NumFolds: 3, Seed: 1, Stratify: "group"}
+	kFold := NewKFolds(flow, spec)
+	all := testhelpers.ReadField(t, testhelpers.NewFlowDataset(), "height")
+	sort.Strings(all)
+	allTest := []string{}
+	for fold := 0; fold < spec.NumFolds; fold++ {
+		train := testhelpers.ReadField(t, kFold.Fold(fold, Train), "height")
+		test := testhelpers.ReadField(t, kFold.Fold(fold, Test), "height")
+		for _, h := range test {
+			for _, th := range train {
+				if h == th {
+					t.Errorf("fold: %d, height: %s, in train and test", fold, h)
+				}
+			}
+		}
+		allTest = append(allTest, test...)
+	}
+	sort.Strings(allTest)
+	if !reflect.DeepEqual(allTest, all) {
+		t.Errorf("test folds got: %v, want disjoint cover of: %v", allTest, all)
+	}
+	// One pass to assign the records and one for each read
+	if want := 1 + 2*spec.NumFolds; flow.numOpens != want {
+		t.Errorf("underlying dataset opened %d times, want: %d",
+			flow.numOpens, want)
+	}
+}
+
+func TestNew_strataOrder(t *testing.T) {
+	// The records of each group are in the same order in both files but
+	// the groups are in a different order
+	reordered := dcsv.New(
+		filepath.Join("fixtures", "flow_reordered.csv"),
+		true,
+		',',
+		testhelpers.FlowFields,
+	)
+	spec := Spec{Holdout: 0.3, Seed: 1, Stratify: "group"}
+	flow := testhelpers.NewFlowDataset()
+	want := testhelpers.ReadField(t, New(flow, spec, Test), "height")
+	got := testhelpers.ReadField(t, New(reordered, spec, Test), "height")
+	sort.Strings(want)
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+	kFoldSpec := KFoldSpec{NumFolds: 3, Seed: 2, Stratify: "group"}
+	for fold := 0; fold < kFoldSpec.NumFolds; fold++ {
+		flowTest := NewKFold(flow, kFoldSpec, fold, Test)
+		reorderedTest := NewKFold(reordered, kFoldSpec, fold, Test)
+		want := testhelpers.ReadField(t, flowTest, "height")
+		got := testhelpers.ReadField(t, reorderedTest, "height")
+		sort.Strings(want)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("fold: %d, got: %v, want: %v", fold, got, want)
+		}
+	}
+}
+
+func TestLessFunc(t *testing.T) {
+	cases := []struct {
+		values []string
+		want   []string
+	}{
+		{values: []string{"10", "9", "8.5", "100"},
+			want: []string{"8.5", "9", "10", "100"},
+		},
+		{values: []string{"10", "9", "1a", "100"},
+			want: []string{"10", "100", "1a", "9"},
+		},
+		{values: []string{"2018-03-04", "2018-01-02", "2017-12-31"},
+			want: []string{"2017-12-31", "2018-01-02", "2018-03-04"},
+		},
+	}
+	for i, c := range cases {
+		values := make([]*dlit.Literal, len(c.values))
+		for j, v := range c.values {
+			values[j] = dlit.NewString(v)
+		}
+		less := lessFunc(values)
+		sort.SliceStable(values, func(i, j int) bool {
+			return less(values[i], values[j])
+		})
+		got := make([]string, len(values))
+		for j, v := range values {
+			got[j] = v.String()
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("(%d) got: %v, want: %v", i, got, c.want)
+		}
+	}
+}
+
+func TestOpen_errors(t *testing.T) {
+	cases := []Spec{
+		{Holdout: 0.3, Stratify: "region"},
+		{Holdout: 0.3, TimeField: "region"},
+	}
+	wantErr := UnknownFieldError("region")
+	flow := testhelpers.NewFlowDataset()
+	for i, spec := range cases {
+		if _, err := New(flow, spec, Train).Open(); err != wantErr {
+			t.Errorf("(%d) Open got: %v, want: %s", i, err, wantErr)
+		}
+	}
+	kFoldSpec := KFoldSpec{NumFolds: 3, Stratify: "region"}
+	if _, err := NewKFold(flow, kFoldSpec, 0, Test).Open(); err != wantErr {
+		t.Errorf("NewKFold: Open got: %v, want: %s", err, wantErr)
+	}
+}
+
+func TestNumRecords_cached(t *testing.T) {
+	flow := &openCounter{Dataset: testhelpers.NewFlowDataset()}
+	test := NewKFold(flow, KFoldSpec{NumFolds: 3, Seed: 1}, 0, Test)
+	for i := 0; i < 3; i++ {
+		if n := test.NumRecords(); n != 3 {
+			t.Errorf("(%d) NumRecords got: %d, want: 3", i, n)
+		}
+		testhelpers.ReadField(t, test, "height")
+	}
+	// One pass to assign the records, one to count them and one for each read
+	if flow.numOpens != 5 {
+		t.Errorf("underlying dataset opened %d times, want: 5", flow.numOpens)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	ds := New(testhelpers.NewFlowDataset(), Spec{Holdout: 0.3}, Train)
+	if err := ds.Release(); err != nil {
+		t.Errorf("Release: %s", err)
+	}
+	if _, err := ds.Open(); err != ddataset.ErrReleased {
+		t.Errorf("Open got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+	if err := ds.Release(); err != ddataset.ErrReleased {
+		t.Errorf("Release got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+}
+
+/*************************
+ *  Helper functions
+ *************************/
+
+// openCounter counts the number of times its Dataset is opened
+type openCounter struct {
+	ddataset.Dataset
+	numOpens int
+}
+
+func (d *openCounter) Open() (ddataset.Conn, error) {
+	d.numOpens++
+	return d.Dataset.Open()
+}
@@ -0,0 +1,428 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+// Package dxlsx handles access to a sheet of an Excel (.xlsx) workbook
+// as a Dataset.  Each field name given refers to a column of the sheet
+// in order, starting at the first column of the cell range if one is
+// given or column A if not.  Rows without any values in those columns
+// are skipped.  Numeric cells become numbers and cells formatted as
+// dates become strings of the form: 2006-01-02 or, if they have a time
+// part, 2006-01-02T15:04:05Z.
+package dxlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/dlit"
+	"github.com/vlifesystems/rulehunter/internal/dataset"
+)
+
+// ErrNoSheets indicates that a workbook doesn't contain any sheets
+var ErrNoSheets = errors.New("workbook has no sheets")
+
+var errPartNotFound = errors.New("part not found")
+
+// SheetNotFoundError indicates that a named sheet isn't in the workbook
+type SheetNotFoundError string
+
+func (e SheetNotFoundError) Error() string {
+	return "sheet not found: " + string(e)
+}
+
+// DXLSX represents an Excel workbook sheet Dataset
+type DXLSX struct {
+	filename   string
+	sheet      string
+	hasHeader  bool
+	cellRange  Range
+	fieldNames []string
+	isReleased bool
+}
+
+// DXLSXConn represents a connection to a DXLSX Dataset
+type DXLSXConn struct {
+	dataset       *DXLSX
+	file          *zip.ReadCloser
+	sheet         io.ReadCloser
+	decoder       *xml.Decoder
+	workbook      *workbook
+	cellRange     Range
+	rowNum        int
+	hasSkipped    bool
+	currentRecord ddataset.Record
+	err           error
+}
+
+// Range is a rectangular range of cells given by the column and row
+// numbers, starting from 1, of its corners.  A Range with a LastRow
+// of 0 extends to the last row of the sheet.
+type Range struct {
+	FirstCol int
+	FirstRow int
+	LastCol  int
+	LastRow  int
+}
+
+type xlsxCell struct {
+	Ref      string    `xml:"r,attr"`
+	Type     string    `xml:"t,attr"`
+	Style    int       `xml:"s,attr"`
+	Value    string    `xml:"v"`
+	InlineIs *xlsxText `xml:"is"`
+}
+
+// New creates a new DXLSX Dataset.  If sheet is empty the first sheet
+// of the workbook is used and if cellRange is the zero Range the
+// columns starting at column A of the whole sheet are used.
+func New(
+	filename string,
+	sheet string,
+	hasHeader bool,
+	cellRange Range,
+	fieldNames []string,
+) ddataset.Dataset {
+	return &DXLSX{
+		filename:   filename,
+		sheet:      sheet,
+		hasHeader:  hasHeader,
+		cellRange:  cellRange,
+		fieldNames: fieldNames,
+		isReleased: false,
+	}
+}
+
+// Open creates a connection to the Dataset
+func (d *DXLSX) Open() (ddataset.Conn, error) {
+	if d.isReleased {
+		return nil, ddataset.ErrReleased
+	}
+	cellRange := d.cellRange
+	if cellRange == (Range{}) {
+		cellRange = Range{
+			FirstCol: 1,
+			FirstRow: 1,
+			LastCol:  len(d.fieldNames),
+			LastRow:  0,
+		}
+	}
+	if cellRange.LastCol-cellRange.FirstCol+1 != len(d.fieldNames) {
+		return nil, ddataset.ErrWrongNumFields
+	}
+	f, err := zip.OpenReader(d.filename)
+	if err != nil {
+		return nil, err
+	}
+	wb, err := readWorkbook(&f.Reader, d.sheet)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	sheet, err := openPart(&f.Reader, wb.sheetPath)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %s", wb.sheetPath, err)
+	}
+	return &DXLSXConn{
+		dataset:       d,
+		file:          f,
+		sheet:         sheet,
+		decoder:       xml.NewDecoder(sheet),
+		workbook:      wb,
+		cellRange:     cellRange,
+		rowNum:        0,
+		hasSkipped:    !d.hasHeader,
+		currentRecord: make(ddataset.Record, len(d.fieldNames)),
+		err:           nil,
+	}, nil
+}
+
+// Fields returns the field names used by the Dataset
+func (d *DXLSX) Fields() []string {
+	return d.fieldNames
+}
+
+// NumRecords returns the number of records in the Dataset.  If there is
+// a problem getting the number of records it returns -1.  NOTE: The returned
+// value can change if the underlying Dataset changes.
+func (d *DXLSX) NumRecords() int64 {
+	return dataset.CountNumRecords(d)
+}
+
+// Release releases any resources associated with the Dataset d,
+// rendering it unusable in the future.
+func (d *DXLSX) Release() error {
+	if !d.isReleased {
+		d.isReleased = true
+		return nil
+	}
+	return ddataset.ErrReleased
+}
+
+// Next returns whether there is a Record to be Read
+func (c *DXLSXConn) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	if c.file == nil {
+		c.err = ddataset.ErrConnClosed
+		return false
+	}
+	for {
+		cells, err := c.nextRow()
+		if err == io.EOF {
+			return false
+		}
+		if err != nil {
+			c.Close()
+			c.err = fmt.Errorf("row %d: %s", c.rowNum, err)
+			return false
+		}
+		if cells == nil {
+			continue
+		}
+		if !c.hasSkipped {
+			c.hasSkipped = true
+			continue
+		}
+		for i, field := range c.dataset.fieldNames {
+			c.currentRecord[field] = cells[i]
+		}
+		return true
+	}
+}
+
+// Err returns any errors from the connection
+func (c *DXLSXConn) Err() error {
+	return c.err
+}
+
+// Read returns the current Record
+func (c *DXLSXConn) Read() ddataset.Record {
+	return c.currentRecord
+}
+
+// Close closes the connection
+func (c *DXLSXConn) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	c.sheet.Close()
+	err := c.file.Close()
+	c.file = nil
+	c.sheet = nil
+	c.decoder = nil
+	return err
+}
+
+// nextRow returns the values of the next row within the cell range or
+// nil if the row has no values within the range.  Missing cells become
+// empty strings.  It returns io.EOF if there are no more rows.
+func (c *DXLSXConn) nextRow() ([]*dlit.Literal, error) {
+	if c.cellRange.LastRow != 0 && c.rowNum >= c.cellRange.LastRow {
+		return nil, io.EOF
+	}
+	for {
+		t, err := c.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch e := t.(type) {
+		case xml.StartElement:
+			if e.Name.Local != "row" {
+				continue
+			}
+			c.rowNum++
+			for _, a := range e.Attr {
+				if a.Name.Local == "r" {
+					if c.rowNum, err = strconv.Atoi(a.Value); err != nil {
+						return nil, fmt.Errorf("invalid row number: %s", a.Value)
+					}
+				}
+			}
+			if c.rowNum < c.cellRange.FirstRow {
+				if err := c.decoder.Skip(); err != nil {
+					return nil, err
+				}
+				return nil, nil
+			}
+			if c.cellRange.LastRow != 0 && c.rowNum > c.cellRange.LastRow {
+				return nil, io.EOF
+			}
+			return c.readRow()
+		case xml.EndElement:
+			if e.Name.Local == "sheetData" {
+				return nil, io.EOF
+			}
+		}
+	}
+}
+
+// readRow reads the cells of the current row
+func (c *DXLSXConn) readRow() ([]*dlit.Literal, error) {
+	values := make([]*dlit.Literal, c.cellRange.LastCol-c.cellRange.FirstCol+1)
+	hasValues := false
+	colNum := 0
+	for {
+		t, err := c.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch e := t.(type) {
+		case xml.StartElement:
+			if e.Name.Local != "c" {
+				if err := c.decoder.Skip(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			cell := xlsxCell{}
+			if err := c.decoder.DecodeElement(&cell, &e); err != nil {
+				return nil, err
+			}
+			colNum++
+			if cell.Ref != "" {
+				if colNum, _, err = parseCellRef(cell.Ref); err != nil {
+					return nil, err
+				}
+			}
+			if colNum < c.cellRange.FirstCol || colNum > c.cellRange.LastCol {
+				continue
+			}
+			l, err := c.cellToLiteral(cell)
+			if err != nil {
+				return nil, fmt.Errorf("cell %s: %s", cell.Ref, err)
+			}
+			values[colNum-c.cellRange.FirstCol] = l
+			hasValues = hasValues || l.String() != ""
+		case xml.EndElement:
+			if !hasValues {
+				return nil, nil
+			}
+			for i, v := range values {
+				if v == nil {
+					values[i] = dlit.NewString("")
+				}
+			}
+			return values, nil
+		}
+	}
+}
+
+func (c *DXLSXConn) cellToLiteral(cell xlsxCell) (*dlit.Literal, error) {
+	switch cell.Type {
+	case "s":
+		i, err := strconv.Atoi(cell.Value)
+		if err != nil || i < 0 || i >= len(c.workbook.sharedStrings) {
+			return nil, fmt.Errorf("invalid shared string: %s", cell.Value)
+		}
+		return dlit.NewString(c.workbook.sharedStrings[i]), nil
+	case "inlineStr":
+		if cell.InlineIs == nil {
+			return dlit.NewString(""), nil
+		}
+		return dlit.NewString(cell.InlineIs.String()), nil
+	case "b":
+		return dlit.MustNew(cell.Value == "1"), nil
+	case "str", "e", "d":
+		return dlit.NewString(cell.Value), nil
+	}
+	if cell.Value == "" {
+		return dlit.NewString(""), nil
+	}
+	if c.workbook.dateStyles[cell.Style] {
+		serial, err := strconv.ParseFloat(cell.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date: %s", cell.Value)
+		}
+		return excelDateToLiteral(serial, c.workbook.date1904), nil
+	}
+	if i, err := strconv.ParseInt(cell.Value, 10, 64); err == nil {
+		return dlit.MustNew(i), nil
+	}
+	if f, err := strconv.ParseFloat(cell.Value, 64); err == nil {
+		return dlit.MustNew(f), nil
+	}
+	return dlit.NewString(cell.Value), nil
+}
+
+// excelDateToLiteral converts an Excel date serial number, which is the
+// number of days since an epoch, to a Literal
+func excelDateToLiteral(serial float64, date1904 bool) *dlit.Literal {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	} else if serial < 61 {
+		// Excel wrongly treats 1900 as a leap year
+		epoch = epoch.AddDate(0, 0, 1)
+	}
+	days, frac := math.Modf(serial)
+	t := epoch.AddDate(0, 0, int(days)).Add(
+		time.Duration(math.Round(frac*24*60*60*1000)) * time.Millisecond,
+	)
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 &&
+		t.Nanosecond() == 0 {
+		return dlit.NewString(t.Format("2006-01-02"))
+	}
+	return dlit.NewString(t.Format(time.RFC3339Nano))
+}
+
+// ParseRange parses a cell range such as: A2:D100.  The last row
+// may be left out, as in: A2:D, to extend the range to the last row
+// of the sheet.
+func ParseRange(s string) (Range, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return Range{}, fmt.Errorf("invalid range: %s", s)
+	}
+	firstCol, firstRow, err := parseCellRef(parts[0])
+	if err != nil || firstRow == 0 {
+		return Range{}, fmt.Errorf("invalid range: %s", s)
+	}
+	lastCol, lastRow, err := parseCellRef(parts[1])
+	if err != nil || lastCol < firstCol || (lastRow != 0 && lastRow < firstRow) {
+		return Range{}, fmt.Errorf("invalid range: %s", s)
+	}
+	return Range{
+		FirstCol: firstCol,
+		FirstRow: firstRow,
+		LastCol:  lastCol,
+		LastRow:  lastRow,
+	}, nil
+}
+
+// parseCellRef returns the column and row numbers of a cell reference
+// such as: B12.  The row number is 0 if the reference only has a column.
+func parseCellRef(ref string) (int, int, error) {
+	col := 0
+	i := 0
+	for ; i < len(ref); i++ {
+		c := ref[i]
+		if c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		col = col*26 + int(c-'A') + 1
+	}
+	if col == 0 {
+		return 0, 0, fmt.Errorf("invalid cell reference: %s", ref)
+	}
+	if i == len(ref) {
+		return col, 0, nil
+	}
+	row, err := strconv.Atoi(ref[i:])
+	if err != nil || row < 1 {
+		return 0, 0, fmt.Errorf("invalid cell reference: %s", ref)
+	}
+	return col, row, nil
+}
@@ -0,0 +1,212 @@
+package dxlsx
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lawrencewoodman/ddataset"
+)
+
+var flowFields = []string{
+	"group", "district", "height", "flow", "ok", "day", "time",
+}
+
+func TestOpenNextRead(t *testing.T) {
+	cases := []struct {
+		sheet     string
+		hasHeader bool
+		cellRange Range
+		fields    []string
+		want      [][]string
+	}{
+		{sheet: "flow",
+			hasHeader: true,
+			cellRange: Range{FirstCol: 2, FirstRow: 3, LastCol: 8, LastRow: 0},
+			fields:    flowFields,
+			want: [][]string{
+				{"a", "northcal", "120", "16.5", "true", "2018-01-02",
+					"2018-01-02T09:30:00Z"},
+				{"a", "", "128", "19", "false", "2018-01-03",
+					"2018-01-03T17:45:00Z"},
+				{"b", "southcal", "18", "5", "true", "2018-02-01", "2018-02-01"},
+				{"c", "midcal", "-6", "0.25", "false", "2018-03-03",
+					"2018-03-03T12:00:00Z"},
+			},
+		},
+		{sheet: "flow",
+			hasHeader: false,
+			cellRange: Range{FirstCol: 2, FirstRow: 4, LastCol: 4, LastRow: 5},
+			fields:    []string{"group", "district", "height"},
+			want: [][]string{
+				{"a", "northcal", "120"},
+				{"a", "", "128"},
+			},
+		},
+		{sheet: "flow",
+			hasHeader: false,
+			cellRange: Range{},
+			fields:    []string{"title"},
+			want:      [][]string{{"Flow readings"}},
+		},
+		{sheet: "",
+			hasHeader: false,
+			cellRange: Range{},
+			fields:    []string{"notes"},
+			want:      [][]string{{"ignore this sheet"}},
+		},
+	}
+	for i, c := range cases {
+		ds := New(
+			filepath.Join("fixtures", "flow.xlsx"),
+			c.sheet,
+			c.hasHeader,
+			c.cellRange,
+			c.fields,
+		)
+		conn, err := ds.Open()
+		if err != nil {
+			t.Fatalf("(%d) Open: %s", i, err)
+		}
+		got := [][]string{}
+		for conn.Next() {
+			record := conn.Read()
+			row := make([]string, len(c.fields))
+			for j, f := range c.fields {
+				row[j] = record[f].String()
+			}
+			got = append(got, row)
+		}
+		if err := conn.Err(); err != nil {
+			t.Fatalf("(%d) Err: %s", i, err)
+		}
+		conn.Close()
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("(%d) got: %v, want: %v", i, got, c.want)
+		}
+		if n := ds.NumRecords(); n != int64(len(c.want)) {
+			t.Errorf("(%d) NumRecords got: %d, want: %d", i, n, len(c.want))
+		}
+	}
+}
+
+func TestOpen_errors(t *testing.T) {
+	cases := []struct {
+		filename  string
+		sheet     string
+		cellRange Range
+		wantErr   error
+	}{
+		{filename: "flow.xlsx",
+			sheet:     "flow",
+			cellRange: Range{FirstCol: 2, FirstRow: 3, LastCol: 4, LastRow: 0},
+			wantErr:   ddataset.ErrWrongNumFields,
+		},
+		{filename: "flow.xlsx",
+			sheet:     "missing",
+			cellRange: Range{FirstCol: 2, FirstRow: 3, LastCol: 8, LastRow: 0},
+			wantErr:   SheetNotFoundError("missing"),
+		},
+		{filename: "flow.txt",
+			sheet:     "flow",
+			cellRange: Range{FirstCol: 2, FirstRow: 3, LastCol: 8, LastRow: 0},
+			wantErr:   errors.New("zip: not a valid zip file"),
+		},
+	}
+	for i, c := range cases {
+		ds := New(
+			filepath.Join("fixtures", c.filename),
+			c.sheet,
+			true,
+			c.cellRange,
+			flowFields,
+		)
+		_, err := ds.Open()
+		if err == nil || err.Error() != c.wantErr.Error() {
+			t.Errorf("(%d) Open got: %v, want: %s", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    Range
+		wantErr error
+	}{
+		{in: "A1:D10", want: Range{FirstCol: 1, FirstRow: 1, LastCol: 4, LastRow: 10}},
+		{in: "b2:AA", want: Range{FirstCol: 2, FirstRow: 2, LastCol: 27, LastRow: 0}},
+		{in: "A1", wantErr: errors.New("invalid range: A1")},
+		{in: "A:D", wantErr: errors.New("invalid range: A:D")},
+		{in: "D1:A10", wantErr: errors.New("invalid range: D1:A10")},
+		{in: "A10:D1", wantErr: errors.New("invalid range: A10:D1")},
+	}
+	for i, c := range cases {
+		got, err := ParseRange(c.in)
+		if c.wantErr != nil {
+			if err == nil || err.Error() != c.wantErr.Error() {
+				t.Errorf("(%d) ParseRange got err: %v, want: %s", i, err, c.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("(%d) ParseRange: %s", i, err)
+		} else if got != c.want {
+			t.Errorf("(%d) ParseRange got: %v, want: %v", i, got, c.want)
+		}
+	}
+}
+
+func TestIsDateFormat(t *testing.T) {
+	cases := []struct {
+		code string
+		want bool
+	}{
+		{code: "General", want: false},
+		{code: "0.00%", want: false},
+		{code: "yyyy-mm-dd hh:mm", want: true},
+		{code: `[Red]0.00;"days"`, want: false},
+		{code: `\d0`, want: false},
+		{code: "[$-409]d-mmm-yy", want: true},
+	}
+	for i, c := range cases {
+		if got := isDateFormat(c.code); got != c.want {
+			t.Errorf("(%d) isDateFormat(%s) got: %t, want: %t",
+				i, c.code, got, c.want)
+		}
+	}
+}
+
+func TestExcelDateToLiteral(t *testing.T) {
+	cases := []struct {
+		serial   float64
+		date1904 bool
+		want     string
+	}{
+		{serial: 43102, want: "2018-01-02"},
+		{serial: 43102.395833333336, want: "2018-01-02T09:30:00Z"},
+		{serial: 1, want: "1900-01-01"},
+		{serial: 61, want: "1900-03-01"},
+		{serial: 0, date1904: true, want: "1904-01-01"},
+	}
+	for i, c := range cases {
+		got := excelDateToLiteral(c.serial, c.date1904)
+		if got.String() != c.want {
+			t.Errorf("(%d) excelDateToLiteral got: %s, want: %s", i, got, c.want)
+		}
+	}
+}
+
+func TestRelease(t *testing.T) {
+	ds := New(filepath.Join("fixtures", "flow.xlsx"), "", false, Range{}, []string{"notes"})
+	if err := ds.Release(); err != nil {
+		t.Errorf("Release: %s", err)
+	}
+	if _, err := ds.Open(); err != ddataset.ErrReleased {
+		t.Errorf("Open got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+	if err := ds.Release(); err != ddataset.ErrReleased {
+		t.Errorf("Release got: %v, want: %s", err, ddataset.ErrReleased)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package dxlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// workbook holds the parts of a workbook needed to read a sheet
+type workbook struct {
+	sharedStrings []string
+	dateStyles    map[int]bool
+	date1904      bool
+	sheetPath     string
+}
+
+type xlsxWorkbook struct {
+	WorkbookPr struct {
+		Date1904 bool `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+// xlsxText is rich text made up of either a single piece of text or
+// a number of runs of text
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	s := ""
+	for _, r := range t.Runs {
+		s += r.T
+	}
+	return s
+}
+
+type xlsxStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+// readWorkbook reads the workbook parts of r needed to read sheet.  If
+// sheet is empty the first sheet is used.
+func readWorkbook(r *zip.Reader, sheet string) (*workbook, error) {
+	wb := &xlsxWorkbook{}
+	if err := decodePart(r, "xl/workbook.xml", wb); err != nil {
+		return nil, err
+	}
+	rels := &xlsxRelationships{}
+	if err := decodePart(r, "xl/_rels/workbook.xml.rels", rels); err != nil {
+		return nil, err
+	}
+	if len(wb.Sheets) == 0 {
+		return nil, ErrNoSheets
+	}
+	sheetID := ""
+	if sheet == "" {
+		sheetID = wb.Sheets[0].ID
+	} else {
+		for _, s := range wb.Sheets {
+			if s.Name == sheet {
+				sheetID = s.ID
+				break
+			}
+		}
+		if sheetID == "" {
+			return nil, SheetNotFoundError(sheet)
+		}
+	}
+	sheetPath := ""
+	for _, rel := range rels.Relationships {
+		if rel.ID == sheetID {
+			sheetPath = partPath(rel.Target)
+			break
+		}
+	}
+	if sheetPath == "" {
+		return nil, fmt.Errorf("missing relationship: %s", sheetID)
+	}
+
+	sharedStrings := &xlsxSharedStrings{}
+	err := decodePart(r, "xl/sharedStrings.xml", sharedStrings)
+	if err != nil && err != errPartNotFound {
+		return nil, err
+	}
+	styles := &xlsxStyles{}
+	err = decodePart(r, "xl/styles.xml", styles)
+	if err != nil && err != errPartNotFound {
+		return nil, err
+	}
+
+	strs := make([]string, len(sharedStrings.Items))
+	for i, item := range sharedStrings.Items {
+		strs[i] = item.String()
+	}
+	return &workbook{
+		sharedStrings: strs,
+		dateStyles:    makeDateStyles(styles),
+		date1904:      wb.WorkbookPr.Date1904,
+		sheetPath:     sheetPath,
+	}, nil
+}
+
+// partPath returns the path within the zip file of a relationship target
+func partPath(target string) string {
+	if strings.HasPrefix(target, "/") {
+		return path.Clean(target[1:])
+	}
+	return path.Join("xl", target)
+}
+
+func openPart(r *zip.Reader, name string) (io.ReadCloser, error) {
+	for _, f := range r.File {
+		if f.Name == name {
+			return f.Open()
+		}
+	}
+	return nil, errPartNotFound
+}
+
+func decodePart(r *zip.Reader, name string, v interface{}) error {
+	rc, err := openPart(r, name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	return nil
+}
+
+// makeDateStyles returns which cell styles use a date format
+func makeDateStyles(styles *xlsxStyles) map[int]bool {
+	customFormats := make(map[int]string, len(styles.NumFmts))
+	for _, f := range styles.NumFmts {
+		customFormats[f.ID] = f.Code
+	}
+	dateStyles := map[int]bool{}
+	for i, xf := range styles.CellXfs {
+		if code, ok := customFormats[xf.NumFmtID]; ok {
+			dateStyles[i] = isDateFormat(code)
+		} else {
+			dateStyles[i] = isBuiltInDateFormat(xf.NumFmtID)
+		}
+	}
+	return dateStyles
+}
+
+func isBuiltInDateFormat(id int) bool {
+	return (id >= 14 && id <= 22) ||
+		(id >= 27 && id <= 36) ||
+		(id >= 45 && id <= 47) ||
+		(id >= 50 && id <= 58)
+}
+
+// isDateFormat returns whether a custom number format code formats
+// dates or times, ignoring any quoted text, escaped characters and
+// bracketed sections such as colours
+func isDateFormat(code string) bool {
+	inQuotes := false
+	inBrackets := false
+	escaped := false
+	for _, c := range strings.ToLower(code) {
+		switch {
+		case escaped:
+			escaped = false
+		case inQuotes:
+			inQuotes = c != '"'
+		case inBrackets:
+			inBrackets = c != ']'
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			inQuotes = true
+		case c == '[':
+			inBrackets = true
+		case strings.ContainsRune("ymdhs", c):
+			return true
+		}
+	}
+	return false
+}
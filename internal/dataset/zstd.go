@@ -0,0 +1,33 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+//go:build go1.17
+// +build go1.17
+
+package dataset
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ZstdSupported is whether zstd compressed data can be decompressed.
+// The zstd package needs Go 1.17 or later.
+const ZstdSupported = true
+
+// zstdDecoder is shared as DecodeAll can be called concurrently
+var zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+
+// DecodeZstd returns data decompressed using zstd
+func DecodeZstd(data []byte) ([]byte, error) {
+	return zstdDecoder.DecodeAll(data, nil)
+}
+
+func newZstdReader(r io.Reader) (io.Reader, error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
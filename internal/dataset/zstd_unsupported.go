@@ -0,0 +1,27 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+//go:build !go1.17
+// +build !go1.17
+
+package dataset
+
+import (
+	"errors"
+	"io"
+)
+
+// ZstdSupported is whether zstd compressed data can be decompressed.
+// The zstd package needs Go 1.17 or later.
+const ZstdSupported = false
+
+var errZstdUnsupported = errors.New("zstd compression needs Go 1.17 or later")
+
+// DecodeZstd returns data decompressed using zstd
+func DecodeZstd(data []byte) ([]byte, error) {
+	return nil, errZstdUnsupported
+}
+
+func newZstdReader(r io.Reader) (io.Reader, error) {
+	return nil, errZstdUnsupported
+}
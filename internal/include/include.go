@@ -0,0 +1,332 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+// Package include resolves the shared fragments that experiment files
+// include from a library directory.
+//
+// A file lists the fragments it includes, relative to the library
+// directory, in its top-level include field.  Fragments may include other
+// fragments.  The fragments are merged in order and then the file itself
+// is merged on top so that later fragments override earlier ones and the
+// file overrides all of them.  Mappings are merged key by key, lists whose
+// items are all mappings with a name, such as aggregators, are merged by
+// name and other values are replaced.
+package include
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vlifesystems/rulehunter/fileinfo"
+	"gopkg.in/yaml.v2"
+)
+
+// Doc is a decoded experiment file or fragment
+type Doc map[string]interface{}
+
+// CycleError indicates that a fragment includes itself
+type CycleError []string
+
+func (e CycleError) Error() string {
+	return "cycle: " + strings.Join(e, " -> ")
+}
+
+// InvalidExtError indicates that a fragment has an invalid extension
+type InvalidExtError string
+
+func (e InvalidExtError) Error() string {
+	return "invalid extension: " + string(e)
+}
+
+// OutsideLibraryError indicates that a fragment's name refers to a file
+// outside of the library directory
+type OutsideLibraryError string
+
+func (e OutsideLibraryError) Error() string {
+	return "outside library directory: " + string(e)
+}
+
+var errInvalidInclude = errors.New("include: must be a list of filenames")
+
+// Resolve returns the document in filename merged with the fragments
+// it includes from libraryDir, along with the filenames of those fragments
+func Resolve(filename, libraryDir string) (Doc, []string, error) {
+	r := &resolver{libraryDir: libraryDir, seen: map[string]bool{}}
+	doc, err := r.resolve(filename, []string{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, r.files, nil
+}
+
+// FileInfo returns file with its ModTime replaced by the latest
+// modification time of file and the fragments in files
+func FileInfo(
+	file fileinfo.FileInfo,
+	files []string,
+) (fileinfo.FileInfo, error) {
+	modTime, err := latestModTime(files)
+	if err != nil {
+		return nil, err
+	}
+	if !modTime.After(file.ModTime()) {
+		return file, nil
+	}
+	return fileinfo.New(file.Name(), modTime), nil
+}
+
+// Marshal encodes doc in the format given by the extension ext
+func Marshal(doc Doc, ext string) ([]byte, error) {
+	switch ext {
+	case ".json":
+		return json.Marshal(doc)
+	case ".yaml":
+		return yaml.Marshal(doc)
+	}
+	return nil, InvalidExtError(ext)
+}
+
+type resolver struct {
+	libraryDir string
+	files      []string
+	seen       map[string]bool
+}
+
+// resolve returns the merged document for filename, stack holds the
+// names of the fragments being resolved to detect cycles
+func (r *resolver) resolve(filename string, stack []string) (Doc, error) {
+	doc, err := load(filename)
+	if err != nil {
+		return nil, err
+	}
+	names, err := includeNames(doc)
+	if err != nil {
+		return nil, err
+	}
+	delete(doc, "include")
+	if len(names) == 0 {
+		return doc, nil
+	}
+
+	merged := Doc{}
+	for _, name := range names {
+		for _, s := range stack {
+			if s == name {
+				return nil, CycleError(append(stack, name))
+			}
+		}
+		includeFilename := filepath.Join(r.libraryDir, name)
+		if !r.seen[includeFilename] {
+			r.seen[includeFilename] = true
+			r.files = append(r.files, includeFilename)
+		}
+		includeDoc, err := r.resolve(includeFilename, append(stack, name))
+		if err != nil {
+			if _, ok := err.(CycleError); ok {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		merged = merge(merged, includeDoc).(Doc)
+	}
+	return merge(merged, doc).(Doc), nil
+}
+
+func load(filename string) (Doc, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	switch ext := filepath.Ext(filename); ext {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		err = dec.Decode(&v)
+	case ".yaml":
+		err = yaml.Unmarshal(b, &v)
+	default:
+		return nil, InvalidExtError(ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return Doc{}, nil
+	}
+	doc, ok := normalize(v).(Doc)
+	if !ok {
+		return nil, errors.New("not a mapping")
+	}
+	return doc, nil
+}
+
+func includeNames(doc Doc) ([]string, error) {
+	v, ok := doc["include"]
+	if !ok || v == nil {
+		return []string{}, nil
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, errInvalidInclude
+	}
+	names := make([]string, len(items))
+	for i, item := range items {
+		name, ok := item.(string)
+		if !ok || name == "" {
+			return nil, errInvalidInclude
+		}
+		if !isInLibrary(name) {
+			return nil, OutsideLibraryError(name)
+		}
+		names[i] = name
+	}
+	return names, nil
+}
+
+// isInLibrary returns whether name is relative to the library directory
+// and doesn't refer to a file outside of it
+func isInLibrary(name string) bool {
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return false
+	}
+	name = filepath.Clean(name)
+	return name != ".." &&
+		!strings.HasPrefix(name, ".."+string(filepath.Separator))
+}
+
+// normalize converts the mappings decoded by yaml to Docs so that
+// they can be merged and encoded as JSON, and the numbers decoded from
+// JSON to int64 or float64 so that they can be encoded as YAML
+func normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		doc := make(Doc, len(x))
+		for k, v := range x {
+			doc[fmt.Sprint(k)] = normalize(v)
+		}
+		return doc
+	case map[string]interface{}:
+		doc := make(Doc, len(x))
+		for k, v := range x {
+			doc[k] = normalize(v)
+		}
+		return doc
+	case []interface{}:
+		r := make([]interface{}, len(x))
+		for i, v := range x {
+			r[i] = normalize(v)
+		}
+		return r
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			return n
+		}
+		if f, err := x.Float64(); err == nil {
+			return f
+		}
+		return x.String()
+	}
+	return v
+}
+
+// merge returns over merged on top of base
+func merge(base, over interface{}) interface{} {
+	switch o := over.(type) {
+	case Doc:
+		b, ok := base.(Doc)
+		if !ok {
+			return o
+		}
+		r := make(Doc, len(b)+len(o))
+		for k, v := range b {
+			r[k] = v
+		}
+		for k, v := range o {
+			if bv, ok := r[k]; ok {
+				r[k] = merge(bv, v)
+			} else {
+				r[k] = v
+			}
+		}
+		return r
+	case []interface{}:
+		b, ok := base.([]interface{})
+		if !ok || !isNamedList(b) || !isNamedList(o) {
+			return o
+		}
+		return mergeNamedList(b, o)
+	}
+	return over
+}
+
+// mergeNamedList returns the items of base with any that share a name
+// with an item of over replaced by it, followed by the rest of over
+func mergeNamedList(base, over []interface{}) []interface{} {
+	overByName := make(map[string]interface{}, len(over))
+	for _, item := range over {
+		overByName[itemName(item)] = item
+	}
+	r := make([]interface{}, 0, len(base)+len(over))
+	replaced := map[string]bool{}
+	for _, item := range base {
+		name := itemName(item)
+		if o, ok := overByName[name]; ok {
+			r = append(r, o)
+			replaced[name] = true
+		} else {
+			r = append(r, item)
+		}
+	}
+	for _, item := range over {
+		if !replaced[itemName(item)] {
+			r = append(r, item)
+		}
+	}
+	return r
+}
+
+func isNamedList(l []interface{}) bool {
+	if len(l) == 0 {
+		return false
+	}
+	for _, item := range l {
+		if itemName(item) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func itemName(item interface{}) string {
+	doc, ok := item.(Doc)
+	if !ok {
+		return ""
+	}
+	name, ok := doc["name"].(string)
+	if !ok {
+		return ""
+	}
+	return name
+}
+
+func latestModTime(filenames []string) (time.Time, error) {
+	var latest time.Time
+	for _, filename := range filenames {
+		fi, err := os.Stat(filename)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
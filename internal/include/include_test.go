@@ -0,0 +1,182 @@
+package include
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vlifesystems/rulehunter/internal/testhelpers"
+	"gopkg.in/yaml.v2"
+)
+
+func TestResolve(t *testing.T) {
+	libraryDir := filepath.Join("fixtures", "library")
+	wantDoc := Doc{
+		"title": "What would indicate good ROI?",
+		"train": Doc{
+			"dataset": Doc{
+				"csv": Doc{
+					"filename":  "acme_2018.csv",
+					"hasHeader": true,
+					"separator": ",",
+				},
+			},
+		},
+		"aggregators": []interface{}{
+			Doc{"name": "totalValue", "kind": "sum", "arg": "value"},
+			Doc{"name": "totalContacts", "kind": "sum", "arg": "numContacts"},
+			Doc{
+				"name": "totalROI",
+				"kind": "calc",
+				"arg":  "totalValue / totalContacts",
+			},
+			Doc{
+				"name": "conversion",
+				"kind": "calc",
+				"arg":  "totalValue / totalContacts",
+			},
+		},
+		"goals": []interface{}{"conversion > 0.5"},
+		"sortOrder": []interface{}{
+			Doc{"aggregator": "totalValue", "direction": "descending"},
+		},
+	}
+	wantFiles := []string{
+		filepath.Join(libraryDir, "roi.yaml"),
+		filepath.Join(libraryDir, "counts.yaml"),
+	}
+	for _, filename := range []string{"acme.yaml", "acme.json"} {
+		doc, files, err := Resolve(filepath.Join("fixtures", filename), libraryDir)
+		if err != nil {
+			t.Errorf("Resolve(%s): %s", filename, err)
+			continue
+		}
+		if !reflect.DeepEqual(doc, wantDoc) {
+			t.Errorf("Resolve(%s) doc got: %v, want: %v", filename, doc, wantDoc)
+		}
+		if !reflect.DeepEqual(files, wantFiles) {
+			t.Errorf("Resolve(%s) files got: %v, want: %v",
+				filename, files, wantFiles)
+		}
+	}
+}
+
+func TestResolve_errors(t *testing.T) {
+	libraryDir := filepath.Join("fixtures", "library")
+	cases := []struct {
+		filename string
+		wantErr  string
+	}{
+		{filename: "acme_cycle.yaml",
+			wantErr: "cycle: cycle_a.yaml -> cycle_b.yaml -> cycle_a.yaml",
+		},
+		{filename: "acme_missing.yaml",
+			wantErr: "missing.yaml: open " +
+				filepath.Join(libraryDir, "missing.yaml") +
+				": no such file or directory",
+		},
+		{filename: "acme_invalid_include.yaml",
+			wantErr: "include: must be a list of filenames",
+		},
+		{filename: "acme_invalid_ext.yaml",
+			wantErr: "roi.txt: invalid extension: .txt",
+		},
+		{filename: "acme_outside.yaml",
+			wantErr: "outside library directory: ../acme.yaml",
+		},
+		{filename: "acme_absolute.yaml",
+			wantErr: "outside library directory: /etc/passwd.yaml",
+		},
+	}
+	for _, c := range cases {
+		_, _, err := Resolve(filepath.Join("fixtures", c.filename), libraryDir)
+		if err == nil || err.Error() != c.wantErr {
+			t.Errorf("Resolve(%s) err: %v, want: %s", c.filename, err, c.wantErr)
+		}
+	}
+}
+
+func TestResolve_mixedFormats(t *testing.T) {
+	type limitsDesc struct {
+		Train struct {
+			RuleGeneration struct {
+				CombinationLength int `yaml:"combinationLength"`
+			} `yaml:"ruleGeneration"`
+		} `yaml:"train"`
+		Split struct {
+			Holdout float64 `yaml:"holdout"`
+		} `yaml:"split"`
+	}
+	libraryDir := filepath.Join("fixtures", "library")
+	for _, filename := range []string{"acme_limits.yaml", "acme_limits.json"} {
+		doc, _, err := Resolve(filepath.Join("fixtures", filename), libraryDir)
+		if err != nil {
+			t.Errorf("Resolve(%s): %s", filename, err)
+			continue
+		}
+		ext := filepath.Ext(filename)
+		b, err := Marshal(doc, ext)
+		if err != nil {
+			t.Errorf("Marshal(%s): %s", filename, err)
+			continue
+		}
+		var got limitsDesc
+		if ext == ".json" {
+			err = json.Unmarshal(b, &got)
+		} else {
+			err = yaml.Unmarshal(b, &got)
+		}
+		if err != nil {
+			t.Errorf("Unmarshal(%s): %s", filename, err)
+			continue
+		}
+		if got.Train.RuleGeneration.CombinationLength != 2 ||
+			got.Split.Holdout != 0.25 {
+			t.Errorf("Unmarshal(%s) got: %+v, want combinationLength: 2, holdout: 0.25",
+				filename, got)
+		}
+	}
+}
+
+func TestFileInfo(t *testing.T) {
+	tmpDir := testhelpers.TempDir(t)
+	defer os.RemoveAll(tmpDir)
+	testhelpers.CopyFile(
+		t,
+		filepath.Join("fixtures", "library", "roi.yaml"),
+		tmpDir,
+	)
+	filename := filepath.Join(tmpDir, "roi.yaml")
+	modTime := time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC)
+	if err := os.Chtimes(filename, modTime, modTime); err != nil {
+		t.Fatalf("Chtimes: %s", err)
+	}
+	cases := []struct {
+		fileModTime time.Time
+		want        time.Time
+	}{
+		{fileModTime: modTime.Add(-time.Hour), want: modTime},
+		{fileModTime: modTime.Add(time.Hour), want: modTime.Add(time.Hour)},
+	}
+	for i, c := range cases {
+		file := testhelpers.NewFileInfo("acme.yaml", c.fileModTime)
+		got, err := FileInfo(file, []string{filename})
+		if err != nil {
+			t.Errorf("(%d) FileInfo: %s", i, err)
+			continue
+		}
+		if got.Name() != "acme.yaml" || !got.ModTime().Equal(c.want) {
+			t.Errorf("(%d) FileInfo got: %s %s, want: acme.yaml %s",
+				i, got.Name(), got.ModTime(), c.want)
+		}
+	}
+
+	file := testhelpers.NewFileInfo("acme.yaml", modTime)
+	missing := filepath.Join(tmpDir, "missing.yaml")
+	if _, err := FileInfo(file, []string{missing}); err == nil {
+		t.Error("FileInfo: expected an error")
+	}
+}
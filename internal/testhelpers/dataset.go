@@ -0,0 +1,45 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package testhelpers
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/lawrencewoodman/ddataset"
+	"github.com/lawrencewoodman/ddataset/dcsv"
+)
+
+// FlowFields are the fields of the flow dataset
+var FlowFields = []string{"group", "district", "height", "flow"}
+
+// FlowFilename returns the name of the csv file of the flow dataset,
+// which has a header and some blank lines
+func FlowFilename() string {
+	_, filename, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(filename), "fixtures", "flow.csv")
+}
+
+// NewFlowDataset returns the flow dataset
+func NewFlowDataset() ddataset.Dataset {
+	return dcsv.New(FlowFilename(), true, ',', FlowFields)
+}
+
+// ReadField returns the values of field for each record of d
+func ReadField(t *testing.T, d ddataset.Dataset, field string) []string {
+	conn, err := d.Open()
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer conn.Close()
+	r := []string{}
+	for conn.Next() {
+		r = append(r, conn.Read()[field].String())
+	}
+	if err := conn.Err(); err != nil {
+		t.Fatalf("Err: %s", err)
+	}
+	return r
+}
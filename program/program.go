@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/kardianos/service"
@@ -27,6 +28,9 @@ type Program struct {
 	files           chan fileinfo.FileInfo
 	shouldStop      chan struct{}
 	isRunning       bool
+	// The experiment files that are waiting for the files they depend
+	// on, so that waiting is only logged when it changes
+	waiting map[string]string
 }
 
 func New(
@@ -43,6 +47,7 @@ func New(
 		files:           make(chan fileinfo.FileInfo, 100),
 		shouldStop:      make(chan struct{}),
 		isRunning:       false,
+		waiting:         map[string]string{},
 	}
 }
 
@@ -50,6 +55,7 @@ func (p *Program) Start(s service.Service) error {
 	watchPeriod := 2.0 * time.Second
 	go watcher.Watch(
 		p.config.ExperimentsDir,
+		p.config.LibraryDir,
 		watchPeriod,
 		p.logger,
 		p.quit,
@@ -63,29 +69,66 @@ func (p *Program) Start(s service.Service) error {
 // error if it is out of the ordinary for example if an error occurs when
 // reporting to the progress monitor, not if it can't load an experiment
 // nor if there is a problem processing the experiment. Pass ignoreWhen
-// as true if you want to ignore experiment's 'when' statement.
+// as true if you want to ignore experiment's 'when' statement.  If the
+// file has a matrix each of its experiments is loaded and processed in
+// turn, so that one that can't be loaded doesn't stop the others.
 func (p *Program) ProcessFile(file fileinfo.FileInfo, ignoreWhen bool) error {
-	var err error
 	pm := p.progressMonitor
 
-	e, err := experiment.Load(p.config, file)
+	f, err := experiment.ReadFile(p.config, file, pm)
 	if err != nil {
-		logErr := fmt.Errorf("Can't load experiment: %s, %s", file.Name(), err)
-		p.logger.Error(logErr)
-		if pmErr := pm.ReportLoadError(file.Name(), err); pmErr != nil {
-			return p.logger.Error(pmErr)
+		return p.reportLoadError(file.Name(), err)
+	}
+	for i := 0; i < f.NumExperiments(); i++ {
+		if err := p.processExperiment(f, i, ignoreWhen); err != nil {
+			return err
 		}
-		return nil
+	}
+	return nil
+}
+
+// processExperiment loads, processes and then releases experiment i
+// of f
+func (p *Program) processExperiment(
+	f *experiment.File,
+	i int,
+	ignoreWhen bool,
+) error {
+	pm := p.progressMonitor
+	e, err := f.Load(i)
+	if err != nil {
+		return p.reportLoadError(f.Name(i), err)
 	}
 	defer func() {
 		if err := e.Release(); err != nil {
 			logErr := fmt.Errorf("Couldn't release experiment: %s, %s",
-				file.Name(), err)
+				e.File.Name(), err)
 			p.logger.Error(logErr)
 		}
 	}()
 
-	return e.Process(p.config, p.progressMonitor, p.logger, p.quit, ignoreWhen)
+	if waiting := e.WaitingFor(pm); len(waiting) > 0 {
+		msg := fmt.Sprintf("Experiment: %s, waiting for: %s",
+			e.File.Name(), strings.Join(waiting, ", "))
+		if p.waiting[e.File.Name()] != msg {
+			p.logger.Info(msg)
+			p.waiting[e.File.Name()] = msg
+		}
+		return nil
+	}
+	delete(p.waiting, e.File.Name())
+	return e.Process(p.config, pm, p.logger, p.quit, ignoreWhen)
+}
+
+// reportLoadError logs and reports to the progress monitor that the
+// experiment in filename couldn't be loaded
+func (p *Program) reportLoadError(filename string, err error) error {
+	logErr := fmt.Errorf("Can't load experiment: %s, %s", filename, err)
+	p.logger.Error(logErr)
+	if pmErr := p.progressMonitor.ReportLoadError(filename, err); pmErr != nil {
+		return p.logger.Error(pmErr)
+	}
+	return nil
 }
 
 func (p *Program) ProcessDir(dir string, ignoreWhen bool) error {
@@ -93,8 +136,42 @@ func (p *Program) ProcessDir(dir string, ignoreWhen bool) error {
 	if err != nil {
 		return err
 	}
-	for _, file := range files {
-		if err := p.ProcessFile(file, ignoreWhen); err != nil {
+	return p.processFiles(files, ignoreWhen)
+}
+
+// processFiles processes files so that each file is processed after
+// the files that it depends on.  Files that depend on each other in a
+// cycle are reported as load errors.
+func (p *Program) processFiles(
+	files []fileinfo.FileInfo,
+	ignoreWhen bool,
+) error {
+	pm := p.progressMonitor
+	names := make([]string, len(files))
+	filesMap := make(map[string]fileinfo.FileInfo, len(files))
+	dependsOn := make(map[string][]string, len(files))
+	for i, file := range files {
+		names[i] = file.Name()
+		filesMap[file.Name()] = file
+		// Any error is reported when the file is processed
+		if deps, err := experiment.DependsOn(p.config, file); err == nil {
+			dependsOn[file.Name()] = deps
+		}
+	}
+
+	order, cycles := sortByDependencies(names, dependsOn)
+	for _, name := range names {
+		if err, ok := cycles[name]; ok {
+			err = fmt.Errorf("experiment field: dependsOn: %s", err)
+			logErr := fmt.Errorf("Can't load experiment: %s, %s", name, err)
+			p.logger.Error(logErr)
+			if pmErr := pm.ReportLoadError(name, err); pmErr != nil {
+				return p.logger.Error(pmErr)
+			}
+		}
+	}
+	for _, name := range order {
+		if err := p.ProcessFile(filesMap[name], ignoreWhen); err != nil {
 			return err
 		}
 	}
@@ -125,6 +202,11 @@ func (p *Program) ProcessFilename(filename string, ignoreWhen bool) error {
 func (p *Program) run() {
 	p.isRunning = true
 	defer func() { p.isRunning = false }()
+	defer func() {
+		if err := experiment.CloseDataSources(); err != nil {
+			p.logger.Error(err)
+		}
+	}()
 	for {
 		select {
 		case <-p.quit.C:
@@ -135,7 +217,31 @@ func (p *Program) run() {
 			if file == nil {
 				break
 			}
-			p.ProcessFile(file, false)
+			p.processFiles(p.receiveFiles(file), false)
+		}
+	}
+}
+
+// receiveFiles returns file along with any other files that are waiting
+// to be received so that they can be processed in order of their
+// dependencies
+func (p *Program) receiveFiles(file fileinfo.FileInfo) []fileinfo.FileInfo {
+	files := []fileinfo.FileInfo{file}
+	indices := map[string]int{file.Name(): 0}
+	for {
+		select {
+		case file, ok := <-p.files:
+			if !ok || file == nil {
+				return files
+			}
+			if i, ok := indices[file.Name()]; ok {
+				files[i] = file
+				continue
+			}
+			indices[file.Name()] = len(files)
+			files = append(files, file)
+		default:
+			return files
 		}
 	}
 }
@@ -431,6 +431,162 @@ func TestProcessFile_title_change(t *testing.T) {
 	}
 }
 
+func TestProcessFile_matrix(t *testing.T) {
+	cfgDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(cfgDir)
+	cfg := &config.Config{
+		ExperimentsDir:  filepath.Join(cfgDir, "experiments"),
+		WWWDir:          filepath.Join(cfgDir, "www"),
+		BuildDir:        filepath.Join(cfgDir, "build"),
+		MaxNumRecords:   100,
+		MaxNumProcesses: 4,
+	}
+	testhelpers.CopyFile(
+		t,
+		filepath.Join("fixtures", "debt_matrix.yaml"),
+		filepath.Join(cfgDir, "experiments"),
+	)
+
+	l := testhelpers.NewLogger()
+	quit := quitter.New()
+	defer quit.Quit()
+	pm, err := progress.NewMonitor(
+		filepath.Join(cfg.BuildDir, "progress"),
+	)
+	if err != nil {
+		t.Fatalf("progress.NewMonitor: %s", err)
+	}
+
+	p := New(cfg, pm, l, quit)
+	file := testhelpers.NewFileInfo("debt_matrix.yaml", time.Now())
+	if err := p.ProcessFile(file, false); err != nil {
+		t.Fatalf("ProcessFile: %s", err)
+	}
+
+	wantReportFiles := []string{
+		internal.MakeBuildFilename(
+			"train",
+			"testing",
+			"Does married indicate success?",
+		),
+		internal.MakeBuildFilename(
+			"train",
+			"testing",
+			"Does single indicate success?",
+		),
+	}
+	gotReportFiles := testhelpers.GetFilesInDir(
+		t,
+		filepath.Join(cfgDir, "build", "reports"),
+	)
+	sort.Strings(gotReportFiles)
+	sort.Strings(wantReportFiles)
+	if !reflect.DeepEqual(gotReportFiles, wantReportFiles) {
+		t.Errorf("GetFilesInDir - got: %v\n want: %v",
+			gotReportFiles, wantReportFiles)
+	}
+
+	wantPMExperiments := []*progress.Experiment{
+		&progress.Experiment{
+			Title:    "Does single indicate success?",
+			Filename: "debt_matrix.yaml (status: single)",
+			Tags:     []string{"bank"},
+			Category: "testing",
+			Status: &progress.Status{
+				Stamp:   time.Now(),
+				Msg:     "Finished processing successfully",
+				Percent: 0.0,
+				State:   progress.Success,
+			},
+		},
+		&progress.Experiment{
+			Title:    "Does married indicate success?",
+			Filename: "debt_matrix.yaml (status: married)",
+			Tags:     []string{"bank"},
+			Category: "testing",
+			Status: &progress.Status{
+				Stamp:   time.Now(),
+				Msg:     "Finished processing successfully",
+				Percent: 0.0,
+				State:   progress.Success,
+			},
+		},
+	}
+	got := pm.GetExperiments()
+	initExperimentsTime(wantPMExperiments)
+	err = progresstest.CheckExperimentsMatch(got, wantPMExperiments, false)
+	if err != nil {
+		t.Errorf("checkExperimentsMatch() err: %s", err)
+	}
+}
+
+func TestProcessFile_matrix_loadError(t *testing.T) {
+	cfgDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(cfgDir)
+	cfg := &config.Config{
+		ExperimentsDir:  filepath.Join(cfgDir, "experiments"),
+		WWWDir:          filepath.Join(cfgDir, "www"),
+		BuildDir:        filepath.Join(cfgDir, "build"),
+		MaxNumRecords:   100,
+		MaxNumProcesses: 4,
+	}
+	testhelpers.CopyFile(
+		t,
+		filepath.Join("fixtures", "debt_matrix_missing.yaml"),
+		filepath.Join(cfgDir, "experiments"),
+	)
+
+	l := testhelpers.NewLogger()
+	quit := quitter.New()
+	defer quit.Quit()
+	pm, err := progress.NewMonitor(
+		filepath.Join(cfg.BuildDir, "progress"),
+	)
+	if err != nil {
+		t.Fatalf("progress.NewMonitor: %s", err)
+	}
+
+	p := New(cfg, pm, l, quit)
+	file := testhelpers.NewFileInfo("debt_matrix_missing.yaml", time.Now())
+	if err := p.ProcessFile(file, false); err != nil {
+		t.Fatalf("ProcessFile: %s", err)
+	}
+
+	wantPMExperiments := []*progress.Experiment{
+		&progress.Experiment{
+			Title:    "",
+			Filename: "debt_matrix_missing.yaml (source: missing)",
+			Tags:     []string{},
+			Category: "",
+			Status: &progress.Status{
+				Stamp: time.Now(),
+				Msg: "Error loading experiment: experiment field: train: " +
+					"dataset: open fixtures/missing.csv: no such file or directory",
+				Percent: 0.0,
+				State:   progress.Error,
+			},
+		},
+		&progress.Experiment{
+			Title:    "Is debt in debt successful?",
+			Filename: "debt_matrix_missing.yaml (source: debt)",
+			Tags:     []string{"bank"},
+			Category: "testing",
+			Status: &progress.Status{
+				Stamp:   time.Now(),
+				Msg:     "Finished processing successfully",
+				Percent: 0.0,
+				State:   progress.Success,
+			},
+		},
+	}
+	got := pm.GetExperiments()
+	initExperimentsTime(wantPMExperiments)
+	err = progresstest.CheckExperimentsMatch(got, wantPMExperiments, false)
+	if err != nil {
+		t.Errorf("checkExperimentsMatch() err: %s", err)
+	}
+}
+
 func TestProcessFile_ignoreWhen(t *testing.T) {
 	cfgDir := testhelpers.BuildConfigDirs(t, true)
 	defer os.RemoveAll(cfgDir)
@@ -749,3 +905,94 @@ func TestStart(t *testing.T) {
 		}
 	}
 }
+
+func TestProcessDir_dependsOn(t *testing.T) {
+	cfgDir := testhelpers.BuildConfigDirs(t, true)
+	defer os.RemoveAll(cfgDir)
+	cfg := &config.Config{
+		ExperimentsDir:  filepath.Join(cfgDir, "experiments"),
+		WWWDir:          filepath.Join(cfgDir, "www"),
+		BuildDir:        filepath.Join(cfgDir, "build"),
+		MaxNumRecords:   100,
+		MaxNumProcesses: 4,
+	}
+	files := []string{
+		"a_debt_downstream.yaml",
+		"cycle_a.yaml",
+		"cycle_b.yaml",
+		"z_debt_upstream.yaml",
+	}
+	for _, f := range files {
+		testhelpers.CopyFile(
+			t,
+			filepath.Join("fixtures", f),
+			filepath.Join(cfgDir, "experiments"),
+		)
+	}
+
+	l := testhelpers.NewLogger()
+	quit := quitter.New()
+	defer quit.Quit()
+	pm, err := progress.NewMonitor(
+		filepath.Join(cfg.BuildDir, "progress"),
+	)
+	if err != nil {
+		t.Fatalf("progress.NewMonitor: %s", err)
+	}
+	p := New(cfg, pm, l, quit)
+
+	// The downstream experiment waits until upstream has been processed
+	downstream := testhelpers.NewFileInfo("a_debt_downstream.yaml", time.Now())
+	for i := 0; i < 2; i++ {
+		if err := p.ProcessFile(downstream, false); err != nil {
+			t.Fatalf("ProcessFile: %s", err)
+		}
+	}
+	if err := p.ProcessDir(cfg.ExperimentsDir, false); err != nil {
+		t.Fatalf("ProcessDir: %s", err)
+	}
+
+	cycleErr := "experiment field: dependsOn: cycle: " +
+		"cycle_a.yaml -> cycle_b.yaml -> cycle_a.yaml"
+	wantEntries := []testhelpers.Entry{
+		{Level: testhelpers.Info,
+			Msg: "Experiment: a_debt_downstream.yaml, waiting for: z_debt_upstream.yaml"},
+		{Level: testhelpers.Error,
+			Msg: "Can't load experiment: cycle_a.yaml, " + cycleErr},
+		{Level: testhelpers.Error,
+			Msg: "Can't load experiment: cycle_b.yaml, " + cycleErr},
+		{Level: testhelpers.Info,
+			Msg: "Processing experiment: z_debt_upstream.yaml, mode: train"},
+		{Level: testhelpers.Info,
+			Msg: "Successfully processed experiment: z_debt_upstream.yaml, mode: train"},
+		{Level: testhelpers.Info,
+			Msg: "Processing experiment: a_debt_downstream.yaml, mode: train"},
+		{Level: testhelpers.Info,
+			Msg: "Successfully processed experiment: a_debt_downstream.yaml, mode: train"},
+	}
+	if !reflect.DeepEqual(l.GetEntries(), wantEntries) {
+		t.Errorf("GetEntries() got: %v\n want: %v", l.GetEntries(), wantEntries)
+	}
+
+	// The downstream experiment is rerun after upstream is rerun
+	upstream := testhelpers.NewFileInfo("z_debt_upstream.yaml", time.Now())
+	if err := p.ProcessFile(upstream, true); err != nil {
+		t.Fatalf("ProcessFile: %s", err)
+	}
+	if err := p.ProcessFile(downstream, false); err != nil {
+		t.Fatalf("ProcessFile: %s", err)
+	}
+	wantEntries = append(wantEntries,
+		testhelpers.Entry{Level: testhelpers.Info,
+			Msg: "Processing experiment: z_debt_upstream.yaml, mode: train"},
+		testhelpers.Entry{Level: testhelpers.Info,
+			Msg: "Successfully processed experiment: z_debt_upstream.yaml, mode: train"},
+		testhelpers.Entry{Level: testhelpers.Info,
+			Msg: "Processing experiment: a_debt_downstream.yaml, mode: train"},
+		testhelpers.Entry{Level: testhelpers.Info,
+			Msg: "Successfully processed experiment: a_debt_downstream.yaml, mode: train"},
+	)
+	if !reflect.DeepEqual(l.GetEntries(), wantEntries) {
+		t.Errorf("GetEntries() got: %v\n want: %v", l.GetEntries(), wantEntries)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (C) 2018 vLife Systems Ltd <http://vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENSE.md for details.
+
+package program
+
+import (
+	"strings"
+)
+
+// CycleError indicates that experiment files depend on each other
+type CycleError []string
+
+func (e CycleError) Error() string {
+	return "cycle: " + strings.Join(e, " -> ")
+}
+
+// sortByDependencies returns names ordered so that each name comes after
+// the names that it depends on, otherwise keeping the order of names.
+// Dependencies that aren't in names are ignored.  Names that are part of
+// a cycle are left out of the order and returned with the cycle.
+func sortByDependencies(
+	names []string,
+	dependsOn map[string][]string,
+) ([]string, map[string]error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	isName := make(map[string]bool, len(names))
+	for _, name := range names {
+		isName[name] = true
+	}
+	state := make(map[string]int, len(names))
+	order := make([]string, 0, len(names))
+	cycles := map[string]error{}
+	stack := []string{}
+
+	var visit func(name string)
+	visit = func(name string) {
+		switch state[name] {
+		case visited:
+			return
+		case visiting:
+			start := 0
+			for i, n := range stack {
+				if n == name {
+					start = i
+				}
+			}
+			cycle := append(append([]string{}, stack[start:]...), name)
+			for _, n := range stack[start:] {
+				if _, ok := cycles[n]; !ok {
+					cycles[n] = CycleError(cycle)
+				}
+			}
+			return
+		}
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, dep := range dependsOn[name] {
+			if isName[dep] {
+				visit(dep)
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+		if _, ok := cycles[name]; !ok {
+			order = append(order, name)
+		}
+	}
+
+	for _, name := range names {
+		visit(name)
+	}
+	return order, cycles
+}
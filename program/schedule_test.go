@@ -0,0 +1,79 @@
+package program
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortByDependencies(t *testing.T) {
+	cases := []struct {
+		names      []string
+		dependsOn  map[string][]string
+		wantOrder  []string
+		wantCycles map[string]error
+	}{
+		{names: []string{"a", "b", "c"},
+			dependsOn:  map[string][]string{},
+			wantOrder:  []string{"a", "b", "c"},
+			wantCycles: map[string]error{},
+		},
+		{names: []string{"a", "b", "c"},
+			dependsOn: map[string][]string{
+				"a": {"c"},
+				"c": {"b"},
+			},
+			wantOrder:  []string{"b", "c", "a"},
+			wantCycles: map[string]error{},
+		},
+		{names: []string{"a", "b"},
+			dependsOn: map[string][]string{
+				"a": {"x"},
+				"b": {"y", "a"},
+			},
+			wantOrder:  []string{"a", "b"},
+			wantCycles: map[string]error{},
+		},
+		{names: []string{"a", "b", "c", "d"},
+			dependsOn: map[string][]string{
+				"a": {"b"},
+				"b": {"c"},
+				"c": {"a"},
+				"d": {"b"},
+			},
+			wantOrder: []string{"d"},
+			wantCycles: map[string]error{
+				"a": CycleError{"a", "b", "c", "a"},
+				"b": CycleError{"a", "b", "c", "a"},
+				"c": CycleError{"a", "b", "c", "a"},
+			},
+		},
+		{names: []string{"a", "b"},
+			dependsOn: map[string][]string{
+				"b": {"b"},
+			},
+			wantOrder: []string{"a"},
+			wantCycles: map[string]error{
+				"b": CycleError{"b", "b"},
+			},
+		},
+	}
+	for i, c := range cases {
+		gotOrder, gotCycles := sortByDependencies(c.names, c.dependsOn)
+		if !reflect.DeepEqual(gotOrder, c.wantOrder) {
+			t.Errorf("(%d) sortByDependencies order got: %v, want: %v",
+				i, gotOrder, c.wantOrder)
+		}
+		if !reflect.DeepEqual(gotCycles, c.wantCycles) {
+			t.Errorf("(%d) sortByDependencies cycles got: %v, want: %v",
+				i, gotCycles, c.wantCycles)
+		}
+	}
+}
+
+func TestCycleErrorError(t *testing.T) {
+	err := CycleError{"a.yaml", "b.yaml", "a.yaml"}
+	want := "cycle: a.yaml -> b.yaml -> a.yaml"
+	if got := err.Error(); got != want {
+		t.Errorf("Error() got: %s, want: %s", got, want)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	rhkaggregator "github.com/vlifesystems/rhkit/aggregator"
 	rhkassessment "github.com/vlifesystems/rhkit/assessment"
 	"github.com/vlifesystems/rhkit/description"
+	"github.com/vlifesystems/rhkit/goal"
 	"github.com/vlifesystems/rhkit/rule"
 	"github.com/vlifesystems/rulehunter/config"
 	"github.com/vlifesystems/rulehunter/internal"
@@ -30,6 +31,9 @@ type Aggregator struct {
 	OriginalValue string `json:"originalValue"`
 	RuleValue     string `json:"ruleValue"`
 	Difference    string `json:"difference"`
+	// The rule value for each fold of a cross-validation report, empty for
+	// folds that the rule wasn't assessed on
+	FoldValues []string `json:"foldValues,omitempty"`
 }
 
 type Goal struct {
@@ -69,12 +73,33 @@ type Report struct {
 	Stamp              time.Time                 `json:"stamp"`
 	ExperimentFilename string                    `json:"experimentFilename"`
 	NumRecords         int64                     `json:"numRecords"`
+	Where              string                    `json:"where"`
+	Sample             *Sample                   `json:"sample"`
+	NumFolds           int                       `json:"numFolds,omitempty"`
+	NullCounts         map[string]int64          `json:"nullCounts,omitempty"`
+	Matrix             *Matrix                   `json:"matrix,omitempty"`
 	SortOrder          []rhkassessment.SortOrder `json:"sortOrder"`
 	Aggregators        []AggregatorDesc          `json:"aggregators"`
 	Description        *description.Description  `json:"description"`
 	Assessments        []*Assessment             `json:"assessments"`
 }
 
+// Matrix describes which combination of the values of the matrix
+// variables of an experiment file a report was produced for
+type Matrix struct {
+	// Filename is the name of the experiment file with the matrix
+	Filename string            `json:"filename"`
+	Values   map[string]string `json:"values"`
+}
+
+// Sample describes how the records of the dataset were sampled
+type Sample struct {
+	Method     string `json:"method"`
+	Field      string `json:"field"`
+	Seed       int64  `json:"seed"`
+	NumRecords int64  `json:"numRecords"`
+}
+
 type AggregatorDesc struct {
 	Name string `json:"name"`
 	Kind string `json:"kind"`
@@ -87,11 +112,15 @@ type ModeKind int
 const (
 	Train ModeKind = iota
 	Test
+	CrossValidation
 )
 
 func (m ModeKind) String() string {
-	if m == Train {
+	switch m {
+	case Train:
 		return "train"
+	case CrossValidation:
+		return "crossvalidation"
 	}
 	return "test"
 }
@@ -100,6 +129,8 @@ func New(
 	mode ModeKind,
 	title string,
 	desc *description.Description,
+	where string,
+	sample *Sample,
 	assessment *rhkassessment.Assessment,
 	aggregators []rhkaggregator.Spec,
 	sortOrder []rhkassessment.SortOrder,
@@ -127,6 +158,8 @@ func New(
 		Stamp:              time.Now(),
 		ExperimentFilename: experimentFilename,
 		NumRecords:         assessment.NumRecords,
+		Where:              where,
+		Sample:             sample,
 		SortOrder:          sortOrder,
 		Aggregators:        aggregatorDescs,
 		Assessments:        makeAssessments(assessment),
@@ -134,6 +167,146 @@ func New(
 	}
 }
 
+// NewCrossValidation creates a cross-validation report from the
+// assessments of the held out fold of each fold.  Each fold only assesses
+// the rules found by training on the rest of that fold, so the rule value
+// of each aggregator is the mean of its values over the folds that the
+// rule was assessed on and the goals are assessed against these means.
+func NewCrossValidation(
+	title string,
+	desc *description.Description,
+	where string,
+	sample *Sample,
+	foldAssessments []*rhkassessment.Assessment,
+	aggregators []rhkaggregator.Spec,
+	goals []*goal.Goal,
+	sortOrder []rhkassessment.SortOrder,
+	experimentFilename string,
+	tags []string,
+	category string,
+) *Report {
+	numFolds := len(foldAssessments)
+	rules := []rule.Rule{}
+	foldValues := map[string][]map[string]*dlit.Literal{}
+	for i, fa := range foldAssessments {
+		for _, ra := range fa.RuleAssessments {
+			values, ok := foldValues[ra.Rule.String()]
+			if !ok {
+				values = make([]map[string]*dlit.Literal, numFolds)
+				foldValues[ra.Rule.String()] = values
+				rules = append(rules, ra.Rule)
+			}
+			if values[i] == nil {
+				values[i] = ra.Aggregators
+			}
+		}
+	}
+
+	assessment := rhkassessment.New(aggregators, goals)
+	for _, fa := range foldAssessments {
+		assessment.NumRecords += fa.NumRecords
+	}
+	for _, r := range rules {
+		means := meanAggregators(assessedValues(foldValues[r.String()]))
+		assessment.RuleAssessments = append(
+			assessment.RuleAssessments,
+			&rhkassessment.RuleAssessment{
+				Rule:        r,
+				Aggregators: means,
+				Goals:       assessGoals(goals, means),
+			},
+		)
+	}
+	assessment.Sort(sortOrder)
+
+	report := New(
+		CrossValidation,
+		title,
+		desc,
+		where,
+		sample,
+		assessment,
+		aggregators,
+		sortOrder,
+		experimentFilename,
+		tags,
+		category,
+	)
+	report.NumFolds = numFolds
+	for _, a := range report.Assessments {
+		values := foldValues[a.Rule]
+		for _, agg := range a.Aggregators {
+			agg.FoldValues = make([]string, numFolds)
+			for i, v := range values {
+				if v != nil {
+					agg.FoldValues[i] = v[agg.Name].String()
+				}
+			}
+		}
+	}
+	return report
+}
+
+// assessedValues returns the aggregator values of the folds that a rule
+// was assessed on
+func assessedValues(
+	values []map[string]*dlit.Literal,
+) []map[string]*dlit.Literal {
+	r := []map[string]*dlit.Literal{}
+	for _, v := range values {
+		if v != nil {
+			r = append(r, v)
+		}
+	}
+	return r
+}
+
+// meanAggregators returns the mean value of each aggregator over the
+// folds, to two more decimal places than the fold values
+func meanAggregators(
+	values []map[string]*dlit.Literal,
+) map[string]*dlit.Literal {
+	means := make(map[string]*dlit.Literal, len(values[0]))
+	for name := range values[0] {
+		sum := 0.0
+		maxDP := 0
+		var err error
+		for _, v := range values {
+			x, isFloat := v[name].Float()
+			if !isFloat {
+				err = CantConvertToTypeError{Kind: "float", Value: v[name]}
+				break
+			}
+			sum += x
+			if dp := numDecPlaces(v[name].String()); dp > maxDP {
+				maxDP = dp
+			}
+		}
+		if err != nil {
+			means[name] = dlit.MustNew(err)
+			continue
+		}
+		mean, _ := roundTo(dlit.MustNew(sum/float64(len(values))), maxDP+2)
+		means[name] = mean
+	}
+	return means
+}
+
+func assessGoals(
+	goals []*goal.Goal,
+	aggregators map[string]*dlit.Literal,
+) []*rhkassessment.GoalAssessment {
+	goalAssessments := make([]*rhkassessment.GoalAssessment, len(goals))
+	for i, g := range goals {
+		passed, err := g.Assess(aggregators)
+		goalAssessments[i] = &rhkassessment.GoalAssessment{
+			Expr:   g.String(),
+			Passed: err == nil && passed,
+		}
+	}
+	return goalAssessments
+}
+
 func (r *Report) WriteJSON(config *config.Config) error {
 	// File mode permission:
 	// No special permission bits
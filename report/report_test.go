@@ -118,6 +118,13 @@ func TestNew(t *testing.T) {
 		Stamp:              time.Now(),
 		ExperimentFilename: "somename.yaml",
 		NumRecords:         assessment.NumRecords,
+		Where:              "income > 0",
+		Sample: &Sample{
+			Method:     "stratified",
+			Field:      "group",
+			Seed:       7,
+			NumRecords: 1000,
+		},
 		SortOrder: []rhkassessment.SortOrder{
 			rhkassessment.SortOrder{
 				Aggregator: "goalsScore",
@@ -269,6 +276,8 @@ func TestNew(t *testing.T) {
 		wantReport.Mode,
 		wantReport.Title,
 		wantReport.Description,
+		wantReport.Where,
+		wantReport.Sample,
 		assessment,
 		aggregatorSpecs,
 		wantReport.SortOrder,
@@ -281,6 +290,194 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewCrossValidation(t *testing.T) {
+	aggregatorSpecs := []aggregator.Spec{
+		aggregator.MustNew("numMatches", "count", "true()"),
+		aggregator.MustNew(
+			"percentMatches",
+			"calc",
+			"roundto(100.0 * numMatches / numRecords, 2)",
+		),
+		aggregator.MustNew("numIncomeGt2", "count", "income > 2"),
+	}
+	goals := []*goal.Goal{goal.MustNew("numIncomeGt2 >= 2")}
+	sortOrder := []rhkassessment.SortOrder{
+		rhkassessment.SortOrder{
+			Aggregator: "percentMatches",
+			Direction:  rhkassessment.ASCENDING,
+		},
+	}
+	newRuleAssessment := func(
+		r rule.Rule,
+		numMatches, percentMatches, numIncomeGt2 string,
+	) *rhkassessment.RuleAssessment {
+		return &rhkassessment.RuleAssessment{
+			Rule: r,
+			Aggregators: map[string]*dlit.Literal{
+				"numMatches":     dlit.MustNew(numMatches),
+				"percentMatches": dlit.MustNew(percentMatches),
+				"numIncomeGt2":   dlit.MustNew(numIncomeGt2),
+			},
+		}
+	}
+	fold0 := rhkassessment.New(aggregatorSpecs, goals)
+	fold0.NumRecords = 10
+	fold0.RuleAssessments = []*rhkassessment.RuleAssessment{
+		newRuleAssessment(rule.NewGEFV("rate", dlit.MustNew(789.2)), "4", "40", "3"),
+		newRuleAssessment(rule.NewEQFV("month", dlit.NewString("may")), "2", "20", "1"),
+		newRuleAssessment(rule.NewTrue(), "10", "100", "2"),
+	}
+	fold1 := rhkassessment.New(aggregatorSpecs, goals)
+	fold1.NumRecords = 11
+	fold1.RuleAssessments = []*rhkassessment.RuleAssessment{
+		newRuleAssessment(rule.NewTrue(), "11", "100", "3"),
+		newRuleAssessment(rule.NewGEFV("rate", dlit.MustNew(789.2)), "5", "45.45", "2"),
+	}
+	// The month rule is only assessed on fold 0
+	wantAssessments := []*Assessment{
+		&Assessment{
+			Rule: "month == \"may\"",
+			Aggregators: []*Aggregator{
+				&Aggregator{
+					Name:          "numIncomeGt2",
+					OriginalValue: "2.5",
+					RuleValue:     "1",
+					Difference:    "-1.5",
+					FoldValues:    []string{"1", ""},
+				},
+				&Aggregator{
+					Name:          "numMatches",
+					OriginalValue: "10.5",
+					RuleValue:     "2",
+					Difference:    "-8.5",
+					FoldValues:    []string{"2", ""},
+				},
+				&Aggregator{
+					Name:          "percentMatches",
+					OriginalValue: "100",
+					RuleValue:     "20",
+					Difference:    "-80",
+					FoldValues:    []string{"20", ""},
+				},
+			},
+			Goals: []*Goal{
+				&Goal{
+					Expr:           "numIncomeGt2 >= 2",
+					OriginalPassed: true,
+					RulePassed:     false,
+				},
+			},
+		},
+		&Assessment{
+			Rule: "rate >= 789.2",
+			Aggregators: []*Aggregator{
+				&Aggregator{
+					Name:          "numIncomeGt2",
+					OriginalValue: "2.5",
+					RuleValue:     "2.5",
+					Difference:    "0",
+					FoldValues:    []string{"3", "2"},
+				},
+				&Aggregator{
+					Name:          "numMatches",
+					OriginalValue: "10.5",
+					RuleValue:     "4.5",
+					Difference:    "-6",
+					FoldValues:    []string{"4", "5"},
+				},
+				&Aggregator{
+					Name:          "percentMatches",
+					OriginalValue: "100",
+					RuleValue:     "42.725",
+					Difference:    "-57.275",
+					FoldValues:    []string{"40", "45.45"},
+				},
+			},
+			Goals: []*Goal{
+				&Goal{
+					Expr:           "numIncomeGt2 >= 2",
+					OriginalPassed: true,
+					RulePassed:     true,
+				},
+			},
+		},
+		&Assessment{
+			Rule: "true()",
+			Aggregators: []*Aggregator{
+				&Aggregator{
+					Name:          "numIncomeGt2",
+					OriginalValue: "2.5",
+					RuleValue:     "2.5",
+					Difference:    "0",
+					FoldValues:    []string{"2", "3"},
+				},
+				&Aggregator{
+					Name:          "numMatches",
+					OriginalValue: "10.5",
+					RuleValue:     "10.5",
+					Difference:    "0",
+					FoldValues:    []string{"10", "11"},
+				},
+				&Aggregator{
+					Name:          "percentMatches",
+					OriginalValue: "100",
+					RuleValue:     "100",
+					Difference:    "0",
+					FoldValues:    []string{"100", "100"},
+				},
+			},
+			Goals: []*Goal{
+				&Goal{
+					Expr:           "numIncomeGt2 >= 2",
+					OriginalPassed: true,
+					RulePassed:     true,
+				},
+			},
+		},
+	}
+	got := NewCrossValidation(
+		"some title",
+		testDescription,
+		"",
+		nil,
+		[]*rhkassessment.Assessment{fold0, fold1},
+		aggregatorSpecs,
+		goals,
+		sortOrder,
+		"somename.yaml",
+		[]string{"bank"},
+		"testing",
+	)
+	if got.Mode != CrossValidation {
+		t.Errorf("Mode got: %s, want: %s", got.Mode, CrossValidation)
+	}
+	if got.NumFolds != 2 {
+		t.Errorf("NumFolds got: %d, want: 2", got.NumFolds)
+	}
+	if got.NumRecords != 21 {
+		t.Errorf("NumRecords got: %d, want: 21", got.NumRecords)
+	}
+	if !reflect.DeepEqual(got.Assessments, wantAssessments) {
+		t.Errorf("Assessments got: %v, want: %v", got.Assessments, wantAssessments)
+	}
+}
+
+func TestModeKindString(t *testing.T) {
+	cases := []struct {
+		mode ModeKind
+		want string
+	}{
+		{mode: Train, want: "train"},
+		{mode: Test, want: "test"},
+		{mode: CrossValidation, want: "crossvalidation"},
+	}
+	for _, c := range cases {
+		if got := c.mode.String(); got != c.want {
+			t.Errorf("String() got: %s, want: %s", got, c.want)
+		}
+	}
+}
+
 func TestNew_single_true_rule(t *testing.T) {
 	aggregatorSpecs := []aggregator.Spec{
 		aggregator.MustNew("numMatches", "count", "true()"),
@@ -391,6 +588,8 @@ func TestNew_single_true_rule(t *testing.T) {
 		wantReport.Mode,
 		wantReport.Title,
 		wantReport.Description,
+		wantReport.Where,
+		wantReport.Sample,
 		assessment,
 		aggregatorSpecs,
 		wantReport.SortOrder,
@@ -537,6 +736,8 @@ func TestWriteLoadJSON(t *testing.T) {
 		Train,
 		title,
 		testDescription,
+		"income > 0",
+		&Sample{Method: "reservoir", Seed: 7, NumRecords: 1000},
 		assessment,
 		aggregators,
 		sortOrder,
@@ -684,6 +885,8 @@ func TestLoadJSON_multiple_attempts(t *testing.T) {
 		Train,
 		title,
 		testDescription,
+		"income > 0",
+		&Sample{Method: "reservoir", Seed: 7, NumRecords: 1000},
 		assessment,
 		aggregators,
 		sortOrder,
@@ -865,6 +1068,12 @@ func checkReportsMatch(r1, r2 *Report) error {
 		return fmt.Errorf("NumRecords don't match - %d != %d",
 			r1.NumRecords, r2.NumRecords)
 	}
+	if r1.Where != r2.Where {
+		return fmt.Errorf("Wheres don't match - %s != %s", r1.Where, r2.Where)
+	}
+	if !reflect.DeepEqual(r1.Sample, r2.Sample) {
+		return fmt.Errorf("Samples don't match - %v != %v", r1.Sample, r2.Sample)
+	}
 	if !reflect.DeepEqual(r1.SortOrder, r2.SortOrder) {
 		return fmt.Errorf("SortOrder don't match - %v != %v",
 			r1.SortOrder, r2.SortOrder)
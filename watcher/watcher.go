@@ -6,6 +6,7 @@ package watcher
 
 import (
 	"github.com/vlifesystems/rulehunter/fileinfo"
+	"github.com/vlifesystems/rulehunter/internal/include"
 	"github.com/vlifesystems/rulehunter/logger"
 	"github.com/vlifesystems/rulehunter/quitter"
 	"io/ioutil"
@@ -22,8 +23,11 @@ func (e DirError) Error() string {
 
 // Watch sends experiment filenames that need processing
 // to the filenames channel.  It checks every period of time.
+// Experiments are treated as changed if a fragment that they include
+// from libraryDir changes.
 func Watch(
 	dir string,
+	libraryDir string,
 	period time.Duration,
 	l logger.Logger,
 	quit *quitter.Quitter,
@@ -33,7 +37,7 @@ func Watch(
 	quit.Add()
 	defer quit.Done()
 	ticker := time.NewTicker(period).C
-	allFiles, err := getFilesToMap(dir)
+	allFiles, err := getFilesToMap(dir, libraryDir)
 	if err != nil {
 		lastLogErr = l.Error(err)
 	}
@@ -50,7 +54,7 @@ func Watch(
 			close(files)
 			return
 		case <-ticker:
-			newFiles, err := getFilesToMap(dir)
+			newFiles, err := getFilesToMap(dir, libraryDir)
 			if err != nil {
 				if lastLogErr == nil || lastLogErr.Error() != err.Error() {
 					lastLogErr = l.Error(err)
@@ -94,14 +98,37 @@ func GetExperimentFiles(dir string) ([]fileinfo.FileInfo, error) {
 	return experimentFiles, nil
 }
 
-func getFilesToMap(dir string) (map[string]fileinfo.FileInfo, error) {
+func getFilesToMap(
+	dir string,
+	libraryDir string,
+) (map[string]fileinfo.FileInfo, error) {
 	filesMap := make(map[string]fileinfo.FileInfo)
 	files, err := GetExperimentFiles(dir)
 	if err != nil {
 		return filesMap, err
 	}
 	for _, file := range files {
-		filesMap[file.Name()] = file
+		filesMap[file.Name()] = includeModTime(dir, libraryDir, file)
 	}
 	return filesMap, nil
 }
+
+// includeModTime returns file with its ModTime set to the latest of
+// its own and those of the fragments that it includes.  If the includes
+// can't be resolved file is returned as is and the error is left to be
+// reported when the experiment is loaded.
+func includeModTime(
+	dir string,
+	libraryDir string,
+	file fileinfo.FileInfo,
+) fileinfo.FileInfo {
+	_, files, err := include.Resolve(filepath.Join(dir, file.Name()), libraryDir)
+	if err != nil {
+		return file
+	}
+	r, err := include.FileInfo(file, files)
+	if err != nil {
+		return file
+	}
+	return r
+}
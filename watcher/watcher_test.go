@@ -26,7 +26,7 @@ func TestWatch_1(t *testing.T) {
 	quit := quitter.New()
 	period := 50 * time.Millisecond
 	go logger.Run(quit)
-	go Watch(tmpDir, period, logger, quit, files)
+	go Watch(tmpDir, filepath.Join(tmpDir, "library"), period, logger, quit, files)
 	time.Sleep(200 * time.Millisecond)
 	quit.Quit()
 
@@ -62,7 +62,7 @@ func TestWatch_2(t *testing.T) {
 	quit := quitter.New()
 	period := 50 * time.Millisecond
 	go logger.Run(quit)
-	go Watch(tmpDir, period, logger, quit, files)
+	go Watch(tmpDir, filepath.Join(tmpDir, "library"), period, logger, quit, files)
 	time.Sleep(100 * time.Millisecond)
 
 	testhelpers.CopyFile(t, filepath.Join("fixtures", "debt.yaml"), tmpDir)
@@ -100,7 +100,7 @@ func TestWatch_3(t *testing.T) {
 	quit := quitter.New()
 	period := 50 * time.Millisecond
 	go logger.Run(quit)
-	go Watch(tmpDir, period, logger, quit, files)
+	go Watch(tmpDir, filepath.Join(tmpDir, "library"), period, logger, quit, files)
 	time.Sleep(100 * time.Millisecond)
 
 	testhelpers.CopyFile(t, filepath.Join("fixtures", "debt.json"), tmpDir)
@@ -124,6 +124,55 @@ func TestWatch_3(t *testing.T) {
 	}
 }
 
+// Test changing a file included by an experiment
+func TestWatch_include(t *testing.T) {
+	tmpDir := testhelpers.TempDir(t)
+	defer os.RemoveAll(tmpDir)
+	libraryDir := filepath.Join(tmpDir, "library")
+	if err := os.Mkdir(libraryDir, 0700); err != nil {
+		t.Fatalf("Mkdir: %s", err)
+	}
+	testhelpers.CopyFile(t, filepath.Join("fixtures", "acme.yaml"), tmpDir)
+	testhelpers.CopyFile(t, filepath.Join("fixtures", "flow.yaml"), tmpDir)
+	testhelpers.CopyFile(
+		t,
+		filepath.Join("fixtures", "library", "roi.yaml"),
+		libraryDir,
+	)
+
+	files := make(chan fileinfo.FileInfo, 100)
+	logger := testhelpers.NewLogger()
+	quit := quitter.New()
+	period := 50 * time.Millisecond
+	go logger.Run(quit)
+	go Watch(tmpDir, libraryDir, period, logger, quit, files)
+	time.Sleep(100 * time.Millisecond)
+
+	later := time.Now().Add(time.Minute)
+	err := os.Chtimes(filepath.Join(libraryDir, "roi.yaml"), later, later)
+	if err != nil {
+		t.Fatalf("Chtimes: %s", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	quit.Quit()
+
+	wantNewFiles := map[string]int{
+		"acme.yaml": 2,
+		"flow.yaml": 1,
+	}
+	wantNonNewFiles := map[string]int{
+		"acme.yaml": 1,
+		"flow.yaml": 2,
+	}
+	err = checkCorrectFileChan(wantNewFiles, wantNonNewFiles, files)
+	if err != nil {
+		t.Error("Watch:", err)
+	}
+	if logEntries := logger.GetEntries(); len(logEntries) != 0 {
+		t.Errorf("Watch: gotLogEntries: %v, wanted: []", logEntries)
+	}
+}
+
 func TestWatch_errors(t *testing.T) {
 	tmpDir := testhelpers.TempDir(t)
 	os.RemoveAll(tmpDir)
@@ -133,7 +182,7 @@ func TestWatch_errors(t *testing.T) {
 	quit := quitter.New()
 	period := 50 * time.Millisecond
 	go logger.Run(quit)
-	go Watch(dir, period, logger, quit, files)
+	go Watch(dir, filepath.Join(dir, "library"), period, logger, quit, files)
 	time.Sleep(100 * time.Millisecond)
 	quit.Quit()
 
@@ -164,7 +213,7 @@ func TestWatch_errors2(t *testing.T) {
 	quit := quitter.New()
 	period := 50 * time.Millisecond
 	go logger.Run(quit)
-	go Watch(tmpDir, period, logger, quit, files)
+	go Watch(tmpDir, filepath.Join(tmpDir, "library"), period, logger, quit, files)
 	time.Sleep(100 * time.Millisecond)
 
 	os.RemoveAll(tmpDir)